@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestForgedSessionToken replays a verification token whose "email" is laid out like
+// a session payload: it must not be issued, and must not work as a bearer token if it were.
+func TestForgedSessionToken(t *testing.T) {
+	s := newTestServer(t)
+	forged := "session|" + primitive.NewObjectID().Hex() + "|admin"
+
+	if code := s.do("", http.MethodPost, "/auth/request-verify", map[string]string{"email": forged}, nil); code != http.StatusBadRequest {
+		t.Errorf("request-verify with a forged email = %d, want 400", code)
+	}
+	if code := s.do("", http.MethodPost, "/auth/request-verify", map[string]string{"email": forged + "@example.com"}, nil); code != http.StatusBadRequest {
+		t.Errorf("request-verify with | in the address = %d, want 400", code)
+	}
+
+	token, _ := s.tokens.GenerateVerificationToken(forged)
+	if code := s.do(token, http.MethodGet, "/giftcards", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("GET /giftcards with a verification token = %d, want 401", code)
+	}
+	_, admin := s.login("boss", "admin")
+	if code := s.do(admin, http.MethodGet, "/giftcards", nil, nil); code != http.StatusOK {
+		t.Errorf("GET /giftcards as admin = %d, want 200", code)
+	}
+}
@@ -0,0 +1,90 @@
+// Command migrate applies and rolls back schema migrations (see internal/migrations).
+//
+//	go run ./cmd/migrate status
+//	go run ./cmd/migrate up                 # apply everything pending
+//	go run ./cmd/migrate -to 3 up           # apply up to and including version 3
+//	go run ./cmd/migrate -steps 2 down      # roll back the last two
+//	go run ./cmd/migrate -dry-run up        # print what would run
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/db"
+	"leblanc/server/internal/migrations"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the migrations that would run without applying them")
+	to := flag.Int("to", 0, "up: stop after this version (default: all pending)")
+	steps := flag.Int("steps", 1, "down: number of migrations to roll back")
+	lockTTL := flag.Duration("lock-ttl", migrations.DefaultLockTTL, "how long the migration lock is honoured if this process dies")
+	timeout := flag.Duration("timeout", 10*time.Minute, "overall timeout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: migrate [flags] up|down|status\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	db.Init(cfg.Mongo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	m := migrations.New(db.DB)
+	m.DryRun = *dryRun
+
+	m.LockTTL = *lockTTL
+	switch cmd := flag.Arg(0); cmd {
+	case "up":
+		err = m.Up(ctx, *to)
+	case "down":
+		if *steps <= 0 {
+			log.Fatal("steps must be positive")
+		}
+		err = m.Down(ctx, *steps)
+	case "status":
+		err = printStatus(ctx, m)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("migrate: %v", err)
+	}
+}
+
+func printStatus(ctx context.Context, m *migrations.Migrator) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tNAME")
+	for _, s := range status {
+		state, at := "pending", ""
+		if s.Applied {
+			state, at = "applied", s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		if s.Unknown {
+			state = "unknown"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, state, at, s.Name)
+	}
+	return w.Flush()
+}
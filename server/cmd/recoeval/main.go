@@ -0,0 +1,116 @@
+// Command recoeval replays historical bookings and logged recommendation events against
+// one or more scorer configurations and prints precision@k, recall@k, NDCG, coverage and
+// diversity for each.
+//
+//	go run ./cmd/recoeval                              # read from MONGO_URI/MONGO_DB
+//	go run ./cmd/recoeval -export-dump data.json       # save a dump for offline runs
+//	go run ./cmd/recoeval -dump data.json -configs configs.json -json report.json
+//
+// configs.json is a list of scorer configurations, for example:
+//
+//	[{"name": "label", "scorer": "emotion"},
+//	 {"name": "cosine-diverse", "scorer": "cosine", "diversity": 0.6,
+//	  "cosineWeights": {"emotion": 0.6, "preference": 0.4, "mismatch": 0.5}}]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/db"
+	"leblanc/server/internal/recoeval"
+	"leblanc/server/internal/services"
+)
+
+func main() {
+	dumpPath := flag.String("dump", "", "read drinks, bookings and events from this JSON dump instead of Mongo")
+	exportPath := flag.String("export-dump", "", "write the Mongo data to this JSON dump and exit")
+	configsPath := flag.String("configs", "", "JSON file with scorer configurations (default: both scorers with default weights)")
+	jsonPath := flag.String("json", "", "also write the comparison as JSON to this file")
+	k := flag.Int("k", services.DefaultRecoLimit, "list length to evaluate")
+	flag.Parse()
+
+	if *k <= 0 || *k > services.MaxRecoLimit {
+		log.Fatalf("k must be between 1 and %d", services.MaxRecoLimit)
+	}
+
+	configs, err := loadConfigs(*configsPath)
+	if err != nil {
+		log.Fatalf("load configs: %v", err)
+	}
+
+	ds, err := loadDataset(*dumpPath)
+	if err != nil {
+		log.Fatalf("load data: %v", err)
+	}
+	if *exportPath != "" {
+		if err := recoeval.WriteDump(*exportPath, ds); err != nil {
+			log.Fatalf("write dump: %v", err)
+		}
+		log.Printf("wrote %d drinks, %d bookings, %d events to %s", len(ds.Drinks), len(ds.Bookings), len(ds.Events), *exportPath)
+		return
+	}
+
+	cases := recoeval.BuildCases(ds)
+	report := recoeval.Report{Bookings: len(ds.Bookings), Events: len(ds.Events)}
+	report.Results = append(report.Results, recoeval.EvaluateLogged(ds.Drinks, cases, *k))
+	for _, cfg := range configs {
+		report.Results = append(report.Results, recoeval.Evaluate(ds.Drinks, cases, cfg, *k))
+	}
+
+	if err := recoeval.WriteText(os.Stdout, report); err != nil {
+		log.Fatalf("write report: %v", err)
+	}
+	if *jsonPath != "" {
+		f, err := os.Create(*jsonPath)
+		if err != nil {
+			log.Fatalf("write json: %v", err)
+		}
+		defer f.Close()
+		if err := recoeval.WriteJSON(f, report); err != nil {
+			log.Fatalf("write json: %v", err)
+		}
+	}
+}
+
+func loadDataset(dumpPath string) (*recoeval.Dataset, error) {
+	if dumpPath != "" {
+		return recoeval.LoadDump(dumpPath)
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, err
+	}
+	db.Init(cfg.Mongo)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	return recoeval.LoadMongo(ctx, db.DB)
+}
+
+func loadConfigs(path string) ([]services.ScorerConfig, error) {
+	if path == "" {
+		return []services.ScorerConfig{
+			{Name: "emotion-default", Scorer: services.ScorerEmotion},
+			{Name: "cosine-default", Scorer: services.ScorerCosine},
+		}, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []services.ScorerConfig
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, err
+	}
+	for _, c := range configs {
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return configs, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/payments"
+	"leblanc/server/internal/repository"
+	"leblanc/server/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestDepositExpiry lets two deposits run out, pays one of them first, and checks the
+// expiry worker cancels only the unpaid booking and gives back its gift card payment,
+// once however often it runs.
+func TestDepositExpiry(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	cfg := config.PaymentConfig{Provider: "fake", DepositsEnabled: true, DepositGuestsOver: 6,
+		DepositPerGuestVND: 50000, DepositTimeout: -time.Minute, RefundBefore: 24 * time.Hour}
+	fake := payments.NewFake("http://localhost:3000", services.PaymentsKey("test-secret"))
+	bookings := services.NewBookings(repos,
+		services.NewLoyalty(repos.Loyalty, config.LoyaltyConfig{}),
+		services.NewPromotions(repos.Promotions, time.UTC),
+		services.NewGiftCards(repos.GiftCards),
+		services.NewPayments(repos.Payments, fake, cfg))
+
+	latte := models.Drink{Name: "Latte", Price: 45000}
+	if err := repos.Drinks.Save(ctx, &latte); err != nil {
+		t.Fatal(err)
+	}
+	card := models.GiftCard{Code: "TESTCARD00000002", Value: 500000, Balance: 500000, Status: models.GiftCardActive, CreatedAt: time.Now()}
+	if err := repos.GiftCards.Insert(ctx, []models.GiftCard{card}); err != nil {
+		t.Fatal(err)
+	}
+	balance := func() int {
+		t.Helper()
+		c, err := repos.GiftCards.FindByCode(ctx, card.Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Balance
+	}
+
+	var placed []*models.Booking
+	for range 2 {
+		b := &models.Booking{Email: "party@example.com", Name: "Party", Phone: "0901234567", Channel: "web",
+			Time: time.Now().Add(72 * time.Hour), Guests: 8,
+			Items: []models.BookingItem{{DrinkID: latte.ID, Qty: 1}}}
+		if err := bookings.Place(ctx, b, services.BookingOptions{GiftCard: &services.GiftCardRequest{Code: card.Code}}); err != nil {
+			t.Fatal(err)
+		}
+		if b.Deposit == nil || b.GiftCardPayment == nil || b.GiftCardPayment.Amount != 45000 {
+			t.Fatalf("placed %+v, want a deposit and 45000 paid by gift card", b)
+		}
+		placed = append(placed, b)
+	}
+	if got := balance(); got != 410000 {
+		t.Fatalf("card balance after two bookings = %d, want 410000", got)
+	}
+	unpaid, paid := placed[0], placed[1]
+	if _, err := bookings.ConfirmDeposit(ctx, "fake", fake.Callback(paid.Deposit.PaymentID.Hex(), paid.Deposit.Amount, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if err := bookings.ExpireDeposits(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []struct {
+		b               *models.Booking
+		status, deposit string
+	}{
+		{unpaid, models.BookingCancelled, models.PaymentExpired},
+		{paid, models.BookingPending, models.PaymentPaid},
+	} {
+		b, err := repos.Bookings.Get(ctx, want.b.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Status != want.status || b.Deposit == nil || b.Deposit.Status != want.deposit {
+			t.Errorf("booking %s is %s with deposit %+v, want %s with deposit %s", b.ID.Hex(), b.Status, b.Deposit, want.status, want.deposit)
+		}
+	}
+	if got := balance(); got != 455000 {
+		t.Errorf("card balance after expiry = %d, want 455000 with the unpaid booking refunded once", got)
+	}
+}
+
+// TestFakePaymentsKey checks that the fake provider's callbacks are signed with a key
+// derived from TOKEN_SECRET, not with the secret itself.
+func TestFakePaymentsKey(t *testing.T) {
+	s := newTestServer(t)
+	paymentID := primitive.NewObjectID().Hex()
+	for _, tc := range []struct {
+		name string
+		key  []byte
+		want int
+	}{
+		{"the raw token secret", []byte("test-secret"), http.StatusBadRequest},
+		{"the payments key", services.PaymentsKey("test-secret"), http.StatusNotFound},
+	} {
+		q := payments.NewFake("http://localhost:3000", tc.key).Callback(paymentID, 50000, true)
+		if code := s.do("", http.MethodGet, "/payments/fake/return?"+q.Encode(), nil, nil); code != tc.want {
+			t.Errorf("callback signed with %s = %d, want %d", tc.name, code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestReorderDraft reorders a booking by day and by night and checks archived drinks
+// and drinks off the menu at that hour are dropped, and moved prices are reported.
+// Only the user who made the booking while logged in may reorder it.
+func TestReorderDraft(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	latte := models.Drink{Name: "Latte", Price: 50000}
+	cocktail := models.Drink{Name: "Espresso martini", Price: 120000, Tags: []string{"night"}}
+	gone := models.Drink{Name: "Pumpkin latte", Price: 55000, Archived: true}
+	for _, d := range []*models.Drink{&latte, &cocktail, &gone} {
+		if err := s.repos.Drinks.Save(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, token := s.login("regular", "")
+	booking := func(userID *primitive.ObjectID) string {
+		t.Helper()
+		b := &models.Booking{Email: user.Email, Name: "Regular", Phone: "0901234567", Time: time.Now().Add(-24 * time.Hour),
+			Channel: "web", UserID: userID, Status: models.BookingCompleted, Items: []models.BookingItem{
+				{DrinkID: latte.ID, Qty: 2, Name: latte.Name, Price: 45000},
+				{DrinkID: cocktail.ID, Qty: 1, Name: cocktail.Name, Price: cocktail.Price},
+				{DrinkID: gone.ID, Qty: 1, Name: gone.Name, Price: gone.Price},
+			}}
+		if err := s.repos.Bookings.Insert(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+		return b.ID.Hex()
+	}
+	mine := booking(&user.ID)
+
+	// the test server's café is in the default timezone
+	cafe := services.NewCafe(nil, nil).Location()
+	tomorrow := time.Now().In(cafe).AddDate(0, 0, 1)
+	at := func(hour int) string {
+		return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), hour, 0, 0, 0, cafe).Format(time.RFC3339)
+	}
+	var draft services.Draft
+	if code := s.do(token, http.MethodPost, "/reorder", map[string]any{"bookingId": mine, "time": at(10)}, &draft); code != http.StatusOK {
+		t.Fatalf("POST /reorder by day = %d", code)
+	}
+	if len(draft.Items) != 1 || draft.Items[0].DrinkID != latte.ID || draft.Subtotal != 100000 {
+		t.Errorf("day draft items = %+v, subtotal %d; want 2 lattes at 50000", draft.Items, draft.Subtotal)
+	}
+	if len(draft.Changed) != 1 || draft.Changed[0].Was != 45000 || draft.Changed[0].Now != 50000 {
+		t.Errorf("day draft changed = %+v, want the latte from 45000 to 50000", draft.Changed)
+	}
+	dropped := map[primitive.ObjectID]string{}
+	for _, d := range draft.Dropped {
+		dropped[d.DrinkID] = d.Reason
+	}
+	if len(dropped) != 2 || dropped[gone.ID] != "no longer on the menu" || dropped[cocktail.ID] != "not served at day" {
+		t.Errorf("day draft dropped = %+v, want the archived drink and the night-only one", draft.Dropped)
+	}
+
+	if code := s.do(token, http.MethodPost, "/reorder", map[string]any{"bookingId": mine, "time": at(21)}, &draft); code != http.StatusOK {
+		t.Fatalf("POST /reorder by night = %d", code)
+	}
+	if len(draft.Items) != 2 || len(draft.Dropped) != 1 || draft.Dropped[0].DrinkID != gone.ID || draft.Subtotal != 220000 {
+		t.Errorf("night draft = %+v, want the lattes and the cocktail, dropping only the archived drink", draft)
+	}
+
+	_, other := s.login("other", "")
+	if code := s.do(other, http.MethodPost, "/reorder", map[string]any{"bookingId": mine}, nil); code != http.StatusNotFound {
+		t.Errorf("POST /reorder of another user's booking = %d, want 404", code)
+	}
+	anonymous := booking(nil)
+	if code := s.do(token, http.MethodPost, "/reorder", map[string]any{"bookingId": anonymous}, nil); code != http.StatusNotFound {
+		t.Errorf("POST /reorder of an anonymous booking with the user's email = %d, want 404", code)
+	}
+}
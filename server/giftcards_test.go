@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+	"leblanc/server/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestGiftCardLedger redeems a card from many goroutines at once, refunds one booking
+// twice, then voids the card, and checks the balance never goes below zero, the refund
+// lands once, the ledger adds up and a voided card takes neither debits nor credits.
+func TestGiftCardLedger(t *testing.T) {
+	ctx := context.Background()
+	cards := repository.NewMemory().GiftCards
+	card := models.GiftCard{Code: "TESTCARD00000001", Value: 100000, Balance: 100000, Status: models.GiftCardActive, CreatedAt: time.Now()}
+	if err := cards.Insert(ctx, []models.GiftCard{card}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := cards.FindByCode(ctx, card.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := stored.ID
+
+	var mu sync.Mutex
+	spent := 0
+	var paid []primitive.ObjectID
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			booking := primitive.NewObjectID()
+			e := models.GiftCardEntry{CardID: id, Kind: models.GiftCardRedeem, Amount: -7000, BookingID: &booking}
+			c, err := cards.Apply(ctx, &e)
+			switch {
+			case errors.Is(err, repository.ErrInsufficient):
+				return
+			case err != nil:
+				t.Error(err)
+				return
+			case c.Balance < 0 || e.Balance != c.Balance:
+				t.Errorf("debit left balance %d, entry balance %d", c.Balance, e.Balance)
+			}
+			mu.Lock()
+			spent += 7000
+			paid = append(paid, booking)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	stored, err = cards.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spent != 98000 || stored.Balance != 2000 {
+		t.Fatalf("spent %d leaving %d, want 14 debits of 7000 leaving 2000", spent, stored.Balance)
+	}
+
+	// cancelling a booking refunds it once, however often it is retried
+	giftCards := services.NewGiftCards(cards)
+	cancelled := &models.Booking{ID: paid[0], GiftCardPayment: &models.GiftCardPayment{CardID: id, Amount: 7000}}
+	for range 2 {
+		if err := giftCards.Refund(ctx, cancelled); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stored, err = cards.Get(ctx, id); err != nil || stored.Balance != 9000 {
+		t.Fatalf("balance after refunding twice = %d, %v; want 9000", stored.Balance, err)
+	}
+
+	if _, err := cards.Void(ctx, id, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cards.Void(ctx, id, time.Now()); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("voiding twice = %v, want ErrConflict", err)
+	}
+	for _, amount := range []int{-1000, 5000} {
+		e := models.GiftCardEntry{CardID: id, Kind: models.GiftCardRefund, Amount: amount}
+		if _, err := cards.Apply(ctx, &e); !errors.Is(err, repository.ErrConflict) {
+			t.Errorf("applying %d to a voided card = %v, want ErrConflict", amount, err)
+		}
+	}
+
+	history, err := cards.History(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := 0
+	for _, e := range history {
+		sum += e.Amount
+	}
+	if len(history) != 17 || history[0].Kind != models.GiftCardVoid || history[0].Amount != -9000 || sum != 0 {
+		t.Errorf("ledger has %d entries summing to %d, newest %+v; want issue, 14 debits, a refund and a void of 9000 summing to 0", len(history), sum, history[0])
+	}
+}
+
+// flakyGiftCards fails the first refund, as a lost connection to Mongo would.
+type flakyGiftCards struct {
+	repository.GiftCardRepository
+	failed bool
+}
+
+func (r *flakyGiftCards) Apply(ctx context.Context, e *models.GiftCardEntry) (*models.GiftCard, error) {
+	if e.Kind == models.GiftCardRefund && !r.failed {
+		r.failed = true
+		return nil, errors.New("connection reset")
+	}
+	return r.GiftCardRepository.Apply(ctx, e)
+}
+
+// flakyLoyalty fails the first earn.
+type flakyLoyalty struct {
+	repository.LoyaltyRepository
+	failed bool
+}
+
+func (r *flakyLoyalty) Apply(ctx context.Context, e *models.LoyaltyEntry) error {
+	if e.Kind == models.LoyaltyEarn && !r.failed {
+		r.failed = true
+		return errors.New("connection reset")
+	}
+	return r.LoyaltyRepository.Apply(ctx, e)
+}
+
+// TestRetryAfterStatusChange fails the gift card refund of a cancel and the loyalty
+// earn of a completion after the status has changed, and checks that cancelling or
+// completing again finishes the job once, however often it is repeated.
+func TestRetryAfterStatusChange(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	repos.GiftCards = &flakyGiftCards{GiftCardRepository: repos.GiftCards}
+	repos.Loyalty = &flakyLoyalty{LoyaltyRepository: repos.Loyalty}
+	rules := config.LoyaltyConfig{Enabled: true, EarnPoints: 1, EarnPerVND: 10000, PointValueVND: 100, MinRedeem: 50}
+	bookings := services.NewBookings(repos,
+		services.NewLoyalty(repos.Loyalty, rules),
+		services.NewPromotions(repos.Promotions, time.UTC),
+		services.NewGiftCards(repos.GiftCards),
+		services.NewPayments(repos.Payments, nil, config.PaymentConfig{}))
+
+	latte := models.Drink{Name: "Latte", Price: 45000}
+	if err := repos.Drinks.Save(ctx, &latte); err != nil {
+		t.Fatal(err)
+	}
+	card := models.GiftCard{Code: "TESTCARD00000003", Value: 100000, Balance: 100000, Status: models.GiftCardActive, CreatedAt: time.Now()}
+	if err := repos.GiftCards.Insert(ctx, []models.GiftCard{card}); err != nil {
+		t.Fatal(err)
+	}
+	userID := primitive.NewObjectID()
+	place := func(opts services.BookingOptions) *models.Booking {
+		t.Helper()
+		b := &models.Booking{Email: "regular@example.com", Name: "Regular", Phone: "0901234567", Channel: "web",
+			Time: time.Now().Add(72 * time.Hour), UserID: &userID, Items: []models.BookingItem{{DrinkID: latte.ID, Qty: 2}}}
+		if err := bookings.Place(ctx, b, opts); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	balance := func() int {
+		t.Helper()
+		c, err := repos.GiftCards.FindByCode(ctx, card.Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Balance
+	}
+	points := func() int {
+		t.Helper()
+		a, err := repos.Loyalty.Account(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a.Points
+	}
+
+	paid := place(services.BookingOptions{GiftCard: &services.GiftCardRequest{Code: card.Code}})
+	if _, err := bookings.Cancel(ctx, paid.ID); err == nil {
+		t.Fatal("cancel with a failing refund succeeded")
+	}
+	if got := balance(); got != 10000 {
+		t.Fatalf("card balance after the failed refund = %d, want 10000", got)
+	}
+	for range 2 {
+		b, err := bookings.Cancel(ctx, paid.ID)
+		if err != nil || b.Status != models.BookingCancelled {
+			t.Fatalf("cancelling again = %+v, %v", b, err)
+		}
+	}
+	if got := balance(); got != 100000 {
+		t.Errorf("card balance after retrying = %d, want 100000 refunded once", got)
+	}
+
+	completed := place(services.BookingOptions{})
+	if _, err := bookings.Complete(ctx, completed.ID); err == nil {
+		t.Fatal("complete with a failing earn succeeded")
+	}
+	for range 2 {
+		if _, err := bookings.Complete(ctx, completed.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := points(); got != 9 {
+		t.Errorf("points after retrying = %d, want 9 earned once", got)
+	}
+	if _, err := bookings.Cancel(ctx, completed.ID); err == nil {
+		t.Error("cancelling a completed booking succeeded")
+	}
+}
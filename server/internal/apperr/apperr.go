@@ -0,0 +1,147 @@
+// Package apperr defines the errors the API shows to clients: a stable machine-readable
+// code, a human message and optional per-field details.
+//
+// Handlers and resolvers return *Error values for anything the client can act on. Every
+// other error is treated as internal: it is logged with the request ID and the client
+// only sees "internal error" plus that ID, so Mongo messages and the like never leak.
+package apperr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// Code is part of the API contract; clients switch on it, so never rename one.
+type Code string
+
+const (
+	InvalidArgument    Code = "INVALID_ARGUMENT"
+	Unauthenticated    Code = "UNAUTHENTICATED"
+	InvalidCredentials Code = "INVALID_CREDENTIALS"
+	InvalidToken       Code = "INVALID_TOKEN"
+	EmailNotVerified   Code = "EMAIL_NOT_VERIFIED"
+	PermissionDenied   Code = "PERMISSION_DENIED"
+	NotFound           Code = "NOT_FOUND"
+	AlreadyExists      Code = "ALREADY_EXISTS"
+	// FailedPrecondition: the resource is not in a state that allows the action.
+	FailedPrecondition  Code = "FAILED_PRECONDITION"
+	InsufficientBalance Code = "INSUFFICIENT_BALANCE"
+	RateLimited         Code = "RATE_LIMITED"
+	Unavailable         Code = "UNAVAILABLE"
+	Internal            Code = "INTERNAL"
+)
+
+var statuses = map[Code]int{
+	InvalidArgument:     http.StatusBadRequest,
+	Unauthenticated:     http.StatusUnauthorized,
+	InvalidCredentials:  http.StatusUnauthorized,
+	InvalidToken:        http.StatusUnauthorized,
+	EmailNotVerified:    http.StatusForbidden,
+	PermissionDenied:    http.StatusForbidden,
+	NotFound:            http.StatusNotFound,
+	AlreadyExists:       http.StatusConflict,
+	FailedPrecondition:  http.StatusConflict,
+	InsufficientBalance: http.StatusConflict,
+	RateLimited:         http.StatusTooManyRequests,
+	Unavailable:         http.StatusServiceUnavailable,
+	Internal:            http.StatusInternalServerError,
+}
+
+// Status is the HTTP status REST responses use for c.
+func (c Code) Status() int {
+	if s, ok := statuses[c]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// FieldError points at one invalid input field, e.g. "constraints.maxPrice".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Code    Code
+	Message string
+	Fields  []FieldError
+	// cause is logged, never shown
+	cause error
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Invalid reports a bad value in field; the message reads "<field> <problem>".
+func Invalid(field, problem string) *Error {
+	return &Error{
+		Code:    InvalidArgument,
+		Message: field + " " + problem,
+		Fields:  []FieldError{{Field: field, Message: problem}},
+	}
+}
+
+// Wrap keeps err as the logged cause of a client-facing error.
+func Wrap(err error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, cause: err}
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.cause }
+
+// From classifies any error. *Error values pass through, deadlines become Unavailable and
+// everything else Internal with err as the cause.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Wrap(err, Unavailable, "the request timed out, try again")
+	}
+	return Wrap(err, Internal, "internal error")
+}
+
+// BadJSON describes a request body that could not be decoded, naming the field when the
+// problem is a wrong JSON type.
+func BadJSON(err error) *Error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		e := Invalid(typeErr.Field, "must be "+jsonType(typeErr.Type))
+		e.cause = err
+		return e
+	}
+	return Wrap(err, InvalidArgument, "request body must be a valid JSON object")
+}
+
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	}
+	return "of a different type"
+}
@@ -0,0 +1,145 @@
+package apperr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"leblanc/server/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		code Code
+		want int
+	}{
+		{InvalidArgument, http.StatusBadRequest},
+		{Unauthenticated, http.StatusUnauthorized},
+		{InvalidCredentials, http.StatusUnauthorized},
+		{InvalidToken, http.StatusUnauthorized},
+		{EmailNotVerified, http.StatusForbidden},
+		{PermissionDenied, http.StatusForbidden},
+		{NotFound, http.StatusNotFound},
+		{AlreadyExists, http.StatusConflict},
+		{FailedPrecondition, http.StatusConflict},
+		{InsufficientBalance, http.StatusConflict},
+		{RateLimited, http.StatusTooManyRequests},
+		{Unavailable, http.StatusServiceUnavailable},
+		{Internal, http.StatusInternalServerError},
+		{"SOMETHING_NEW", http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		if got := tc.code.Status(); got != tc.want {
+			t.Errorf("%s.Status() = %d, want %d", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	notFound := New(NotFound, "booking not found")
+	cause := errors.New("connection reset")
+	tests := []struct {
+		name    string
+		err     error
+		code    Code
+		message string
+	}{
+		{"client error", notFound, NotFound, "booking not found"},
+		{"wrapped client error", fmt.Errorf("cancel: %w", notFound), NotFound, "booking not found"},
+		{"invalid field", Invalid("guests", "must be positive"), InvalidArgument, "guests must be positive"},
+		{"deadline", fmt.Errorf("find: %w", context.DeadlineExceeded), Unavailable, "the request timed out, try again"},
+		{"anything else", cause, Internal, "internal error"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := From(tc.err)
+			if e.Code != tc.code || e.Message != tc.message {
+				t.Errorf("From = %s %q, want %s %q", e.Code, e.Message, tc.code, tc.message)
+			}
+		})
+	}
+	if e := From(cause); !errors.Is(e, cause) {
+		t.Errorf("From(%v) lost its cause", cause)
+	}
+}
+
+func TestBadJSON(t *testing.T) {
+	var body struct {
+		Name   string         `json:"name"`
+		Guests int            `json:"guests"`
+		Price  float64        `json:"price"`
+		Tags   []string       `json:"tags"`
+		Paid   *bool          `json:"paid"`
+		Items  map[string]int `json:"items"`
+	}
+	tests := []struct {
+		json, field, message string
+	}{
+		{`{"name": 1}`, "name", "name must be a string"},
+		{`{"guests": "3"}`, "guests", "guests must be an integer"},
+		{`{"guests": 2.5}`, "guests", "guests must be an integer"},
+		{`{"price": "cheap"}`, "price", "price must be a number"},
+		{`{"tags": "coffee"}`, "tags", "tags must be an array"},
+		{`{"paid": "yes"}`, "paid", "paid must be a boolean"},
+		{`{"items": []}`, "items", "items must be an object"},
+		{`[1, 2]`, "", "request body must be a valid JSON object"},
+		{`{"name":`, "", "request body must be a valid JSON object"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.json, func(t *testing.T) {
+			err := json.Unmarshal([]byte(tc.json), &body)
+			e := BadJSON(err)
+			if e.Code != InvalidArgument || e.Message != tc.message || !errors.Is(e, err) {
+				t.Errorf("BadJSON = %s %q, want %q wrapping %v", e.Code, e.Message, tc.message, err)
+			}
+			if tc.field != "" && (len(e.Fields) != 1 || e.Fields[0].Field != tc.field) {
+				t.Errorf("fields = %+v, want %s", e.Fields, tc.field)
+			}
+		})
+	}
+}
+
+// TestWrite checks the REST envelope, and that internal causes never reach the client.
+func TestWrite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		want   Body
+	}{
+		{"invalid field", Invalid("guests", "must be positive"), http.StatusBadRequest,
+			Body{Error: "guests must be positive", Code: InvalidArgument, Fields: []FieldError{{Field: "guests", Message: "must be positive"}}, RequestID: "req-1"}},
+		{"wrapped client error", Wrap(errors.New("no documents"), NotFound, "drink not found"), http.StatusNotFound,
+			Body{Error: "drink not found", Code: NotFound, RequestID: "req-1"}},
+		{"internal", errors.New("mongo: server selection timeout at db.internal:27017"), http.StatusInternalServerError,
+			Body{Error: "internal error", Code: Internal, RequestID: "req-1"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(logging.WithRequestID(context.Background(), "req-1"))
+			Write(c, tc.err)
+
+			var got Body
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tc.status || !c.IsAborted() || fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("Write = %d %+v, want %d %+v", w.Code, got, tc.status, tc.want)
+			}
+		})
+	}
+
+	message, ext := GraphQL(logging.WithRequestID(context.Background(), "req-2"), errors.New("secret cause"))
+	if message != "internal error" || ext.Code != Internal || ext.RequestID != "req-2" {
+		t.Errorf("GraphQL = %q %+v, want an internal error with the request ID", message, ext)
+	}
+}
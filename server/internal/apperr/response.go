@@ -0,0 +1,48 @@
+package apperr
+
+import (
+	"context"
+	"log/slog"
+
+	"leblanc/server/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Body is the REST error envelope. Error stays a plain string so clients written against
+// the old {"error": "..."} shape keep working.
+type Body struct {
+	Error     string       `json:"error"`
+	Code      Code         `json:"code"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// Extensions is the extensions object of a GraphQL error.
+type Extensions struct {
+	Code      Code         `json:"code"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// Public classifies err for a client. Internal and Unavailable errors are logged here with
+// their cause, so callers must not log them again.
+func Public(ctx context.Context, err error) (*Error, string) {
+	e := From(err)
+	if e.Code == Internal || e.Code == Unavailable {
+		slog.ErrorContext(ctx, "request failed", "code", string(e.Code), "error", err)
+	}
+	return e, logging.RequestID(ctx)
+}
+
+// Write aborts the request with err as a REST error envelope.
+func Write(c *gin.Context, err error) {
+	e, id := Public(c.Request.Context(), err)
+	c.AbortWithStatusJSON(e.Code.Status(), Body{Error: e.Message, Code: e.Code, Fields: e.Fields, RequestID: id})
+}
+
+// GraphQL returns the message and extensions for err in a GraphQL error.
+func GraphQL(ctx context.Context, err error) (string, Extensions) {
+	e, id := Public(ctx, err)
+	return e.Message, Extensions{Code: e.Code, Fields: e.Fields, RequestID: id}
+}
@@ -0,0 +1,92 @@
+// Package auth reads the bearer session token issued by /auth/login and makes the user
+// available to handlers, resolvers and the rate limiter.
+//
+// Middleware only identifies: requests without a token go through anonymously, so public
+// routes stay public. Routes that need a user add RequireUser or RequireRole.
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/ratelimit"
+	"leblanc/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const RoleAdmin = "admin"
+
+// Identity is the logged-in user making a request.
+type Identity struct {
+	UserID primitive.ObjectID
+	Role   string
+}
+
+type ctxKey struct{}
+
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request's user, if it sent a valid session token.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(ctxKey{}).(Identity)
+	return id, ok
+}
+
+// Middleware verifies "Authorization: Bearer <session token>" when present. A bad or
+// expired token is rejected rather than ignored, so clients notice and log in again.
+func Middleware(tokens *services.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			c.Next()
+			return
+		}
+		s, err := tokens.VerifySessionToken(token)
+		if err != nil {
+			apperr.Write(c, err)
+			return
+		}
+		userID, err := primitive.ObjectIDFromHex(s.UserID)
+		if err != nil {
+			apperr.Write(c, apperr.New(apperr.InvalidToken, "invalid token subject"))
+			return
+		}
+		c.Set(ratelimit.UserIDKey, s.UserID)
+		c.Request = c.Request.WithContext(WithIdentity(c.Request.Context(), Identity{UserID: userID, Role: s.Role}))
+		c.Next()
+	}
+}
+
+var errLoginRequired = apperr.New(apperr.Unauthenticated, "log in to continue")
+
+// RequireUser rejects anonymous requests with 401.
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := FromContext(c.Request.Context()); !ok {
+			apperr.Write(c, errLoginRequired)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole rejects anonymous requests with 401 and other roles with 403.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := FromContext(c.Request.Context())
+		if !ok {
+			apperr.Write(c, errLoginRequired)
+			return
+		}
+		if id.Role != role {
+			apperr.Write(c, apperr.New(apperr.PermissionDenied, "requires the "+role+" role"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,803 @@
+// Package config loads the server configuration once at startup, validates it and hands
+// typed values to the subsystems that need them. Nothing else in the server reads the
+// environment.
+//
+// Values come from, in order of precedence: the process environment, a .env file in the
+// working directory, an optional JSON file of the same keys ({"MONGO_URI": "..."}), and
+// the defaults below.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	// embed the zone database; the runtime image ships without tzdata
+	_ "time/tzdata"
+
+	"github.com/joho/godotenv"
+)
+
+// Environments. Anything but dev refuses insecure defaults.
+const (
+	EnvDev        = "dev"
+	EnvStaging    = "staging"
+	EnvProduction = "production"
+)
+
+// devTokenSecret is only accepted in dev, where it stands in for a missing TOKEN_SECRET.
+const devTokenSecret = "change-me-token-secret"
+
+const minSecretLength = 32
+
+// invoiceBranch keeps branch codes short enough to print in invoice numbers.
+var invoiceBranch = regexp.MustCompile(`^[A-Z0-9]{1,10}$`)
+
+type Config struct {
+	Env  string
+	Port string
+	// ShutdownTimeout bounds how long SIGTERM waits for requests and workers to drain.
+	ShutdownTimeout time.Duration
+
+	Log     LogConfig
+	Mongo   MongoConfig
+	Tokens  TokenConfig
+	Admin   AdminConfig
+	Email   EmailConfig
+	CORS    CORSConfig
+	Cafe    CafeConfig
+	Weather WeatherConfig
+	Metrics MetricsConfig
+	Tracing TracingConfig
+	HTTP    HTTPConfig
+	Limits  RateLimitConfig
+	Loyalty LoyaltyConfig
+	Payment PaymentConfig
+	Invoice InvoiceConfig
+	Mail    MailConfig
+
+	// DrinkImageBase prefixes image file names from the menu fixture.
+	DrinkImageBase string
+
+	// File is the optional config file the values were read from.
+	File string
+}
+
+type LogConfig struct {
+	Level  string // debug|info|warn|error
+	Format string // json|text
+}
+
+type MongoConfig struct {
+	URI string
+	DB  string
+}
+
+type TokenConfig struct {
+	Secret          string
+	VerificationTTL time.Duration
+	RegistrationTTL time.Duration
+	// SessionTTL is how long a login stays valid.
+	SessionTTL time.Duration
+}
+
+// AdminConfig is the account EnsureAdminUser creates; empty Email disables it.
+type AdminConfig struct {
+	Name     string
+	Email    string
+	Password string
+}
+
+type EmailConfig struct {
+	// RequireMX rejects registrations whose domain has no MX record.
+	RequireMX bool
+	// FrontendVerifyURL is where verification links point; empty returns the token only.
+	FrontendVerifyURL string
+}
+
+type CORSConfig struct {
+	AllowOrigins []string
+}
+
+type CafeConfig struct {
+	Timezone string
+	Location *time.Location
+}
+
+// WeatherConfig configures a static weather reading; nil TempC disables weather.
+type WeatherConfig struct {
+	TempC     *float64
+	Condition string
+}
+
+// MetricsConfig guards /metrics. Token, when set, must be sent as a bearer token.
+type MetricsConfig struct {
+	Enabled bool
+	Token   string
+}
+
+// TracingConfig selects the OpenTelemetry trace exporter.
+type TracingConfig struct {
+	Exporter    string // none|stdout|otlp
+	ServiceName string
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://localhost:4318.
+	Endpoint string
+	// Headers are sent with every export, typically a vendor API key.
+	Headers map[string]string
+	// SampleRatio is the fraction of new traces recorded; incoming sampled traces are kept.
+	SampleRatio float64
+}
+
+// HTTPConfig decides which client IP the server believes.
+type HTTPConfig struct {
+	// ClientIPHeader is set by the platform's edge (Fly-Client-IP on Fly.io) and trusted as is.
+	ClientIPHeader string
+	// TrustedProxies may set X-Forwarded-For; empty trusts none.
+	TrustedProxies []string
+	// ValidateOpenAPI checks requests and responses against the OpenAPI document. Dev only.
+	ValidateOpenAPI bool
+}
+
+// RateLimitConfig holds the per-route token-bucket policies.
+type RateLimitConfig struct {
+	Enabled bool
+	Backend string // memory|mongo
+	// Policies maps "METHOD /route" to its limit; routes without one are not limited.
+	Policies map[string]RatePolicy
+}
+
+// RatePolicy allows Limit requests per Period, refilled continuously.
+type RatePolicy struct {
+	Limit  int
+	Period time.Duration
+}
+
+func (p RatePolicy) String() string { return fmt.Sprintf("%d/%s", p.Limit, p.Period) }
+
+// LoyaltyConfig holds the earn and burn rules of the loyalty program.
+type LoyaltyConfig struct {
+	Enabled bool
+	// EarnPoints points are earned for every EarnPerVND paid on a completed booking.
+	EarnPoints int
+	EarnPerVND int
+	// PointValueVND is the discount one redeemed point buys.
+	PointValueVND int
+	// MinRedeem is the fewest points a booking may redeem.
+	MinRedeem int
+	// StampCards maps a drink tag to the stamps that earn one free drink with that tag.
+	StampCards map[string]int
+}
+
+// defaultRatePolicies protect the endpoints that are expensive (MX lookups, bcrypt,
+// scoring) or worth brute-forcing. RATE_LIMITS overrides them route by route.
+var defaultRatePolicies = map[string]RatePolicy{
+	"POST /auth/register":       {Limit: 5, Period: 10 * time.Minute},
+	"POST /auth/request-verify": {Limit: 3, Period: 10 * time.Minute},
+	"POST /auth/login":          {Limit: 10, Period: 5 * time.Minute},
+	"POST /giftcards/balance":   {Limit: 10, Period: 5 * time.Minute},
+	"POST /invoices/:id/email":  {Limit: 5, Period: 10 * time.Minute},
+	"POST /reco/from-features":  {Limit: 60, Period: time.Minute},
+	"POST /reco/group":          {Limit: 30, Period: time.Minute},
+	"POST /graphql":             {Limit: 120, Period: time.Minute},
+}
+
+// PaymentConfig selects the payment provider and when bookings need a deposit.
+type PaymentConfig struct {
+	Provider string // fake|vnpay
+	// PublicURL is where the provider sends customers and callbacks back to.
+	PublicURL string
+	// ResultURL is the front-end page customers land on after paying; empty answers JSON.
+	ResultURL string
+
+	// Deposits are taken for bookings of more than DepositGuestsOver guests, at
+	// DepositPerGuestVND each, and must be paid within DepositTimeout.
+	DepositsEnabled    bool
+	DepositGuestsOver  int
+	DepositPerGuestVND int
+	DepositTimeout     time.Duration
+	// RefundBefore is how long before the booked time a cancellation still gets the
+	// deposit back.
+	RefundBefore time.Duration
+
+	VNPay VNPayConfig
+}
+
+// VNPayConfig holds the merchant credentials and endpoints of VNPay.
+type VNPayConfig struct {
+	TmnCode    string
+	HashSecret string
+	PayURL     string
+	APIURL     string
+}
+
+// InvoiceConfig is the seller printed on receipts and VAT invoices.
+type InvoiceConfig struct {
+	// Branch prefixes invoice numbers; every branch numbers its invoices on its own.
+	Branch        string
+	SellerName    string
+	SellerTaxCode string // required to issue VAT invoices
+	SellerAddress string
+	// VATPercent is the VAT included in menu prices.
+	VATPercent int
+}
+
+// MailConfig is the SMTP server receipts are emailed through. Without a Host, mail is
+// only logged in dev and refused elsewhere.
+type MailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+var defaultCORSOrigins = []string{
+	"http://localhost:3000",
+	"http://localhost:5173",
+	"http://127.0.0.1:3000",
+	"http://127.0.0.1:5173",
+	"https://le-blanc-web.vercel.app",
+}
+
+// Load reads .env (if present), the optional JSON file at path and the environment, and
+// validates the result. path may be empty; CONFIG_FILE is used then.
+func Load(path string) (*Config, error) {
+	_ = godotenv.Load()
+
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("CONFIG_FILE"))
+	}
+	file := map[string]string{}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+		if err := json.Unmarshal(b, &file); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	l := loader{file: file}
+	cfg := &Config{
+		Env:  strings.ToLower(l.str("APP_ENV", EnvDev)),
+		Port: l.str("PORT", "4000"),
+
+		ShutdownTimeout: l.seconds("SHUTDOWN_TIMEOUT_SEC", 20),
+		Log: LogConfig{
+			Level:  strings.ToLower(l.str("LOG_LEVEL", "info")),
+			Format: strings.ToLower(l.str("LOG_FORMAT", "json")),
+		},
+		Mongo: MongoConfig{
+			URI: l.str("MONGO_URI", ""),
+			DB:  l.str("MONGO_DB", ""),
+		},
+		Tokens: TokenConfig{
+			Secret:          l.str("TOKEN_SECRET", ""),
+			VerificationTTL: l.minutes("VERIFICATION_TTL_MIN", 30),
+			RegistrationTTL: l.minutes("REGISTRATION_TTL_MIN", 60),
+			SessionTTL:      l.duration("SESSION_TTL_HOURS", 24*7, time.Hour, "hours"),
+		},
+		Admin: AdminConfig{
+			Name:     l.str("ADMIN_NAME", "Admin"),
+			Email:    l.str("ADMIN_EMAIL", ""),
+			Password: l.raw("ADMIN_PASSWORD"),
+		},
+		Email: EmailConfig{
+			RequireMX:         l.boolean("EMAIL_REQUIRE_MX", true),
+			FrontendVerifyURL: l.str("FRONTEND_VERIFY_URL", ""),
+		},
+		CORS:    CORSConfig{AllowOrigins: l.list("CORS_ALLOW_ORIGINS", defaultCORSOrigins)},
+		Cafe:    CafeConfig{Timezone: l.str("CAFE_TIMEZONE", "Asia/Ho_Chi_Minh")},
+		Weather: WeatherConfig{TempC: l.optFloat("WEATHER_TEMP_C"), Condition: strings.ToLower(l.str("WEATHER_CONDITION", ""))},
+		Metrics: MetricsConfig{Token: l.raw("METRICS_TOKEN")},
+		Tracing: TracingConfig{
+			Exporter:    strings.ToLower(l.str("OTEL_TRACES_EXPORTER", "none")),
+			ServiceName: l.str("OTEL_SERVICE_NAME", "leblanc-api"),
+			Endpoint:    l.str("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			Headers:     l.pairs("OTEL_EXPORTER_OTLP_HEADERS"),
+			SampleRatio: l.ratio("OTEL_TRACES_SAMPLER_ARG", 1),
+		},
+		HTTP: HTTPConfig{
+			ClientIPHeader:  l.str("CLIENT_IP_HEADER", ""),
+			TrustedProxies:  l.list("TRUSTED_PROXIES", nil),
+			ValidateOpenAPI: l.boolean("OPENAPI_VALIDATE", false),
+		},
+		Limits: RateLimitConfig{
+			Enabled:  l.boolean("RATE_LIMIT_ENABLED", true),
+			Backend:  strings.ToLower(l.str("RATE_LIMIT_BACKEND", "memory")),
+			Policies: l.ratePolicies("RATE_LIMITS", defaultRatePolicies),
+		},
+		Loyalty: LoyaltyConfig{
+			Enabled:       l.boolean("LOYALTY_ENABLED", true),
+			EarnPoints:    l.positive("LOYALTY_EARN_POINTS", 1),
+			EarnPerVND:    l.positive("LOYALTY_EARN_PER_VND", 10000),
+			PointValueVND: l.positive("LOYALTY_POINT_VALUE_VND", 100),
+			MinRedeem:     l.positive("LOYALTY_MIN_REDEEM", 50),
+			StampCards:    l.counts("LOYALTY_STAMP_CARDS", map[string]int{"coffee": 10}),
+		},
+		Payment: PaymentConfig{
+			Provider:           strings.ToLower(l.str("PAYMENT_PROVIDER", "fake")),
+			ResultURL:          l.str("PAYMENT_RESULT_URL", ""),
+			DepositGuestsOver:  l.positive("DEPOSIT_GUESTS_OVER", 6),
+			DepositPerGuestVND: l.positive("DEPOSIT_PER_GUEST_VND", 50000),
+			DepositTimeout:     l.minutes("DEPOSIT_TIMEOUT_MIN", 15),
+			RefundBefore:       l.duration("DEPOSIT_REFUND_HOURS", 24, time.Hour, "hours"),
+			VNPay: VNPayConfig{
+				TmnCode:    l.str("VNPAY_TMN_CODE", ""),
+				HashSecret: l.raw("VNPAY_HASH_SECRET"),
+				PayURL:     l.str("VNPAY_PAY_URL", "https://sandbox.vnpayment.vn/paymentv2/vpcpay.html"),
+				APIURL:     l.str("VNPAY_API_URL", "https://sandbox.vnpayment.vn/merchant_webapi/api/transaction"),
+			},
+		},
+		Invoice: InvoiceConfig{
+			Branch:        strings.ToUpper(l.str("INVOICE_BRANCH", "LB01")),
+			SellerName:    l.str("INVOICE_SELLER_NAME", "LeBlanc Café"),
+			SellerTaxCode: l.str("INVOICE_SELLER_TAX_CODE", ""),
+			SellerAddress: l.str("INVOICE_SELLER_ADDRESS", ""),
+			VATPercent:    l.percent("VAT_PERCENT", 8),
+		},
+		Mail: MailConfig{
+			Host:     l.str("SMTP_HOST", ""),
+			Port:     l.positive("SMTP_PORT", 587),
+			Username: l.str("SMTP_USERNAME", ""),
+			Password: l.raw("SMTP_PASSWORD"),
+			From:     l.str("SMTP_FROM", ""),
+		},
+		DrinkImageBase: strings.TrimRight(l.str("DRINK_IMAGE_BASE", "https://le-blanc-web.vercel.app/drinks"), "/"),
+		File:           path,
+	}
+	// on by default where it is safe: in dev, or when scrapes are authenticated
+	cfg.Metrics.Enabled = l.boolean("METRICS_ENABLED", cfg.IsDev() || cfg.Metrics.Token != "")
+	// likewise deposits: in dev, where the fake provider takes them, or with a real provider
+	cfg.Payment.DepositsEnabled = l.boolean("DEPOSITS_ENABLED", cfg.IsDev() || cfg.Payment.Provider != "fake")
+	cfg.Payment.PublicURL = strings.TrimRight(l.str("PUBLIC_URL", "http://localhost:"+cfg.Port), "/")
+	if loc, err := time.LoadLocation(cfg.Cafe.Timezone); err != nil {
+		l.errs = append(l.errs, fmt.Errorf("CAFE_TIMEZONE: unknown timezone %q", cfg.Cafe.Timezone))
+	} else {
+		cfg.Cafe.Location = loc
+	}
+
+	if err := errors.Join(append(l.errs, cfg.Validate())...); err != nil {
+		return nil, err
+	}
+	if cfg.Tokens.Secret == "" {
+		// dev only; Validate refuses this anywhere else
+		cfg.Tokens.Secret = devTokenSecret
+	}
+	return cfg, nil
+}
+
+// Validate checks required values and, outside dev, refuses insecure defaults.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if !slices.Contains([]string{EnvDev, EnvStaging, EnvProduction}, c.Env) {
+		fail("APP_ENV must be %s, %s or %s", EnvDev, EnvStaging, EnvProduction)
+	}
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, c.Log.Level) {
+		fail("LOG_LEVEL must be debug, info, warn or error")
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		fail("LOG_FORMAT must be json or text")
+	}
+	if !slices.Contains([]string{"none", "stdout", "otlp"}, c.Tracing.Exporter) {
+		fail("OTEL_TRACES_EXPORTER must be none, stdout or otlp")
+	}
+	if c.Tracing.Exporter == "otlp" && c.Tracing.Endpoint == "" {
+		fail("OTEL_EXPORTER_OTLP_ENDPOINT is required with OTEL_TRACES_EXPORTER=otlp")
+	}
+	if c.Limits.Backend != "memory" && c.Limits.Backend != "mongo" {
+		fail("RATE_LIMIT_BACKEND must be memory or mongo")
+	}
+	if c.Payment.Provider != "fake" && c.Payment.Provider != "vnpay" {
+		fail("PAYMENT_PROVIDER must be fake or vnpay")
+	}
+	if c.Payment.Provider == "vnpay" && (c.Payment.VNPay.TmnCode == "" || c.Payment.VNPay.HashSecret == "") {
+		fail("VNPAY_TMN_CODE and VNPAY_HASH_SECRET are required with PAYMENT_PROVIDER=vnpay")
+	}
+	if !invoiceBranch.MatchString(c.Invoice.Branch) {
+		fail("INVOICE_BRANCH must be 1 to 10 letters or digits")
+	}
+	if c.Mail.Host != "" && c.Mail.From == "" {
+		fail("SMTP_FROM is required with SMTP_HOST")
+	}
+	if c.Mongo.URI == "" {
+		fail("MONGO_URI is required")
+	}
+	if c.Mongo.DB == "" {
+		fail("MONGO_DB is required")
+	}
+	if c.Admin.Email != "" && c.Admin.Password == "" {
+		fail("ADMIN_PASSWORD is required when ADMIN_EMAIL is set")
+	}
+	if c.Weather.Condition != "" && !slices.Contains([]string{"clear", "cloudy", "rain", "storm"}, c.Weather.Condition) {
+		fail("WEATHER_CONDITION must be clear, cloudy, rain or storm")
+	}
+
+	if c.Env != EnvDev {
+		switch {
+		case c.Tokens.Secret == "" || c.Tokens.Secret == devTokenSecret:
+			fail("TOKEN_SECRET must be set in %s", c.Env)
+		case len(c.Tokens.Secret) < minSecretLength:
+			fail("TOKEN_SECRET must be at least %d characters in %s", minSecretLength, c.Env)
+		}
+		if c.Admin.Email != "" && len(c.Admin.Password) < 12 {
+			fail("ADMIN_PASSWORD must be at least 12 characters in %s", c.Env)
+		}
+		if c.Metrics.Enabled && len(c.Metrics.Token) < 16 {
+			fail("METRICS_TOKEN of at least 16 characters is required to enable metrics in %s", c.Env)
+		}
+		if c.HTTP.ValidateOpenAPI {
+			fail("OPENAPI_VALIDATE is only allowed in %s", EnvDev)
+		}
+		if slices.Contains(c.CORS.AllowOrigins, "*") {
+			fail("CORS_ALLOW_ORIGINS must list origins explicitly in %s", c.Env)
+		}
+		if c.Payment.DepositsEnabled && c.Payment.Provider == "fake" {
+			fail("DEPOSITS_ENABLED needs a real PAYMENT_PROVIDER in %s", c.Env)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsDev reports whether the server runs in the dev environment.
+func (c *Config) IsDev() bool { return c.Env == EnvDev }
+
+// WriteRedacted prints the effective configuration with secrets masked.
+func (c *Config) WriteRedacted(w io.Writer) error {
+	for _, r := range c.redacted() {
+		if _, err := fmt.Fprintf(w, "%-24s %s\n", r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogValue logs the same redacted view, one attribute per key.
+func (c *Config) LogValue() slog.Value {
+	rows := c.redacted()
+	attrs := make([]slog.Attr, len(rows))
+	for i, r := range rows {
+		attrs[i] = slog.String(r[0], r[1])
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (c *Config) redacted() [][2]string {
+	weather := "off"
+	if c.Weather.TempC != nil {
+		weather = fmt.Sprintf("%.1fC %s", *c.Weather.TempC, c.Weather.Condition)
+	}
+	file := c.File
+	if file == "" {
+		file = "(none)"
+	}
+	return [][2]string{
+		{"APP_ENV", c.Env},
+		{"CONFIG_FILE", file},
+		{"PORT", c.Port},
+		{"SHUTDOWN_TIMEOUT_SEC", fmt.Sprint(c.ShutdownTimeout.Seconds())},
+		{"LOG_LEVEL", c.Log.Level},
+		{"LOG_FORMAT", c.Log.Format},
+		{"MONGO_URI", RedactURI(c.Mongo.URI)},
+		{"MONGO_DB", c.Mongo.DB},
+		{"TOKEN_SECRET", mask(c.Tokens.Secret)},
+		{"VERIFICATION_TTL_MIN", fmt.Sprint(c.Tokens.VerificationTTL.Minutes())},
+		{"REGISTRATION_TTL_MIN", fmt.Sprint(c.Tokens.RegistrationTTL.Minutes())},
+		{"ADMIN_NAME", c.Admin.Name},
+		{"ADMIN_EMAIL", c.Admin.Email},
+		{"ADMIN_PASSWORD", mask(c.Admin.Password)},
+		{"EMAIL_REQUIRE_MX", strconv.FormatBool(c.Email.RequireMX)},
+		{"FRONTEND_VERIFY_URL", c.Email.FrontendVerifyURL},
+		{"CORS_ALLOW_ORIGINS", strings.Join(c.CORS.AllowOrigins, ",")},
+		{"CAFE_TIMEZONE", c.Cafe.Timezone},
+		{"WEATHER", weather},
+		{"METRICS_ENABLED", strconv.FormatBool(c.Metrics.Enabled)},
+		{"METRICS_TOKEN", mask(c.Metrics.Token)},
+		{"OTEL_TRACES_EXPORTER", c.Tracing.Exporter},
+		{"OTEL_SERVICE_NAME", c.Tracing.ServiceName},
+		{"OTEL_EXPORTER_OTLP_ENDPOINT", c.Tracing.Endpoint},
+		{"OTEL_EXPORTER_OTLP_HEADERS", maskPairs(c.Tracing.Headers)},
+		{"OTEL_TRACES_SAMPLER_ARG", strconv.FormatFloat(c.Tracing.SampleRatio, 'g', -1, 64)},
+		{"CLIENT_IP_HEADER", c.HTTP.ClientIPHeader},
+		{"TRUSTED_PROXIES", strings.Join(c.HTTP.TrustedProxies, ",")},
+		{"OPENAPI_VALIDATE", strconv.FormatBool(c.HTTP.ValidateOpenAPI)},
+		{"RATE_LIMIT_ENABLED", strconv.FormatBool(c.Limits.Enabled)},
+		{"RATE_LIMIT_BACKEND", c.Limits.Backend},
+		{"RATE_LIMITS", formatPolicies(c.Limits.Policies)},
+		{"SESSION_TTL_HOURS", fmt.Sprint(c.Tokens.SessionTTL.Hours())},
+		{"LOYALTY_ENABLED", strconv.FormatBool(c.Loyalty.Enabled)},
+		{"LOYALTY_EARN", fmt.Sprintf("%d per %d VND", c.Loyalty.EarnPoints, c.Loyalty.EarnPerVND)},
+		{"LOYALTY_POINT_VALUE_VND", strconv.Itoa(c.Loyalty.PointValueVND)},
+		{"LOYALTY_MIN_REDEEM", strconv.Itoa(c.Loyalty.MinRedeem)},
+		{"LOYALTY_STAMP_CARDS", formatCounts(c.Loyalty.StampCards)},
+		{"PAYMENT_PROVIDER", c.Payment.Provider},
+		{"PUBLIC_URL", c.Payment.PublicURL},
+		{"PAYMENT_RESULT_URL", c.Payment.ResultURL},
+		{"DEPOSITS_ENABLED", strconv.FormatBool(c.Payment.DepositsEnabled)},
+		{"DEPOSIT", fmt.Sprintf("%d VND per guest over %d guests", c.Payment.DepositPerGuestVND, c.Payment.DepositGuestsOver)},
+		{"DEPOSIT_TIMEOUT_MIN", fmt.Sprint(c.Payment.DepositTimeout.Minutes())},
+		{"DEPOSIT_REFUND_HOURS", fmt.Sprint(c.Payment.RefundBefore.Hours())},
+		{"VNPAY_TMN_CODE", c.Payment.VNPay.TmnCode},
+		{"VNPAY_HASH_SECRET", mask(c.Payment.VNPay.HashSecret)},
+		{"VNPAY_PAY_URL", c.Payment.VNPay.PayURL},
+		{"VNPAY_API_URL", c.Payment.VNPay.APIURL},
+		{"INVOICE_BRANCH", c.Invoice.Branch},
+		{"INVOICE_SELLER_NAME", c.Invoice.SellerName},
+		{"INVOICE_SELLER_TAX_CODE", c.Invoice.SellerTaxCode},
+		{"INVOICE_SELLER_ADDRESS", c.Invoice.SellerAddress},
+		{"VAT_PERCENT", strconv.Itoa(c.Invoice.VATPercent)},
+		{"SMTP_HOST", c.Mail.Host},
+		{"SMTP_PORT", strconv.Itoa(c.Mail.Port)},
+		{"SMTP_USERNAME", c.Mail.Username},
+		{"SMTP_PASSWORD", mask(c.Mail.Password)},
+		{"SMTP_FROM", c.Mail.From},
+		{"DRINK_IMAGE_BASE", c.DrinkImageBase},
+	}
+}
+
+func mask(secret string) string {
+	if secret == "" {
+		return "(unset)"
+	}
+	return "****"
+}
+
+// maskPairs lists header names only.
+func maskPairs(pairs map[string]string) string {
+	if len(pairs) == 0 {
+		return "(none)"
+	}
+	out := make([]string, 0, len(pairs))
+	for k := range pairs {
+		out = append(out, k+"=****")
+	}
+	slices.Sort(out)
+	return strings.Join(out, ",")
+}
+
+func formatPolicies(policies map[string]RatePolicy) string {
+	out := make([]string, 0, len(policies))
+	for route, p := range policies {
+		out = append(out, route+"="+p.String())
+	}
+	slices.Sort(out)
+	return strings.Join(out, ";")
+}
+
+func formatCounts(counts map[string]int) string {
+	out := make([]string, 0, len(counts))
+	for k, n := range counts {
+		out = append(out, k+"="+strconv.Itoa(n))
+	}
+	slices.Sort(out)
+	return strings.Join(out, ",")
+}
+
+// RedactURI hides the password in a connection string.
+func RedactURI(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+// loader reads keys from the environment, falling back to the config file, and collects
+// parse errors so they are all reported at once.
+type loader struct {
+	file map[string]string
+	errs []error
+}
+
+func (l *loader) raw(key string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return l.file[key]
+}
+
+func (l *loader) str(key, def string) string {
+	if v := strings.TrimSpace(l.raw(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+func (l *loader) minutes(key string, def int) time.Duration {
+	return l.duration(key, def, time.Minute, "minutes")
+}
+
+func (l *loader) seconds(key string, def int) time.Duration {
+	return l.duration(key, def, time.Second, "seconds")
+}
+
+func (l *loader) duration(key string, def int, unit time.Duration, unitName string) time.Duration {
+	v := l.str(key, "")
+	if v == "" {
+		return time.Duration(def) * unit
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s: must be a positive number of %s", key, unitName))
+		return time.Duration(def) * unit
+	}
+	return time.Duration(n) * unit
+}
+
+func (l *loader) boolean(key string, def bool) bool {
+	v := l.str(key, "")
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: must be true or false", key))
+		return def
+	}
+	return b
+}
+
+func (l *loader) optFloat(key string) *float64 {
+	v := l.str(key, "")
+	if v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: must be a number", key))
+		return nil
+	}
+	return &f
+}
+
+func (l *loader) ratio(key string, def float64) float64 {
+	v := l.str(key, "")
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		l.errs = append(l.errs, fmt.Errorf("%s: must be a number between 0 and 1", key))
+		return def
+	}
+	return f
+}
+
+func (l *loader) positive(key string, def int) int {
+	v := l.str(key, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s: must be a positive integer", key))
+		return def
+	}
+	return n
+}
+
+func (l *loader) percent(key string, def int) int {
+	v := l.str(key, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > 100 {
+		l.errs = append(l.errs, fmt.Errorf("%s: must be a whole percentage between 0 and 100", key))
+		return def
+	}
+	return n
+}
+
+// counts parses "coffee=10,tea=8" into positive counts per lower-case tag; "off" clears
+// the defaults.
+func (l *loader) counts(key string, def map[string]int) map[string]int {
+	v := l.str(key, "")
+	if v == "" {
+		return def
+	}
+	out := map[string]int{}
+	if v == "off" {
+		return out
+	}
+	for k, raw := range l.pairs(key) {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || !validTag(k) {
+			l.errs = append(l.errs, fmt.Errorf("%s: %q must look like coffee=10", key, k+"="+raw))
+			continue
+		}
+		out[k] = n
+	}
+	return out
+}
+
+// validTag keeps tags safe to use in Mongo field paths.
+func validTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, r := range tag {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// pairs parses "k1=v1,k2=v2", the OTEL_EXPORTER_OTLP_HEADERS format.
+func (l *loader) pairs(key string) map[string]string {
+	out := map[string]string{}
+	for _, p := range l.list(key, nil) {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			l.errs = append(l.errs, fmt.Errorf("%s: expected key=value pairs", key))
+			return nil
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+// ratePolicies starts from defaults and applies "POST /graphql=120/1m;POST /auth/login=off".
+// Entries are separated by semicolons since routes may not contain them.
+func (l *loader) ratePolicies(key string, defaults map[string]RatePolicy) map[string]RatePolicy {
+	out := make(map[string]RatePolicy, len(defaults))
+	for route, p := range defaults {
+		out[route] = p
+	}
+	for _, entry := range strings.Split(l.str(key, ""), ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		route, spec, ok := strings.Cut(entry, "=")
+		method, path, okRoute := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || !okRoute || !strings.HasPrefix(strings.TrimSpace(path), "/") {
+			l.errs = append(l.errs, fmt.Errorf("%s: %q must look like \"POST /path=10/1m\"", key, entry))
+			continue
+		}
+		route = strings.ToUpper(method) + " " + strings.TrimSpace(path)
+		spec = strings.TrimSpace(spec)
+		if spec == "off" {
+			delete(out, route)
+			continue
+		}
+		n, period, ok := strings.Cut(spec, "/")
+		limit, err := strconv.Atoi(n)
+		d, perr := time.ParseDuration(period)
+		if !ok || err != nil || perr != nil || limit <= 0 || d <= 0 {
+			l.errs = append(l.errs, fmt.Errorf("%s: %q: limit must look like 10/1m or off", key, entry))
+			continue
+		}
+		out[route] = RatePolicy{Limit: limit, Period: d}
+	}
+	return out
+}
+
+func (l *loader) list(key string, def []string) []string {
+	v := l.str(key, "")
+	if v == "" {
+		return def
+	}
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
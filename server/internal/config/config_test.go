@@ -0,0 +1,197 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// valid is the smallest config Validate accepts in dev.
+func valid() *Config {
+	return &Config{
+		Env:     EnvDev,
+		Log:     LogConfig{Level: "info", Format: "json"},
+		Mongo:   MongoConfig{URI: "mongodb://localhost:27017", DB: "leblanc"},
+		Tracing: TracingConfig{Exporter: "none"},
+		Limits:  RateLimitConfig{Backend: "memory"},
+		Payment: PaymentConfig{Provider: "fake"},
+		Invoice: InvoiceConfig{Branch: "LB01"},
+	}
+}
+
+// production is valid with every secret set the way production needs it.
+func production() *Config {
+	c := valid()
+	c.Env = EnvProduction
+	c.Tokens.Secret = strings.Repeat("s", minSecretLength)
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  func() *Config
+		change  func(c *Config)
+		problem string // empty when valid
+	}{
+		{"dev", valid, func(c *Config) {}, ""},
+		{"production", production, func(c *Config) {}, ""},
+		{"unknown env", valid, func(c *Config) { c.Env = "prod" }, "APP_ENV must be"},
+		{"log level", valid, func(c *Config) { c.Log.Level = "trace" }, "LOG_LEVEL must be"},
+		{"log format", valid, func(c *Config) { c.Log.Format = "xml" }, "LOG_FORMAT must be"},
+		{"otlp without endpoint", valid, func(c *Config) { c.Tracing.Exporter = "otlp" }, "OTEL_EXPORTER_OTLP_ENDPOINT is required"},
+		{"rate limit backend", valid, func(c *Config) { c.Limits.Backend = "redis" }, "RATE_LIMIT_BACKEND must be"},
+		{"vnpay without credentials", valid, func(c *Config) { c.Payment.Provider = "vnpay" }, "VNPAY_TMN_CODE and VNPAY_HASH_SECRET are required"},
+		{"invoice branch", valid, func(c *Config) { c.Invoice.Branch = "LB-01" }, "INVOICE_BRANCH must be"},
+		{"smtp without from", valid, func(c *Config) { c.Mail.Host = "smtp.example.com" }, "SMTP_FROM is required"},
+		{"no mongo", valid, func(c *Config) { c.Mongo = MongoConfig{} }, "MONGO_URI is required"},
+		{"admin without password", valid, func(c *Config) { c.Admin.Email = "admin@example.com" }, "ADMIN_PASSWORD is required"},
+		{"weather condition", valid, func(c *Config) { c.Weather.Condition = "snow" }, "WEATHER_CONDITION must be"},
+		{"dev allows its defaults", valid, func(c *Config) {
+			c.Admin = AdminConfig{Email: "admin@example.com", Password: "short"}
+			c.Metrics.Enabled = true
+			c.HTTP.ValidateOpenAPI = true
+			c.CORS.AllowOrigins = []string{"*"}
+			c.Payment.DepositsEnabled = true
+		}, ""},
+		{"no token secret", production, func(c *Config) { c.Tokens.Secret = "" }, "TOKEN_SECRET must be set"},
+		{"dev token secret", production, func(c *Config) { c.Tokens.Secret = devTokenSecret }, "TOKEN_SECRET must be set"},
+		{"short token secret", production, func(c *Config) { c.Tokens.Secret = "0123456789" }, "TOKEN_SECRET must be at least 32"},
+		{"short admin password", production, func(c *Config) {
+			c.Admin = AdminConfig{Email: "admin@example.com", Password: "elevenchars"}
+		}, "ADMIN_PASSWORD must be at least 12"},
+		{"metrics without token", production, func(c *Config) { c.Metrics.Enabled = true }, "METRICS_TOKEN of at least 16"},
+		{"openapi validation", production, func(c *Config) { c.HTTP.ValidateOpenAPI = true }, "OPENAPI_VALIDATE is only allowed"},
+		{"any origin", production, func(c *Config) { c.CORS.AllowOrigins = []string{"https://a.example.com", "*"} }, "CORS_ALLOW_ORIGINS must list origins"},
+		{"fake deposits", production, func(c *Config) { c.Payment.DepositsEnabled = true }, "DEPOSITS_ENABLED needs a real PAYMENT_PROVIDER"},
+		{"staging is strict too", production, func(c *Config) { c.Env = EnvStaging; c.Tokens.Secret = "" }, "TOKEN_SECRET must be set in staging"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.config()
+			tc.change(c)
+			err := c.Validate()
+			if tc.problem == "" && err != nil || tc.problem != "" && (err == nil || !strings.Contains(err.Error(), tc.problem)) {
+				t.Errorf("Validate = %v, want %q", err, tc.problem)
+			}
+		})
+	}
+}
+
+// TestLoad sets every key it relies on, so the environment the tests run in does not leak
+// into the results.
+func TestLoad(t *testing.T) {
+	base := map[string]string{
+		"APP_ENV":             "dev",
+		"MONGO_URI":           "mongodb://localhost:27017",
+		"MONGO_DB":            "leblanc",
+		"TOKEN_SECRET":        "",
+		"CAFE_TIMEZONE":       "",
+		"SESSION_TTL_HOURS":   "",
+		"RATE_LIMITS":         "",
+		"LOYALTY_STAMP_CARDS": "",
+		"PAYMENT_PROVIDER":    "",
+		"DEPOSITS_ENABLED":    "",
+		"METRICS_ENABLED":     "",
+		"METRICS_TOKEN":       "",
+		"CONFIG_FILE":         "",
+		"CORS_ALLOW_ORIGINS":  "",
+	}
+	tests := []struct {
+		name     string
+		env      map[string]string
+		problems []string
+		check    func(t *testing.T, c *Config)
+	}{
+		{"defaults", nil, nil, func(t *testing.T, c *Config) {
+			if c.Tokens.Secret != devTokenSecret || c.Cafe.Location.String() != "Asia/Ho_Chi_Minh" || c.Tokens.SessionTTL != 7*24*time.Hour {
+				t.Errorf("secret set %v, location %v, session %v; want the dev defaults", c.Tokens.Secret != "", c.Cafe.Location, c.Tokens.SessionTTL)
+			}
+			if !c.Metrics.Enabled || !c.Payment.DepositsEnabled || c.Loyalty.StampCards["coffee"] != 10 {
+				t.Errorf("metrics %v, deposits %v, stamp cards %v; want metrics and deposits on in dev", c.Metrics.Enabled, c.Payment.DepositsEnabled, c.Loyalty.StampCards)
+			}
+		}},
+		{"overrides", map[string]string{
+			"CAFE_TIMEZONE":       "Asia/Tokyo",
+			"SESSION_TTL_HOURS":   "12",
+			"RATE_LIMITS":         "post /graphql=10/1s; POST /auth/login=off",
+			"LOYALTY_STAMP_CARDS": "tea=8",
+		}, nil, func(t *testing.T, c *Config) {
+			if c.Cafe.Location.String() != "Asia/Tokyo" || c.Tokens.SessionTTL != 12*time.Hour {
+				t.Errorf("location %v, session %v", c.Cafe.Location, c.Tokens.SessionTTL)
+			}
+			if p := c.Limits.Policies["POST /graphql"]; p != (RatePolicy{Limit: 10, Period: time.Second}) {
+				t.Errorf("POST /graphql limit = %v, want 10/1s", p)
+			}
+			if _, ok := c.Limits.Policies["POST /auth/login"]; ok {
+				t.Errorf("POST /auth/login is still limited")
+			}
+			if len(c.Loyalty.StampCards) != 1 || c.Loyalty.StampCards["tea"] != 8 {
+				t.Errorf("stamp cards = %v, want tea=8 only", c.Loyalty.StampCards)
+			}
+		}},
+		{"every bad value is reported", map[string]string{
+			"CAFE_TIMEZONE":       "Mars/Olympus",
+			"SESSION_TTL_HOURS":   "-1",
+			"RATE_LIMITS":         "/graphql=10",
+			"LOYALTY_STAMP_CARDS": "Coffee=10",
+			"MONGO_DB":            "",
+		}, []string{
+			`CAFE_TIMEZONE: unknown timezone "Mars/Olympus"`,
+			"SESSION_TTL_HOURS: must be a positive number of hours",
+			`RATE_LIMITS: "/graphql=10"`,
+			`LOYALTY_STAMP_CARDS: "Coffee=10"`,
+			"MONGO_DB is required",
+		}, nil},
+		{"production refuses dev defaults", map[string]string{"APP_ENV": "production", "CORS_ALLOW_ORIGINS": "*"}, []string{
+			"TOKEN_SECRET must be set in production",
+			"CORS_ALLOW_ORIGINS must list origins explicitly in production",
+		}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range base {
+				t.Setenv(k, v)
+			}
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			c, err := Load("")
+			for _, p := range tc.problems {
+				if err == nil || !strings.Contains(err.Error(), p) {
+					t.Errorf("Load = %v, want it to report %q", err, p)
+				}
+			}
+			if len(tc.problems) == 0 && err != nil {
+				t.Fatalf("Load = %v", err)
+			}
+			if tc.check != nil && c != nil {
+				tc.check(t, c)
+			}
+		})
+	}
+}
+
+// TestLoadFile checks the config file is read and the environment wins over it.
+func TestLoadFile(t *testing.T) {
+	t.Setenv("APP_ENV", "dev")
+	t.Setenv("MONGO_DB", "from-env")
+	t.Setenv("MONGO_URI", "") // restored after the test
+	os.Unsetenv("MONGO_URI")
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"MONGO_URI": "mongodb://file:27017", "MONGO_DB": "from-file"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Mongo.URI != "mongodb://file:27017" || c.Mongo.DB != "from-env" || c.File != path {
+		t.Errorf("mongo %q/%q from %q; want the URI from the file and the DB from the environment", c.Mongo.URI, c.Mongo.DB, c.File)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Load of a missing config file succeeded")
+	}
+}
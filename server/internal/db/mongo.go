@@ -2,11 +2,15 @@ package db
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
-	"github.com/joho/godotenv"
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/metrics"
+	"leblanc/server/internal/tracing"
+
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -14,23 +18,57 @@ import (
 var Client *mongo.Client
 var DB *mongo.Database
 
-func Init() {
-	_ = godotenv.Load()
-
-	uri := os.Getenv("MONGO_URI")
-	name := os.Getenv("MONGO_DB")
+func Init(cfg config.MongoConfig) {
+	uri := cfg.URI
+	name := cfg.DB
 	// Keep connect attempt short to fail fast if Mongo is unreachable.
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cl, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	cl, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetMonitor(monitors(metrics.MongoMonitor(), tracing.MongoMonitor())))
 	if err != nil {
-		log.Fatal("Mongo connect error:", err)
+		slog.Error("mongo connect failed", "error", err)
+		os.Exit(1)
 	}
 	if err := cl.Ping(ctx, nil); err != nil {
-		log.Fatal("Mongo ping error:", err)
+		slog.Error("mongo ping failed", "error", err)
+		os.Exit(1)
 	}
 	Client = cl
 	DB = cl.Database(name)
-	log.Println("Mongo connected:", uri, "db:", name)
-}
\ No newline at end of file
+	slog.Info("mongo connected", "uri", config.RedactURI(uri), "db", name)
+}
+// Disconnect closes the client's connections, waiting for in-use ones until ctx expires.
+func Disconnect(ctx context.Context) error {
+	if Client == nil {
+		return nil
+	}
+	return Client.Disconnect(ctx)
+}
+
+// monitors fans driver events out to several monitors; the driver accepts only one.
+func monitors(ms ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range ms {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range ms {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range ms {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
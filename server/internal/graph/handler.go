@@ -3,10 +3,22 @@ package graph
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/metrics"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/payments"
+	"leblanc/server/internal/repository"
+	"leblanc/server/internal/services"
+	"leblanc/server/internal/tracing"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type GraphQLRequest struct {
@@ -16,28 +28,50 @@ type GraphQLRequest struct {
 }
 
 type GraphQLResponse struct {
-	Data   interface{} `json:"data,omitempty"`
-	Errors []string    `json:"errors,omitempty"`
+	Data   interface{}    `json:"data,omitempty"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLError follows the spec's error format; extensions.code is an apperr code.
+type GraphQLError struct {
+	Message    string            `json:"message"`
+	Path       []string          `json:"path,omitempty"`
+	Extensions apperr.Extensions `json:"extensions"`
+}
+
+// graphQLErrors reports err against the root field op, when it is known.
+func graphQLErrors(ctx context.Context, op string, err error) []GraphQLError {
+	msg, ext := apperr.GraphQL(ctx, err)
+	e := GraphQLError{Message: msg, Extensions: ext}
+	if operations[op] {
+		e.Path = []string{op}
+	}
+	return []GraphQLError{e}
 }
 
 // Handler creates a Gin handler for GraphQL
-func Handler() gin.HandlerFunc {
-	resolver := &Resolver{}
+func Handler(cfg *config.Config, repos repository.Repositories) gin.HandlerFunc {
+	resolver := NewResolver(cfg, repos)
 
 	return func(c *gin.Context) {
 		var req GraphQLRequest
-		if err := c.BindJSON(&req); err != nil {
+		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, GraphQLResponse{
-				Errors: []string{err.Error()},
+				Errors: graphQLErrors(c.Request.Context(), "", apperr.BadJSON(err)),
 			})
 			return
 		}
 
-		ctx := context.Background()
+		ctx := payments.WithClientIP(c.Request.Context(), c.ClientIP())
+		op := operationLabel(req.Query)
+		ctx, span := tracing.Start(ctx, "graphql "+op, attribute.String("graphql.operation.name", op))
+		start := time.Now()
 		result, err := executeQuery(ctx, resolver, req.Query, req.Variables)
+		metrics.ObserveGraphQL(op, err, time.Since(start))
+		tracing.End(span, err)
 		if err != nil {
 			c.JSON(http.StatusOK, GraphQLResponse{
-				Errors: []string{err.Error()},
+				Errors: graphQLErrors(ctx, op, err),
 			})
 			return
 		}
@@ -51,12 +85,46 @@ func executeQuery(ctx context.Context, resolver *Resolver, query string, variabl
 	// Basic routing based on the presence of operation names; responses are wrapped
 	// in a field keyed by the operation to match the GraphQL spec and frontend expectations.
 	if contains(query, "query") {
+		if contains(query, "loyalty") {
+			var args LoyaltyArgs
+			jsonData, _ := json.Marshal(variables)
+			_ = json.Unmarshal(jsonData, &args)
+			loyalty, err := resolver.Loyalty(ctx, args)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"loyalty": loyalty}, nil
+		}
+		if contains(query, "favorites") {
+			favorites, err := resolver.Favorites(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"favorites": favorites}, nil
+		}
+		if contains(query, "savedOrders") {
+			orders, err := resolver.SavedOrders(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"savedOrders": orders}, nil
+		}
 		if contains(query, "drink(") {
 			id, _ := variables["id"].(string)
 			drink, err := resolver.Drink(ctx, id)
 			if err != nil {
 				return nil, err
 			}
+			if contains(query, "reviews") {
+				var args ReviewsArgs
+				jsonData, _ := json.Marshal(variables)
+				_ = json.Unmarshal(jsonData, &args)
+				withReviews, err := resolver.WithReviews(ctx, []*models.Drink{drink}, args)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"drink": withReviews[0]}, nil
+			}
 			return map[string]interface{}{"drink": drink}, nil
 		}
 		if contains(query, "drinks") {
@@ -64,6 +132,16 @@ func executeQuery(ctx context.Context, resolver *Resolver, query string, variabl
 			if err != nil {
 				return nil, err
 			}
+			if contains(query, "reviews") {
+				var args ReviewsArgs
+				jsonData, _ := json.Marshal(variables)
+				_ = json.Unmarshal(jsonData, &args)
+				withReviews, err := resolver.WithReviews(ctx, drinks, args)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"drinks": withReviews}, nil
+			}
 			return map[string]interface{}{"drinks": drinks}, nil
 		}
 		if contains(query, "users") {
@@ -120,35 +198,115 @@ func executeQuery(ctx context.Context, resolver *Resolver, query string, variabl
 			}
 		}
 		if contains(query, "recommendFromFeatures") {
-			var emotionFit EmotionFitInput
-			if emotionData, ok := variables["emotionFit"].(map[string]interface{}); ok {
-				jsonData, _ := json.Marshal(emotionData)
-				_ = json.Unmarshal(jsonData, &emotionFit)
-			}
+			var args RecommendArgs
+			jsonData, _ := json.Marshal(variables)
+			_ = json.Unmarshal(jsonData, &args)
 
-			var caffeine, temp *string
-			var sweetness *int
-
-			if c, ok := variables["caffeine"].(string); ok {
-				caffeine = &c
+			scores, err := resolver.RecommendFromFeatures(ctx, args)
+			if err != nil {
+				return nil, err
 			}
-			if t, ok := variables["temp"].(string); ok {
-				temp = &t
+			return map[string]interface{}{"recommendFromFeatures": scores}, nil
+		}
+		if contains(query, "recommendForGroup") {
+			var input GroupRecoInput
+			if inputData, ok := variables["input"].(map[string]interface{}); ok {
+				jsonData, _ := json.Marshal(inputData)
+				_ = json.Unmarshal(jsonData, &input)
+				rec, err := resolver.RecommendForGroup(ctx, input)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"recommendForGroup": rec}, nil
 			}
-			if s, ok := variables["sweetness"].(float64); ok {
-				sInt := int(s)
-				sweetness = &sInt
+		}
+		if contains(query, "addFavorite") {
+			drinkID, _ := variables["drinkId"].(string)
+			favorites, err := resolver.AddFavorite(ctx, drinkID)
+			if err != nil {
+				return nil, err
 			}
-
-			scores, err := resolver.RecommendFromFeatures(ctx, emotionFit, caffeine, temp, sweetness)
+			return map[string]interface{}{"addFavorite": favorites}, nil
+		}
+		if contains(query, "removeFavorite") {
+			drinkID, _ := variables["drinkId"].(string)
+			favorites, err := resolver.RemoveFavorite(ctx, drinkID)
 			if err != nil {
 				return nil, err
 			}
-			return map[string]interface{}{"recommendFromFeatures": scores}, nil
+			return map[string]interface{}{"removeFavorite": favorites}, nil
+		}
+		if contains(query, "deleteSavedOrder") {
+			id, _ := variables["id"].(string)
+			ok, err := resolver.DeleteSavedOrder(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"deleteSavedOrder": ok}, nil
+		}
+		if contains(query, "saveOrder") {
+			var input SaveOrderInput
+			if inputData, ok := variables["input"].(map[string]interface{}); ok {
+				jsonData, _ := json.Marshal(inputData)
+				_ = json.Unmarshal(jsonData, &input)
+				order, err := resolver.SaveOrder(ctx, input)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"saveOrder": order}, nil
+			}
 		}
+		if contains(query, "reorder") {
+			var input services.ReorderRequest
+			if inputData, ok := variables["input"].(map[string]interface{}); ok {
+				jsonData, _ := json.Marshal(inputData)
+				_ = json.Unmarshal(jsonData, &input)
+				draft, err := resolver.Reorder(ctx, input)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"reorder": draft}, nil
+			}
+		}
+	}
+
+	return nil, apperr.New(apperr.InvalidArgument, "unsupported query")
+}
+
+// operations are the root fields executeQuery serves; they bound the metrics label.
+var operations = map[string]bool{
+	"drink": true, "drinks": true, "users": true, "bookings": true, "loyalty": true,
+	"createBooking": true, "register": true, "login": true,
+	"recommendFromFeatures": true, "recommendForGroup": true,
+	"favorites": true, "savedOrders": true, "addFavorite": true, "removeFavorite": true,
+	"saveOrder": true, "deleteSavedOrder": true, "reorder": true,
+}
+
+// operationLabel returns the first root field of query ("drinks", "createBooking", ...)
+// or "other". Client-chosen operation names are not used: they are unbounded.
+func operationLabel(query string) string {
+	i := strings.IndexByte(query, '{')
+	if i < 0 {
+		return "other"
 	}
+	name, rest := ident(strings.TrimLeftFunc(query[i+1:], unicode.IsSpace))
+	// "alias: field"
+	if after, ok := strings.CutPrefix(strings.TrimLeftFunc(rest, unicode.IsSpace), ":"); ok {
+		name, _ = ident(strings.TrimLeftFunc(after, unicode.IsSpace))
+	}
+	if operations[name] {
+		return name
+	}
+	return "other"
+}
 
-	return nil, fmt.Errorf("unsupported query")
+// ident splits a leading GraphQL name off s.
+func ident(s string) (name, rest string) {
+	n := strings.IndexFunc(s, func(r rune) bool { return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if n < 0 {
+		return s, ""
+	}
+	return s[:n], s[n:]
 }
 
 func contains(s, substr string) bool {
@@ -3,88 +3,169 @@ package graph
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
-	"leblanc/server/internal/db"
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/auth"
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/metrics"
 	"leblanc/server/internal/models"
+	"leblanc/server/internal/payments"
+	"leblanc/server/internal/repository"
 	"leblanc/server/internal/services"
+	"leblanc/server/internal/tracing"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type Resolver struct{}
+type Resolver struct {
+	repos     repository.Repositories
+	cafe      *services.Cafe
+	tokens    *services.Tokens
+	loyalty   *services.Loyalty
+	bookings  *services.Bookings
+	reviews   *services.Reviews
+	favorites *services.Favorites
+}
+
+func NewResolver(cfg *config.Config, repos repository.Repositories) *Resolver {
+	cafe := services.CafeFromConfig(cfg.Cafe, cfg.Weather)
+	loyalty := services.NewLoyalty(repos.Loyalty, cfg.Loyalty)
+	deposits := services.NewPayments(repos.Payments, payments.New(cfg.Payment, services.PaymentsKey(cfg.Tokens.Secret)), cfg.Payment)
+	bookings := services.NewBookings(repos, loyalty, services.NewPromotions(repos.Promotions, cafe.Location()), services.NewGiftCards(repos.GiftCards), deposits)
+	return &Resolver{
+		repos:     repos,
+		cafe:      cafe,
+		tokens:    services.NewTokens(cfg.Tokens),
+		loyalty:   loyalty,
+		bookings:  bookings,
+		reviews:   services.NewReviews(repos),
+		favorites: services.NewFavorites(repos, bookings, cafe),
+	}
+}
+
+// pointers turns a repository result into the pointer slices the executor returns.
+func pointers[T any](items []T) []*T {
+	out := make([]*T, len(items))
+	for i := range items {
+		out[i] = &items[i]
+	}
+	return out
+}
 
 // Query resolvers
 func (r *Resolver) Drinks(ctx context.Context) ([]*models.Drink, error) {
-	cur, err := db.DB.Collection("drinks").Find(ctx, bson.D{})
+	ctx, span := tracing.Start(ctx, "Resolver.Drinks")
+	defer span.End()
+	drinks, err := r.repos.Drinks.List(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer cur.Close(ctx)
-
-	var drinks []*models.Drink
-	if err := cur.All(ctx, &drinks); err != nil {
-		return nil, err
-	}
-	return drinks, nil
+	return pointers(drinks), nil
 }
 
 func (r *Resolver) Drink(ctx context.Context, id string) (*models.Drink, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.Drink")
+	defer span.End()
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid ID format")
+		return nil, apperr.Invalid("id", "is not a valid drink ID")
 	}
 
-	var drink models.Drink
-	err = db.DB.Collection("drinks").FindOne(ctx, bson.M{"_id": objID}).Decode(&drink)
-	if err != nil {
-		return nil, err
+	return r.repos.Drinks.Get(ctx, objID)
+}
+
+// ReviewsArgs are the arguments of Drink.reviews.
+type ReviewsArgs struct {
+	First int    `json:"first"`
+	After string `json:"after"`
+}
+
+// DrinkResult is a drink with the page of reviews the query asked for.
+type DrinkResult struct {
+	*models.Drink
+	Reviews *ReviewConnection `json:"reviews,omitempty"`
+}
+
+type ReviewConnection struct {
+	Edges    []ReviewEdge `json:"edges"`
+	PageInfo PageInfo     `json:"pageInfo"`
+	// TotalCount is every approved review of the drink.
+	TotalCount int `json:"totalCount"`
+}
+
+type ReviewEdge struct {
+	Cursor string              `json:"cursor"`
+	Node   models.PublicReview `json:"node"`
+}
+
+type PageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor,omitempty"`
+}
+
+// WithReviews adds each drink's first page of approved reviews.
+func (r *Resolver) WithReviews(ctx context.Context, drinks []*models.Drink, args ReviewsArgs) ([]*DrinkResult, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.WithReviews")
+	defer span.End()
+	out := make([]*DrinkResult, len(drinks))
+	for i, d := range drinks {
+		page, err := r.reviews.ForDrink(ctx, d.ID, args.First, args.After)
+		if err != nil {
+			return nil, err
+		}
+		conn := &ReviewConnection{
+			Edges:      make([]ReviewEdge, len(page.Reviews)),
+			PageInfo:   PageInfo{HasNextPage: page.Next != ""},
+			TotalCount: d.RatingCount,
+		}
+		for j, rv := range page.Reviews {
+			conn.Edges[j] = ReviewEdge{Cursor: rv.ID.Hex(), Node: rv}
+		}
+		if n := len(conn.Edges); n > 0 {
+			conn.PageInfo.EndCursor = conn.Edges[n-1].Cursor
+		}
+		out[i] = &DrinkResult{Drink: d, Reviews: conn}
 	}
-	return &drink, nil
+	return out, nil
 }
 
 func (r *Resolver) Users(ctx context.Context) ([]*models.User, error) {
-	cur, err := db.DB.Collection("users").Find(ctx, bson.D{})
+	ctx, span := tracing.Start(ctx, "Resolver.Users")
+	defer span.End()
+	users, err := r.repos.Users.List(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer cur.Close(ctx)
-
-	var users []*models.User
-	if err := cur.All(ctx, &users); err != nil {
-		return nil, err
-	}
-	return users, nil
+	return pointers(users), nil
 }
 
 func (r *Resolver) Bookings(ctx context.Context) ([]*models.Booking, error) {
-	cur, err := db.DB.Collection("bookings").Find(ctx, bson.D{})
+	ctx, span := tracing.Start(ctx, "Resolver.Bookings")
+	defer span.End()
+	bookings, err := r.repos.Bookings.List(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer cur.Close(ctx)
-
-	var bookings []*models.Booking
-	if err := cur.All(ctx, &bookings); err != nil {
-		return nil, err
-	}
-	return bookings, nil
+	return pointers(bookings), nil
 }
 
 // Mutation resolvers
 type CreateBookingInput struct {
-	Email   string             `json:"email"`
-	Name    string             `json:"name"`
-	Phone   string             `json:"phone"`
-	Time    string             `json:"time"`
-	Guests  int                `json:"guests"`
-	Items   []BookingItemInput `json:"items"`
-	Channel string             `json:"channel"`
+	Email     string             `json:"email"`
+	Name      string             `json:"name"`
+	Phone     string             `json:"phone"`
+	Time      string             `json:"time"`
+	Guests    int                `json:"guests"`
+	Items     []BookingItemInput `json:"items"`
+	Channel   string             `json:"channel"`
+	SessionID string             `json:"sessionId"`
+	services.BookingOptions
 }
 
 type BookingItemInput struct {
@@ -93,21 +174,13 @@ type BookingItemInput struct {
 	Options string `json:"options"`
 }
 
-func (r *Resolver) CreateBooking(ctx context.Context, input CreateBookingInput) (*models.Booking, error) {
-	timeVal, err := time.Parse(time.RFC3339, input.Time)
-	if err != nil {
-		return nil, fmt.Errorf("invalid time format")
-	}
-	email := strings.TrimSpace(input.Email)
-	if email == "" {
-		return nil, fmt.Errorf("email is required")
-	}
-
-	items := make([]models.BookingItem, len(input.Items))
-	for i, item := range input.Items {
+// bookingItems converts BookingItemInputs, whose options are a JSON object in a string.
+func bookingItems(input []BookingItemInput) ([]models.BookingItem, error) {
+	items := make([]models.BookingItem, len(input))
+	for i, item := range input {
 		drinkID, err := primitive.ObjectIDFromHex(item.DrinkID)
 		if err != nil {
-			return nil, fmt.Errorf("invalid drink ID format")
+			return nil, apperr.Invalid(fmt.Sprintf("input.items[%d].drinkId", i), "is not a valid drink ID")
 		}
 
 		var options map[string]any
@@ -125,23 +198,39 @@ func (r *Resolver) CreateBooking(ctx context.Context, input CreateBookingInput)
 			Options: options,
 		}
 	}
+	return items, nil
+}
 
-	booking := models.Booking{
-		ID:      primitive.NewObjectID(),
-		Email:   email,
-		Name:    input.Name,
-		Phone:   input.Phone,
-		Time:    timeVal,
-		Guests:  input.Guests,
-		Items:   items,
-		Channel: input.Channel,
+func (r *Resolver) CreateBooking(ctx context.Context, input CreateBookingInput) (*models.Booking, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.CreateBooking")
+	defer span.End()
+	timeVal, err := time.Parse(time.RFC3339, input.Time)
+	if err != nil {
+		return nil, apperr.Invalid("input.time", "must be an RFC 3339 timestamp")
 	}
 
-	_, err = db.DB.Collection("bookings").InsertOne(ctx, booking)
+	items, err := bookingItems(input.Items)
 	if err != nil {
 		return nil, err
 	}
 
+	booking := models.Booking{
+		Email:     input.Email,
+		Name:      input.Name,
+		Phone:     input.Phone,
+		Time:      timeVal,
+		Guests:    input.Guests,
+		Items:     items,
+		Channel:   input.Channel,
+		SessionID: input.SessionID,
+	}
+	if id, ok := auth.FromContext(ctx); ok {
+		booking.UserID = &id.UserID
+	}
+
+	if err := r.bookings.Place(ctx, &booking, input.BookingOptions); err != nil {
+		return nil, err
+	}
 	return &booking, nil
 }
 
@@ -156,42 +245,43 @@ type LoginInput struct {
 	Password string `json:"password"`
 }
 
+var errUserExists = apperr.New(apperr.AlreadyExists, "user already exists")
+
 type AuthResponse struct {
 	Ok   bool         `json:"ok"`
 	User *models.User `json:"user"`
+	// Token is the bearer session token; only login sets it.
+	Token     string     `json:"token,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
 func (r *Resolver) Register(ctx context.Context, input RegisterInput) (*AuthResponse, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.Register")
+	defer span.End()
 	name := strings.TrimSpace(input.Name)
 	email := strings.TrimSpace(input.Email)
 	password := strings.TrimSpace(input.Password)
 
 	if name == "" || email == "" || password == "" {
-		return nil, fmt.Errorf("name, email and password are required")
+		return nil, apperr.New(apperr.InvalidArgument, "name, email and password are required")
 	}
 
-	coll := db.DB.Collection("users")
 	lowerName := strings.ToLower(name)
 	lowerEmail := strings.ToLower(email)
 
 	// Check if user exists
-	filter := bson.M{"$or": []bson.M{
-		{"nameLower": lowerName},
-		{"emailLower": lowerEmail},
-	}}
-	if err := coll.FindOne(ctx, filter).Err(); err == nil {
-		return nil, fmt.Errorf("user already exists")
-	} else if err != mongo.ErrNoDocuments {
+	if _, err := r.repos.Users.FindByNameOrEmail(ctx, name, email); err == nil {
+		return nil, errUserExists
+	} else if !errors.Is(err, repository.ErrNotFound) {
 		return nil, err
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, fmt.Errorf("could not hash password")
+		return nil, fmt.Errorf("hash password: %w", err)
 	}
 
 	user := models.User{
-		ID:           primitive.NewObjectID(),
 		Name:         name,
 		NameLower:    lowerName,
 		Email:        email,
@@ -200,42 +290,164 @@ func (r *Resolver) Register(ctx context.Context, input RegisterInput) (*AuthResp
 		CreatedAt:    time.Now(),
 	}
 
-	if _, err := coll.InsertOne(ctx, user); err != nil {
+	if err := r.repos.Users.Insert(ctx, &user); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, errUserExists
+		}
 		return nil, err
 	}
+	metrics.Registered()
 
 	return &AuthResponse{Ok: true, User: &user}, nil
 }
 
 func (r *Resolver) Login(ctx context.Context, input LoginInput) (*AuthResponse, error) {
-	nameOrEmail := strings.TrimSpace(input.Name)
-	password := strings.TrimSpace(input.Password)
+	ctx, span := tracing.Start(ctx, "Resolver.Login")
+	defer span.End()
+	user, err := services.Authenticate(ctx, r.repos.Users, input.Name, input.Password)
+	if err != nil {
+		return nil, err
+	}
+	token, expiresAt := r.tokens.GenerateSessionToken(services.Session{UserID: user.ID.Hex(), Role: user.Role})
+	return &AuthResponse{Ok: true, User: user, Token: token, ExpiresAt: &expiresAt}, nil
+}
+
+type LoyaltyArgs struct {
+	HistoryLimit int `json:"historyLimit"`
+}
+
+// LoyaltyResult is the logged-in user's balance with their newest ledger entries.
+type LoyaltyResult struct {
+	*services.LoyaltySummary
+	History []models.LoyaltyEntry `json:"history"`
+}
 
-	if nameOrEmail == "" || password == "" {
-		return nil, fmt.Errorf("name and password are required")
+func (r *Resolver) Loyalty(ctx context.Context, args LoyaltyArgs) (*LoyaltyResult, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.Loyalty")
+	defer span.End()
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, apperr.New(apperr.Unauthenticated, "log in to continue")
 	}
+	summary, err := r.loyalty.Summary(ctx, id.UserID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := r.loyalty.History(ctx, id.UserID, args.HistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &LoyaltyResult{LoyaltySummary: summary, History: history}, nil
+}
+
+// user is the logged-in user's ID, for resolvers that need a session.
+func user(ctx context.Context) (primitive.ObjectID, error) {
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return primitive.NilObjectID, apperr.New(apperr.Unauthenticated, "log in to continue")
+	}
+	return id.UserID, nil
+}
 
-	coll := db.DB.Collection("users")
-	lower := strings.ToLower(nameOrEmail)
+func (r *Resolver) Favorites(ctx context.Context) ([]models.Drink, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.Favorites")
+	defer span.End()
+	userID, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.favorites.List(ctx, userID)
+}
+
+func (r *Resolver) AddFavorite(ctx context.Context, drinkID string) ([]models.Drink, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.AddFavorite")
+	defer span.End()
+	userID, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := primitive.ObjectIDFromHex(drinkID)
+	if err != nil {
+		return nil, apperr.Invalid("drinkId", "is not a valid drink ID")
+	}
+	return r.favorites.Add(ctx, userID, id)
+}
 
-	filter := bson.M{"$or": []bson.M{
-		{"nameLower": lower},
-		{"emailLower": lower},
-	}}
+func (r *Resolver) RemoveFavorite(ctx context.Context, drinkID string) ([]models.Drink, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.RemoveFavorite")
+	defer span.End()
+	userID, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := primitive.ObjectIDFromHex(drinkID)
+	if err != nil {
+		return nil, apperr.Invalid("drinkId", "is not a valid drink ID")
+	}
+	return r.favorites.Remove(ctx, userID, id)
+}
 
-	var user models.User
-	if err := coll.FindOne(ctx, filter).Decode(&user); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("user not found")
+func (r *Resolver) SavedOrders(ctx context.Context) ([]models.SavedOrder, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.SavedOrders")
+	defer span.End()
+	userID, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.favorites.SavedOrders(ctx, userID)
+}
+
+// SaveOrderInput creates a saved order, or updates the one with ID.
+type SaveOrderInput struct {
+	ID    string             `json:"id"`
+	Name  string             `json:"name"`
+	Items []BookingItemInput `json:"items"`
+}
+
+func (r *Resolver) SaveOrder(ctx context.Context, input SaveOrderInput) (*models.SavedOrder, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.SaveOrder")
+	defer span.End()
+	userID, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o := models.SavedOrder{Name: input.Name}
+	if input.ID != "" {
+		if o.ID, err = primitive.ObjectIDFromHex(input.ID); err != nil {
+			return nil, apperr.Invalid("input.id", "is not a valid saved order ID")
 		}
+	}
+	if o.Items, err = bookingItems(input.Items); err != nil {
 		return nil, err
 	}
+	return r.favorites.SaveOrder(ctx, userID, o)
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, fmt.Errorf("invalid password")
+func (r *Resolver) DeleteSavedOrder(ctx context.Context, id string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.DeleteSavedOrder")
+	defer span.End()
+	userID, err := user(ctx)
+	if err != nil {
+		return false, err
+	}
+	orderID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, apperr.Invalid("id", "is not a valid saved order ID")
 	}
+	if err := r.favorites.DeleteOrder(ctx, userID, orderID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	return &AuthResponse{Ok: true, User: &user}, nil
+func (r *Resolver) Reorder(ctx context.Context, input services.ReorderRequest) (*services.Draft, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.Reorder")
+	defer span.End()
+	userID, err := user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.favorites.Reorder(ctx, userID, input)
 }
 
 type EmotionFitInput struct {
@@ -251,52 +463,292 @@ type RecommendationScore struct {
 	Score   float64 `json:"score"`
 }
 
-func (r *Resolver) RecommendFromFeatures(ctx context.Context, emotionFit EmotionFitInput, caffeine *string, temp *string, sweetness *int) ([]*RecommendationScore, error) {
-	// Get all drinks
-	cur, err := db.DB.Collection("drinks").Find(ctx, bson.D{})
+type ConstraintExclusion struct {
+	Constraint string `json:"constraint"`
+	Count      int    `json:"count"`
+}
+
+// RecommendationResult wraps the ranked drinks with an explanation when
+// hard constraints left fewer than were requested.
+type RecommendationResult struct {
+	Items     []*RecommendationScore `json:"items"`
+	Requested int                    `json:"requested"`
+	Notice    string                 `json:"notice,omitempty"`
+	Excluded  []ConstraintExclusion  `json:"excluded"`
+	// set when the request was bucketed into an A/B experiment
+	Experiment *services.Exposure `json:"experiment,omitempty"`
+	// what was understood from the free-text mood, if one was given
+	Mood *services.MoodHints `json:"mood,omitempty"`
+}
+
+// RecommendArgs mirrors the arguments of the recommendFromFeatures mutation.
+type RecommendArgs struct {
+	EmotionFit       *EmotionFitInput `json:"emotionFit"`
+	Mood             *string          `json:"mood"`
+	Caffeine         *string          `json:"caffeine"`
+	Temp             *string          `json:"temp"`
+	Sweetness        *int             `json:"sweetness"`
+	Limit            *int             `json:"limit"`
+	Diversity        *float64         `json:"diversity"`
+	ExcludeBookingID *string          `json:"excludeBookingId"`
+	BookingTime      *string          `json:"bookingTime"`
+
+	Constraints *services.Constraints `json:"constraints"`
+
+	Email     *string `json:"email"`
+	SessionID *string `json:"sessionId"`
+}
+
+func (r *Resolver) RecommendFromFeatures(ctx context.Context, args RecommendArgs) (*RecommendationResult, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.RecommendFromFeatures")
+	defer span.End()
+	defer metrics.ObserveRecommendation(metrics.RecoSingle, time.Now())
+	var constraints services.Constraints
+	if args.Constraints != nil {
+		constraints = *args.Constraints
+	}
+	if err := constraints.Validate(); err != nil {
+		return nil, err
+	}
+
+	var limit int
+	var excludeBookingID string
+	if args.Limit != nil {
+		limit = *args.Limit
+	}
+	if args.ExcludeBookingID != nil {
+		excludeBookingID = *args.ExcludeBookingID
+	}
+	recoCtx := services.Context{}
+	if args.BookingTime != nil && *args.BookingTime != "" {
+		t, err := time.Parse(time.RFC3339, *args.BookingTime)
+		if err != nil {
+			return nil, apperr.Invalid("bookingTime", "must be an RFC 3339 timestamp")
+		}
+		recoCtx.BookingTime = &t
+	}
+
+	// A free-text mood fills in whatever the explicit arguments leave out
+	var mood *services.MoodHints
+	if args.Mood != nil && strings.TrimSpace(*args.Mood) != "" {
+		hints := services.ParseMood(*args.Mood)
+		mood = &hints
+	}
+	if args.EmotionFit == nil && mood == nil {
+		return nil, apperr.New(apperr.InvalidArgument, "emotionFit or mood is required")
+	}
+	if args.Temp == nil && mood != nil && mood.TempPref != "" {
+		recoCtx.TempPref = &mood.TempPref
+	}
+
+	who, _ := auth.FromContext(ctx)
+	exclude, err := r.bookings.BookedDrinkIDs(ctx, who.UserID, excludeBookingID)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := services.NewRerankOptions(limit, args.Diversity, exclude)
 	if err != nil {
 		return nil, err
 	}
-	defer cur.Close(ctx)
 
-	var drinks []models.Drink
-	if err := cur.All(ctx, &drinks); err != nil {
+	// Only suggest what is on the menu at the booking time and within the constraints
+	drinks, recoCtx, report, err := r.cafe.RecoCandidates(ctx, r.repos.Drinks, recoCtx, constraints)
+	if err != nil {
 		return nil, err
 	}
 
 	// Convert input to models.EmotionFit
-	emotionFitModel := models.EmotionFit{
-		Calm:        emotionFit.Calm,
-		Happy:       emotionFit.Happy,
-		Stressed:    emotionFit.Stressed,
-		Sad:         emotionFit.Sad,
-		Adventurous: emotionFit.Adventurous,
+	var emotionFitModel models.EmotionFit
+	if args.EmotionFit != nil {
+		emotionFitModel = models.EmotionFit{
+			Calm:        args.EmotionFit.Calm,
+			Happy:       args.EmotionFit.Happy,
+			Stressed:    args.EmotionFit.Stressed,
+			Sad:         args.EmotionFit.Sad,
+			Adventurous: args.EmotionFit.Adventurous,
+		}
+	} else {
+		emotionFitModel = mood.EmotionFit
 	}
 
 	var caffeineVal, tempVal string
 	var sweetnessVal int
 
-	if caffeine != nil {
-		caffeineVal = *caffeine
+	if args.Caffeine != nil {
+		caffeineVal = *args.Caffeine
+	}
+	if args.Temp != nil {
+		tempVal = *args.Temp
+	} else if recoCtx.TempPref != nil {
+		tempVal = *recoCtx.TempPref
+	}
+	if args.Sweetness != nil {
+		sweetnessVal = *args.Sweetness
+	} else if mood != nil {
+		sweetnessVal = mood.Sweetness
+	}
+
+	var email, sessionID string
+	if args.Email != nil {
+		email = *args.Email
 	}
-	if temp != nil {
-		tempVal = *temp
+	if args.SessionID != nil {
+		sessionID = *args.SessionID
 	}
-	if sweetness != nil {
-		sweetnessVal = *sweetness
+	query := services.RecoQuery{
+		EmotionFit:  &emotionFitModel,
+		Caffeine:    caffeineVal,
+		Temp:        tempVal,
+		Sweetness:   sweetnessVal,
+		TimeOfDay:   recoCtx.TimeOfDay,
+		Constraints: constraints,
 	}
 
-	// Score each drink
-	scores := services.ScoreDrinks(drinks, emotionFitModel, caffeineVal, tempVal, sweetnessVal)
+	// Score each drink with the scorer the active experiment assigns, then pick a varied top-N
+	var userID *primitive.ObjectID
+	if who, ok := auth.FromContext(ctx); ok {
+		userID = &who.UserID
+	}
+	scorer, exposure := services.AssignScorer(ctx, r.repos.Experiments, services.ExperimentUnit(userID, sessionID),
+		services.ScorerConfig{Name: "default", Scorer: services.ScorerCosine})
+	if scorer.Diversity != nil {
+		opts.Diversity = *scorer.Diversity
+	}
+	scores := services.RerankDiverse(drinks, scorer.Score(drinks, query), opts)
+
+	event := services.RecoEvent{
+		Email:     email,
+		SessionID: sessionID,
+		UserID:    userID,
+		Endpoint:  "graphql",
+		Scorer:    scorer.Scorer,
+		Query:     query,
+		DrinkIDs:  services.ScoreIDs(scores),
+		Exposure:  exposure,
+	}
+	services.LogRecoEvent(ctx, r.repos.RecoEvents, event)
 
 	// Convert to response format
-	result := make([]*RecommendationScore, len(scores))
+	items := make([]*RecommendationScore, len(scores))
 	for i, score := range scores {
-		result[i] = &RecommendationScore{
+		items[i] = &RecommendationScore{
 			DrinkID: score.DrinkID,
 			Score:   score.Score,
 		}
 	}
 
-	return result, nil
+	return &RecommendationResult{
+		Items:      items,
+		Requested:  opts.Limit,
+		Notice:     services.ShortfallNotice(opts.Limit, len(items), report),
+		Excluded:   constraintExclusions(report),
+		Experiment: exposure,
+		Mood:       mood,
+	}, nil
+}
+
+type GuestProfileInput struct {
+	Name       string          `json:"name"`
+	EmotionFit EmotionFitInput `json:"emotionFit"`
+	Caffeine   string          `json:"caffeine"`
+	Temp       string          `json:"temp"`
+	Sweetness  int             `json:"sweetness"`
+}
+
+type GroupRecoInput struct {
+	Guests           []GuestProfileInput   `json:"guests"`
+	Strategy         string                `json:"strategy"`
+	Limit            int                   `json:"limit"`
+	Diversity        *float64              `json:"diversity"`
+	ExcludeBookingID string                `json:"excludeBookingId"`
+	BookingTime      string                `json:"bookingTime"`
+	Constraints      *services.Constraints `json:"constraints"`
+}
+
+// GroupRecommendationResult is a group set with the same shortfall explanation as RecommendationResult.
+type GroupRecommendationResult struct {
+	*services.GroupRecommendation
+	Requested int                   `json:"requested"`
+	Notice    string                `json:"notice,omitempty"`
+	Excluded  []ConstraintExclusion `json:"excluded"`
+}
+
+func (r *Resolver) RecommendForGroup(ctx context.Context, input GroupRecoInput) (*GroupRecommendationResult, error) {
+	ctx, span := tracing.Start(ctx, "Resolver.RecommendForGroup")
+	defer span.End()
+	defer metrics.ObserveRecommendation(metrics.RecoGroup, time.Now())
+	var constraints services.Constraints
+	if input.Constraints != nil {
+		constraints = *input.Constraints
+	}
+	if err := constraints.Validate(); err != nil {
+		return nil, err
+	}
+
+	recoCtx := services.Context{}
+	if input.BookingTime != "" {
+		t, err := time.Parse(time.RFC3339, input.BookingTime)
+		if err != nil {
+			return nil, apperr.Invalid("input.bookingTime", "must be an RFC 3339 timestamp")
+		}
+		recoCtx.BookingTime = &t
+	}
+	who, _ := auth.FromContext(ctx)
+	exclude, err := r.bookings.BookedDrinkIDs(ctx, who.UserID, input.ExcludeBookingID)
+	if err != nil {
+		return nil, err
+	}
+	limit := input.Limit
+	if limit <= 0 {
+		limit = len(input.Guests)
+	}
+	opts, err := services.NewRerankOptions(limit, input.Diversity, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	drinks, recoCtx, report, err := r.cafe.RecoCandidates(ctx, r.repos.Drinks, recoCtx, constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	guests := make([]services.GuestProfile, len(input.Guests))
+	for i, g := range input.Guests {
+		guests[i] = services.GuestProfile{
+			Name: g.Name,
+			EmotionFit: models.EmotionFit{
+				Calm:        g.EmotionFit.Calm,
+				Happy:       g.EmotionFit.Happy,
+				Stressed:    g.EmotionFit.Stressed,
+				Sad:         g.EmotionFit.Sad,
+				Adventurous: g.EmotionFit.Adventurous,
+			},
+			Caffeine:  g.Caffeine,
+			Temp:      g.Temp,
+			Sweetness: g.Sweetness,
+		}
+		if guests[i].Temp == "" && recoCtx.TempPref != nil {
+			guests[i].Temp = *recoCtx.TempPref
+		}
+	}
+
+	rec, err := services.RecommendForGroup(drinks, guests, input.Strategy, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &GroupRecommendationResult{
+		GroupRecommendation: rec,
+		Requested:           opts.Limit,
+		Notice:              services.ShortfallNotice(opts.Limit, len(rec.Drinks), report),
+		Excluded:            constraintExclusions(report),
+	}, nil
+}
+
+func constraintExclusions(report services.ConstraintReport) []ConstraintExclusion {
+	excluded := make([]ConstraintExclusion, 0, len(report))
+	for name, count := range report {
+		excluded = append(excluded, ConstraintExclusion{Constraint: name, Count: count})
+	}
+	sort.Slice(excluded, func(i, j int) bool { return excluded[i].Constraint < excluded[j].Constraint })
+	return excluded
 }
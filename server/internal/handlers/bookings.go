@@ -3,32 +3,85 @@ package handlers
 import (
 	"context"
 	"net/http"
-	"strings"
 	"time"
 
-	"leblanc/server/internal/db"
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/auth"
 	"leblanc/server/internal/models"
+	"leblanc/server/internal/payments"
+	"leblanc/server/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func CreateBooking(c *gin.Context) {
-	var b models.Booking
-	if err := c.BindJSON(&b); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+type bookingRequest struct {
+	models.Booking
+	services.BookingOptions
+}
+
+func (h *Handler) CreateBooking(c *gin.Context) {
+	var req bookingRequest
+	if !bind(c, &req) {
 		return
 	}
-	b.Email = strings.TrimSpace(b.Email)
-	if b.Email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+	b := req.Booking
+	// amounts, status and owner are set by the server, never taken from the body
+	b.ID, b.UserID = primitive.NilObjectID, nil
+	if id, ok := auth.FromContext(c.Request.Context()); ok {
+		b.UserID = &id.UserID
+	}
+	ctx, cancel := context.WithTimeout(payments.WithClientIP(c.Request.Context(), c.ClientIP()), 5*time.Second)
+	defer cancel()
+	if err := h.bookings.Place(ctx, &b, req.BookingOptions); err != nil {
+		apperr.Write(c, err)
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	c.JSON(http.StatusOK, gin.H{
+		"ok":              true,
+		"id":              b.ID,
+		"subtotal":        b.Subtotal,
+		"discount":        b.Discount,
+		"total":           b.Total,
+		"promotions":      b.Promotions,
+		"redemption":      b.Redemption,
+		"amountDue":       b.AmountDue,
+		"giftCardPayment": b.GiftCardPayment,
+		"deposit":         b.Deposit,
+	})
+}
+
+type bookingStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// SetBookingStatus completes or cancels a pending booking (admin only). Completing earns
+// loyalty points; cancelling refunds what the booking redeemed.
+func (h *Handler) SetBookingStatus(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		apperr.Write(c, apperr.Invalid("id", "is not a valid booking ID"))
+		return
+	}
+	var req bookingStatusRequest
+	if !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
-	res, err := db.DB.Collection("bookings").InsertOne(ctx, b)
+
+	var b *models.Booking
+	switch req.Status {
+	case models.BookingCompleted:
+		b, err = h.bookings.Complete(ctx, id)
+	case models.BookingCancelled:
+		b, err = h.bookings.Cancel(ctx, id)
+	default:
+		err = apperr.Invalid("status", "must be completed or cancelled")
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apperr.Write(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"ok": true, "id": res.InsertedID})
+	c.JSON(http.StatusOK, b)
 }
@@ -5,23 +5,16 @@ import (
 	"net/http"
 	"time"
 
-	"leblanc/server/internal/db"
-	"leblanc/server/internal/models"
+	"leblanc/server/internal/apperr"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
-func GetDrinks(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (h *Handler) GetDrinks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	cur, err := db.DB.Collection("drinks").Find(ctx, bson.D{})
-	if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return }
-
-	var list []models.Drink
-	if err := cur.All(ctx, &list); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
-	}
+	list, err := h.repos.Drinks.List(ctx)
+	if err != nil { apperr.Write(c, err); return }
 	c.JSON(http.StatusOK, list)
 }
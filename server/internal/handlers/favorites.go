@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/auth"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListFavorites returns the user's favorite drinks in the order they were added.
+func (h *Handler) ListFavorites(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	drinks, err := h.favorites.List(ctx, who.UserID)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, drinks)
+}
+
+// AddFavorite adds a drink to the user's favorites and returns them all.
+func (h *Handler) AddFavorite(c *gin.Context) {
+	id, ok := objectID(c, "is not a valid drink ID")
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	drinks, err := h.favorites.Add(ctx, who.UserID, id)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, drinks)
+}
+
+// RemoveFavorite drops a drink from the user's favorites and returns the rest.
+func (h *Handler) RemoveFavorite(c *gin.Context) {
+	id, ok := objectID(c, "is not a valid drink ID")
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	drinks, err := h.favorites.Remove(ctx, who.UserID, id)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, drinks)
+}
+
+// ListSavedOrders returns the user's saved orders.
+func (h *Handler) ListSavedOrders(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	orders, err := h.favorites.SavedOrders(ctx, who.UserID)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+type saveOrderRequest struct {
+	Name  string               `json:"name"`
+	Items []models.BookingItem `json:"items"`
+}
+
+// CreateSavedOrder saves a named order for the user.
+func (h *Handler) CreateSavedOrder(c *gin.Context) {
+	var req saveOrderRequest
+	if !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	o, err := h.favorites.SaveOrder(ctx, who.UserID, models.SavedOrder{Name: req.Name, Items: req.Items})
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, o)
+}
+
+// UpdateSavedOrder renames a saved order or replaces its items.
+func (h *Handler) UpdateSavedOrder(c *gin.Context) {
+	id, ok := objectID(c, "is not a valid saved order ID")
+	if !ok {
+		return
+	}
+	var req saveOrderRequest
+	if !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	o, err := h.favorites.SaveOrder(ctx, who.UserID, models.SavedOrder{ID: id, Name: req.Name, Items: req.Items})
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// DeleteSavedOrder removes one of the user's saved orders.
+func (h *Handler) DeleteSavedOrder(c *gin.Context) {
+	id, ok := objectID(c, "is not a valid saved order ID")
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	if err := h.favorites.DeleteOrder(ctx, who.UserID, id); err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// Reorder drafts a new booking from one of the user's bookings or saved orders, priced
+// as the menu is now. The client places the draft with POST /bookings.
+func (h *Handler) Reorder(c *gin.Context) {
+	var req services.ReorderRequest
+	if !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	draft, err := h.favorites.Reorder(ctx, who.UserID, req)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, draft)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/repository"
+	"leblanc/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errGiftCardNotFound = apperr.New(apperr.NotFound, "gift card not found")
+
+// ListGiftCards returns every gift card, newest first (admin only).
+func (h *Handler) ListGiftCards(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	cards, err := h.repos.GiftCards.List(ctx)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cards)
+}
+
+// IssueGiftCards creates gift cards with the same value (admin only).
+func (h *Handler) IssueGiftCards(c *gin.Context) {
+	var req services.IssueRequest
+	if !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	cards, err := h.giftCards.Issue(ctx, req)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"giftCards": cards})
+}
+
+// GetGiftCard returns a card and its ledger, newest first (admin only).
+func (h *Handler) GetGiftCard(c *gin.Context) {
+	id, ok := giftCardID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	card, err := h.repos.GiftCards.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		err = errGiftCardNotFound
+	}
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	history, err := h.repos.GiftCards.History(ctx, id)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"giftCard": card, "history": history})
+}
+
+// VoidGiftCard writes off a card's balance (admin only).
+func (h *Handler) VoidGiftCard(c *gin.Context) {
+	id, ok := giftCardID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	card, err := h.giftCards.Void(ctx, id)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, card)
+}
+
+type giftCardBalanceRequest struct {
+	Code string `json:"code"`
+}
+
+// GiftCardBalance lets a holder check a card by its code. The code travels in the body
+// so it stays out of access logs.
+func (h *Handler) GiftCardBalance(c *gin.Context) {
+	var req giftCardBalanceRequest
+	if !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	card, err := h.giftCards.Balance(ctx, req.Code)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":      services.MaskGiftCard(card.Code),
+		"balance":   card.Balance,
+		"status":    card.Status,
+		"expiresAt": card.ExpiresAt,
+	})
+}
+
+func giftCardID(c *gin.Context) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		apperr.Write(c, apperr.Invalid("id", "is not a valid gift card ID"))
+		return id, false
+	}
+	return id, true
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/mailer"
+	"leblanc/server/internal/payments"
+	"leblanc/server/internal/repository"
+	"leblanc/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the REST endpoints on top of the repositories it is given.
+type Handler struct {
+	cfg        *config.Config
+	repos      repository.Repositories
+	cafe       *services.Cafe
+	tokens     *services.Tokens
+	loyalty    *services.Loyalty
+	promotions *services.Promotions
+	giftCards  *services.GiftCards
+	payments   *services.Payments
+	bookings   *services.Bookings
+	invoices   *services.Invoices
+	reviews    *services.Reviews
+	favorites  *services.Favorites
+}
+
+func New(cfg *config.Config, repos repository.Repositories) *Handler {
+	cafe := services.CafeFromConfig(cfg.Cafe, cfg.Weather)
+	loyalty := services.NewLoyalty(repos.Loyalty, cfg.Loyalty)
+	promotions := services.NewPromotions(repos.Promotions, cafe.Location())
+	giftCards := services.NewGiftCards(repos.GiftCards)
+	deposits := services.NewPayments(repos.Payments, payments.New(cfg.Payment, services.PaymentsKey(cfg.Tokens.Secret)), cfg.Payment)
+	bookings := services.NewBookings(repos, loyalty, promotions, giftCards, deposits)
+	return &Handler{
+		cfg:        cfg,
+		repos:      repos,
+		cafe:       cafe,
+		tokens:     services.NewTokens(cfg.Tokens),
+		loyalty:    loyalty,
+		promotions: promotions,
+		giftCards:  giftCards,
+		payments:   deposits,
+		bookings:   bookings,
+		invoices:   services.NewInvoices(repos, cfg.Invoice, mailer.New(cfg.Mail, cfg.IsDev()), cafe.Location()),
+		reviews:    services.NewReviews(repos),
+		favorites:  services.NewFavorites(repos, bookings, cafe),
+	}
+}
+
+// bind decodes the JSON body into v and answers 400 itself when it cannot.
+func bind(c *gin.Context, v any) bool {
+	if err := c.ShouldBindJSON(v); err != nil {
+		apperr.Write(c, apperr.BadJSON(err))
+		return false
+	}
+	return true
+}
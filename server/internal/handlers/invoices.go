@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/auth"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+	"leblanc/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	errBookingNotFound = apperr.New(apperr.NotFound, "booking not found")
+	errInvoiceNotFound = apperr.New(apperr.NotFound, "invoice not found")
+)
+
+// IssueInvoice returns the receipt or VAT invoice of a completed booking, issuing it on
+// first request. Admins and the guest who booked may ask.
+func (h *Handler) IssueInvoice(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		apperr.Write(c, apperr.Invalid("id", "is not a valid booking ID"))
+		return
+	}
+	var req services.InvoiceRequest
+	if c.Request.ContentLength != 0 && !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	b, err := h.ownBooking(ctx, id)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	inv, err := h.invoices.Issue(ctx, b, req)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, inv)
+}
+
+// DownloadInvoice serves an invoice as ?format=pdf (the default), text or json.
+func (h *Handler) DownloadInvoice(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	inv, ok := h.ownInvoice(ctx, c)
+	if !ok {
+		return
+	}
+	attachment := func(ext string) {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": inv.Code + ext}))
+	}
+	switch c.DefaultQuery("format", "pdf") {
+	case "pdf":
+		attachment(".pdf")
+		c.Data(http.StatusOK, "application/pdf", h.invoices.PDF(inv))
+	case "text":
+		attachment(".txt")
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(h.invoices.Text(inv)))
+	case "json":
+		c.JSON(http.StatusOK, inv)
+	default:
+		apperr.Write(c, apperr.Invalid("format", "must be pdf, text or json"))
+	}
+}
+
+type emailInvoiceRequest struct {
+	// To is for admins; guests get the invoice at the company or booking email.
+	To string `json:"to"`
+}
+
+// EmailInvoice sends an invoice with its PDF attached.
+func (h *Handler) EmailInvoice(c *gin.Context) {
+	var req emailInvoiceRequest
+	if c.Request.ContentLength != 0 && !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
+	inv, ok := h.ownInvoice(ctx, c)
+	if !ok {
+		return
+	}
+	if id, _ := auth.FromContext(ctx); req.To != "" && id.Role != auth.RoleAdmin {
+		apperr.Write(c, apperr.New(apperr.PermissionDenied, "only admins can choose the recipient"))
+		return
+	}
+	to, err := h.invoices.Email(ctx, inv, req.To)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "to": to})
+}
+
+// ListInvoices returns every invoice, newest first (admin only).
+func (h *Handler) ListInvoices(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	list, err := h.repos.Invoices.List(ctx)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// ownBooking loads a booking the caller may see invoices for. Other people's bookings
+// are reported missing rather than forbidden, so IDs cannot be probed.
+func (h *Handler) ownBooking(ctx context.Context, id primitive.ObjectID) (*models.Booking, error) {
+	b, err := h.repos.Bookings.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errBookingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	who, _ := auth.FromContext(ctx)
+	if who.Role == auth.RoleAdmin {
+		return b, nil
+	}
+	if !h.bookings.BelongsTo(b, who.UserID) {
+		return nil, errBookingNotFound
+	}
+	return b, nil
+}
+
+// ownInvoice loads the :id invoice if the caller may see its booking, answering itself
+// when not.
+func (h *Handler) ownInvoice(ctx context.Context, c *gin.Context) (*models.Invoice, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		apperr.Write(c, apperr.Invalid("id", "is not a valid invoice ID"))
+		return nil, false
+	}
+	inv, err := h.repos.Invoices.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		err = errInvoiceNotFound
+	}
+	if err == nil {
+		_, err = h.ownBooking(ctx, inv.BookingID)
+	}
+	if errors.Is(err, errBookingNotFound) {
+		err = errInvoiceNotFound
+	}
+	if err != nil {
+		apperr.Write(c, err)
+		return nil, false
+	}
+	return inv, true
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLoyalty returns the logged-in user's points and stamp cards.
+func (h *Handler) GetLoyalty(c *gin.Context) {
+	id, _ := auth.FromContext(c.Request.Context())
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	summary, err := h.loyalty.Summary(ctx, id.UserID)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetLoyaltyHistory returns the logged-in user's ledger, newest first (?limit=, max 100).
+func (h *Handler) GetLoyaltyHistory(c *gin.Context) {
+	id, _ := auth.FromContext(c.Request.Context())
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			apperr.Write(c, apperr.Invalid("limit", "must be a positive integer"))
+			return
+		}
+		limit = n
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	entries, err := h.loyalty.History(ctx, id.UserID, limit)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
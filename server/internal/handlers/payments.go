@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/payments"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaymentReturn is where the provider sends the customer back after paying a deposit.
+// The redirect is signed like a callback, so it confirms the payment too in case it
+// arrives first. The customer is sent on to PAYMENT_RESULT_URL when one is set.
+func (h *Handler) PaymentReturn(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	b, err := h.bookings.ConfirmDeposit(ctx, c.Param("provider"), c.Request.URL.Query())
+	if errors.Is(err, payments.ErrAlreadyConfirmed) {
+		err = nil
+	}
+	if err != nil {
+		apperr.Write(c, callbackError(err))
+		return
+	}
+	status := ""
+	if b.Deposit != nil {
+		status = b.Deposit.Status
+	}
+	if h.cfg.Payment.ResultURL != "" {
+		q := url.Values{"bookingId": {b.ID.Hex()}, "status": {status}}
+		c.Redirect(http.StatusSeeOther, h.cfg.Payment.ResultURL+"?"+q.Encode())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bookingId": b.ID, "status": b.Status, "deposit": b.Deposit})
+}
+
+// PaymentIPN receives the provider's server-to-server payment notification and answers
+// in the provider's own format.
+func (h *Handler) PaymentIPN(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	_, err := h.bookings.ConfirmDeposit(ctx, c.Param("provider"), c.Request.URL.Query())
+	if err != nil && !errors.Is(err, payments.ErrAlreadyConfirmed) {
+		slog.WarnContext(ctx, "payment callback rejected", "provider", c.Param("provider"), "error", err)
+	}
+	c.JSON(h.payments.Acknowledge(err))
+}
+
+// ExpireDeposits cancels bookings whose deposit was not paid in time; main runs it
+// every minute.
+func (h *Handler) ExpireDeposits(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := h.bookings.ExpireDeposits(ctx); err != nil {
+		slog.ErrorContext(ctx, "deposit expiry failed", "error", err)
+	}
+}
+
+func callbackError(err error) error {
+	switch {
+	case errors.Is(err, payments.ErrSignature), errors.Is(err, payments.ErrAmount):
+		return apperr.Wrap(err, apperr.InvalidArgument, "the payment callback is invalid")
+	case errors.Is(err, payments.ErrUnknownPayment):
+		return apperr.Wrap(err, apperr.NotFound, "payment not found")
+	}
+	return err
+}
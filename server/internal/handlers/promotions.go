@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+	"leblanc/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errPromotionNotFound = apperr.New(apperr.NotFound, "promotion not found")
+
+// ListPromotions returns every promotion, active or not (admin only).
+func (h *Handler) ListPromotions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	promos, err := h.repos.Promotions.List(ctx)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, promos)
+}
+
+// CreatePromotion adds a promotion (admin only).
+func (h *Handler) CreatePromotion(c *gin.Context) {
+	var p models.Promotion
+	if !bind(c, &p) {
+		return
+	}
+	p.ID = primitive.NewObjectID()
+	p.CreatedAt = time.Now()
+	h.savePromotion(c, &p)
+}
+
+// UpdatePromotion replaces a promotion, keeping its use count (admin only).
+func (h *Handler) UpdatePromotion(c *gin.Context) {
+	id, ok := promotionID(c)
+	if !ok {
+		return
+	}
+	var p models.Promotion
+	if !bind(c, &p) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	if _, err := h.repos.Promotions.Get(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = errPromotionNotFound
+		}
+		apperr.Write(c, err)
+		return
+	}
+	p.ID = id
+	h.savePromotion(c, &p)
+}
+
+func (h *Handler) savePromotion(c *gin.Context, p *models.Promotion) {
+	if err := services.ValidatePromotion(p); err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	p.UpdatedAt = time.Now()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	if err := h.repos.Promotions.Save(ctx, p); err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+type voucherRequest struct {
+	Count int `json:"count"`
+}
+
+// IssueVouchers creates single-use codes for a promotion (admin only).
+func (h *Handler) IssueVouchers(c *gin.Context) {
+	id, ok := promotionID(c)
+	if !ok {
+		return
+	}
+	var req voucherRequest
+	if !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	vouchers, err := h.promotions.IssueVouchers(ctx, id, req.Count)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"vouchers": vouchers})
+}
+
+// ListVouchers returns a promotion's codes and which bookings used them (admin only).
+func (h *Handler) ListVouchers(c *gin.Context) {
+	id, ok := promotionID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	vouchers, err := h.repos.Promotions.Vouchers(ctx, id)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"vouchers": vouchers})
+}
+
+func promotionID(c *gin.Context) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		apperr.Write(c, apperr.Invalid("id", "is not a valid promotion ID"))
+		return id, false
+	}
+	return id, true
+}
@@ -3,41 +3,86 @@ package handlers
 import (
 	"context"
 	"net/http"
-	"sort"
 	"time"
 
-	"leblanc/server/internal/db"
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/auth"
+	"leblanc/server/internal/metrics"
 	"leblanc/server/internal/models"
 	"leblanc/server/internal/services"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func RecoFromFeatures(c *gin.Context) {
+func (h *Handler) RecoFromFeatures(c *gin.Context) {
+	defer metrics.ObserveRecommendation(metrics.RecoSingle, time.Now())
 	var payload services.RecoPayload
-	if err := c.BindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+	if !bind(c, &payload) {
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := payload.Constraints.Validate(); err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	// explicit fields win over what the free-text mood suggests
+	mood := payload.ApplyMood()
+	if payload.Sweetness < 0 || payload.Sweetness > 5 {
+		apperr.Write(c, apperr.Invalid("sweetness", "must be between 0 and 5"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	cur, err := db.DB.Collection("drinks").Find(ctx, bson.D{})
-	if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return }
+	who, _ := auth.FromContext(ctx)
+	exclude, err := h.bookings.BookedDrinkIDs(ctx, who.UserID, payload.ExcludeBookingID)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	opts, err := services.NewRerankOptions(payload.Limit, payload.Diversity, exclude)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
 
-	var drinks []models.Drink
-	if err := cur.All(ctx, &drinks); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+	// only suggest what is on the menu at the booking time and within the constraints
+	drinks, recoCtx, report, err := h.cafe.RecoCandidates(ctx, h.repos.Drinks, payload.Context, payload.Constraints)
+	if err != nil {
+		apperr.Write(c, err)
+		return
 	}
+	payload.Context = recoCtx
 
-	type item struct{ D models.Drink; S float64 }
-	var ranked []item
+	byID := make(map[string]models.Drink, len(drinks))
 	for _, d := range drinks {
-		ranked = append(ranked, item{D: d, S: services.ScoreDrink(d, payload)})
+		byID[d.ID.Hex()] = d
+	}
+
+	// the active experiment, if any, decides which scorer serves this user
+	query := payload.Query()
+	var userID *primitive.ObjectID
+	if who, ok := auth.FromContext(ctx); ok {
+		userID = &who.UserID
 	}
-	sort.Slice(ranked, func(i, j int) bool { return ranked[i].S > ranked[j].S })
-	if len(ranked) > 5 { ranked = ranked[:5] }
+	scorer, exposure := services.AssignScorer(ctx, h.repos.Experiments, services.ExperimentUnit(userID, payload.SessionID),
+		services.ScorerConfig{Name: "default", Scorer: services.ScorerEmotion})
+	if scorer.Diversity != nil {
+		opts.Diversity = *scorer.Diversity
+	}
+	ranked := services.RerankDiverse(drinks, scorer.Score(drinks, query), opts)
+	services.LogRecoEvent(ctx, h.repos.RecoEvents, services.RecoEvent{
+		Email:     payload.Email,
+		SessionID: payload.SessionID,
+		UserID:    userID,
+		Endpoint:  "rest",
+		Scorer:    scorer.Scorer,
+		Query:     query,
+		DrinkIDs:  services.ScoreIDs(ranked),
+		Exposure:  exposure,
+	})
 
 	// attach score to response
 	type out struct {
@@ -46,7 +91,87 @@ func RecoFromFeatures(c *gin.Context) {
 	}
 	resp := make([]out, len(ranked))
 	for i, r := range ranked {
-		resp[i] = out{Drink: r.D, Score: float64(int(r.S*1000)) / 1000.0}
+		resp[i] = out{Drink: byID[r.DrinkID], Score: float64(int(r.Score*1000)) / 1000.0}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":      resp,
+		"requested":  opts.Limit,
+		"excluded":   report,
+		"notice":     services.ShortfallNotice(opts.Limit, len(resp), report),
+		"experiment": exposure,
+		"mood":       mood,
+	})
+}
+
+// RecoForGroup recommends one set of drinks for a table of guests with different moods.
+// The returned items can be used as-is to prefill a booking.
+func (h *Handler) RecoForGroup(c *gin.Context) {
+	defer metrics.ObserveRecommendation(metrics.RecoGroup, time.Now())
+	var payload services.GroupRecoRequest
+	if !bind(c, &payload) {
+		return
+	}
+	if err := payload.Constraints.Validate(); err != nil {
+		apperr.Write(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	who, _ := auth.FromContext(ctx)
+	exclude, err := h.bookings.BookedDrinkIDs(ctx, who.UserID, payload.ExcludeBookingID)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	limit := payload.Limit
+	if limit <= 0 {
+		limit = len(payload.Guests)
+	}
+	opts, err := services.NewRerankOptions(limit, payload.Diversity, exclude)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+
+	drinks, recoCtx, report, err := h.cafe.RecoCandidates(ctx, h.repos.Drinks, payload.Context, payload.Constraints)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	guests := payload.Guests
+	for i := range guests {
+		if guests[i].Temp == "" && recoCtx.TempPref != nil {
+			guests[i].Temp = *recoCtx.TempPref
+		}
+	}
+
+	rec, err := services.RecommendForGroup(drinks, guests, payload.Strategy, opts)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"strategy":    rec.Strategy,
+		"drinks":      rec.Drinks,
+		"assignments": rec.Assignments,
+		"items":       rec.Items,
+		"requested":   opts.Limit,
+		"excluded":    report,
+		"notice":      services.ShortfallNotice(opts.Limit, len(rec.Drinks), report),
+	})
+}
+
+// ExperimentReport shows conversion-to-booking per arm of a recommendation experiment.
+func (h *Handler) ExperimentReport(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	report, err := services.BuildExperimentReport(ctx, h.repos, c.Param("key"))
+	if err != nil {
+		apperr.Write(c, err)
+		return
 	}
-	c.JSON(http.StatusOK, resp)
+	c.JSON(http.StatusOK, report)
 }
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/auth"
+	"leblanc/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListDrinkReviews returns a page of a drink's approved reviews, newest first.
+func (h *Handler) ListDrinkReviews(c *gin.Context) {
+	id, ok := objectID(c, "is not a valid drink ID")
+	if !ok {
+		return
+	}
+	first, ok := pageSize(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	page, err := h.reviews.ForDrink(ctx, id, first, c.Query("after"))
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// WriteReview rates a drink the user had on a completed booking, replacing their
+// earlier review of it.
+func (h *Handler) WriteReview(c *gin.Context) {
+	id, ok := objectID(c, "is not a valid drink ID")
+	if !ok {
+		return
+	}
+	var req services.ReviewInput
+	if !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	rv, err := h.reviews.Write(ctx, who.UserID, id, req)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rv)
+}
+
+// DeleteReview removes a review; the author or an admin may.
+func (h *Handler) DeleteReview(c *gin.Context) {
+	id, ok := objectID(c, "is not a valid review ID")
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	who, _ := auth.FromContext(ctx)
+	if err := h.reviews.Delete(ctx, id, who.UserID, who.Role == auth.RoleAdmin); err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ReviewQueue lists reviews by status, pending by default, oldest first (admin only).
+func (h *Handler) ReviewQueue(c *gin.Context) {
+	first, ok := pageSize(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	page, err := h.reviews.Queue(ctx, c.Query("status"), first, c.Query("after"))
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// RecountRatings recomputes every drink's rating from its approved reviews (admin only).
+func (h *Handler) RecountRatings(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	n, err := h.reviews.Recount(ctx)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "corrected": n})
+}
+
+type moderateReviewRequest struct {
+	Status string `json:"status"`
+	// Note tells the author why a review was rejected.
+	Note string `json:"note"`
+}
+
+// ModerateReview approves or rejects a review (admin only).
+func (h *Handler) ModerateReview(c *gin.Context) {
+	id, ok := objectID(c, "is not a valid review ID")
+	if !ok {
+		return
+	}
+	var req moderateReviewRequest
+	if !bind(c, &req) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	rv, err := h.reviews.Moderate(ctx, id, req.Status, req.Note)
+	if err != nil {
+		apperr.Write(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rv)
+}
+
+// objectID parses the :id parameter, answering 400 with problem when it is malformed.
+func objectID(c *gin.Context, problem string) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		apperr.Write(c, apperr.Invalid("id", problem))
+		return id, false
+	}
+	return id, true
+}
+
+// pageSize reads ?first, leaving 0 (the default) when it is absent.
+func pageSize(c *gin.Context) (int, bool) {
+	raw := c.Query("first")
+	if raw == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		apperr.Write(c, apperr.Invalid("first", "must be a number"))
+		return 0, false
+	}
+	return n, true
+}
@@ -2,23 +2,23 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/mail"
-	"os"
+	"sort"
 	"strings"
 	"time"
 
-	"leblanc/server/internal/db"
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/metrics"
 	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
 	"leblanc/server/internal/services"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -41,26 +41,13 @@ type verifyTokenRequest struct {
 	Token string `json:"token"`
 }
 
-var adminEmailLower = strings.ToLower(os.Getenv("ADMIN_EMAIL"))
-
-// Require MX check by default; set EMAIL_REQUIRE_MX=false to disable.
-var requireMXCheck = !strings.EqualFold(os.Getenv("EMAIL_REQUIRE_MX"), "false")
-
-func GetUsers(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (h *Handler) GetUsers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
-	coll := db.DB.Collection("users")
 
-	cur, err := coll.Find(ctx, bson.D{})
+	users, err := h.repos.Users.List(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer cur.Close(ctx)
-
-	var users []models.User
-	if err := cur.All(ctx, &users); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apperr.Write(c, err)
 		return
 	}
 
@@ -72,10 +59,9 @@ func GetUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, publicUsers)
 }
 
-func RegisterUser(c *gin.Context) {
+func (h *Handler) RegisterUser(c *gin.Context) {
 	var req registerRequest
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bind(c, &req) {
 		return
 	}
 
@@ -83,56 +69,50 @@ func RegisterUser(c *gin.Context) {
 	req.Email = strings.TrimSpace(req.Email)
 	req.Password = strings.TrimSpace(req.Password)
 
-	if req.Name == "" || req.Email == "" || req.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name, email and password are required"})
+	if err := requireFields(map[string]string{"name": req.Name, "email": req.Email, "password": req.Password}); err != nil {
+		apperr.Write(c, err)
 		return
 	}
 	if !isValidEmail(req.Email) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+		apperr.Write(c, errInvalidEmail)
 		return
 	}
 	// MX lookup: if no MX -> invalid; if lookup errors -> log and allow (to avoid blocking due to DNS issues).
-	if requireMXCheck {
+	if h.cfg.Email.RequireMX {
 		if ok := hasMXRecord(req.Email); !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+			apperr.Write(c, errInvalidEmail)
 			return
 		}
 	}
-	if adminEmailLower != "" && strings.ToLower(req.Email) == adminEmailLower {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "this email is reserved"})
+	if h.cfg.Admin.Email != "" && strings.EqualFold(req.Email, h.cfg.Admin.Email) {
+		apperr.Write(c, apperr.Invalid("email", "is reserved"))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
-	coll := db.DB.Collection("users")
 
 	lowerName := strings.ToLower(req.Name)
 	lowerEmail := strings.ToLower(req.Email)
 
 	// ensure user doesn't already exist
-	filter := bson.M{"$or": []bson.M{
-		{"nameLower": lowerName},
-		{"emailLower": lowerEmail},
-	}}
-	if err := coll.FindOne(ctx, filter).Err(); err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user already exists"})
+	if _, err := h.repos.Users.FindByNameOrEmail(ctx, req.Name, req.Email); err == nil {
+		apperr.Write(c, errUserExists)
 		return
-	} else if err != mongo.ErrNoDocuments {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		apperr.Write(c, err)
 		return
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not hash password"})
+		apperr.Write(c, fmt.Errorf("hash password: %w", err))
 		return
 	}
 
 	// Insert a pending (unverified) user immediately so you can see it in Mongo,
 	// then return the verification token/URL to complete activation.
 	user := models.User{
-		ID:           primitive.NewObjectID(),
 		Name:         req.Name,
 		NameLower:    lowerName,
 		Email:        req.Email,
@@ -142,8 +122,11 @@ func RegisterUser(c *gin.Context) {
 		PasswordHash: string(hash),
 		CreatedAt:    time.Now(),
 	}
-	if _, err := coll.InsertOne(ctx, user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create user"})
+	if err := h.repos.Users.Insert(ctx, &user); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			err = errUserExists
+		}
+		apperr.Write(c, err)
 		return
 	}
 
@@ -153,17 +136,18 @@ func RegisterUser(c *gin.Context) {
 		PasswordHash: string(hash),
 		Role:         "user",
 	}
-	token, expiresAt, err := services.GenerateRegistrationToken(claims)
+	token, expiresAt, err := h.tokens.GenerateRegistrationToken(claims)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+		apperr.Write(c, fmt.Errorf("registration token: %w", err))
 		return
 	}
-	verifyURLBase := strings.TrimSpace(os.Getenv("FRONTEND_VERIFY_URL"))
+	verifyURLBase := h.cfg.Email.FrontendVerifyURL
 	verifyURL := ""
 	if verifyURLBase != "" {
 		verifyURL = fmt.Sprintf("%s?token=%s", strings.TrimRight(verifyURLBase, "/"), token)
 	}
-	log.Printf("register-init: email=%s token=%s verifyUrl=%s", req.Email, token, verifyURL)
+	metrics.Registered()
+	slog.InfoContext(c.Request.Context(), "registration started", "email", req.Email, "expires_at", expiresAt)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"ok":        true,
@@ -174,68 +158,41 @@ func RegisterUser(c *gin.Context) {
 	})
 }
 
-func LoginUser(c *gin.Context) {
+func (h *Handler) LoginUser(c *gin.Context) {
 	var req loginRequest
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	req.NameOrEmail = strings.TrimSpace(req.NameOrEmail)
-	req.Password = strings.TrimSpace(req.Password)
-	if req.NameOrEmail == "" || req.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name and password are required"})
+	if !bind(c, &req) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
-	coll := db.DB.Collection("users")
-
-	lookup := strings.ToLower(req.NameOrEmail)
-	filter := bson.M{
-		"$or": []bson.M{
-			{"nameLower": lookup},
-			{"emailLower": lookup},
-		},
-	}
-
-	var user models.User
-	if err := coll.FindOne(ctx, filter).Decode(&user); err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
-		return
-	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "incorrect password"})
-		return
-	}
 
-	if !user.Verified {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "email not verified"})
+	user, err := services.Authenticate(ctx, h.repos.Users, req.NameOrEmail, req.Password)
+	if err != nil {
+		apperr.Write(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"ok": true, "user": user.Public()})
+	token, expiresAt := h.tokens.GenerateSessionToken(services.Session{UserID: user.ID.Hex(), Role: user.Role})
+	c.JSON(http.StatusOK, gin.H{"ok": true, "user": user.Public(), "token": token, "expiresAt": expiresAt})
 }
 
 // Request verification token (e.g., to send via email).
-func RequestVerify(c *gin.Context) {
+func (h *Handler) RequestVerify(c *gin.Context) {
 	var req verifyRequest
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bind(c, &req) {
 		return
 	}
 	req.Email = strings.TrimSpace(req.Email)
 	if req.Email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+		apperr.Write(c, apperr.Invalid("email", "is required"))
 		return
 	}
-	token, expiresAt := services.GenerateVerificationToken(req.Email)
+	if !isValidEmail(req.Email) {
+		apperr.Write(c, errInvalidEmail)
+		return
+	}
+	token, expiresAt := h.tokens.GenerateVerificationToken(req.Email)
 	c.JSON(http.StatusOK, gin.H{
 		"token":     token,
 		"expiresAt": expiresAt,
@@ -243,23 +200,19 @@ func RequestVerify(c *gin.Context) {
 }
 
 // Verify token and return embedded email.
-func VerifyToken(c *gin.Context) {
+func (h *Handler) VerifyToken(c *gin.Context) {
 	var req verifyTokenRequest
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bind(c, &req) {
 		return
 	}
 	// Try registration token first (contains user data).
-	if claims, err := services.VerifyRegistrationToken(req.Token); err == nil && claims != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if claims, err := h.tokens.VerifyRegistrationToken(req.Token); err == nil && claims != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
-		coll := db.DB.Collection("users")
 		lowerEmail := strings.ToLower(claims.Email)
-		var existing models.User
-		err := coll.FindOne(ctx, bson.M{"emailLower": lowerEmail}).Decode(&existing)
-		if err == mongo.ErrNoDocuments {
+		existing, err := h.repos.Users.FindByEmail(ctx, claims.Email)
+		if errors.Is(err, repository.ErrNotFound) {
 			user := models.User{
-				ID:           primitive.NewObjectID(),
 				Name:         claims.Name,
 				NameLower:    strings.ToLower(claims.Name),
 				Email:        claims.Email,
@@ -272,27 +225,15 @@ func VerifyToken(c *gin.Context) {
 			if user.Role == "" {
 				user.Role = "user"
 			}
-			if _, err := coll.InsertOne(ctx, user); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			if err := h.repos.Users.Insert(ctx, &user); err != nil {
+				apperr.Write(c, err)
 				return
 			}
+			metrics.Verified(true)
 			c.JSON(http.StatusOK, gin.H{"ok": true, "email": claims.Email, "user": user.Public()})
 			return
 		} else if err == nil {
-			update := bson.M{"verified": true}
-			if claims.PasswordHash != "" {
-				update["passwordHash"] = claims.PasswordHash
-			}
-			if claims.Name != "" {
-				update["name"] = claims.Name
-				update["nameLower"] = strings.ToLower(claims.Name)
-			}
-			if claims.Role != "" {
-				update["role"] = claims.Role
-			}
-			_, _ = coll.UpdateOne(ctx, bson.M{"_id": existing.ID}, bson.M{"$set": update})
-			// Refresh user fields.
-			updated := existing
+			updated := *existing
 			if claims.Name != "" {
 				updated.Name = claims.Name
 				updated.NameLower = strings.ToLower(claims.Name)
@@ -304,31 +245,67 @@ func VerifyToken(c *gin.Context) {
 			if claims.PasswordHash != "" {
 				updated.PasswordHash = claims.PasswordHash
 			}
+			_ = h.repos.Users.Update(ctx, &updated)
+			metrics.Verified(true)
 			c.JSON(http.StatusOK, gin.H{"ok": true, "email": claims.Email, "user": updated.Public()})
 			return
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			apperr.Write(c, err)
 			return
 		}
 	}
 
 	// Fallback: legacy simple email token.
-	email, err := services.VerifyToken(req.Token)
+	email, err := h.tokens.VerifyToken(req.Token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		metrics.Verified(false)
+		apperr.Write(c, err)
 		return
 	}
-	filter := bson.M{"emailLower": strings.ToLower(email)}
-	_, _ = db.DB.Collection("users").UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"verified": true}})
 	var user models.User
-	_ = db.DB.Collection("users").FindOne(context.Background(), filter).Decode(&user)
+	if existing, err := h.repos.Users.FindByEmail(c.Request.Context(), email); err == nil {
+		existing.Verified = true
+		_ = h.repos.Users.Update(c.Request.Context(), existing)
+		user = *existing
+	}
 
+	metrics.Verified(true)
 	c.JSON(http.StatusOK, gin.H{"ok": true, "email": email, "user": user.Public()})
 }
 
+var (
+	errInvalidEmail = apperr.Invalid("email", "is not a valid address")
+	errUserExists   = apperr.New(apperr.AlreadyExists, "user already exists")
+)
+
+// requireFields reports every empty field at once, in a stable order.
+func requireFields(fields map[string]string) error {
+	names := make([]string, 0, len(fields))
+	for name, v := range fields {
+		if v == "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	msg := names[0] + " is required"
+	if n := len(names); n > 1 {
+		msg = strings.Join(names[:n-1], ", ") + " and " + names[n-1] + " are required"
+	}
+	err := apperr.New(apperr.InvalidArgument, msg)
+	for _, name := range names {
+		err.Fields = append(err.Fields, apperr.FieldError{Field: name, Message: "is required"})
+	}
+	return err
+}
+
+// isValidEmail accepts a bare address. "|" is allowed by RFC 5322 but separates the
+// fields of verification tokens.
 func isValidEmail(addr string) bool {
-	_, err := mail.ParseAddress(addr)
-	return err == nil
+	parsed, err := mail.ParseAddress(addr)
+	return err == nil && parsed.Address == addr && !strings.Contains(addr, "|")
 }
 
 func hasMXRecord(addr string) bool {
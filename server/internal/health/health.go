@@ -0,0 +1,115 @@
+// Package health serves the liveness and readiness probes.
+//
+// /healthz only says the process is up and serving HTTP. /readyz runs the registered
+// checks (Mongo reachable, schema migrated) and turns 503 as soon as shutdown starts, so
+// the proxy stops routing new requests here while in-flight ones drain.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"leblanc/server/internal/migrations"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// checkTimeout bounds each readiness check; the proxy's own probe timeout is longer.
+const checkTimeout = 2 * time.Second
+
+// Check is one readiness condition; a nil error means ready.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type Checker struct {
+	checks   []Check
+	draining atomic.Bool
+}
+
+func New(checks ...Check) *Checker {
+	return &Checker{checks: checks}
+}
+
+// Drain marks the server as shutting down; /readyz fails from then on.
+func (h *Checker) Drain() { h.draining.Store(true) }
+
+// Live handles GET /healthz.
+func (h *Checker) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready handles GET /readyz, running the checks concurrently.
+func (h *Checker) Ready(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+	defer cancel()
+
+	results := make(map[string]string, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ready := true
+	for _, chk := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := "ok"
+			if err := chk.Run(ctx); err != nil {
+				status = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			results[chk.Name] = status
+			ready = ready && status == "ok"
+		}()
+	}
+	wg.Wait()
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": results})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": results})
+}
+
+// MongoPing checks that the primary answers.
+func MongoPing(client *mongo.Client) Check {
+	return Check{Name: "mongo", Run: func(ctx context.Context) error {
+		if err := client.Ping(ctx, nil); err != nil {
+			return errors.New("unreachable")
+		}
+		return nil
+	}}
+}
+
+// Migrated checks that every migration in this build has been applied. Once it passes it
+// is not re-run: migrations are only rolled back by hand.
+func Migrated(db *mongo.Database) Check {
+	var done atomic.Bool
+	m := migrations.New(db)
+	return Check{Name: "migrations", Run: func(ctx context.Context) error {
+		if done.Load() {
+			return nil
+		}
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return errors.New("cannot read migration history")
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending, next is %d %s", len(pending), pending[0].Version, pending[0].Name)
+		}
+		done.Store(true)
+		return nil
+	}}
+}
@@ -0,0 +1,94 @@
+package invoices
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"leblanc/server/internal/models"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// PDF lays the text receipt out in Courier on A4 pages. The standard PDF fonts cannot
+// show Vietnamese, so accents are dropped ("Cà phê" prints as "Ca phe"); the text
+// receipt keeps them.
+func PDF(inv *models.Invoice, loc *time.Location) []byte {
+	const (
+		perPage = 60
+		size    = 10 // pt; Courier is 0.6 em wide, so a 56-character line is 336pt
+		leading = 12
+	)
+	lines := strings.Split(strings.TrimRight(Text(inv, loc), "\n"), "\n")
+	var pages [][]string
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	pages = append(pages, lines)
+
+	// objects: 1 catalog, 2 page tree, 3 font, then a page and its content per page
+	var objs []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objs = append(objs,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL 72 790 Td\n", size, leading)
+		for _, l := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfString(l))
+		}
+		content.WriteString("ET")
+		objs = append(objs,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info << /Title (%s) >> >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objs)+1, pdfString(inv.Code), xref)
+	return b.Bytes()
+}
+
+// pdfString folds s to ASCII and escapes it for a PDF literal string.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// accent marks
+		case r == 'đ':
+			b.WriteByte('d')
+		case r == 'Đ':
+			b.WriteByte('D')
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+// Package invoices renders receipts and VAT invoices as plain text and PDF. Labels are
+// in Vietnamese with English alongside.
+package invoices
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"leblanc/server/internal/models"
+)
+
+// Width is the number of characters in a text receipt line.
+const Width = 56
+
+// Title is the document heading for kind.
+func Title(kind string) string {
+	if kind == models.InvoiceVAT {
+		return "HÓA ĐƠN GTGT / VAT INVOICE"
+	}
+	return "BIÊN NHẬN / RECEIPT"
+}
+
+// Text renders inv with dates in loc.
+func Text(inv *models.Invoice, loc *time.Location) string {
+	var w writer
+	w.center(inv.Seller.Name)
+	if inv.Seller.Address != "" {
+		w.center(inv.Seller.Address)
+	}
+	if inv.Seller.TaxCode != "" {
+		w.center("MST / Tax code: " + inv.Seller.TaxCode)
+	}
+	w.rule('=')
+	w.center(Title(inv.Kind))
+	w.line("Số / No: " + inv.Code)
+	w.line("Ngày / Date: " + inv.IssuedAt.In(loc).Format("02/01/2006 15:04"))
+	w.line("Đặt bàn / Booking: " + inv.BookingID.Hex())
+	w.line("Đến / Visit: " + inv.VisitAt.In(loc).Format("02/01/2006 15:04"))
+	w.line("Khách / Guest: " + inv.Customer.Name)
+	if inv.Company != nil {
+		w.rule('-')
+		w.line("Đơn vị / Company: " + inv.Company.Name)
+		w.line("MST / Tax code: " + inv.Company.TaxCode)
+		w.line("Địa chỉ / Address: " + inv.Company.Address)
+	}
+	w.rule('-')
+	for _, l := range inv.Lines {
+		w.line(l.Name)
+		if len(l.Options) > 0 {
+			w.line("  " + strings.Join(l.Options, ", "))
+		}
+		w.amount(fmt.Sprintf("  %d x %s", l.Qty, VND(l.UnitPrice)), l.Amount)
+	}
+	w.rule('-')
+	w.amount("Tạm tính / Subtotal", inv.Subtotal)
+	for _, a := range inv.Adjustments {
+		w.amount(a.Label, a.Amount)
+	}
+	w.amount("Tổng cộng / Total", inv.Total)
+	if inv.VATPercent > 0 {
+		w.amount("  Giá chưa thuế / Before VAT", inv.Total-inv.VAT)
+		w.amount(fmt.Sprintf("  Thuế GTGT / VAT %d%%", inv.VATPercent), inv.VAT)
+	}
+	for _, p := range inv.Payments {
+		w.amount(p.Label, p.Amount)
+	}
+	if len(inv.Payments) > 0 {
+		w.amount("Còn phải trả / Amount due", inv.AmountDue)
+	}
+	w.rule('=')
+	w.center("Cảm ơn quý khách! / Thank you!")
+	return w.String()
+}
+
+// VND formats n with dots between thousands, as prices are written in Vietnam.
+func VND(n int) string {
+	s := strconv.Itoa(n)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "." + s[i:]
+	}
+	if neg {
+		return "-" + s
+	}
+	return s
+}
+
+type writer struct{ strings.Builder }
+
+func (w *writer) line(s string) {
+	w.WriteString(s)
+	w.WriteByte('\n')
+}
+
+func (w *writer) center(s string) {
+	if pad := (Width - utf8.RuneCountInString(s)) / 2; pad > 0 {
+		s = strings.Repeat(" ", pad) + s
+	}
+	w.line(s)
+}
+
+func (w *writer) rule(c rune) {
+	w.line(strings.Repeat(string(c), Width))
+}
+
+// amount puts label on the left and the amount right-aligned.
+func (w *writer) amount(label string, n int) {
+	v := VND(n)
+	pad := Width - utf8.RuneCountInString(label) - len(v)
+	if pad < 1 {
+		w.line(label)
+		pad = Width - len(v)
+		label = ""
+	}
+	w.line(label + strings.Repeat(" ", pad) + v)
+}
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// a caller-supplied ID is kept only if it is short and safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// AssignRequestID accepts the caller's X-Request-ID or generates one, echoes it in the
+// response and stores it in the request context for handlers, resolvers and logs.
+func AssignRequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// quietPaths are probe endpoints logged at debug so they do not drown real traffic.
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// AccessLog writes one line per request with status and latency. The query string is
+// left out: verification tokens travel in it.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		case quietPaths[c.Request.URL.Path]:
+			level = slog.LevelDebug
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "http request", attrs...)
+	}
+}
+
+// Recovery turns a panic into a 500 and logs it with the request ID.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "panic serving request", "panic", err, "path", c.Request.URL.Path)
+		// same envelope as apperr.Write, which cannot be used here: apperr imports logging
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "internal error", "code": "INTERNAL", "requestId": RequestID(c.Request.Context()),
+		})
+	})
+}
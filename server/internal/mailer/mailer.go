@@ -0,0 +1,172 @@
+// Package mailer sends email from the server, through SMTP with STARTTLS when the server
+// offers it. In dev without an SMTP server, messages are logged instead.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"leblanc/server/internal/config"
+)
+
+// Message is a plain-text email with optional attachments.
+type Message struct {
+	To          string
+	Subject     string
+	Text        string
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// New returns the SMTP mailer cfg describes, a logging one in dev without SMTP_HOST, or
+// nil when mail is off.
+func New(cfg config.MailConfig, dev bool) Mailer {
+	switch {
+	case cfg.Host != "":
+		return &SMTP{cfg: cfg}
+	case dev:
+		return Log{}
+	}
+	return nil
+}
+
+// Log writes messages to the log instead of sending them.
+type Log struct{}
+
+func (Log) Send(ctx context.Context, m Message) error {
+	names := make([]string, len(m.Attachments))
+	for i, a := range m.Attachments {
+		names[i] = a.Name
+	}
+	slog.InfoContext(ctx, "mail not sent, no SMTP_HOST", "to", m.To, "subject", m.Subject, "attachments", names)
+	return nil
+}
+
+type SMTP struct {
+	cfg config.MailConfig
+}
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("SMTP_FROM: %w", err)
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("recipient: %w", err)
+	}
+	body, err := encode(from, to, m)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port)))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// encode builds a multipart/mixed message: the text as quoted-printable UTF-8, then the
+// attachments in base64.
+func encode(from, to *mail.Address, m Message) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n",
+		from.String(), to.String(), mime.QEncoding.Encode("utf-8", m.Subject), time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(m.Text)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := base64.StdEncoding.EncodeToString(a.Data)
+		for len(enc) > 76 {
+			fmt.Fprintf(part, "%s\r\n", enc[:76])
+			enc = enc[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", enc)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
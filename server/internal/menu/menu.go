@@ -0,0 +1,213 @@
+// Package menu syncs the drinks collection with the menu fixture (data/menu.json).
+//
+// Drinks are matched by slug, so their IDs never change and bookings keep pointing at
+// them. Drinks missing from the file are archived, never deleted.
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+)
+
+// Item is one drink in the fixture. Image is a file name under the asset base, or a full URL.
+type Item struct {
+	Slug       string            `json:"slug"`
+	Name       string            `json:"name"`
+	Price      int               `json:"price"`
+	Tags       []string          `json:"tags"`
+	Caffeine   string            `json:"caffeine"`
+	Temp       string            `json:"temp"`
+	Sweetness  int               `json:"sweetness"`
+	ColorTone  string            `json:"colorTone"`
+	EmotionFit models.EmotionFit `json:"emotionFit"`
+	Allergens  []string          `json:"allergens,omitempty"`
+	Image      string            `json:"image"`
+	Desc       string            `json:"desc"`
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Load reads and validates a fixture file.
+func Load(path string) ([]Item, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	if err := json.Unmarshal(b, &items); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seen := make(map[string]bool, len(items))
+	for i, it := range items {
+		where := fmt.Sprintf("%s: item %d (%s)", path, i+1, it.Slug)
+		switch {
+		case !slugPattern.MatchString(it.Slug):
+			return nil, fmt.Errorf("%s: slug must be lower-case words joined by dashes", where)
+		case seen[it.Slug]:
+			return nil, fmt.Errorf("%s: duplicate slug", where)
+		case strings.TrimSpace(it.Name) == "":
+			return nil, fmt.Errorf("%s: name is required", where)
+		case it.Price < 0:
+			return nil, fmt.Errorf("%s: price must not be negative", where)
+		case !slices.Contains([]string{"none", "low", "med", "high"}, it.Caffeine):
+			return nil, fmt.Errorf("%s: caffeine must be none, low, med or high", where)
+		case !slices.Contains([]string{"hot", "iced", "cold", "room", "either"}, it.Temp):
+			return nil, fmt.Errorf("%s: temp must be hot, iced, cold, room or either", where)
+		case it.Sweetness < 0 || it.Sweetness > 5:
+			return nil, fmt.Errorf("%s: sweetness must be between 0 and 5", where)
+		}
+		seen[it.Slug] = true
+	}
+	return items, nil
+}
+
+// Drink converts the item to a drink document, resolving Image against assetBase.
+func (it Item) Drink(assetBase string) models.Drink {
+	image := it.Image
+	if image != "" && !strings.HasPrefix(image, "http://") && !strings.HasPrefix(image, "https://") {
+		image = strings.TrimRight(assetBase, "/") + "/" + strings.TrimLeft(image, "/")
+	}
+	return models.Drink{
+		Slug:       it.Slug,
+		Name:       it.Name,
+		Price:      it.Price,
+		Tags:       it.Tags,
+		Caffeine:   it.Caffeine,
+		Temp:       it.Temp,
+		Sweetness:  it.Sweetness,
+		ColorTone:  it.ColorTone,
+		EmotionFit: it.EmotionFit,
+		Allergens:  it.Allergens,
+		Image:      image,
+		Desc:       it.Desc,
+	}
+}
+
+// Actions in a plan.
+const (
+	Create    = "create"
+	Update    = "update"
+	Unchanged = "unchanged"
+	Archive   = "archive"
+)
+
+// FieldDiff is one changed field, formatted for display.
+type FieldDiff struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Change is what the sync will do to one drink. Drink is the document to save
+// (nil for unchanged drinks).
+type Change struct {
+	Action string
+	Slug   string
+	Name   string
+	Diffs  []FieldDiff
+	Drink  *models.Drink
+}
+
+type Plan struct {
+	Changes                               []Change
+	Created, Updated, Unchanged, Archived int
+}
+
+// PlanSync compares the fixture with the stored drinks. A stored drink matches an item by
+// slug; drinks seeded before slugs existed are adopted by exact name, keeping their ID.
+// Stored drinks that match nothing are archived.
+func PlanSync(existing []models.Drink, items []Item, assetBase string) Plan {
+	bySlug := make(map[string]int)
+	byName := make(map[string]int)
+	for i, d := range existing {
+		if d.Slug != "" {
+			bySlug[d.Slug] = i
+		} else if _, dup := byName[d.Name]; !dup {
+			byName[d.Name] = i
+		}
+	}
+
+	var plan Plan
+	matched := make(map[int]bool)
+	for _, it := range items {
+		want := it.Drink(assetBase)
+		i, ok := bySlug[it.Slug]
+		if !ok {
+			i, ok = byName[it.Name]
+		}
+		if !ok || matched[i] {
+			plan.Created++
+			plan.Changes = append(plan.Changes, Change{Action: Create, Slug: it.Slug, Name: it.Name, Drink: &want})
+			continue
+		}
+		matched[i] = true
+		cur := existing[i]
+		want.ID = cur.ID
+		diffs := diffDrinks(cur, want)
+		if len(diffs) == 0 {
+			plan.Unchanged++
+			plan.Changes = append(plan.Changes, Change{Action: Unchanged, Slug: it.Slug, Name: it.Name})
+			continue
+		}
+		plan.Updated++
+		plan.Changes = append(plan.Changes, Change{Action: Update, Slug: it.Slug, Name: it.Name, Diffs: diffs, Drink: &want})
+	}
+
+	for i, d := range existing {
+		if matched[i] || d.Archived {
+			continue
+		}
+		archived := d
+		archived.Archived = true
+		plan.Archived++
+		plan.Changes = append(plan.Changes, Change{
+			Action: Archive, Slug: d.Slug, Name: d.Name, Drink: &archived,
+			Diffs: []FieldDiff{{Field: "archived", Old: "false", New: "true"}},
+		})
+	}
+	return plan
+}
+
+// Apply saves every created, updated and archived drink in the plan.
+func Apply(ctx context.Context, drinks repository.DrinkRepository, plan Plan) error {
+	for _, c := range plan.Changes {
+		if c.Drink == nil {
+			continue
+		}
+		if err := drinks.Save(ctx, c.Drink); err != nil {
+			return fmt.Errorf("%s %s: %w", c.Action, c.Slug, err)
+		}
+	}
+	return nil
+}
+
+func diffDrinks(a, b models.Drink) []FieldDiff {
+	var diffs []FieldDiff
+	add := func(field, old, new string) {
+		if old != new {
+			diffs = append(diffs, FieldDiff{Field: field, Old: old, New: new})
+		}
+	}
+	add("slug", a.Slug, b.Slug)
+	add("name", a.Name, b.Name)
+	add("price", fmt.Sprint(a.Price), fmt.Sprint(b.Price))
+	add("tags", strings.Join(a.Tags, ","), strings.Join(b.Tags, ","))
+	add("caffeine", a.Caffeine, b.Caffeine)
+	add("temp", a.Temp, b.Temp)
+	add("sweetness", fmt.Sprint(a.Sweetness), fmt.Sprint(b.Sweetness))
+	add("colorTone", a.ColorTone, b.ColorTone)
+	add("emotionFit", fmt.Sprintf("%+v", a.EmotionFit), fmt.Sprintf("%+v", b.EmotionFit))
+	add("allergens", strings.Join(a.Allergens, ","), strings.Join(b.Allergens, ","))
+	add("image", a.Image, b.Image)
+	add("desc", a.Desc, b.Desc)
+	add("archived", fmt.Sprint(a.Archived), fmt.Sprint(b.Archived))
+	return diffs
+}
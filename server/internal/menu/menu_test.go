@@ -0,0 +1,127 @@
+package menu
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const assets = "https://cdn.example.com/drinks/"
+
+func item(slug, name string, price int) Item {
+	return Item{Slug: slug, Name: name, Price: price, Caffeine: "med", Temp: "hot", Sweetness: 2, Image: slug + ".jpg"}
+}
+
+func TestPlanSync(t *testing.T) {
+	stored := func(it Item) models.Drink {
+		d := it.Drink(assets)
+		d.ID = primitive.NewObjectID()
+		return d
+	}
+	latte, mocha := item("latte", "Latte", 45000), item("mocha", "Mocha", 50000)
+	legacy := stored(item("jasmine-tea", "Jasmine tea", 35000))
+	legacy.Slug = "" // seeded before drinks had slugs
+	gone := stored(item("espresso", "Espresso", 30000))
+	retired := stored(item("old-brew", "Old brew", 30000))
+	retired.Archived = true
+	existing := []models.Drink{stored(latte), stored(item("mocha", "Mocha", 45000)), legacy, gone, retired}
+
+	items := []Item{latte, mocha, item("jasmine-tea", "Jasmine tea", 35000), item("yuzu-soda", "Yuzu soda", 40000)}
+	plan := PlanSync(existing, items, assets)
+
+	type row struct {
+		action, slug string
+		diffs        []string
+	}
+	want := []row{
+		{Unchanged, "latte", nil},
+		{Update, "mocha", []string{"price 45000 -> 50000"}},
+		{Update, "jasmine-tea", []string{"slug  -> jasmine-tea"}},
+		{Create, "yuzu-soda", nil},
+		{Archive, "espresso", []string{"archived false -> true"}},
+	}
+	var got []row
+	for _, c := range plan.Changes {
+		r := row{action: c.Action, slug: c.Slug}
+		for _, d := range c.Diffs {
+			r.diffs = append(r.diffs, d.Field+" "+d.Old+" -> "+d.New)
+		}
+		got = append(got, r)
+	}
+	if !slices.EqualFunc(got, want, func(a, b row) bool {
+		return a.action == b.action && a.slug == b.slug && slices.Equal(a.diffs, b.diffs)
+	}) {
+		t.Errorf("plan = %+v\nwant %+v", got, want)
+	}
+	if plan.Created != 1 || plan.Updated != 2 || plan.Unchanged != 1 || plan.Archived != 1 {
+		t.Errorf("plan counts %d created, %d updated, %d unchanged, %d archived; want 1, 2, 1, 1",
+			plan.Created, plan.Updated, plan.Unchanged, plan.Archived)
+	}
+	if c := plan.Changes[2]; c.Drink.ID != legacy.ID {
+		t.Errorf("the legacy drink got ID %v, want its own %v kept", c.Drink.ID, legacy.ID)
+	}
+
+	// applying the plan leaves nothing to do next time
+	drinks := repository.NewMemoryDrinks(existing...)
+	if err := Apply(context.Background(), drinks, plan); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := drinks.ListAll(context.Background())
+	again := PlanSync(after, items, assets)
+	if again.Unchanged != len(items) || again.Created+again.Updated+again.Archived != 0 {
+		t.Errorf("second plan = %+v, want every item unchanged", again)
+	}
+}
+
+func TestDrinkImage(t *testing.T) {
+	tests := []struct{ image, want string }{
+		{"latte.jpg", "https://cdn.example.com/drinks/latte.jpg"},
+		{"/latte.jpg", "https://cdn.example.com/drinks/latte.jpg"},
+		{"https://elsewhere.example.com/latte.jpg", "https://elsewhere.example.com/latte.jpg"},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		if got := (Item{Image: tc.image}).Drink(assets).Image; got != tc.want {
+			t.Errorf("image %q resolves to %q, want %q", tc.image, got, tc.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := Load("../../data/menu.json"); err != nil {
+		t.Errorf("the shipped menu does not load: %v", err)
+	}
+	tests := []struct {
+		name, json, problem string
+	}{
+		{"valid", `[{"slug":"latte","name":"Latte","price":45000,"caffeine":"med","temp":"hot","sweetness":2}]`, ""},
+		{"bad slug", `[{"slug":"Latte","name":"Latte","caffeine":"med","temp":"hot"}]`, "slug must be"},
+		{"duplicate slug", `[{"slug":"latte","name":"Latte","caffeine":"med","temp":"hot"},{"slug":"latte","name":"Latte 2","caffeine":"med","temp":"hot"}]`, "duplicate slug"},
+		{"no name", `[{"slug":"latte","name":" ","caffeine":"med","temp":"hot"}]`, "name is required"},
+		{"negative price", `[{"slug":"latte","name":"Latte","price":-1,"caffeine":"med","temp":"hot"}]`, "price must not be negative"},
+		{"caffeine", `[{"slug":"latte","name":"Latte","caffeine":"lots","temp":"hot"}]`, "caffeine must be"},
+		{"temp", `[{"slug":"latte","name":"Latte","caffeine":"med","temp":"warm"}]`, "temp must be"},
+		{"sweetness", `[{"slug":"latte","name":"Latte","caffeine":"med","temp":"hot","sweetness":6}]`, "sweetness must be"},
+		{"not JSON", `{`, "unexpected end of JSON input"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "menu.json")
+			if err := os.WriteFile(path, []byte(tc.json), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if tc.problem == "" && err != nil || tc.problem != "" && (err == nil || !strings.Contains(err.Error(), tc.problem)) {
+				t.Errorf("Load = %v, want %q", err, tc.problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Package metrics exposes Prometheus metrics at /metrics.
+//
+// Every label is drawn from a fixed set: routes are Gin route patterns (never raw paths),
+// GraphQL operations are the known root fields, Mongo commands and booking channels are
+// allow-listed, and anything else is reported as "other". A client cannot grow the
+// number of series by sending unusual requests.
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "leblanc"
+
+// Registry holds the server's metrics plus the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "http_requests_total",
+		Help: "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route pattern and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	graphqlOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "graphql_operations_total",
+		Help: "GraphQL operations by root field and result (ok or error).",
+	}, []string{"operation", "result"})
+	graphqlDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "graphql_operation_duration_seconds",
+		Help:    "GraphQL operation latency by root field.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	mongoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "mongo_command_duration_seconds",
+		Help:    "MongoDB command latency by command and result (ok or error).",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms .. ~4s
+	}, []string{"command", "result"})
+
+	bookingsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "bookings_created_total",
+		Help: "Bookings created by channel.",
+	}, []string{"channel"})
+	registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Name: "registrations_total",
+		Help: "Accounts registered (pending verification on REST).",
+	})
+	verifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "verifications_total",
+		Help: "Email verification attempts by result (verified or invalid).",
+	}, []string{"result"})
+	loginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "login_failures_total",
+		Help: "Failed logins by reason.",
+	}, []string{"reason"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "rate_limited_total",
+		Help: "Requests rejected with 429 by route policy.",
+	}, []string{"route"})
+
+	recoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "recommendation_duration_seconds",
+		Help:    "Recommendation latency by kind (single or group).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"kind"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		graphqlOperations, graphqlDuration,
+		mongoDuration,
+		bookingsCreated, registrations, verifications, loginFailures,
+		rateLimited,
+		recoDuration,
+	)
+}
+
+var httpMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// Booking channels reported by name; others count as "other".
+var bookingChannels = map[string]bool{"web": true, "app": true, "phone": true, "walk-in": true, "staff": true}
+
+// Login failure reasons.
+const (
+	LoginInvalidRequest = "invalid_request"
+	LoginUnknownUser    = "unknown_user"
+	LoginWrongPassword  = "wrong_password"
+	LoginUnverified     = "unverified"
+)
+
+// Recommendation kinds.
+const (
+	RecoSingle = "single"
+	RecoGroup  = "group"
+)
+
+// Middleware counts and times every request by its route pattern.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		if !httpMethods[method] {
+			method = "other"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(method, route, status).Inc()
+		httpDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveGraphQL records one GraphQL operation. operation must come from a fixed set.
+func ObserveGraphQL(operation string, err error, took time.Duration) {
+	graphqlOperations.WithLabelValues(operation, result(err)).Inc()
+	graphqlDuration.WithLabelValues(operation).Observe(took.Seconds())
+}
+
+// BookingCreated counts a stored booking.
+func BookingCreated(channel string) {
+	channel = strings.ToLower(strings.TrimSpace(channel))
+	switch {
+	case channel == "":
+		channel = "unknown"
+	case !bookingChannels[channel]:
+		channel = "other"
+	}
+	bookingsCreated.WithLabelValues(channel).Inc()
+}
+
+// Registered counts a new account.
+func Registered() { registrations.Inc() }
+
+// Verified counts a verification attempt.
+func Verified(ok bool) {
+	if ok {
+		verifications.WithLabelValues("verified").Inc()
+	} else {
+		verifications.WithLabelValues("invalid").Inc()
+	}
+}
+
+// LoginFailed counts a failed login; reason is one of the Login* constants.
+func LoginFailed(reason string) { loginFailures.WithLabelValues(reason).Inc() }
+
+// RateLimited counts a rejected request; route is a configured "METHOD /route" policy key.
+func RateLimited(route string) { rateLimited.WithLabelValues(route).Inc() }
+
+// ObserveRecommendation records how long a recommendation of kind took since start.
+// Use it as defer metrics.ObserveRecommendation(metrics.RecoSingle, time.Now()).
+func ObserveRecommendation(kind string, start time.Time) {
+	recoDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves the metrics. With a token configured, scrapers must send it as a
+// bearer token; config refuses to enable metrics without one outside dev.
+func Handler(cfg config.MetricsConfig) gin.HandlerFunc {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		if cfg.Token != "" {
+			got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(cfg.Token)) != 1 {
+				c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+				apperr.Write(c, apperr.New(apperr.Unauthenticated, "unauthorized"))
+				return
+			}
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// mongoCommands are the commands reported by name; the driver's handshakes and anything
+// else count as "other".
+var mongoCommands = map[string]bool{
+	"find": true, "getMore": true, "aggregate": true, "count": true, "distinct": true,
+	"insert": true, "update": true, "delete": true, "findAndModify": true,
+	"createIndexes": true, "dropIndexes": true, "listIndexes": true, "ping": true,
+}
+
+// MongoMonitor times every command the driver sends.
+func MongoMonitor() *event.CommandMonitor {
+	observe := func(name, result string, took float64) {
+		if !mongoCommands[name] {
+			name = "other"
+		}
+		mongoDuration.WithLabelValues(name, result).Observe(took)
+	}
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			observe(e.CommandName, "ok", e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			observe(e.CommandName, "error", e.Duration.Seconds())
+		},
+	}
+}
@@ -0,0 +1,202 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All returns every migration, oldest first. Append new ones; never renumber or edit a
+// migration that has shipped.
+func All() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "user name and email unique indexes",
+			Up: createIndexes("users",
+				index("nameLower_1", bson.D{{Key: "nameLower", Value: 1}}, true),
+				index("emailLower_1", bson.D{{Key: "emailLower", Value: 1}}, true),
+			),
+			Down: dropIndexes("users", "nameLower_1", "emailLower_1"),
+		},
+		{
+			Version: 2,
+			Name:    "booking lookup indexes",
+			Up: createIndexes("bookings",
+				index("email_1_time_-1", bson.D{{Key: "email", Value: 1}, {Key: "time", Value: -1}}, false),
+				index("sessionId_1", bson.D{{Key: "sessionId", Value: 1}}, false),
+				index("createdAt_-1", bson.D{{Key: "createdAt", Value: -1}}, false),
+			),
+			Down: dropIndexes("bookings", "email_1_time_-1", "sessionId_1", "createdAt_-1"),
+		},
+		{
+			Version: 3,
+			Name:    "drink menu indexes",
+			Up: createIndexes("drinks",
+				index("tags_1", bson.D{{Key: "tags", Value: 1}}, false),
+				index("price_1", bson.D{{Key: "price", Value: 1}}, false),
+			),
+			Down: dropIndexes("drinks", "tags_1", "price_1"),
+		},
+		{
+			Version: 4,
+			Name:    "recommendation event indexes",
+			Up: createIndexes("reco_events",
+				index("exposure.key_1", bson.D{{Key: "exposure.key", Value: 1}}, false),
+				index("email_1_time_-1", bson.D{{Key: "email", Value: 1}, {Key: "time", Value: -1}}, false),
+			),
+			Down: dropIndexes("reco_events", "exposure.key_1", "email_1_time_-1"),
+		},
+		{
+			Version: 5,
+			Name:    "drink slug unique index",
+			// drinks seeded before menu.json have no slug until the next seed run
+			Up: createIndexes("drinks", mongo.IndexModel{
+				Keys: bson.D{{Key: "slug", Value: 1}},
+				Options: options.Index().SetName("slug_1").SetUnique(true).
+					SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}}),
+			}),
+			Down: dropIndexes("drinks", "slug_1"),
+		},
+		{
+			Version: 6,
+			Name:    "rate limit bucket expiry",
+			Up: createIndexes("rate_limits", mongo.IndexModel{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+			}),
+			Down: dropIndexes("rate_limits", "expiresAt_ttl"),
+		},
+		{
+			Version: 7,
+			Name:    "loyalty ledger indexes",
+			// a booking earns, redeems and refunds at most once each; a repeated Apply
+			// fails on this index and undoes its balance change
+			Up: createIndexes("loyalty_ledger",
+				index("userId_1_createdAt_-1", bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}, false),
+				mongo.IndexModel{
+					Keys: bson.D{{Key: "bookingId", Value: 1}, {Key: "kind", Value: 1}},
+					Options: options.Index().SetName("bookingId_1_kind_1").SetUnique(true).
+						SetPartialFilterExpression(bson.M{"bookingId": bson.M{"$exists": true}}),
+				},
+			),
+			Down: dropIndexes("loyalty_ledger", "userId_1_createdAt_-1", "bookingId_1_kind_1"),
+		},
+		{
+			Version: 8,
+			Name:    "booking user index",
+			Up: createIndexes("bookings",
+				index("userId_1", bson.D{{Key: "userId", Value: 1}}, false),
+			),
+			Down: dropIndexes("bookings", "userId_1"),
+		},
+		{
+			Version: 9,
+			Name:    "voucher promotion index",
+			Up: createIndexes("vouchers",
+				index("promotionId_1", bson.D{{Key: "promotionId", Value: 1}}, false),
+			),
+			Down: dropIndexes("vouchers", "promotionId_1"),
+		},
+		{
+			Version: 10,
+			Name:    "gift card indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				if err := createIndexes("giftcards",
+					index("code_1", bson.D{{Key: "code", Value: 1}}, true),
+					index("createdAt_-1", bson.D{{Key: "createdAt", Value: -1}}, false),
+				)(ctx, db); err != nil {
+					return err
+				}
+				// like the loyalty ledger, a booking redeems and refunds a card at most once
+				return createIndexes("giftcard_ledger",
+					index("cardId_1_createdAt_-1", bson.D{{Key: "cardId", Value: 1}, {Key: "createdAt", Value: -1}}, false),
+					mongo.IndexModel{
+						Keys: bson.D{{Key: "bookingId", Value: 1}, {Key: "kind", Value: 1}},
+						Options: options.Index().SetName("bookingId_1_kind_1").SetUnique(true).
+							SetPartialFilterExpression(bson.M{"bookingId": bson.M{"$exists": true}}),
+					},
+				)(ctx, db)
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				if err := dropIndexes("giftcard_ledger", "cardId_1_createdAt_-1", "bookingId_1_kind_1")(ctx, db); err != nil {
+					return err
+				}
+				return dropIndexes("giftcards", "code_1", "createdAt_-1")(ctx, db)
+			},
+		},
+		{
+			Version: 11,
+			Name:    "payment indexes",
+			// the expiry worker looks up pending payments past their deadline
+			Up: createIndexes("payments",
+				index("status_1_expiresAt_1", bson.D{{Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}}, false),
+				index("bookingId_1", bson.D{{Key: "bookingId", Value: 1}}, false),
+			),
+			Down: dropIndexes("payments", "status_1_expiresAt_1", "bookingId_1"),
+		},
+		{
+			Version: 12,
+			Name:    "invoice indexes",
+			// numbers are unique per branch and kind, and a booking gets one invoice of each kind
+			Up: createIndexes("invoices",
+				index("branch_1_kind_1_number_-1", bson.D{{Key: "branch", Value: 1}, {Key: "kind", Value: 1}, {Key: "number", Value: -1}}, true),
+				index("bookingId_1_kind_1", bson.D{{Key: "bookingId", Value: 1}, {Key: "kind", Value: 1}}, true),
+				index("issuedAt_-1", bson.D{{Key: "issuedAt", Value: -1}}, false),
+			),
+			Down: dropIndexes("invoices", "branch_1_kind_1_number_-1", "bookingId_1_kind_1", "issuedAt_-1"),
+		},
+		{
+			Version: 13,
+			Name:    "review indexes",
+			// one review per user and drink; pages by drink and the moderation queue
+			Up: createIndexes("reviews",
+				index("drinkId_1_userId_1", bson.D{{Key: "drinkId", Value: 1}, {Key: "userId", Value: 1}}, true),
+				index("drinkId_1_status_1__id_-1", bson.D{{Key: "drinkId", Value: 1}, {Key: "status", Value: 1}, {Key: "_id", Value: -1}}, false),
+				index("status_1__id_1", bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}, false),
+			),
+			Down: dropIndexes("reviews", "drinkId_1_userId_1", "drinkId_1_status_1__id_-1", "status_1__id_1"),
+		},
+	}
+}
+
+func index(name string, keys bson.D, unique bool) mongo.IndexModel {
+	opts := options.Index().SetName(name)
+	if unique {
+		opts.SetUnique(true)
+	}
+	return mongo.IndexModel{Keys: keys, Options: opts}
+}
+
+// createIndexes is idempotent: creating an index that already exists with the same
+// definition is a no-op.
+func createIndexes(coll string, models ...mongo.IndexModel) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(coll).Indexes().CreateMany(ctx, models)
+		return err
+	}
+}
+
+// dropIndexes ignores indexes (and collections) that are already gone.
+func dropIndexes(coll string, names ...string) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, name := range names {
+			if _, err := db.Collection(coll).Indexes().DropOne(ctx, name); err != nil && !isNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func isNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		// IndexNotFound, NamespaceNotFound
+		return cmdErr.Code == 27 || cmdErr.Code == 26
+	}
+	return false
+}
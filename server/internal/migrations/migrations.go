@@ -0,0 +1,281 @@
+// Package migrations applies ordered, versioned schema changes to the Mongo database and
+// records them in the schema_migrations collection.
+//
+// Mongo has no transactional DDL, so each Up and Down must be safe to re-run: a migration
+// that fails halfway is retried from the start on the next run.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// HistoryCollection has one document per applied migration, keyed by version.
+	HistoryCollection = "schema_migrations"
+	// LockCollection holds the single lock document while a migration run is in progress.
+	LockCollection = "schema_migrations_lock"
+
+	lockID = "lock"
+	// DefaultLockTTL is how long a lock is honoured before another run may take it over,
+	// in case the process holding it died.
+	DefaultLockTTL = 10 * time.Minute
+)
+
+var ErrLocked = errors.New("another migration run holds the lock")
+
+// Migration is one schema change. Versions must be unique and are applied in ascending order.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is a migration's entry in HistoryCollection.
+type Record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// Status is one line of the status report.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Unknown is set for versions recorded in the database but missing from this build.
+	Unknown bool
+}
+
+type Migrator struct {
+	DB         *mongo.Database
+	Migrations []Migration
+	// Owner identifies this process in the lock document.
+	Owner   string
+	LockTTL time.Duration
+	// DryRun prints what would run without changing anything or taking the lock.
+	DryRun bool
+	Out    io.Writer
+}
+
+// New returns a migrator for all registered migrations.
+func New(db *mongo.Database) *Migrator {
+	host, _ := os.Hostname()
+	return &Migrator{
+		DB:         db,
+		Migrations: All(),
+		Owner:      fmt.Sprintf("%s:%d", host, os.Getpid()),
+		LockTTL:    DefaultLockTTL,
+		Out:        os.Stdout,
+	}
+}
+
+func (m *Migrator) sorted() ([]Migration, error) {
+	list := append([]Migration(nil), m.Migrations...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i, mig := range list {
+		if mig.Version <= 0 || mig.Up == nil || mig.Down == nil {
+			return nil, fmt.Errorf("migration %d %q: needs a positive version, Up and Down", mig.Version, mig.Name)
+		}
+		if i > 0 && list[i-1].Version == mig.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", mig.Version)
+		}
+	}
+	return list, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]Record, error) {
+	cur, err := m.DB.Collection(HistoryCollection).Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	out := make(map[int]Record, len(records))
+	for _, r := range records {
+		out[r.Version] = r
+	}
+	return out, nil
+}
+
+// Status lists every known migration and whether it has been applied, followed by any
+// applied versions this build does not know about.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	list, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []Status
+	for _, mig := range list {
+		r, ok := applied[mig.Version]
+		out = append(out, Status{Version: mig.Version, Name: mig.Name, Applied: ok, AppliedAt: r.AppliedAt})
+		delete(applied, mig.Version)
+	}
+	for _, r := range applied {
+		out = append(out, Status{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: r.AppliedAt, Unknown: true})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Pending returns the migrations that have not been applied yet, in order.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	list, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, mig := range list {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies pending migrations up to and including version target (0 = all).
+func (m *Migrator) Up(ctx context.Context, target int) error {
+	return m.locked(ctx, func() error {
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		ran := 0
+		for _, mig := range pending {
+			if target > 0 && mig.Version > target {
+				break
+			}
+			ran++
+			if m.DryRun {
+				fmt.Fprintf(m.Out, "would apply %04d %s\n", mig.Version, mig.Name)
+				continue
+			}
+			fmt.Fprintf(m.Out, "applying %04d %s\n", mig.Version, mig.Name)
+			if err := mig.Up(ctx, m.DB); err != nil {
+				return fmt.Errorf("migration %04d %s: %w", mig.Version, mig.Name, err)
+			}
+			rec := Record{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}
+			if _, err := m.DB.Collection(HistoryCollection).InsertOne(ctx, rec); err != nil {
+				return fmt.Errorf("record migration %04d: %w", mig.Version, err)
+			}
+		}
+		if ran == 0 {
+			fmt.Fprintln(m.Out, "nothing to apply")
+		}
+		return nil
+	})
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func() error {
+		list, err := m.sorted()
+		if err != nil {
+			return err
+		}
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		byVersion := make(map[int]Migration, len(list))
+		for _, mig := range list {
+			byVersion[mig.Version] = mig
+		}
+		versions := make([]int, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		if steps > len(versions) {
+			steps = len(versions)
+		}
+		if steps == 0 {
+			fmt.Fprintln(m.Out, "nothing to roll back")
+		}
+		for _, v := range versions[:steps] {
+			mig, ok := byVersion[v]
+			if !ok {
+				return fmt.Errorf("migration %04d %s is applied but unknown to this build; cannot roll it back", v, applied[v].Name)
+			}
+			if m.DryRun {
+				fmt.Fprintf(m.Out, "would roll back %04d %s\n", mig.Version, mig.Name)
+				continue
+			}
+			fmt.Fprintf(m.Out, "rolling back %04d %s\n", mig.Version, mig.Name)
+			if err := mig.Down(ctx, m.DB); err != nil {
+				return fmt.Errorf("roll back %04d %s: %w", mig.Version, mig.Name, err)
+			}
+			if _, err := m.DB.Collection(HistoryCollection).DeleteOne(ctx, bson.M{"_id": v}); err != nil {
+				return fmt.Errorf("unrecord migration %04d: %w", v, err)
+			}
+		}
+		return nil
+	})
+}
+
+// locked runs fn while holding the migration lock. Dry runs change nothing and skip the lock.
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	if m.DryRun {
+		return fn()
+	}
+	if err := m.acquire(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		// release even if ctx was cancelled mid-run
+		rctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = m.DB.Collection(LockCollection).DeleteOne(rctx, bson.M{"_id": lockID, "owner": m.Owner})
+	}()
+	return fn()
+}
+
+// acquire takes the lock, or takes over a lock whose holder let it expire.
+func (m *Migrator) acquire(ctx context.Context) error {
+	ttl := m.LockTTL
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+	now := time.Now()
+	coll := m.DB.Collection(LockCollection)
+	filter := bson.M{"_id": lockID, "expiresAt": bson.M{"$lt": now}}
+	update := bson.M{"$set": bson.M{"owner": m.Owner, "lockedAt": now, "expiresAt": now.Add(ttl)}}
+	err := coll.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetUpsert(true)).Err()
+	switch {
+	case err == nil, errors.Is(err, mongo.ErrNoDocuments):
+		// took over an expired lock, or upserted a fresh one
+		return nil
+	case mongo.IsDuplicateKeyError(err):
+		// the upsert collided with a live lock
+		var holder struct {
+			Owner     string    `bson:"owner"`
+			ExpiresAt time.Time `bson:"expiresAt"`
+		}
+		_ = coll.FindOne(ctx, bson.M{"_id": lockID}).Decode(&holder)
+		return fmt.Errorf("%w (owner %s, expires %s)", ErrLocked, holder.Owner, holder.ExpiresAt.Format(time.RFC3339))
+	default:
+		return err
+	}
+}
@@ -0,0 +1,167 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func noop(ctx context.Context, db *mongo.Database) error { return nil }
+
+func TestSorted(t *testing.T) {
+	mig := func(v int) Migration { return Migration{Version: v, Name: fmt.Sprint(v), Up: noop, Down: noop} }
+	tests := []struct {
+		name    string
+		list    []Migration
+		want    []int
+		wantErr bool
+	}{
+		{"ascending", []Migration{mig(1), mig(2), mig(3)}, []int{1, 2, 3}, false},
+		{"out of order", []Migration{mig(3), mig(1), mig(2)}, []int{1, 2, 3}, false},
+		{"gaps allowed", []Migration{mig(10), mig(2)}, []int{2, 10}, false},
+		{"duplicate version", []Migration{mig(1), mig(2), mig(1)}, nil, true},
+		{"zero version", []Migration{mig(0), mig(1)}, nil, true},
+		{"no Down", []Migration{mig(1), {Version: 2, Up: noop}}, nil, true},
+		{"no Up", []Migration{{Version: 1, Down: noop}}, nil, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &Migrator{Migrations: tc.list}
+			list, err := m.sorted()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("sorted error = %v, want error %v", err, tc.wantErr)
+			}
+			var got []int
+			for _, mig := range list {
+				got = append(got, mig.Version)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("sorted versions = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestCatalog checks the shipped migrations are numbered 1, 2, 3... in the order listed.
+func TestCatalog(t *testing.T) {
+	for i, mig := range All() {
+		if mig.Version != i+1 || mig.Name == "" || mig.Up == nil || mig.Down == nil {
+			t.Errorf("migration %d is %d %q, want version %d with a name, Up and Down", i, mig.Version, mig.Name, i+1)
+		}
+	}
+}
+
+// testDB returns a scratch database on TEST_MONGO_URI, dropped after the test. Tests
+// that need Mongo are skipped without it.
+func testDB(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database(fmt.Sprintf("leblanc_migrations_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = db.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+	return db
+}
+
+// TestUpDownOrder applies migrations listed out of order up to a target, then the rest,
+// then rolls two back, and checks each step ran once in version order.
+func TestUpDownOrder(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	var ran []string
+	mig := func(v int) Migration {
+		return Migration{Version: v, Name: fmt.Sprint(v),
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				ran = append(ran, fmt.Sprint("up ", v))
+				return nil
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				ran = append(ran, fmt.Sprint("down ", v))
+				return nil
+			},
+		}
+	}
+	m := &Migrator{DB: db, Migrations: []Migration{mig(3), mig(1), mig(2)}, Owner: "test", Out: io.Discard}
+
+	steps := []struct {
+		name string
+		run  func() error
+		want []string
+	}{
+		{"up to 2", func() error { return m.Up(ctx, 2) }, []string{"up 1", "up 2"}},
+		{"up", func() error { return m.Up(ctx, 0) }, []string{"up 3"}},
+		{"up again", func() error { return m.Up(ctx, 0) }, nil},
+		{"down 2", func() error { return m.Down(ctx, 2) }, []string{"down 3", "down 2"}},
+	}
+	for _, s := range steps {
+		ran = nil
+		if err := s.run(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if !slices.Equal(ran, s.want) {
+			t.Errorf("%s ran %q, want %q", s.name, ran, s.want)
+		}
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil || len(pending) != 2 || pending[0].Version != 2 || pending[1].Version != 3 {
+		t.Errorf("pending = %+v, %v; want 2 and 3", pending, err)
+	}
+}
+
+// TestLock checks that a second run is refused while the lock is held, takes over an
+// expired lock, and that a run only releases its own lock.
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	a := &Migrator{DB: db, Owner: "a", LockTTL: time.Minute, Out: io.Discard}
+	b := &Migrator{DB: db, Owner: "b", LockTTL: time.Minute, Out: io.Discard}
+
+	if err := a.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.acquire(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("acquire while a holds the lock = %v, want ErrLocked", err)
+	}
+
+	// a dies; once its lock expires b takes over
+	expire := bson.M{"$set": bson.M{"expiresAt": time.Now().Add(-time.Second)}}
+	if _, err := db.Collection(LockCollection).UpdateByID(ctx, lockID, expire); err != nil {
+		t.Fatal(err)
+	}
+	err := b.locked(ctx, func() error {
+		if err := a.acquire(ctx); !errors.Is(err, ErrLocked) {
+			t.Errorf("acquire while b holds the lock = %v, want ErrLocked", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.Collection(LockCollection).CountDocuments(ctx, bson.M{}); err != nil || n != 0 {
+		t.Errorf("%d lock documents left after the run, %v; want none", n, err)
+	}
+	if err := a.acquire(ctx); err != nil {
+		t.Errorf("acquire after b released = %v", err)
+	}
+}
@@ -10,6 +10,10 @@ type BookingItem struct {
 	DrinkID primitive.ObjectID `bson:"drinkId" json:"drinkId"`
 	Qty     int                `bson:"qty" json:"qty"`
 	Options map[string]any     `bson:"options" json:"options"`
+	// Name and Price (VND each) are copied from the menu when the booking is made, for
+	// receipts. Bookings made before they were recorded do not have them.
+	Name  string `bson:"name,omitempty" json:"name,omitempty"`
+	Price int    `bson:"price,omitempty" json:"price,omitempty"`
 }
 
 type Booking struct {
@@ -21,4 +25,45 @@ type Booking struct {
 	Guests  int                `bson:"guests,omitempty" json:"guests,omitempty"`
 	Items   []BookingItem      `bson:"items" json:"items"`
 	Channel string             `bson:"channel" json:"channel"`
+
+	// SessionID links an anonymous booking to the recommendations shown in the same session.
+	SessionID string `bson:"sessionId,omitempty" json:"sessionId,omitempty"`
+	// UserID is set when a logged-in user made the booking.
+	UserID *primitive.ObjectID `bson:"userId,omitempty" json:"userId,omitempty"`
+	// Status is empty on bookings made before statuses existed; treat it as pending.
+	Status string `bson:"status,omitempty" json:"status,omitempty"`
+
+	// Amounts in VND, priced when the booking is made. Total = Subtotal - Discount, where
+	// Discount is the sum of the promotions and the loyalty redemption. A gift card pays
+	// for part of Total rather than discounting it; AmountDue is what is left to pay.
+	Subtotal        int                `bson:"subtotal,omitempty" json:"subtotal,omitempty"`
+	Discount        int                `bson:"discount,omitempty" json:"discount,omitempty"`
+	Total           int                `bson:"total,omitempty" json:"total,omitempty"`
+	Promotions      []AppliedPromotion `bson:"promotions,omitempty" json:"promotions,omitempty"`
+	Redemption      *Redemption        `bson:"redemption,omitempty" json:"redemption,omitempty"`
+	GiftCardPayment *GiftCardPayment   `bson:"giftCardPayment,omitempty" json:"giftCardPayment,omitempty"`
+	AmountDue       int                `bson:"amountDue,omitempty" json:"amountDue,omitempty"`
+
+	// Deposit is set on bookings large enough to need one; they are cancelled if it is
+	// not paid in time.
+	Deposit *Deposit `bson:"deposit,omitempty" json:"deposit,omitempty"`
+
+	CreatedAt   time.Time  `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	CompletedAt *time.Time `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+}
+
+// Booking statuses. Only completed bookings earn loyalty points; cancelling refunds any
+// points or reward the booking redeemed.
+const (
+	BookingPending   = "pending"
+	BookingCompleted = "completed"
+	BookingCancelled = "cancelled"
+)
+
+// Redemption records the loyalty points or stamp-card reward spent on a booking.
+type Redemption struct {
+	Points int `bson:"points,omitempty" json:"points,omitempty"`
+	// Reward is the stamp card (drink tag) whose free drink was used.
+	Reward string `bson:"reward,omitempty" json:"reward,omitempty"`
+	Value  int    `bson:"value" json:"value"`
 }
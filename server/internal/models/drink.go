@@ -12,6 +12,7 @@ type EmotionFit struct {
 
 type Drink struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Slug       string             `bson:"slug,omitempty" json:"slug,omitempty"` // stable key in data/menu.json
 	Name       string             `bson:"name" json:"name"`
 	Price      int                `bson:"price" json:"price"`
 	Tags       []string           `bson:"tags" json:"tags"`
@@ -20,6 +21,15 @@ type Drink struct {
 	Sweetness  int                `bson:"sweetness" json:"sweetness"`
 	ColorTone  string             `bson:"colorTone" json:"colorTone"` // warm|cool|neutral
 	EmotionFit EmotionFit         `bson:"emotionFit" json:"emotionFit"`
+	Allergens  []string           `bson:"allergens,omitempty" json:"allergens,omitempty"` // dairy|nuts|gluten|coconut|honey
 	Image      string             `bson:"image" json:"image"`
 	Desc       string             `bson:"desc" json:"desc"`
+	// Archived drinks were removed from the menu; they stay in the collection so
+	// existing bookings still resolve, but are not listed or recommended.
+	Archived bool `bson:"archived,omitempty" json:"archived,omitempty"`
+	// Rating is the average of approved reviews, kept up to date as reviews are
+	// moderated; RatingSum is the running total it is computed from.
+	Rating      float64 `bson:"rating,omitempty" json:"rating"`
+	RatingCount int     `bson:"ratingCount,omitempty" json:"ratingCount"`
+	RatingSum   int     `bson:"ratingSum,omitempty" json:"-"`
 }
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Gift card statuses. A voided card keeps its history but cannot be spent.
+const (
+	GiftCardActive = "active"
+	GiftCardVoided = "voided"
+)
+
+// GiftCard is café credit in VND, spent by quoting Code on a booking. The ledger holds
+// how Balance got where it is.
+type GiftCard struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Code      string             `bson:"code" json:"code"`
+	Value     int                `bson:"value" json:"value"`
+	Balance   int                `bson:"balance" json:"balance"`
+	Status    string             `bson:"status" json:"status"`
+	ExpiresAt *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	// Note is for the café: who bought it, who it is for.
+	Note      string     `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time  `bson:"updatedAt" json:"updatedAt"`
+	VoidedAt  *time.Time `bson:"voidedAt,omitempty" json:"voidedAt,omitempty"`
+}
+
+// Expired reports whether the card can no longer be spent at t.
+func (g *GiftCard) Expired(t time.Time) bool {
+	return g.ExpiresAt != nil && !t.Before(*g.ExpiresAt)
+}
+
+// Gift card ledger entry kinds.
+const (
+	GiftCardIssue  = "issue"  // the initial value
+	GiftCardRedeem = "redeem" // spent on a booking
+	GiftCardRefund = "refund" // a cancelled booking's payment given back
+	GiftCardVoid   = "void"   // the remaining balance written off
+)
+
+// GiftCardEntry is one change to a card. Amount is signed; Balance is the card's balance
+// after it.
+type GiftCardEntry struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"_id"`
+	CardID    primitive.ObjectID  `bson:"cardId" json:"cardId"`
+	Kind      string              `bson:"kind" json:"kind"`
+	Amount    int                 `bson:"amount" json:"amount"`
+	Balance   int                 `bson:"balance" json:"balance"`
+	BookingID *primitive.ObjectID `bson:"bookingId,omitempty" json:"bookingId,omitempty"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+}
+
+// GiftCardPayment records the part of a booking paid with a gift card. Code is masked to
+// its last four characters.
+type GiftCardPayment struct {
+	CardID primitive.ObjectID `bson:"cardId" json:"cardId"`
+	Code   string             `bson:"code" json:"code"`
+	Amount int                `bson:"amount" json:"amount"`
+}
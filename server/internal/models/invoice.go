@@ -0,0 +1,96 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invoice kinds. A receipt is for the guest; a VAT invoice also names the company that
+// pays, so it can claim the VAT back.
+const (
+	InvoiceReceipt = "receipt"
+	InvoiceVAT     = "vat"
+)
+
+// Invoice is a receipt or VAT invoice for a completed booking. Everything printed on it
+// is copied in when it is issued, so later menu, price or company changes do not alter
+// it. Number counts up from 1 per Branch and Kind with no gaps; invoices are never
+// deleted.
+type Invoice struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	BookingID primitive.ObjectID `bson:"bookingId" json:"bookingId"`
+	Kind      string             `bson:"kind" json:"kind"`
+	Branch    string             `bson:"branch" json:"branch"`
+	Number    int                `bson:"number" json:"number"`
+	// Code is the printed number, see InvoiceCode.
+	Code string `bson:"code" json:"code"`
+
+	Seller   InvoiceSeller `bson:"seller" json:"seller"`
+	Customer InvoiceParty  `bson:"customer" json:"customer"`
+	// Company is set on VAT invoices only.
+	Company *Company `bson:"company,omitempty" json:"company,omitempty"`
+
+	Lines []InvoiceLine `bson:"lines" json:"lines"`
+	// Adjustments are the promotions and loyalty redemptions, as negative amounts.
+	Adjustments []InvoiceAdjustment `bson:"adjustments,omitempty" json:"adjustments,omitempty"`
+	// Amounts in VND. Total = Subtotal - Discount and includes VAT at VATPercent.
+	Subtotal   int `bson:"subtotal" json:"subtotal"`
+	Discount   int `bson:"discount" json:"discount"`
+	Total      int `bson:"total" json:"total"`
+	VATPercent int `bson:"vatPercent" json:"vatPercent"`
+	VAT        int `bson:"vat" json:"vat"`
+	// Payments already made towards Total: gift card and deposit.
+	Payments  []InvoiceAdjustment `bson:"payments,omitempty" json:"payments,omitempty"`
+	AmountDue int                 `bson:"amountDue" json:"amountDue"`
+
+	VisitAt  time.Time `bson:"visitAt" json:"visitAt"`
+	IssuedAt time.Time `bson:"issuedAt" json:"issuedAt"`
+}
+
+// InvoiceSeller is the café as printed on the invoice.
+type InvoiceSeller struct {
+	Name    string `bson:"name" json:"name"`
+	TaxCode string `bson:"taxCode,omitempty" json:"taxCode,omitempty"`
+	Address string `bson:"address,omitempty" json:"address,omitempty"`
+}
+
+// InvoiceParty is the guest who made the booking.
+type InvoiceParty struct {
+	Name  string `bson:"name" json:"name"`
+	Email string `bson:"email" json:"email"`
+	Phone string `bson:"phone,omitempty" json:"phone,omitempty"`
+}
+
+// Company is the buyer of a VAT invoice.
+type Company struct {
+	Name    string `bson:"name" json:"name"`
+	TaxCode string `bson:"taxCode" json:"taxCode"`
+	Address string `bson:"address" json:"address"`
+	// Email receives the invoice; the booking email is used when empty.
+	Email string `bson:"email,omitempty" json:"email,omitempty"`
+}
+
+// InvoiceLine is one drink as it was sold.
+type InvoiceLine struct {
+	DrinkID primitive.ObjectID `bson:"drinkId" json:"drinkId"`
+	Name    string             `bson:"name" json:"name"`
+	// Options are the item's options as "key: value", sorted.
+	Options   []string `bson:"options,omitempty" json:"options,omitempty"`
+	Qty       int      `bson:"qty" json:"qty"`
+	UnitPrice int      `bson:"unitPrice" json:"unitPrice"`
+	Amount    int      `bson:"amount" json:"amount"`
+}
+
+// InvoiceAdjustment is a labelled amount below the lines.
+type InvoiceAdjustment struct {
+	Label  string `bson:"label" json:"label"`
+	Amount int    `bson:"amount" json:"amount"`
+}
+
+// InvoiceCode formats an invoice number as printed, e.g. "LB01-V-0000042".
+func InvoiceCode(branch, kind string, number int) string {
+	return fmt.Sprintf("%s-%s-%07d", branch, strings.ToUpper(kind[:1]), number)
+}
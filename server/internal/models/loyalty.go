@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoyaltyAccount is a user's current balance; the ledger holds how it got there.
+type LoyaltyAccount struct {
+	UserID primitive.ObjectID `bson:"_id" json:"userId"`
+	Points int                `bson:"points" json:"points"`
+	// Stamps and Rewards are keyed by stamp card (drink tag). Rewards are free drinks
+	// earned but not yet redeemed.
+	Stamps    map[string]int `bson:"stamps,omitempty" json:"stamps"`
+	Rewards   map[string]int `bson:"rewards,omitempty" json:"rewards"`
+	UpdatedAt time.Time      `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+}
+
+// Loyalty ledger entry kinds.
+const (
+	LoyaltyEarn   = "earn"   // points and stamps from a completed booking
+	LoyaltyReward = "reward" // a full stamp card turned into a free drink
+	LoyaltyRedeem = "redeem" // points or a free drink spent on a booking
+	LoyaltyRefund = "refund" // a cancelled booking's redemption given back
+)
+
+// LoyaltyEntry is one change to an account. Amounts are signed.
+type LoyaltyEntry struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"_id"`
+	UserID    primitive.ObjectID  `bson:"userId" json:"userId"`
+	Kind      string              `bson:"kind" json:"kind"`
+	Points    int                 `bson:"points,omitempty" json:"points,omitempty"`
+	Stamps    map[string]int      `bson:"stamps,omitempty" json:"stamps,omitempty"`
+	Rewards   map[string]int      `bson:"rewards,omitempty" json:"rewards,omitempty"`
+	BookingID *primitive.ObjectID `bson:"bookingId,omitempty" json:"bookingId,omitempty"`
+	Note      string              `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment statuses. A payment starts pending and moves once to paid, failed, expired
+// or cancelled; a paid one may later be refunded.
+const (
+	PaymentPending   = "pending"
+	PaymentPaid      = "paid"
+	PaymentFailed    = "failed"
+	PaymentExpired   = "expired"   // not paid within the deposit timeout
+	PaymentCancelled = "cancelled" // the booking was cancelled before it was paid
+	PaymentRefunded  = "refunded"
+)
+
+// Payment is one attempt to collect money through the payment provider. Its ID is the
+// reference the provider sends back in callbacks.
+type Payment struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	BookingID primitive.ObjectID `bson:"bookingId" json:"bookingId"`
+	Provider  string             `bson:"provider" json:"provider"`
+	Amount    int                `bson:"amount" json:"amount"`
+	Status    string             `bson:"status" json:"status"`
+	// Ref is the provider's transaction number, needed for refunds.
+	Ref        string     `bson:"ref,omitempty" json:"ref,omitempty"`
+	ExpiresAt  time.Time  `bson:"expiresAt" json:"expiresAt"`
+	PaidAt     *time.Time `bson:"paidAt,omitempty" json:"paidAt,omitempty"`
+	RefundedAt *time.Time `bson:"refundedAt,omitempty" json:"refundedAt,omitempty"`
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// DepositForfeited marks a deposit kept because the booking was cancelled too late for
+// a refund. The payment itself stays paid.
+const DepositForfeited = "forfeited"
+
+// Deposit is the part of a large booking paid up front. Status follows the payment's,
+// or is DepositForfeited.
+type Deposit struct {
+	PaymentID primitive.ObjectID `bson:"paymentId" json:"paymentId"`
+	Amount    int                `bson:"amount" json:"amount"`
+	Status    string             `bson:"status" json:"status"`
+	DueAt     time.Time          `bson:"dueAt" json:"dueAt"`
+	// CheckoutURL is where to send the customer to pay. It is only returned when the
+	// booking is made.
+	CheckoutURL string `bson:"-" json:"checkoutUrl,omitempty"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Promotion kinds.
+const (
+	PromoPercent = "percent" // Percent off the matching items
+	PromoFixed   = "fixed"   // Amount VND off the matching items
+	PromoBuyGet  = "buy_get" // buy BuyQty matching items, get GetQty more free
+)
+
+// Promotion is a discount applied automatically to bookings that match it, or only with
+// one of its vouchers when VoucherOnly is set.
+type Promotion struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Active      bool               `bson:"active" json:"active"`
+	Kind        string             `bson:"kind" json:"kind"`
+	Percent     int                `bson:"percent,omitempty" json:"percent,omitempty"`
+	Amount      int                `bson:"amount,omitempty" json:"amount,omitempty"`
+	BuyQty      int                `bson:"buyQty,omitempty" json:"buyQty,omitempty"`
+	GetQty      int                `bson:"getQty,omitempty" json:"getQty,omitempty"`
+
+	// Tags limits the promotion to drinks with any of these tags; empty matches all.
+	Tags []string `bson:"tags,omitempty" json:"tags,omitempty"`
+	// MinSubtotal is the smallest booking subtotal (VND) it applies to.
+	MinSubtotal int `bson:"minSubtotal,omitempty" json:"minSubtotal,omitempty"`
+	// StartsAt and EndsAt bound the booking times it applies to; Windows further limit
+	// them to hours of the week in café local time.
+	StartsAt *time.Time   `bson:"startsAt,omitempty" json:"startsAt,omitempty"`
+	EndsAt   *time.Time   `bson:"endsAt,omitempty" json:"endsAt,omitempty"`
+	Windows  []TimeWindow `bson:"windows,omitempty" json:"windows,omitempty"`
+
+	// MaxUses caps bookings across all customers, MaxUsesPerUser per customer; 0 is
+	// unlimited. Uses counts bookings that applied it.
+	MaxUses        int `bson:"maxUses,omitempty" json:"maxUses,omitempty"`
+	MaxUsesPerUser int `bson:"maxUsesPerUser,omitempty" json:"maxUsesPerUser,omitempty"`
+	Uses           int `bson:"uses" json:"uses"`
+
+	VoucherOnly bool `bson:"voucherOnly,omitempty" json:"voucherOnly,omitempty"`
+	// Stackable promotions add to the best non-stackable one; higher Priority wins ties.
+	Stackable bool `bson:"stackable,omitempty" json:"stackable,omitempty"`
+	Priority  int  `bson:"priority,omitempty" json:"priority,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// TimeWindow is a daily span in café local time, "21:00"-"23:00". End before Start wraps
+// past midnight. Days are 0 (Sunday) to 6; empty means every day.
+type TimeWindow struct {
+	Days  []int  `bson:"days,omitempty" json:"days,omitempty"`
+	Start string `bson:"start" json:"start"`
+	End   string `bson:"end" json:"end"`
+}
+
+// Voucher is a single-use code for a promotion.
+type Voucher struct {
+	Code        string              `bson:"_id" json:"code"`
+	PromotionID primitive.ObjectID  `bson:"promotionId" json:"promotionId"`
+	BookingID   *primitive.ObjectID `bson:"bookingId,omitempty" json:"bookingId,omitempty"`
+	UsedAt      *time.Time          `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
+}
+
+// AppliedPromotion records a discount a booking received.
+type AppliedPromotion struct {
+	PromotionID primitive.ObjectID `bson:"promotionId" json:"promotionId"`
+	Name        string             `bson:"name" json:"name"`
+	Voucher     string             `bson:"voucher,omitempty" json:"voucher,omitempty"`
+	Amount      int                `bson:"amount" json:"amount"`
+}
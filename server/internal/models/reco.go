@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecoEvent records what was recommended to whom, and from which query.
+type RecoEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Time      time.Time          `bson:"time" json:"time"`
+	Email     string             `bson:"email,omitempty" json:"email,omitempty"`
+	SessionID string             `bson:"sessionId,omitempty" json:"sessionId,omitempty"`
+	// UserID is set when a logged-in user asked; experiments bucket on it.
+	UserID   *primitive.ObjectID `bson:"userId,omitempty" json:"userId,omitempty"`
+	Endpoint string              `bson:"endpoint" json:"endpoint"` // rest|graphql
+	Scorer   string              `bson:"scorer" json:"scorer"`
+	// Query is the scorer input (services.RecoQuery); only offline evaluation reads it back.
+	Query    any       `bson:"query" json:"query"`
+	DrinkIDs []string  `bson:"drinkIds" json:"drinkIds"`
+	Exposure *Exposure `bson:"exposure,omitempty" json:"exposure,omitempty"`
+}
+
+// Exposure tells the client (and the event log) which arm served a recommendation.
+type Exposure struct {
+	Key string `bson:"key" json:"key"`
+	Arm string `bson:"arm" json:"arm"`
+}
+
+// Experiment splits recommendation traffic between scorer configurations.
+type Experiment struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Key       string             `bson:"key" json:"key"`
+	Active    bool               `bson:"active" json:"active"`
+	Arms      []ExperimentArm    `bson:"arms" json:"arms"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// ExperimentArm is one variant; Weight is its relative share of traffic.
+type ExperimentArm struct {
+	Name   string       `bson:"name" json:"name"`
+	Weight int          `bson:"weight" json:"weight"`
+	Scorer ScorerConfig `bson:"scorer" json:"scorer"`
+}
+
+// ScorerConfig names a scorer and its tuning; zero fields fall back to the defaults.
+type ScorerConfig struct {
+	Name          string         `json:"name" bson:"name"`
+	Scorer        string         `json:"scorer" bson:"scorer"` // emotion|cosine
+	Diversity     *float64       `json:"diversity,omitempty" bson:"diversity,omitempty"`
+	LabelWeights  *LabelWeights  `json:"labelWeights,omitempty" bson:"labelWeights,omitempty"`
+	CosineWeights *CosineWeights `json:"cosineWeights,omitempty" bson:"cosineWeights,omitempty"`
+}
+
+// LabelWeights weight the parts of the emotion-label scorer.
+type LabelWeights struct {
+	Emotion float64 `json:"emotion" bson:"emotion"`
+	Color   float64 `json:"color" bson:"color"`
+	Context float64 `json:"context" bson:"context"`
+}
+
+// CosineWeights weight the parts of the cosine-similarity scorer.
+type CosineWeights struct {
+	Emotion    float64 `json:"emotion" bson:"emotion"`
+	Preference float64 `json:"preference" bson:"preference"`
+	// Mismatch multiplies the preference score for each unmet caffeine/temp preference.
+	Mismatch float64 `json:"mismatch" bson:"mismatch"`
+}
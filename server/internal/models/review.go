@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Review statuses. Reviews with a comment wait as pending until an admin approves or
+// rejects them; only approved reviews are shown and counted in a drink's rating.
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// Review is a user's rating of a drink they had on a completed booking. A user has at
+// most one review per drink; writing again replaces it.
+type Review struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	DrinkID primitive.ObjectID `bson:"drinkId" json:"drinkId"`
+	UserID  primitive.ObjectID `bson:"userId" json:"userId"`
+	// BookingID is the completed booking that had the drink.
+	BookingID primitive.ObjectID `bson:"bookingId" json:"bookingId"`
+	// Author is the user's name when they wrote the review.
+	Author  string `bson:"author" json:"author"`
+	Rating  int    `bson:"rating" json:"rating"` // 1-5
+	Comment string `bson:"comment,omitempty" json:"comment,omitempty"`
+	Status  string `bson:"status" json:"status"`
+	// Note is the moderator's reason for rejecting the review.
+	Note        string     `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt   time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time  `bson:"updatedAt" json:"updatedAt"`
+	ModeratedAt *time.Time `bson:"moderatedAt,omitempty" json:"moderatedAt,omitempty"`
+}
+
+// Counted reports whether the review is part of its drink's rating.
+func (r *Review) Counted() bool { return r != nil && r.Status == ReviewApproved }
+
+// PublicReview is what everyone sees of an approved review.
+type PublicReview struct {
+	ID        primitive.ObjectID `json:"_id"`
+	DrinkID   primitive.ObjectID `json:"drinkId"`
+	Author    string             `json:"author"`
+	Rating    int                `json:"rating"`
+	Comment   string             `json:"comment,omitempty"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+func (r Review) Public() PublicReview {
+	return PublicReview{
+		ID:        r.ID,
+		DrinkID:   r.DrinkID,
+		Author:    r.Author,
+		Rating:    r.Rating,
+		Comment:   r.Comment,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
@@ -16,6 +16,21 @@ type User struct {
 	Verified     bool               `bson:"verified,omitempty" json:"verified,omitempty"`
 	PasswordHash string             `bson:"passwordHash" json:"-"`
 	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	// Favorites are drink IDs in the order they were added. Like SavedOrders they are
+	// only served to the user, through their own endpoints.
+	Favorites   []primitive.ObjectID `bson:"favorites,omitempty" json:"-"`
+	SavedOrders []SavedOrder         `bson:"savedOrders,omitempty" json:"-"`
+}
+
+// SavedOrder is a named set of drinks a user orders again and again. Items keep the
+// drink names and prices from when the order was saved.
+type SavedOrder struct {
+	ID        primitive.ObjectID `bson:"_id" json:"_id"`
+	Name      string             `bson:"name" json:"name"`
+	NameLower string             `bson:"nameLower" json:"-"`
+	Items     []BookingItem      `bson:"items" json:"items"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
 type PublicUser struct {
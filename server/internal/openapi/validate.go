@@ -0,0 +1,91 @@
+package openapi
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"leblanc/server/internal/apperr"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+// Validator checks every documented request against doc before the handler runs and
+// rejects mismatches with 400. Responses are checked afterwards; by then they have been
+// sent, so a mismatch is only logged. Meant for dev: it buffers each response body.
+func Validator(doc *openapi3.T) (gin.HandlerFunc, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	// keep 400 messages to one line instead of dumping the schema
+	openapi3.SchemaErrorDetailsDisabled = true
+	// /docs is HTML and invoices download as PDF; both bodies are checked as strings
+	openapi3filter.RegisterBodyDecoder("text/html", htmlDecoder)
+	openapi3filter.RegisterBodyDecoder("application/pdf", htmlDecoder)
+	// Authentication is the handlers' job; the validator only checks shapes.
+	opts := &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}
+
+	return func(c *gin.Context) {
+		route, params, err := router.FindRoute(c.Request)
+		if err != nil {
+			// undocumented paths are caught by TestRoutesDocumented, and 404s need no check
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		in := &openapi3filter.RequestValidationInput{Request: c.Request, PathParams: params, Route: route, Options: opts}
+		if err := openapi3filter.ValidateRequest(ctx, in); err != nil {
+			apperr.Write(c, apperr.New(apperr.InvalidArgument, "request does not match the API description: "+err.Error()))
+			return
+		}
+
+		rec := &recorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		c.Next()
+
+		out := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: in,
+			Status:                 rec.Status(),
+			Header:                 rec.Header(),
+			Options:                opts,
+		}
+		out.SetBodyBytes(rec.body.Bytes())
+		if err := openapi3filter.ValidateResponse(ctx, out); err != nil {
+			slog.ErrorContext(ctx, "response does not match openapi.json", "operation", operationID(route), "status", rec.Status(), "error", err)
+		}
+	}, nil
+}
+
+func htmlDecoder(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (any, error) {
+	b, err := io.ReadAll(body)
+	return string(b), err
+}
+
+func operationID(route *routers.Route) string {
+	if route.Operation != nil && route.Operation.OperationID != "" {
+		return route.Operation.OperationID
+	}
+	return route.Method + " " + route.Path
+}
+
+// recorder keeps a copy of the response body for validation.
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
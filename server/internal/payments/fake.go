@@ -0,0 +1,80 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fake stands in for a gateway in dev and tests. Its checkout URL is the signed return
+// callback itself, so opening it completes the payment.
+type Fake struct {
+	publicURL string
+	key       []byte
+}
+
+func NewFake(publicURL string, key []byte) *Fake {
+	return &Fake{publicURL: publicURL, key: key}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) Checkout(ctx context.Context, c Checkout) (string, error) {
+	q := f.Callback(c.PaymentID, c.Amount, true)
+	return f.publicURL + "/payments/fake/return?" + q.Encode(), nil
+}
+
+// Callback builds the signed query of a fake callback, for tests and for trying the
+// failure path by hand.
+func (f *Fake) Callback(paymentID string, amount int, paid bool) url.Values {
+	status := "failed"
+	if paid {
+		status = "paid"
+	}
+	q := url.Values{"paymentId": {paymentID}, "amount": {strconv.Itoa(amount)}, "status": {status}}
+	q.Set("sig", f.sign(q))
+	return q
+}
+
+func (f *Fake) sign(q url.Values) string {
+	mac := hmac.New(sha256.New, f.key)
+	mac.Write([]byte(strings.Join([]string{"fake", q.Get("paymentId"), q.Get("amount"), q.Get("status")}, "|")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (f *Fake) Verify(q url.Values) (*Result, error) {
+	if !hmac.Equal([]byte(q.Get("sig")), []byte(f.sign(q))) {
+		return nil, ErrSignature
+	}
+	amount, err := strconv.Atoi(q.Get("amount"))
+	if err != nil {
+		return nil, ErrAmount
+	}
+	return &Result{
+		PaymentID: q.Get("paymentId"),
+		Amount:    amount,
+		Paid:      q.Get("status") == "paid",
+		Ref:       "fake-" + q.Get("paymentId"),
+		PaidAt:    time.Now(),
+	}, nil
+}
+
+func (f *Fake) Acknowledge(err error) (int, any) {
+	if err != nil && !errors.Is(err, ErrAlreadyConfirmed) {
+		return http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()}
+	}
+	return http.StatusOK, map[string]any{"ok": true}
+}
+
+func (f *Fake) Refund(ctx context.Context, r Refund) error {
+	slog.InfoContext(ctx, "fake refund", "payment", r.PaymentID, "amount", r.Amount)
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package payments talks to the payment provider. Providers follow the redirect and
+// callback flow of Vietnamese gateways: the customer is sent to a signed checkout URL,
+// and the provider reports the outcome with a signed callback to the server (and with
+// a signed redirect back to it).
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"leblanc/server/internal/config"
+)
+
+// Errors a callback can fail with; Provider.Acknowledge turns them into the answer the
+// provider expects.
+var (
+	ErrSignature        = errors.New("payments: invalid signature")
+	ErrUnknownPayment   = errors.New("payments: unknown payment")
+	ErrAmount           = errors.New("payments: amount does not match")
+	ErrAlreadyConfirmed = errors.New("payments: payment already confirmed")
+)
+
+// Provider is a payment gateway.
+type Provider interface {
+	// Name is the provider's path segment in callback URLs, e.g. "vnpay".
+	Name() string
+	// Checkout returns the URL to send the customer to.
+	Checkout(ctx context.Context, c Checkout) (string, error)
+	// Verify checks a callback's signature and reads its outcome.
+	Verify(query url.Values) (*Result, error)
+	// Acknowledge is the answer to a server-to-server callback that ended with err.
+	Acknowledge(err error) (status int, body any)
+	// Refund gives a paid amount back in full.
+	Refund(ctx context.Context, r Refund) error
+}
+
+// Checkout is a payment to collect.
+type Checkout struct {
+	PaymentID string
+	Amount    int // VND
+	Info      string
+	// ReturnURL is where the customer comes back after paying.
+	ReturnURL string
+	ClientIP  string
+	ExpiresAt time.Time
+}
+
+// Result is the outcome a callback reports.
+type Result struct {
+	PaymentID string
+	Amount    int
+	Paid      bool
+	// Ref is the provider's transaction number.
+	Ref    string
+	PaidAt time.Time
+}
+
+// Refund identifies a paid payment to give back.
+type Refund struct {
+	PaymentID string
+	Amount    int
+	Ref       string
+	PaidAt    time.Time
+	Reason    string
+	ClientIP  string
+}
+
+// New returns the provider cfg selects; config validation has already rejected unknown
+// names, and anything but "vnpay" gets the fake one. key signs the fake provider's
+// callbacks.
+func New(cfg config.PaymentConfig, key []byte) Provider {
+	if cfg.Provider == "vnpay" {
+		return NewVNPay(cfg.VNPay, &http.Client{Timeout: 15 * time.Second})
+	}
+	return NewFake(cfg.PublicURL, key)
+}
+
+type clientIPKey struct{}
+
+// WithClientIP records the customer's IP for the provider, which requires it.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the IP set by WithClientIP, or 127.0.0.1.
+func ClientIP(ctx context.Context) string {
+	if ip, _ := ctx.Value(clientIPKey{}).(string); ip != "" {
+		return ip
+	}
+	return "127.0.0.1"
+}
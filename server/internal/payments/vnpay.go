@@ -0,0 +1,188 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/config"
+)
+
+// vnpayTime is VNPay's timestamp layout, always in Vietnam time.
+const vnpayTime = "20060102150405"
+
+var vnpayZone = time.FixedZone("ICT", 7*60*60)
+
+// VNPay implements the VNPay 2.1.0 payment gateway: HMAC-SHA512 signed checkout URLs
+// and callbacks, and the merchant API for refunds.
+type VNPay struct {
+	cfg    config.VNPayConfig
+	client *http.Client
+}
+
+func NewVNPay(cfg config.VNPayConfig, client *http.Client) *VNPay {
+	return &VNPay{cfg: cfg, client: client}
+}
+
+func (v *VNPay) Name() string { return "vnpay" }
+
+func (v *VNPay) Checkout(ctx context.Context, c Checkout) (string, error) {
+	now := time.Now()
+	q := url.Values{
+		"vnp_Version":    {"2.1.0"},
+		"vnp_Command":    {"pay"},
+		"vnp_TmnCode":    {v.cfg.TmnCode},
+		"vnp_Amount":     {strconv.Itoa(c.Amount * 100)},
+		"vnp_CurrCode":   {"VND"},
+		"vnp_TxnRef":     {c.PaymentID},
+		"vnp_OrderInfo":  {c.Info},
+		"vnp_OrderType":  {"other"},
+		"vnp_Locale":     {"vn"},
+		"vnp_ReturnUrl":  {c.ReturnURL},
+		"vnp_IpAddr":     {c.ClientIP},
+		"vnp_CreateDate": {now.In(vnpayZone).Format(vnpayTime)},
+		"vnp_ExpireDate": {c.ExpiresAt.In(vnpayZone).Format(vnpayTime)},
+	}
+	signed := vnpayQuery(q)
+	return v.cfg.PayURL + "?" + signed + "&vnp_SecureHash=" + v.sign(signed), nil
+}
+
+// vnpayQuery encodes q sorted by key, the string VNPay signs.
+func vnpayQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if q.Get(k) != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = url.QueryEscape(k) + "=" + url.QueryEscape(q.Get(k))
+	}
+	return strings.Join(parts, "&")
+}
+
+func (v *VNPay) sign(data string) string {
+	mac := hmac.New(sha512.New, []byte(v.cfg.HashSecret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (v *VNPay) Verify(query url.Values) (*Result, error) {
+	q := url.Values{}
+	for k, vals := range query {
+		if strings.HasPrefix(k, "vnp_") && k != "vnp_SecureHash" && k != "vnp_SecureHashType" {
+			q[k] = vals
+		}
+	}
+	got := strings.ToLower(query.Get("vnp_SecureHash"))
+	if !hmac.Equal([]byte(got), []byte(v.sign(vnpayQuery(q)))) {
+		return nil, ErrSignature
+	}
+	if q.Get("vnp_TmnCode") != v.cfg.TmnCode {
+		return nil, ErrUnknownPayment
+	}
+	amount, err := strconv.Atoi(q.Get("vnp_Amount"))
+	if err != nil {
+		return nil, ErrAmount
+	}
+	paidAt, err := time.ParseInLocation(vnpayTime, q.Get("vnp_PayDate"), vnpayZone)
+	if err != nil {
+		paidAt = time.Now()
+	}
+	return &Result{
+		PaymentID: q.Get("vnp_TxnRef"),
+		Amount:    amount / 100,
+		Paid:      q.Get("vnp_ResponseCode") == "00" && q.Get("vnp_TransactionStatus") == "00",
+		Ref:       q.Get("vnp_TransactionNo"),
+		PaidAt:    paidAt,
+	}, nil
+}
+
+// Acknowledge answers the IPN with the RspCode VNPay documents; it retries anything
+// but 00 and 02.
+func (v *VNPay) Acknowledge(err error) (int, any) {
+	code, msg := "00", "Confirm Success"
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrSignature):
+		code, msg = "97", "Invalid signature"
+	case errors.Is(err, ErrUnknownPayment):
+		code, msg = "01", "Order not found"
+	case errors.Is(err, ErrAlreadyConfirmed):
+		code, msg = "02", "Order already confirmed"
+	case errors.Is(err, ErrAmount):
+		code, msg = "04", "Invalid amount"
+	default:
+		code, msg = "99", "Unknown error"
+	}
+	return http.StatusOK, map[string]string{"RspCode": code, "Message": msg}
+}
+
+func (v *VNPay) Refund(ctx context.Context, r Refund) error {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	req := map[string]string{
+		"vnp_RequestId":       hex.EncodeToString(id),
+		"vnp_Version":         "2.1.0",
+		"vnp_Command":         "refund",
+		"vnp_TmnCode":         v.cfg.TmnCode,
+		"vnp_TransactionType": "02", // full refund
+		"vnp_TxnRef":          r.PaymentID,
+		"vnp_Amount":          strconv.Itoa(r.Amount * 100),
+		"vnp_TransactionNo":   r.Ref,
+		"vnp_TransactionDate": r.PaidAt.In(vnpayZone).Format(vnpayTime),
+		"vnp_CreateBy":        "leblanc",
+		"vnp_CreateDate":      time.Now().In(vnpayZone).Format(vnpayTime),
+		"vnp_IpAddr":          r.ClientIP,
+		"vnp_OrderInfo":       r.Reason,
+	}
+	// the refund API signs the fields joined by "|" in this order
+	fields := []string{"vnp_RequestId", "vnp_Version", "vnp_Command", "vnp_TmnCode", "vnp_TransactionType",
+		"vnp_TxnRef", "vnp_Amount", "vnp_TransactionNo", "vnp_TransactionDate", "vnp_CreateBy",
+		"vnp_CreateDate", "vnp_IpAddr", "vnp_OrderInfo"}
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		values[i] = req[f]
+	}
+	req["vnp_SecureHash"] = v.sign(strings.Join(values, "|"))
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, v.cfg.APIURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	res, err := v.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("vnpay refund: %w", err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		ResponseCode string `json:"vnp_ResponseCode"`
+		Message      string `json:"vnp_Message"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return fmt.Errorf("vnpay refund: %s: %w", res.Status, err)
+	}
+	if out.ResponseCode != "00" {
+		return fmt.Errorf("vnpay refund: %s %s", out.ResponseCode, out.Message)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"leblanc/server/internal/config"
+)
+
+// sweepEvery bounds how often Memory drops buckets that have refilled completely.
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket will be full again; safe to forget after
+}
+
+// Memory keeps buckets in process memory. Limits are per instance.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket)}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, p config.RatePolicy, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Limit), updated: now}
+		m.buckets[key] = b
+	}
+	rate := refillRate(p)
+	b.tokens = math.Min(float64(p.Limit), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((float64(p.Limit) - b.tokens) / rate * float64(time.Second)))
+	return result(p, b.tokens, allowed), nil
+}
+
+// sweep drops full buckets so memory follows active callers, not every caller ever seen.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepEvery {
+		return
+	}
+	m.lastSweep = now
+	for k, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserIDKey is the Gin context key under which auth.Middleware stores the user ID of a
+// valid session token. main.go registers it before the limiter, so limits follow a
+// logged-in user across IPs; anonymous requests are limited per IP.
+const UserIDKey = "userID"
+
+// Headers are set on limited responses; browsers need them exposed through CORS.
+var Headers = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"}
+
+// Limiter applies the configured policy of each route.
+type Limiter struct {
+	store    Store
+	policies map[string]config.RatePolicy
+}
+
+func New(store Store, policies map[string]config.RatePolicy) *Limiter {
+	return &Limiter{store: store, policies: policies}
+}
+
+// Middleware limits routes that have a policy and sets the RateLimit-* headers on their
+// responses. If the store fails the request is let through: an outage of the limiter
+// must not become an outage of the API.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		p, ok := l.policies[route]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		res, err := l.store.Take(c.Request.Context(), route+"|"+identity(c), p, time.Now())
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "rate limit store failed; allowing request", "route", route, "error", err)
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(p.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(int(res.Reset.Seconds())))
+		h.Set("RateLimit-Policy", strconv.Itoa(p.Limit)+";w="+strconv.Itoa(int(p.Period.Seconds())))
+		if !res.Allowed {
+			metrics.RateLimited(route)
+			h.Set("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds())))
+			apperr.Write(c, apperr.New(apperr.RateLimited, "too many requests, try again later"))
+			return
+		}
+		c.Next()
+	}
+}
+
+func identity(c *gin.Context) string {
+	if id := c.GetString(UserIDKey); id != "" {
+		return "user:" + id
+	}
+	return "ip:" + c.ClientIP()
+}
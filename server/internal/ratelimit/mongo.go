@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"leblanc/server/internal/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection holds one document per bucket; a TTL index on expiresAt removes idle ones.
+const Collection = "rate_limits"
+
+// Mongo shares buckets between instances. Each Take is a single atomic upsert with an
+// update pipeline, so concurrent requests cannot spend the same token twice.
+type Mongo struct {
+	coll *mongo.Collection
+}
+
+func NewMongo(db *mongo.Database) *Mongo {
+	return &Mongo{coll: db.Collection(Collection)}
+}
+
+func (m *Mongo) Take(ctx context.Context, key string, p config.RatePolicy, now time.Time) (Result, error) {
+	limit := float64(p.Limit)
+	// refill by elapsed seconds * rate, capped at limit; a new bucket starts full
+	refilled := bson.M{"$min": bson.A{limit, bson.M{"$add": bson.A{
+		bson.M{"$ifNull": bson.A{"$tokens", limit}},
+		bson.M{"$multiply": bson.A{
+			bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedAt", now}}}}, 1000}},
+			refillRate(p),
+		}},
+	}}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled, "updatedAt": now}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":    bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"expiresAt": now.Add(p.Period),
+		}}},
+	}
+
+	var doc struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := m.coll.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&doc); err != nil {
+		return Result{}, err
+	}
+	return result(p, doc.Tokens, doc.Allowed), nil
+}
@@ -0,0 +1,54 @@
+// Package ratelimit throttles requests with token buckets, one per route policy and
+// caller. A bucket holds up to Limit tokens and refills at Limit per Period; each request
+// takes one. Callers are identified by authenticated user when there is one, otherwise
+// by client IP.
+//
+// Buckets live in a Store: Memory for a single instance, Mongo when several instances
+// must share limits.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"leblanc/server/internal/config"
+)
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token, when not allowed.
+	RetryAfter time.Duration
+}
+
+// Store takes one token from the bucket for key under policy p.
+type Store interface {
+	Take(ctx context.Context, key string, p config.RatePolicy, now time.Time) (Result, error)
+}
+
+// refillRate is tokens per second.
+func refillRate(p config.RatePolicy) float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// result derives the response from the tokens left after the attempt.
+func result(p config.RatePolicy, tokens float64, allowed bool) Result {
+	rate := refillRate(p)
+	r := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(p.Limit) - tokens) / rate),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(math.Max(s, 0))) * time.Second
+}
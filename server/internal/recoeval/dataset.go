@@ -0,0 +1,117 @@
+// Package recoeval replays historical bookings and recommendation events against
+// scorer configurations and reports offline ranking metrics.
+package recoeval
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Dataset is everything an evaluation needs; it is also the JSON dump format.
+type Dataset struct {
+	Drinks   []models.Drink       `json:"drinks"`
+	Bookings []models.Booking     `json:"bookings"`
+	Events   []services.RecoEvent `json:"events"`
+}
+
+// LoadDump reads a dataset written by WriteDump.
+func LoadDump(path string) (*Dataset, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ds Dataset
+	if err := json.Unmarshal(b, &ds); err != nil {
+		return nil, err
+	}
+	return &ds, nil
+}
+
+// WriteDump saves ds so it can be evaluated later without Mongo.
+func WriteDump(path string, ds *Dataset) error {
+	b, err := json.MarshalIndent(ds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// LoadMongo reads drinks, bookings and recommendation events from database.
+func LoadMongo(ctx context.Context, database *mongo.Database) (*Dataset, error) {
+	var ds Dataset
+	if err := findAll(ctx, database.Collection("drinks"), &ds.Drinks); err != nil {
+		return nil, err
+	}
+	if err := findAll(ctx, database.Collection("bookings"), &ds.Bookings); err != nil {
+		return nil, err
+	}
+	if err := findAll(ctx, database.Collection(services.RecoEventsCollection), &ds.Events); err != nil {
+		return nil, err
+	}
+	return &ds, nil
+}
+
+func findAll(ctx context.Context, coll *mongo.Collection, out any) error {
+	cur, err := coll.Find(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	return cur.All(ctx, out)
+}
+
+// Case is one replayable request: the query a guest sent, what they were served,
+// and the drinks they went on to book.
+type Case struct {
+	Query    services.RecoQuery
+	Served   []string
+	Relevant map[string]bool
+}
+
+// BuildCases pairs each booking with the latest recommendation event from the same
+// email before the booking time. Bookings without such an event are skipped.
+func BuildCases(ds *Dataset) []Case {
+	byEmail := make(map[string][]services.RecoEvent)
+	for _, ev := range ds.Events {
+		if ev.Email == "" {
+			continue
+		}
+		email := strings.ToLower(ev.Email)
+		byEmail[email] = append(byEmail[email], ev)
+	}
+	for _, evs := range byEmail {
+		sort.Slice(evs, func(i, j int) bool { return evs[i].Time.Before(evs[j].Time) })
+	}
+
+	var cases []Case
+	for _, b := range ds.Bookings {
+		relevant := make(map[string]bool, len(b.Items))
+		for _, it := range b.Items {
+			relevant[it.DrinkID.Hex()] = true
+		}
+		if len(relevant) == 0 {
+			continue
+		}
+		var last *services.RecoEvent
+		for i, ev := range byEmail[strings.ToLower(b.Email)] {
+			if ev.Time.After(b.Time) {
+				break
+			}
+			last = &byEmail[strings.ToLower(b.Email)][i]
+		}
+		if last == nil {
+			continue
+		}
+		cases = append(cases, Case{Query: last.Query, Served: last.DrinkIDs, Relevant: relevant})
+	}
+	return cases
+}
@@ -0,0 +1,112 @@
+package recoeval
+
+import (
+	"math"
+
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/services"
+)
+
+// LoggedName labels the row computed from what was actually served.
+const LoggedName = "logged"
+
+// Result holds the averaged metrics of one configuration over all cases.
+type Result struct {
+	Name      string  `json:"name"`
+	Scorer    string  `json:"scorer"`
+	Cases     int     `json:"cases"`
+	K         int     `json:"k"`
+	Precision float64 `json:"precisionAtK"`
+	Recall    float64 `json:"recallAtK"`
+	NDCG      float64 `json:"ndcgAtK"`
+	Coverage  float64 `json:"coverage"`  // share of the menu recommended at least once
+	Diversity float64 `json:"diversity"` // mean pairwise dissimilarity within a list
+}
+
+// Evaluate replays every case with cfg and scores the top-k lists.
+func Evaluate(drinks []models.Drink, cases []Case, cfg services.ScorerConfig, k int) Result {
+	lists := make([][]string, len(cases))
+	for i, c := range cases {
+		lists[i] = services.ScoreIDs(cfg.Rank(drinks, c.Query, k))
+	}
+	res := score(drinks, cases, lists, k)
+	res.Name, res.Scorer = cfg.Name, cfg.Scorer
+	return res
+}
+
+// EvaluateLogged scores the lists that were actually served, as a baseline.
+func EvaluateLogged(drinks []models.Drink, cases []Case, k int) Result {
+	lists := make([][]string, len(cases))
+	for i, c := range cases {
+		lists[i] = c.Served
+		if len(lists[i]) > k {
+			lists[i] = lists[i][:k]
+		}
+	}
+	res := score(drinks, cases, lists, k)
+	res.Name, res.Scorer = LoggedName, "-"
+	return res
+}
+
+func score(drinks []models.Drink, cases []Case, lists [][]string, k int) Result {
+	res := Result{Cases: len(cases), K: k}
+	if len(cases) == 0 {
+		return res
+	}
+	byID := make(map[string]models.Drink, len(drinks))
+	for _, d := range drinks {
+		byID[d.ID.Hex()] = d
+	}
+
+	seen := make(map[string]bool)
+	for i, c := range cases {
+		list := lists[i]
+		hits := 0
+		dcg := 0.0
+		for rank, id := range list {
+			seen[id] = true
+			if c.Relevant[id] {
+				hits++
+				dcg += 1 / math.Log2(float64(rank+2))
+			}
+		}
+		idcg := 0.0
+		for rank := 0; rank < len(c.Relevant) && rank < k; rank++ {
+			idcg += 1 / math.Log2(float64(rank+2))
+		}
+		res.Precision += float64(hits) / float64(k)
+		res.Recall += float64(hits) / float64(len(c.Relevant))
+		if idcg > 0 {
+			res.NDCG += dcg / idcg
+		}
+		res.Diversity += listDiversity(list, byID)
+	}
+	n := float64(len(cases))
+	res.Precision /= n
+	res.Recall /= n
+	res.NDCG /= n
+	res.Diversity /= n
+	if len(drinks) > 0 {
+		res.Coverage = float64(len(seen)) / float64(len(drinks))
+	}
+	return res
+}
+
+func listDiversity(list []string, byID map[string]models.Drink) float64 {
+	pairs, total := 0, 0.0
+	for i := 0; i < len(list); i++ {
+		for j := i + 1; j < len(list); j++ {
+			a, okA := byID[list[i]]
+			b, okB := byID[list[j]]
+			if !okA || !okB {
+				continue
+			}
+			total += 1 - services.DrinkSimilarity(a, b)
+			pairs++
+		}
+	}
+	if pairs == 0 {
+		return 0
+	}
+	return total / float64(pairs)
+}
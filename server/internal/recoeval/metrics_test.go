@@ -0,0 +1,117 @@
+package recoeval
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEvaluateLogged(t *testing.T) {
+	// four drinks of different styles, so any two are fully dissimilar
+	var drinks []models.Drink
+	ids := map[string]string{}
+	for _, tag := range []string{"coffee", "tea", "juice", "beer"} {
+		d := models.Drink{ID: primitive.NewObjectID(), Name: tag, Tags: []string{tag}}
+		drinks = append(drinks, d)
+		ids[tag] = d.ID.Hex()
+	}
+	served := func(tags ...string) []string {
+		out := make([]string, len(tags))
+		for i, tag := range tags {
+			out[i] = ids[tag]
+		}
+		return out
+	}
+	relevant := func(tags ...string) map[string]bool {
+		out := map[string]bool{}
+		for _, tag := range tags {
+			out[ids[tag]] = true
+		}
+		return out
+	}
+	tests := []struct {
+		name                                         string
+		cases                                        []Case
+		precision, recall, ndcg, coverage, diversity float64
+	}{
+		{"no cases", nil, 0, 0, 0, 0, 0},
+		{"hit first", []Case{{Served: served("coffee", "tea"), Relevant: relevant("coffee")}}, 0.5, 1, 1, 0.5, 1},
+		{"hit second", []Case{{Served: served("tea", "coffee"), Relevant: relevant("coffee")}}, 0.5, 1, 1 / math.Log2(3), 0.5, 1},
+		{"miss", []Case{{Served: served("juice", "beer"), Relevant: relevant("coffee")}}, 0, 0, 0, 0.5, 1},
+		{"cut to k", []Case{{Served: served("tea", "juice", "coffee"), Relevant: relevant("coffee")}}, 0, 0, 0, 0.5, 1},
+		{"two relevant", []Case{{Served: served("juice", "coffee"), Relevant: relevant("coffee", "beer")}},
+			0.5, 0.5, (1 / math.Log2(3)) / (1 + 1/math.Log2(3)), 0.5, 1},
+		{"unknown drink", []Case{{Served: []string{primitive.NewObjectID().Hex(), ids["coffee"]}, Relevant: relevant("coffee")}},
+			0.5, 1, 1 / math.Log2(3), 0.5, 0},
+		{"averaged over cases", []Case{
+			{Served: served("coffee", "tea"), Relevant: relevant("coffee")},
+			{Served: served("juice", "beer"), Relevant: relevant("coffee")},
+		}, 0.25, 0.5, 0.5, 1, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := EvaluateLogged(drinks, tc.cases, 2)
+			if got.Name != LoggedName || got.Cases != len(tc.cases) || got.K != 2 {
+				t.Errorf("result is %q over %d cases at k=%d", got.Name, got.Cases, got.K)
+			}
+			for _, m := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"precision", got.Precision, tc.precision},
+				{"recall", got.Recall, tc.recall},
+				{"NDCG", got.NDCG, tc.ndcg},
+				{"coverage", got.Coverage, tc.coverage},
+				{"diversity", got.Diversity, tc.diversity},
+			} {
+				if math.Abs(m.got-m.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", m.name, m.got, m.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildCases(t *testing.T) {
+	latte, tea := primitive.NewObjectID(), primitive.NewObjectID()
+	at := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	event := func(email string, offset time.Duration, served string) services.RecoEvent {
+		return services.RecoEvent{Email: email, Time: at.Add(offset), DrinkIDs: []string{served}}
+	}
+	booking := func(email string, items ...primitive.ObjectID) models.Booking {
+		b := models.Booking{Email: email, Time: at}
+		for _, id := range items {
+			b.Items = append(b.Items, models.BookingItem{DrinkID: id, Qty: 1})
+		}
+		return b
+	}
+	ds := &Dataset{
+		Events: []services.RecoEvent{
+			event("an@example.com", -time.Hour, "older"),
+			event("An@Example.com", -time.Minute, "latest"),
+			event("an@example.com", time.Minute, "after the booking"),
+			event("", -time.Minute, "anonymous"),
+			event("binh@example.com", time.Hour, "too late"),
+		},
+		Bookings: []models.Booking{
+			booking("AN@example.com", latte, tea),
+			booking("an@example.com"),            // no items
+			booking("binh@example.com", latte),   // only a later event
+			booking("nobody@example.com", latte), // no event
+		},
+	}
+	cases := BuildCases(ds)
+	if len(cases) != 1 {
+		t.Fatalf("BuildCases = %+v, want one case", cases)
+	}
+	c := cases[0]
+	if !slices.Equal(c.Served, []string{"latest"}) || len(c.Relevant) != 2 || !c.Relevant[latte.Hex()] || !c.Relevant[tea.Hex()] {
+		t.Errorf("case = %+v, want the latest earlier event and both booked drinks", c)
+	}
+}
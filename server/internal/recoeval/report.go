@@ -0,0 +1,34 @@
+package recoeval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Report is the JSON form of a comparison.
+type Report struct {
+	Bookings int      `json:"bookings"`
+	Events   int      `json:"events"`
+	Results  []Result `json:"results"`
+}
+
+// WriteText prints results as an aligned comparison table.
+func WriteText(w io.Writer, r Report) error {
+	fmt.Fprintf(w, "replayed %d bookings against %d recommendation events\n\n", r.Bookings, r.Events)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "config\tscorer\tcases\tk\tprecision@k\trecall@k\tndcg@k\tcoverage\tdiversity")
+	for _, res := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\n",
+			res.Name, res.Scorer, res.Cases, res.K, res.Precision, res.Recall, res.NDCG, res.Coverage, res.Diversity)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes r as indented JSON.
+func WriteJSON(w io.Writer, r Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,1057 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"leblanc/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The in-memory repositories keep documents in insertion order, like Mongo's natural
+// order, and hand out copies so callers cannot mutate the store behind its lock.
+
+type memoryUsers struct {
+	mu    sync.RWMutex
+	users []models.User
+}
+
+func NewMemoryUsers(users ...models.User) UserRepository {
+	return &memoryUsers{users: slices.Clone(users)}
+}
+
+func (r *memoryUsers) List(ctx context.Context) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]models.User{}, r.users...), nil
+}
+
+func (r *memoryUsers) FindByNameOrEmail(ctx context.Context, name, email string) (*models.User, error) {
+	name, email = strings.ToLower(name), strings.ToLower(email)
+	return r.find(func(u models.User) bool { return u.NameLower == name || u.EmailLower == email })
+}
+
+func (r *memoryUsers) Get(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.find(func(u models.User) bool { return u.ID == id })
+}
+
+func (r *memoryUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	email = strings.ToLower(email)
+	return r.find(func(u models.User) bool { return u.EmailLower == email })
+}
+
+func (r *memoryUsers) find(match func(models.User) bool) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, u := range r.users {
+		if match(u) {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// conflicts reports whether another user already has u's name or email, mirroring the
+// unique indexes on users.
+func (r *memoryUsers) conflicts(u *models.User) bool {
+	for _, other := range r.users {
+		if other.ID != u.ID && (other.NameLower == u.NameLower || other.EmailLower == u.EmailLower) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryUsers) Insert(ctx context.Context, u *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u.ID.IsZero() {
+		u.ID = primitive.NewObjectID()
+	}
+	if r.conflicts(u) || slices.ContainsFunc(r.users, func(o models.User) bool { return o.ID == u.ID }) {
+		return ErrDuplicate
+	}
+	r.users = append(r.users, *u)
+	return nil
+}
+
+func (r *memoryUsers) Update(ctx context.Context, u *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.users, func(o models.User) bool { return o.ID == u.ID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	if r.conflicts(u) {
+		return ErrDuplicate
+	}
+	u.Favorites, u.SavedOrders = r.users[i].Favorites, r.users[i].SavedOrders
+	r.users[i] = *u
+	return nil
+}
+
+func (r *memoryUsers) AddFavorite(ctx context.Context, userID, drinkID primitive.ObjectID, limit int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.users, func(o models.User) bool { return o.ID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	u := &r.users[i]
+	if slices.Contains(u.Favorites, drinkID) {
+		return nil
+	}
+	if len(u.Favorites) >= limit {
+		return ErrConflict
+	}
+	u.Favorites = append(slices.Clip(u.Favorites), drinkID)
+	return nil
+}
+
+func (r *memoryUsers) RemoveFavorite(ctx context.Context, userID, drinkID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.users, func(o models.User) bool { return o.ID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.users[i].Favorites = slices.DeleteFunc(slices.Clone(r.users[i].Favorites), func(id primitive.ObjectID) bool { return id == drinkID })
+	return nil
+}
+
+func (r *memoryUsers) SaveOrder(ctx context.Context, userID primitive.ObjectID, o *models.SavedOrder, limit int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.users, func(o models.User) bool { return o.ID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	u := &r.users[i]
+	o.NameLower = strings.ToLower(o.Name)
+	adding := o.ID.IsZero()
+	if adding {
+		o.ID = primitive.NewObjectID()
+	}
+	j := slices.IndexFunc(u.SavedOrders, func(s models.SavedOrder) bool { return s.ID == o.ID })
+	dup := slices.ContainsFunc(u.SavedOrders, func(s models.SavedOrder) bool { return s.ID != o.ID && s.NameLower == o.NameLower })
+	if dup || j < 0 && !adding || adding && len(u.SavedOrders) >= limit {
+		return savedOrderConflict(u, o, adding)
+	}
+	stored := *o
+	stored.Items = slices.Clone(o.Items)
+	orders := slices.Clone(u.SavedOrders)
+	if adding {
+		orders = append(orders, stored)
+	} else {
+		stored.CreatedAt = orders[j].CreatedAt
+		o.CreatedAt = stored.CreatedAt
+		orders[j] = stored
+	}
+	u.SavedOrders = orders
+	return nil
+}
+
+func (r *memoryUsers) DeleteOrder(ctx context.Context, userID, orderID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.users, func(o models.User) bool { return o.ID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	u := &r.users[i]
+	j := slices.IndexFunc(u.SavedOrders, func(s models.SavedOrder) bool { return s.ID == orderID })
+	if j < 0 {
+		return ErrNotFound
+	}
+	u.SavedOrders = slices.Delete(slices.Clone(u.SavedOrders), j, j+1)
+	return nil
+}
+
+type memoryDrinks struct {
+	mu     sync.RWMutex
+	drinks []models.Drink
+}
+
+// NewMemoryDrinks returns a drink repository holding drinks; drinks without an ID get one.
+func NewMemoryDrinks(drinks ...models.Drink) DrinkRepository {
+	r := &memoryDrinks{drinks: slices.Clone(drinks)}
+	for i := range r.drinks {
+		if r.drinks[i].ID.IsZero() {
+			r.drinks[i].ID = primitive.NewObjectID()
+		}
+	}
+	return r
+}
+
+func (r *memoryDrinks) List(ctx context.Context) ([]models.Drink, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []models.Drink{}
+	for _, d := range r.drinks {
+		if !d.Archived {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryDrinks) ListAll(ctx context.Context) ([]models.Drink, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]models.Drink{}, r.drinks...), nil
+}
+
+func (r *memoryDrinks) Get(ctx context.Context, id primitive.ObjectID) (*models.Drink, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, d := range r.drinks {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryDrinks) Save(ctx context.Context, d *models.Drink) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d.ID.IsZero() {
+		d.ID = primitive.NewObjectID()
+	}
+	if slices.ContainsFunc(r.drinks, func(o models.Drink) bool { return o.ID != d.ID && d.Slug != "" && o.Slug == d.Slug }) {
+		return ErrDuplicate
+	}
+	if i := slices.IndexFunc(r.drinks, func(o models.Drink) bool { return o.ID == d.ID }); i >= 0 {
+		d.Rating, d.RatingCount, d.RatingSum = r.drinks[i].Rating, r.drinks[i].RatingCount, r.drinks[i].RatingSum
+		r.drinks[i] = *d
+	} else {
+		r.drinks = append(r.drinks, *d)
+	}
+	return nil
+}
+
+func (r *memoryDrinks) AddRating(ctx context.Context, id primitive.ObjectID, sum, count int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.drinks, func(o models.Drink) bool { return o.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	d := &r.drinks[i]
+	d.RatingSum += sum
+	d.RatingCount += count
+	d.Rating = averageRating(d.RatingSum, d.RatingCount)
+	return nil
+}
+
+func (r *memoryDrinks) SetRating(ctx context.Context, id primitive.ObjectID, sum, count int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.drinks, func(o models.Drink) bool { return o.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	d := &r.drinks[i]
+	d.RatingSum, d.RatingCount, d.Rating = sum, count, averageRating(sum, count)
+	return nil
+}
+
+// averageRating rounds to two decimals, as the Mongo AddRating pipeline does.
+func averageRating(sum, count int) float64 {
+	if count <= 0 {
+		return 0
+	}
+	return math.Round(float64(sum)/float64(count)*100) / 100
+}
+
+type memoryBookings struct {
+	mu       sync.RWMutex
+	bookings []models.Booking
+}
+
+func NewMemoryBookings(bookings ...models.Booking) BookingRepository {
+	return &memoryBookings{bookings: slices.Clone(bookings)}
+}
+
+func (r *memoryBookings) List(ctx context.Context) ([]models.Booking, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]models.Booking{}, r.bookings...), nil
+}
+
+func (r *memoryBookings) Get(ctx context.Context, id primitive.ObjectID) (*models.Booking, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, b := range r.bookings {
+		if b.ID == id {
+			return &b, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryBookings) FindByCustomers(ctx context.Context, userIDs []primitive.ObjectID, sessionIDs []string) ([]models.Booking, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []models.Booking{}
+	for _, b := range r.bookings {
+		if b.UserID != nil && slices.Contains(userIDs, *b.UserID) || (b.SessionID != "" && slices.Contains(sessionIDs, b.SessionID)) {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryBookings) FindByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Booking, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []models.Booking{}
+	for _, b := range r.bookings {
+		if b.UserID != nil && *b.UserID == userID {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryBookings) Insert(ctx context.Context, b *models.Booking) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b.ID.IsZero() {
+		b.ID = primitive.NewObjectID()
+	}
+	if slices.ContainsFunc(r.bookings, func(o models.Booking) bool { return o.ID == b.ID }) {
+		return ErrDuplicate
+	}
+	stored := *b
+	stored.Items = slices.Clone(b.Items)
+	if b.Deposit != nil {
+		// like Mongo, the checkout URL is not stored
+		d := *b.Deposit
+		d.CheckoutURL = ""
+		stored.Deposit = &d
+	}
+	r.bookings = append(r.bookings, stored)
+	return nil
+}
+
+func (r *memoryBookings) SetStatus(ctx context.Context, id primitive.ObjectID, from []string, to string, at time.Time) (*models.Booking, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.bookings {
+		b := &r.bookings[i]
+		if b.ID != id {
+			continue
+		}
+		if !slices.Contains(from, b.Status) {
+			return nil, ErrConflict
+		}
+		b.Status = to
+		if to == models.BookingCompleted {
+			b.CompletedAt = &at
+		}
+		out := *b
+		return &out, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryBookings) SetDepositStatus(ctx context.Context, id primitive.ObjectID, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.bookings {
+		b := &r.bookings[i]
+		if b.ID != id || b.Deposit == nil {
+			continue
+		}
+		d := *b.Deposit
+		d.Status = status
+		b.Deposit = &d
+		return nil
+	}
+	return ErrNotFound
+}
+
+type memoryLoyalty struct {
+	mu       sync.Mutex
+	accounts map[primitive.ObjectID]*models.LoyaltyAccount
+	ledger   []models.LoyaltyEntry
+}
+
+func NewMemoryLoyalty() LoyaltyRepository {
+	return &memoryLoyalty{accounts: map[primitive.ObjectID]*models.LoyaltyAccount{}}
+}
+
+func (r *memoryLoyalty) Account(ctx context.Context, userID primitive.ObjectID) (*models.LoyaltyAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := models.LoyaltyAccount{UserID: userID, Stamps: map[string]int{}, Rewards: map[string]int{}}
+	if a, ok := r.accounts[userID]; ok {
+		out.Points, out.UpdatedAt = a.Points, a.UpdatedAt
+		out.Stamps, out.Rewards = maps.Clone(a.Stamps), maps.Clone(a.Rewards)
+	}
+	return &out, nil
+}
+
+func (r *memoryLoyalty) Apply(ctx context.Context, e *models.LoyaltyEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// like the bookingId/kind index of migration 7
+	if e.BookingID != nil && slices.ContainsFunc(r.ledger, func(o models.LoyaltyEntry) bool {
+		return o.BookingID != nil && *o.BookingID == *e.BookingID && o.Kind == e.Kind
+	}) {
+		return ErrDuplicate
+	}
+	a, ok := r.accounts[e.UserID]
+	if !ok {
+		a = &models.LoyaltyAccount{UserID: e.UserID, Stamps: map[string]int{}, Rewards: map[string]int{}}
+	}
+	if a.Points+e.Points < 0 {
+		return ErrInsufficient
+	}
+	for tag, n := range e.Stamps {
+		if a.Stamps[tag]+n < 0 {
+			return ErrInsufficient
+		}
+	}
+	for tag, n := range e.Rewards {
+		if a.Rewards[tag]+n < 0 {
+			return ErrInsufficient
+		}
+	}
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	a.Points += e.Points
+	for tag, n := range e.Stamps {
+		a.Stamps[tag] += n
+	}
+	for tag, n := range e.Rewards {
+		a.Rewards[tag] += n
+	}
+	a.UpdatedAt = e.CreatedAt
+	r.accounts[e.UserID] = a
+	r.ledger = append(r.ledger, *e)
+	return nil
+}
+
+func (r *memoryLoyalty) History(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.LoyaltyEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []models.LoyaltyEntry{}
+	for i := len(r.ledger) - 1; i >= 0 && len(out) < limit; i-- {
+		if r.ledger[i].UserID == userID {
+			out = append(out, r.ledger[i])
+		}
+	}
+	return out, nil
+}
+
+type memoryPromotions struct {
+	mu         sync.Mutex
+	promotions []models.Promotion
+	usage      map[string]int
+	vouchers   map[string]models.Voucher
+}
+
+func NewMemoryPromotions() PromotionRepository {
+	return &memoryPromotions{usage: map[string]int{}, vouchers: map[string]models.Voucher{}}
+}
+
+func (r *memoryPromotions) List(ctx context.Context) ([]models.Promotion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := slices.Clone(r.promotions)
+	slices.Reverse(out)
+	return out, nil
+}
+
+func (r *memoryPromotions) Active(ctx context.Context) ([]models.Promotion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []models.Promotion{}
+	for _, p := range r.promotions {
+		if p.Active {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryPromotions) Get(ctx context.Context, id primitive.ObjectID) (*models.Promotion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.promotions {
+		if p.ID == id {
+			return &p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPromotions) Save(ctx context.Context, p *models.Promotion) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p.ID.IsZero() {
+		p.ID = primitive.NewObjectID()
+	}
+	if i := slices.IndexFunc(r.promotions, func(o models.Promotion) bool { return o.ID == p.ID }); i >= 0 {
+		p.Uses, p.CreatedAt = r.promotions[i].Uses, r.promotions[i].CreatedAt
+		r.promotions[i] = *p
+		return nil
+	}
+	p.Uses = 0
+	r.promotions = append(r.promotions, *p)
+	return nil
+}
+
+func (r *memoryPromotions) Claim(ctx context.Context, p *models.Promotion, customer string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.promotions, func(o models.Promotion) bool { return o.ID == p.ID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	key := p.ID.Hex() + "|" + customer
+	if p.MaxUses > 0 && r.promotions[i].Uses >= p.MaxUses || p.MaxUsesPerUser > 0 && r.usage[key] >= p.MaxUsesPerUser {
+		return ErrInsufficient
+	}
+	r.promotions[i].Uses++
+	r.usage[key]++
+	return nil
+}
+
+func (r *memoryPromotions) Release(ctx context.Context, promotionID primitive.ObjectID, customer string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := slices.IndexFunc(r.promotions, func(o models.Promotion) bool { return o.ID == promotionID }); i >= 0 && r.promotions[i].Uses > 0 {
+		r.promotions[i].Uses--
+	}
+	if key := promotionID.Hex() + "|" + customer; r.usage[key] > 0 {
+		r.usage[key]--
+	}
+	return nil
+}
+
+func (r *memoryPromotions) InsertVouchers(ctx context.Context, vouchers []models.Voucher) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range vouchers {
+		if _, ok := r.vouchers[v.Code]; ok {
+			return ErrDuplicate
+		}
+	}
+	for _, v := range vouchers {
+		r.vouchers[v.Code] = v
+	}
+	return nil
+}
+
+func (r *memoryPromotions) Voucher(ctx context.Context, code string) (*models.Voucher, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.vouchers[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &v, nil
+}
+
+func (r *memoryPromotions) Vouchers(ctx context.Context, promotionID primitive.ObjectID) ([]models.Voucher, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []models.Voucher{}
+	for _, v := range r.vouchers {
+		if v.PromotionID == promotionID {
+			out = append(out, v)
+		}
+	}
+	slices.SortFunc(out, func(a, b models.Voucher) int { return strings.Compare(a.Code, b.Code) })
+	return out, nil
+}
+
+func (r *memoryPromotions) UseVoucher(ctx context.Context, code string, bookingID primitive.ObjectID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.vouchers[code]
+	if !ok {
+		return ErrNotFound
+	}
+	if v.UsedAt != nil {
+		return ErrConflict
+	}
+	v.UsedAt, v.BookingID = &at, &bookingID
+	r.vouchers[code] = v
+	return nil
+}
+
+func (r *memoryPromotions) ReleaseVoucher(ctx context.Context, code string, bookingID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.vouchers[code]; ok && v.BookingID != nil && *v.BookingID == bookingID {
+		v.UsedAt, v.BookingID = nil, nil
+		r.vouchers[code] = v
+	}
+	return nil
+}
+
+type memoryGiftCards struct {
+	mu     sync.Mutex
+	cards  []models.GiftCard
+	ledger []models.GiftCardEntry
+}
+
+func NewMemoryGiftCards() GiftCardRepository {
+	return &memoryGiftCards{}
+}
+
+func (r *memoryGiftCards) Insert(ctx context.Context, cards []models.GiftCard) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range cards {
+		if r.find(func(c models.GiftCard) bool { return c.Code == g.Code }) >= 0 {
+			return ErrDuplicate
+		}
+	}
+	for i := range cards {
+		if cards[i].ID.IsZero() {
+			cards[i].ID = primitive.NewObjectID()
+		}
+		r.cards = append(r.cards, cards[i])
+		r.ledger = append(r.ledger, models.GiftCardEntry{
+			ID: primitive.NewObjectID(), CardID: cards[i].ID, Kind: models.GiftCardIssue,
+			Amount: cards[i].Balance, Balance: cards[i].Balance, CreatedAt: cards[i].CreatedAt,
+		})
+	}
+	return nil
+}
+
+// find returns the index of the first matching card, or -1. r.mu must be held.
+func (r *memoryGiftCards) find(match func(models.GiftCard) bool) int {
+	return slices.IndexFunc(r.cards, match)
+}
+
+func (r *memoryGiftCards) List(ctx context.Context) ([]models.GiftCard, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := slices.Clone(r.cards)
+	slices.Reverse(out)
+	return out, nil
+}
+
+func (r *memoryGiftCards) Get(ctx context.Context, id primitive.ObjectID) (*models.GiftCard, error) {
+	return r.get(func(c models.GiftCard) bool { return c.ID == id })
+}
+
+func (r *memoryGiftCards) FindByCode(ctx context.Context, code string) (*models.GiftCard, error) {
+	return r.get(func(c models.GiftCard) bool { return c.Code == code })
+}
+
+func (r *memoryGiftCards) get(match func(models.GiftCard) bool) (*models.GiftCard, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.find(match)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	card := r.cards[i]
+	return &card, nil
+}
+
+func (r *memoryGiftCards) Apply(ctx context.Context, e *models.GiftCardEntry) (*models.GiftCard, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	i := r.find(func(c models.GiftCard) bool { return c.ID == e.CardID })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	// like the bookingId/kind index of migration 10
+	if e.BookingID != nil && slices.ContainsFunc(r.ledger, func(o models.GiftCardEntry) bool {
+		return o.BookingID != nil && *o.BookingID == *e.BookingID && o.Kind == e.Kind
+	}) {
+		return nil, ErrDuplicate
+	}
+	card := &r.cards[i]
+	if card.Status != models.GiftCardActive || e.Amount < 0 && card.Expired(e.CreatedAt) {
+		return nil, ErrConflict
+	}
+	if card.Balance+e.Amount < 0 {
+		return nil, ErrInsufficient
+	}
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	card.Balance += e.Amount
+	card.UpdatedAt = e.CreatedAt
+	e.Balance = card.Balance
+	r.ledger = append(r.ledger, *e)
+	out := *card
+	return &out, nil
+}
+
+func (r *memoryGiftCards) Void(ctx context.Context, id primitive.ObjectID, at time.Time) (*models.GiftCard, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.find(func(c models.GiftCard) bool { return c.ID == id })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	card := &r.cards[i]
+	if card.Status != models.GiftCardActive {
+		return nil, ErrConflict
+	}
+	r.ledger = append(r.ledger, models.GiftCardEntry{
+		ID: primitive.NewObjectID(), CardID: id, Kind: models.GiftCardVoid, Amount: -card.Balance, CreatedAt: at,
+	})
+	card.Status, card.Balance, card.VoidedAt, card.UpdatedAt = models.GiftCardVoided, 0, &at, at
+	out := *card
+	return &out, nil
+}
+
+func (r *memoryGiftCards) History(ctx context.Context, id primitive.ObjectID) ([]models.GiftCardEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []models.GiftCardEntry{}
+	for i := len(r.ledger) - 1; i >= 0; i-- {
+		if r.ledger[i].CardID == id {
+			out = append(out, r.ledger[i])
+		}
+	}
+	return out, nil
+}
+
+type memoryPayments struct {
+	mu       sync.Mutex
+	payments []models.Payment
+}
+
+func NewMemoryPayments() PaymentRepository {
+	return &memoryPayments{}
+}
+
+func (r *memoryPayments) Insert(ctx context.Context, p *models.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p.ID.IsZero() {
+		p.ID = primitive.NewObjectID()
+	}
+	if slices.ContainsFunc(r.payments, func(o models.Payment) bool { return o.ID == p.ID }) {
+		return ErrDuplicate
+	}
+	r.payments = append(r.payments, *p)
+	return nil
+}
+
+func (r *memoryPayments) Get(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.payments {
+		if p.ID == id {
+			return &p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPayments) SetStatus(ctx context.Context, id primitive.ObjectID, from []string, to, ref string, at time.Time) (*models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.payments {
+		p := &r.payments[i]
+		if p.ID != id {
+			continue
+		}
+		if !slices.Contains(from, p.Status) {
+			return nil, ErrConflict
+		}
+		p.Status, p.UpdatedAt = to, at
+		switch to {
+		case models.PaymentPaid:
+			p.PaidAt = &at
+		case models.PaymentRefunded:
+			p.RefundedAt = &at
+		}
+		if ref != "" {
+			p.Ref = ref
+		}
+		out := *p
+		return &out, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPayments) Expired(ctx context.Context, t time.Time) ([]models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []models.Payment{}
+	for _, p := range r.payments {
+		if p.Status == models.PaymentPending && p.ExpiresAt.Before(t) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+type memoryInvoices struct {
+	mu       sync.Mutex
+	invoices []models.Invoice
+}
+
+func NewMemoryInvoices() InvoiceRepository {
+	return &memoryInvoices{}
+}
+
+func (r *memoryInvoices) Insert(ctx context.Context, inv *models.Invoice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if inv.ID.IsZero() {
+		inv.ID = primitive.NewObjectID()
+	}
+	last := 0
+	for _, o := range r.invoices {
+		if o.BookingID == inv.BookingID && o.Kind == inv.Kind {
+			return ErrDuplicate
+		}
+		if o.Branch == inv.Branch && o.Kind == inv.Kind {
+			last = max(last, o.Number)
+		}
+	}
+	inv.Number = last + 1
+	inv.Code = models.InvoiceCode(inv.Branch, inv.Kind, inv.Number)
+	r.invoices = append(r.invoices, *inv)
+	return nil
+}
+
+func (r *memoryInvoices) Get(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error) {
+	return r.find(func(inv *models.Invoice) bool { return inv.ID == id })
+}
+
+func (r *memoryInvoices) FindByBooking(ctx context.Context, bookingID primitive.ObjectID, kind string) (*models.Invoice, error) {
+	return r.find(func(inv *models.Invoice) bool { return inv.BookingID == bookingID && inv.Kind == kind })
+}
+
+func (r *memoryInvoices) find(match func(*models.Invoice) bool) (*models.Invoice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, inv := range r.invoices {
+		if match(&inv) {
+			return &inv, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryInvoices) List(ctx context.Context) ([]models.Invoice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]models.Invoice, 0, len(r.invoices))
+	for i := len(r.invoices) - 1; i >= 0; i-- {
+		out = append(out, r.invoices[i])
+	}
+	return out, nil
+}
+
+type memoryReviews struct {
+	mu      sync.Mutex
+	reviews []models.Review
+}
+
+func NewMemoryReviews() ReviewRepository {
+	return &memoryReviews{}
+}
+
+func (r *memoryReviews) Save(ctx context.Context, rv *models.Review) (*models.Review, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.reviews, func(o models.Review) bool { return o.DrinkID == rv.DrinkID && o.UserID == rv.UserID })
+	if i < 0 {
+		rv.ID = primitive.NewObjectID()
+		r.reviews = append(r.reviews, *rv)
+		return nil, nil
+	}
+	prev := r.reviews[i]
+	rv.ID, rv.CreatedAt = prev.ID, prev.CreatedAt
+	rv.Note, rv.ModeratedAt = "", nil
+	r.reviews[i] = *rv
+	return &prev, nil
+}
+
+func (r *memoryReviews) Get(ctx context.Context, id primitive.ObjectID) (*models.Review, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rv := range r.reviews {
+		if rv.ID == id {
+			return &rv, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryReviews) SetStatus(ctx context.Context, id primitive.ObjectID, to, note string, at time.Time) (*models.Review, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.reviews {
+		rv := &r.reviews[i]
+		if rv.ID != id {
+			continue
+		}
+		if rv.Status == to {
+			return nil, ErrConflict
+		}
+		prev := *rv
+		rv.Status, rv.Note, rv.ModeratedAt = to, note, &at
+		return &prev, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryReviews) Delete(ctx context.Context, id primitive.ObjectID) (*models.Review, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.reviews, func(o models.Review) bool { return o.ID == id })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	prev := r.reviews[i]
+	r.reviews = slices.Delete(r.reviews, i, i+1)
+	return &prev, nil
+}
+
+func (r *memoryReviews) ByDrink(ctx context.Context, drinkID, after primitive.ObjectID, limit int) ([]models.Review, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []models.Review{}
+	for i := len(r.reviews) - 1; i >= 0 && len(out) < limit; i-- {
+		rv := r.reviews[i]
+		if rv.DrinkID == drinkID && rv.Status == models.ReviewApproved && (after.IsZero() || rv.ID.Hex() < after.Hex()) {
+			out = append(out, rv)
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryReviews) RatingTotals(ctx context.Context) (map[primitive.ObjectID]RatingTotal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := map[primitive.ObjectID]RatingTotal{}
+	for _, rv := range r.reviews {
+		if rv.Counted() {
+			t := out[rv.DrinkID]
+			t.Sum, t.Count = t.Sum+rv.Rating, t.Count+1
+			out[rv.DrinkID] = t
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryReviews) ByStatus(ctx context.Context, status string, after primitive.ObjectID, limit int) ([]models.Review, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []models.Review{}
+	for _, rv := range r.reviews {
+		if len(out) == limit {
+			break
+		}
+		if rv.Status == status && (after.IsZero() || rv.ID.Hex() > after.Hex()) {
+			out = append(out, rv)
+		}
+	}
+	return out, nil
+}
+
+type memoryRecoEvents struct {
+	mu     sync.Mutex
+	events []models.RecoEvent
+}
+
+func NewMemoryRecoEvents() RecoEventRepository {
+	return &memoryRecoEvents{}
+}
+
+func (r *memoryRecoEvents) Insert(ctx context.Context, ev *models.RecoEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ev.ID.IsZero() {
+		ev.ID = primitive.NewObjectID()
+	}
+	r.events = append(r.events, *ev)
+	return nil
+}
+
+func (r *memoryRecoEvents) ByExperiment(ctx context.Context, key string) ([]models.RecoEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []models.RecoEvent
+	for _, ev := range r.events {
+		if ev.Exposure != nil && ev.Exposure.Key == key {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+type memoryExperiments struct {
+	mu          sync.Mutex
+	experiments []models.Experiment
+}
+
+func NewMemoryExperiments() ExperimentRepository {
+	return &memoryExperiments{}
+}
+
+func (r *memoryExperiments) Insert(ctx context.Context, e *models.Experiment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	for _, x := range r.experiments {
+		if x.ID == e.ID {
+			return ErrDuplicate
+		}
+	}
+	e.Arms = slices.Clone(e.Arms)
+	r.experiments = append(r.experiments, *e)
+	return nil
+}
+
+func (r *memoryExperiments) Active(ctx context.Context) (*models.Experiment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *models.Experiment
+	for i, e := range r.experiments {
+		if e.Active && (latest == nil || !e.CreatedAt.Before(latest.CreatedAt)) {
+			latest = &r.experiments[i]
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	e := *latest
+	e.Arms = slices.Clone(e.Arms)
+	return &e, nil
+}
+
+func (r *memoryExperiments) Get(ctx context.Context, key string) (*models.Experiment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.experiments {
+		if e.Key == key {
+			e.Arms = slices.Clone(e.Arms)
+			return &e, nil
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func user(name, email string) *models.User {
+	return &models.User{Name: name, NameLower: name, Email: email, EmailLower: email}
+}
+
+// TestMemoryUsers checks the unique name and email, and that favorites and saved orders
+// keep their limits and survive a profile update, as the Mongo repository does.
+func TestMemoryUsers(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryUsers()
+	an := user("an", "an@example.com")
+	if err := r.Insert(ctx, an); err != nil || an.ID.IsZero() {
+		t.Fatalf("Insert = %v, ID %v; want an assigned ID", err, an.ID)
+	}
+
+	for _, tc := range []struct {
+		name string
+		u    *models.User
+		want error
+	}{
+		{"same name", user("an", "other@example.com"), ErrDuplicate},
+		{"same email", user("binh", "an@example.com"), ErrDuplicate},
+		{"same ID", &models.User{ID: an.ID, NameLower: "chi", EmailLower: "chi@example.com"}, ErrDuplicate},
+		{"new user", user("binh", "binh@example.com"), nil},
+	} {
+		if err := r.Insert(ctx, tc.u); !errors.Is(err, tc.want) {
+			t.Errorf("Insert %s = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	if u, err := r.FindByNameOrEmail(ctx, "AN", "nobody@example.com"); err != nil || u.ID != an.ID {
+		t.Errorf("FindByNameOrEmail by name = %+v, %v", u, err)
+	}
+	if u, err := r.FindByEmail(ctx, "An@Example.com"); err != nil || u.ID != an.ID {
+		t.Errorf("FindByEmail = %+v, %v", u, err)
+	}
+	if _, err := r.Get(ctx, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get unknown = %v, want ErrNotFound", err)
+	}
+
+	latte, mocha, tea := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	for _, tc := range []struct {
+		drink primitive.ObjectID
+		want  error
+	}{{latte, nil}, {mocha, nil}, {latte, nil}, {tea, ErrConflict}} {
+		if err := r.AddFavorite(ctx, an.ID, tc.drink, 2); !errors.Is(err, tc.want) {
+			t.Errorf("AddFavorite %v = %v, want %v", tc.drink, err, tc.want)
+		}
+	}
+	if err := r.RemoveFavorite(ctx, an.ID, mocha); err != nil {
+		t.Fatal(err)
+	}
+
+	order := &models.SavedOrder{Name: "Morning"}
+	if err := r.SaveOrder(ctx, an.ID, order, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		o    *models.SavedOrder
+		want error
+	}{
+		{"same name", &models.SavedOrder{Name: "MORNING"}, ErrDuplicate},
+		{"unknown ID", &models.SavedOrder{ID: primitive.NewObjectID(), Name: "Evening"}, ErrNotFound},
+		{"second order", &models.SavedOrder{Name: "Evening"}, nil},
+		{"over the limit", &models.SavedOrder{Name: "Night"}, ErrConflict},
+		{"rename", &models.SavedOrder{ID: order.ID, Name: "Early"}, nil},
+	} {
+		if err := r.SaveOrder(ctx, an.ID, tc.o, 2); !errors.Is(err, tc.want) {
+			t.Errorf("SaveOrder %s = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if err := r.DeleteOrder(ctx, an.ID, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteOrder unknown = %v, want ErrNotFound", err)
+	}
+
+	// a profile update leaves favorites and saved orders alone
+	update := user("an", "an@new.example.com")
+	update.ID = an.ID
+	if err := r.Update(ctx, update); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Get(ctx, an.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.EmailLower != "an@new.example.com" || len(got.Favorites) != 1 || got.Favorites[0] != latte || len(got.SavedOrders) != 2 || got.SavedOrders[0].Name != "Early" {
+		t.Errorf("after Update = %+v", got)
+	}
+	taken := user("binh", "an@new.example.com")
+	taken.ID = an.ID
+	if err := r.Update(ctx, taken); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Update to another user's name = %v, want ErrDuplicate", err)
+	}
+
+	// callers get copies
+	got.Name = "changed"
+	if again, _ := r.Get(ctx, an.ID); again.Name != "an" {
+		t.Errorf("Get returned the stored user, not a copy")
+	}
+}
+
+// TestMemoryDrinks checks that archived drinks are only listed by ListAll, slugs are
+// unique, and Save does not overwrite the rating.
+func TestMemoryDrinks(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryDrinks(models.Drink{Name: "Latte", Slug: "latte"}, models.Drink{Name: "Old", Slug: "old", Archived: true})
+	menu, _ := r.List(ctx)
+	all, _ := r.ListAll(ctx)
+	if len(menu) != 1 || menu[0].Slug != "latte" || len(all) != 2 || menu[0].ID.IsZero() {
+		t.Fatalf("List = %+v, ListAll = %+v", menu, all)
+	}
+	latte := menu[0]
+
+	if err := r.Save(ctx, &models.Drink{Name: "Another latte", Slug: "latte"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Save with a taken slug = %v, want ErrDuplicate", err)
+	}
+	for _, tc := range []struct {
+		name       string
+		apply      func() error
+		sum, count int
+		rating     float64
+	}{
+		{"AddRating", func() error { return r.AddRating(ctx, latte.ID, 9, 2) }, 9, 2, 4.5},
+		{"AddRating again", func() error { return r.AddRating(ctx, latte.ID, 5, 1) }, 14, 3, 4.67},
+		{"Save", func() error { d := latte; d.Price = 50000; return r.Save(ctx, &d) }, 14, 3, 4.67},
+		{"SetRating", func() error { return r.SetRating(ctx, latte.ID, 4, 1) }, 4, 1, 4},
+		{"SetRating to none", func() error { return r.SetRating(ctx, latte.ID, 0, 0) }, 0, 0, 0},
+	} {
+		if err := tc.apply(); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		d, err := r.Get(ctx, latte.ID)
+		if err != nil || d.RatingSum != tc.sum || d.RatingCount != tc.count || d.Rating != tc.rating {
+			t.Errorf("after %s: rating %v from %d/%d, %v; want %v from %d/%d", tc.name, d.Rating, d.RatingSum, d.RatingCount, err, tc.rating, tc.sum, tc.count)
+		}
+	}
+	if err := r.AddRating(ctx, primitive.NewObjectID(), 5, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AddRating unknown = %v, want ErrNotFound", err)
+	}
+}
+
+// TestMemoryBookings checks the lookups by customer and that status changes only move
+// from the given statuses.
+func TestMemoryBookings(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryBookings()
+	owner := primitive.NewObjectID()
+	mine := &models.Booking{UserID: &owner, Status: models.BookingPending,
+		Deposit: &models.Deposit{Amount: 20000, Status: "pending", CheckoutURL: "https://pay.example.com/1"}}
+	anonymous := &models.Booking{SessionID: "session-1", Status: models.BookingPending}
+	for _, b := range []*models.Booking{mine, anonymous} {
+		if err := r.Insert(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Insert(ctx, &models.Booking{ID: mine.ID}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Insert with a taken ID = %v, want ErrDuplicate", err)
+	}
+	if got, _ := r.Get(ctx, mine.ID); got.Deposit.CheckoutURL != "" || got.Deposit.Amount != 20000 {
+		t.Errorf("stored deposit = %+v, want it without the checkout URL", got.Deposit)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		find     func() ([]models.Booking, error)
+		wantOnly *models.Booking
+	}{
+		{"FindByUser", func() ([]models.Booking, error) { return r.FindByUser(ctx, owner) }, mine},
+		{"FindByCustomers by user", func() ([]models.Booking, error) { return r.FindByCustomers(ctx, []primitive.ObjectID{owner}, nil) }, mine},
+		{"FindByCustomers by session", func() ([]models.Booking, error) { return r.FindByCustomers(ctx, nil, []string{"session-1"}) }, anonymous},
+	} {
+		got, err := tc.find()
+		if err != nil || len(got) != 1 || got[0].ID != tc.wantOnly.ID {
+			t.Errorf("%s = %+v, %v; want only %v", tc.name, got, err, tc.wantOnly.ID)
+		}
+	}
+
+	at := time.Now()
+	for _, tc := range []struct {
+		name string
+		id   primitive.ObjectID
+		from []string
+		to   string
+		want error
+	}{
+		{"complete a pending booking", mine.ID, []string{models.BookingPending}, models.BookingCompleted, nil},
+		{"complete it again", mine.ID, []string{models.BookingPending}, models.BookingCompleted, ErrConflict},
+		{"unknown booking", primitive.NewObjectID(), []string{models.BookingPending}, models.BookingCancelled, ErrNotFound},
+	} {
+		b, err := r.SetStatus(ctx, tc.id, tc.from, tc.to, at)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s = %v, want %v", tc.name, err, tc.want)
+		}
+		if err == nil && (b.Status != tc.to || b.CompletedAt == nil || !b.CompletedAt.Equal(at)) {
+			t.Errorf("%s = %+v, want status %s completed at %v", tc.name, b, tc.to, at)
+		}
+	}
+
+	if err := r.SetDepositStatus(ctx, mine.ID, "paid"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.Get(ctx, mine.ID); got.Deposit.Status != "paid" {
+		t.Errorf("deposit status = %q, want paid", got.Deposit.Status)
+	}
+	if err := r.SetDepositStatus(ctx, anonymous.ID, "paid"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetDepositStatus without a deposit = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,1016 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoErr maps driver errors to the repository's sentinel errors.
+func mongoErr(err error) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return ErrDuplicate
+	}
+	return err
+}
+
+func findAll[T any](ctx context.Context, coll *mongo.Collection, filter any) ([]T, error) {
+	cur, err := coll.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []T{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func findOne[T any](ctx context.Context, coll *mongo.Collection, filter any) (*T, error) {
+	var v T
+	if err := coll.FindOne(ctx, filter).Decode(&v); err != nil {
+		return nil, mongoErr(err)
+	}
+	return &v, nil
+}
+
+// replaceKeeping is an update pipeline that replaces a document with v but leaves the
+// fields in keep as they are stored, so counters and lists maintained by atomic updates
+// survive a full save.
+func replaceKeeping(v any, keep ...string) mongo.Pipeline {
+	kept := bson.M{}
+	for _, f := range keep {
+		kept[f] = "$" + f
+	}
+	return mongo.Pipeline{{{Key: "$replaceWith", Value: bson.M{
+		// $literal keeps strings such as "$5 off" from reading as field paths
+		"$mergeObjects": bson.A{bson.M{"$literal": v}, kept},
+	}}}}
+}
+
+type mongoUsers struct{ coll *mongo.Collection }
+
+func NewMongoUsers(database *mongo.Database) UserRepository {
+	return &mongoUsers{coll: database.Collection("users")}
+}
+
+func (r *mongoUsers) List(ctx context.Context) ([]models.User, error) {
+	return findAll[models.User](ctx, r.coll, bson.D{})
+}
+
+func (r *mongoUsers) Get(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return findOne[models.User](ctx, r.coll, bson.M{"_id": id})
+}
+
+func (r *mongoUsers) FindByNameOrEmail(ctx context.Context, name, email string) (*models.User, error) {
+	filter := bson.M{"$or": []bson.M{
+		{"nameLower": strings.ToLower(name)},
+		{"emailLower": strings.ToLower(email)},
+	}}
+	return findOne[models.User](ctx, r.coll, filter)
+}
+
+func (r *mongoUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return findOne[models.User](ctx, r.coll, bson.M{"emailLower": strings.ToLower(email)})
+}
+
+func (r *mongoUsers) Insert(ctx context.Context, u *models.User) error {
+	if u.ID.IsZero() {
+		u.ID = primitive.NewObjectID()
+	}
+	_, err := r.coll.InsertOne(ctx, u)
+	return mongoErr(err)
+}
+
+func (r *mongoUsers) Update(ctx context.Context, u *models.User) error {
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": u.ID}, replaceKeeping(u, "favorites", "savedOrders"))
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUsers) AddFavorite(ctx context.Context, userID, drinkID primitive.ObjectID, limit int) error {
+	filter := bson.M{"_id": userID, "$or": []bson.M{
+		{"favorites": drinkID},
+		{fmt.Sprintf("favorites.%d", limit-1): bson.M{"$exists": false}},
+	}}
+	res, err := r.coll.UpdateOne(ctx, filter, bson.M{"$addToSet": bson.M{"favorites": drinkID}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := r.Get(ctx, userID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *mongoUsers) RemoveFavorite(ctx context.Context, userID, drinkID primitive.ObjectID) error {
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$pull": bson.M{"favorites": drinkID}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUsers) SaveOrder(ctx context.Context, userID primitive.ObjectID, o *models.SavedOrder, limit int) error {
+	o.NameLower = strings.ToLower(o.Name)
+	adding := o.ID.IsZero()
+	var res *mongo.UpdateResult
+	var err error
+	if adding {
+		o.ID = primitive.NewObjectID()
+		filter := bson.M{
+			"_id":                                  userID,
+			"savedOrders.nameLower":                bson.M{"$ne": o.NameLower},
+			fmt.Sprintf("savedOrders.%d", limit-1): bson.M{"$exists": false},
+		}
+		res, err = r.coll.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"savedOrders": o}})
+	} else {
+		filter := bson.M{
+			"_id":             userID,
+			"savedOrders._id": o.ID,
+			"savedOrders": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+				"nameLower": o.NameLower, "_id": bson.M{"$ne": o.ID},
+			}}},
+		}
+		res, err = r.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+			"savedOrders.$[o].name":      o.Name,
+			"savedOrders.$[o].nameLower": o.NameLower,
+			"savedOrders.$[o].items":     o.Items,
+			"savedOrders.$[o].updatedAt": o.UpdatedAt,
+		}}, options.Update().SetArrayFilters(options.ArrayFilters{Filters: []any{bson.M{"o._id": o.ID}}}))
+	}
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		if stored, err := r.Get(ctx, userID); err == nil {
+			if i := slices.IndexFunc(stored.SavedOrders, func(s models.SavedOrder) bool { return s.ID == o.ID }); i >= 0 {
+				o.CreatedAt = stored.SavedOrders[i].CreatedAt
+			}
+		}
+		return nil
+	}
+	// find out which condition failed
+	u, err := r.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return savedOrderConflict(u, o, adding)
+}
+
+func (r *mongoUsers) DeleteOrder(ctx context.Context, userID, orderID primitive.ObjectID) error {
+	res, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": userID, "savedOrders._id": orderID},
+		bson.M{"$pull": bson.M{"savedOrders": bson.M{"_id": orderID}}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoDrinks struct{ coll *mongo.Collection }
+
+func NewMongoDrinks(database *mongo.Database) DrinkRepository {
+	return &mongoDrinks{coll: database.Collection("drinks")}
+}
+
+func (r *mongoDrinks) List(ctx context.Context) ([]models.Drink, error) {
+	return findAll[models.Drink](ctx, r.coll, bson.M{"archived": bson.M{"$ne": true}})
+}
+
+func (r *mongoDrinks) ListAll(ctx context.Context) ([]models.Drink, error) {
+	return findAll[models.Drink](ctx, r.coll, bson.D{})
+}
+
+func (r *mongoDrinks) Get(ctx context.Context, id primitive.ObjectID) (*models.Drink, error) {
+	return findOne[models.Drink](ctx, r.coll, bson.M{"_id": id})
+}
+
+func (r *mongoDrinks) Save(ctx context.Context, d *models.Drink) error {
+	if d.ID.IsZero() {
+		d.ID = primitive.NewObjectID()
+	}
+	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": d.ID}, replaceKeeping(d, "rating", "ratingCount", "ratingSum"), options.Update().SetUpsert(true))
+	if err != nil {
+		return mongoErr(err)
+	}
+	stored, err := r.Get(ctx, d.ID)
+	if err != nil {
+		return err
+	}
+	d.Rating, d.RatingCount, d.RatingSum = stored.Rating, stored.RatingCount, stored.RatingSum
+	return nil
+}
+
+func (r *mongoDrinks) AddRating(ctx context.Context, id primitive.ObjectID, sum, count int) error {
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": id}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"ratingSum":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$ratingSum", 0}}, sum}},
+			"ratingCount": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$ratingCount", 0}}, count}},
+		}}},
+		{{Key: "$set", Value: bson.M{"rating": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$ratingCount", 0}},
+			bson.M{"$round": bson.A{bson.M{"$divide": bson.A{"$ratingSum", "$ratingCount"}}, 2}},
+			0,
+		}}}}},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoDrinks) SetRating(ctx context.Context, id primitive.ObjectID, sum, count int) error {
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"ratingSum": sum, "ratingCount": count, "rating": averageRating(sum, count),
+	}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoBookings struct{ coll *mongo.Collection }
+
+func NewMongoBookings(database *mongo.Database) BookingRepository {
+	return &mongoBookings{coll: database.Collection("bookings")}
+}
+
+func (r *mongoBookings) List(ctx context.Context) ([]models.Booking, error) {
+	return findAll[models.Booking](ctx, r.coll, bson.D{})
+}
+
+func (r *mongoBookings) Get(ctx context.Context, id primitive.ObjectID) (*models.Booking, error) {
+	return findOne[models.Booking](ctx, r.coll, bson.M{"_id": id})
+}
+
+func (r *mongoBookings) FindByCustomers(ctx context.Context, userIDs []primitive.ObjectID, sessionIDs []string) ([]models.Booking, error) {
+	if len(userIDs) == 0 && len(sessionIDs) == 0 {
+		return []models.Booking{}, nil
+	}
+	// $in rejects null
+	if userIDs == nil {
+		userIDs = []primitive.ObjectID{}
+	}
+	if sessionIDs == nil {
+		sessionIDs = []string{}
+	}
+	filter := bson.M{"$or": []bson.M{
+		{"userId": bson.M{"$in": userIDs}},
+		{"sessionId": bson.M{"$in": sessionIDs}},
+	}}
+	return findAll[models.Booking](ctx, r.coll, filter)
+}
+
+func (r *mongoBookings) FindByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Booking, error) {
+	return findAll[models.Booking](ctx, r.coll, bson.M{"userId": userID})
+}
+
+func (r *mongoBookings) Insert(ctx context.Context, b *models.Booking) error {
+	if b.ID.IsZero() {
+		b.ID = primitive.NewObjectID()
+	}
+	_, err := r.coll.InsertOne(ctx, b)
+	return mongoErr(err)
+}
+
+func (r *mongoBookings) SetStatus(ctx context.Context, id primitive.ObjectID, from []string, to string, at time.Time) (*models.Booking, error) {
+	states := make([]any, 0, len(from)+1)
+	for _, s := range from {
+		states = append(states, s)
+		if s == "" {
+			states = append(states, nil) // $in with null also matches a missing field
+		}
+	}
+	set := bson.M{"status": to}
+	if to == models.BookingCompleted {
+		set["completedAt"] = at
+	}
+	var b models.Booking
+	err := r.coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": bson.M{"$in": states}},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&b)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *mongoBookings) SetDepositStatus(ctx context.Context, id primitive.ObjectID, status string) error {
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": id, "deposit": bson.M{"$exists": true}}, bson.M{"$set": bson.M{"deposit.status": status}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// mongoLoyalty keeps balances in loyalty_accounts and the history in loyalty_ledger.
+// Mongo cannot update both atomically without a transaction, so the balance is changed
+// first with a conditional $inc (the part that must not race) and undone if the ledger
+// insert fails.
+type mongoLoyalty struct{ accounts, ledger *mongo.Collection }
+
+func NewMongoLoyalty(database *mongo.Database) LoyaltyRepository {
+	return &mongoLoyalty{
+		accounts: database.Collection("loyalty_accounts"),
+		ledger:   database.Collection("loyalty_ledger"),
+	}
+}
+
+func (r *mongoLoyalty) Account(ctx context.Context, userID primitive.ObjectID) (*models.LoyaltyAccount, error) {
+	acct, err := findOne[models.LoyaltyAccount](ctx, r.accounts, bson.M{"_id": userID})
+	if errors.Is(err, ErrNotFound) {
+		acct, err = &models.LoyaltyAccount{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if acct.Stamps == nil {
+		acct.Stamps = map[string]int{}
+	}
+	if acct.Rewards == nil {
+		acct.Rewards = map[string]int{}
+	}
+	return acct, nil
+}
+
+func (r *mongoLoyalty) Apply(ctx context.Context, e *models.LoyaltyEntry) error {
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	inc, filter, debit := loyaltyUpdate(e, 1)
+	update := bson.M{"$set": bson.M{"updatedAt": e.CreatedAt}}
+	if len(inc) > 0 {
+		update["$inc"] = inc
+	}
+	// a debit never upserts: a missing account has nothing to spend
+	res, err := r.accounts.UpdateOne(ctx, filter, update, options.Update().SetUpsert(!debit))
+	if err != nil {
+		return mongoErr(err)
+	}
+	if debit && res.MatchedCount == 0 {
+		return ErrInsufficient
+	}
+	if _, err := r.ledger.InsertOne(ctx, e); err != nil {
+		if undo, _, _ := loyaltyUpdate(e, -1); len(undo) > 0 {
+			if _, uerr := r.accounts.UpdateOne(ctx, bson.M{"_id": e.UserID}, bson.M{"$inc": undo}); uerr != nil {
+				return errors.Join(err, uerr)
+			}
+		}
+		return mongoErr(err)
+	}
+	return nil
+}
+
+// loyaltyUpdate builds the $inc for e (negated when sign is -1) and the account filter
+// that refuses a debit larger than the balance.
+func loyaltyUpdate(e *models.LoyaltyEntry, sign int) (inc, filter bson.M, debit bool) {
+	inc, filter = bson.M{}, bson.M{"_id": e.UserID}
+	add := func(field string, n int) {
+		if n *= sign; n == 0 {
+			return
+		}
+		inc[field] = n
+		if n < 0 {
+			filter[field] = bson.M{"$gte": -n}
+			debit = true
+		}
+	}
+	add("points", e.Points)
+	for tag, n := range e.Stamps {
+		add("stamps."+tag, n)
+	}
+	for tag, n := range e.Rewards {
+		add("rewards."+tag, n)
+	}
+	return inc, filter, debit
+}
+
+func (r *mongoLoyalty) History(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.LoyaltyEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit))
+	cur, err := r.ledger.Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := []models.LoyaltyEntry{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mongoPromotions counts uses on the promotion itself and per customer in
+// promotion_usage, whose _id is "<promotion id>|<customer>".
+type mongoPromotions struct{ promotions, usage, vouchers *mongo.Collection }
+
+func NewMongoPromotions(database *mongo.Database) PromotionRepository {
+	return &mongoPromotions{
+		promotions: database.Collection("promotions"),
+		usage:      database.Collection("promotion_usage"),
+		vouchers:   database.Collection("vouchers"),
+	}
+}
+
+func (r *mongoPromotions) List(ctx context.Context) ([]models.Promotion, error) {
+	cur, err := r.promotions.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	out := []models.Promotion{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *mongoPromotions) Active(ctx context.Context) ([]models.Promotion, error) {
+	return findAll[models.Promotion](ctx, r.promotions, bson.M{"active": true})
+}
+
+func (r *mongoPromotions) Get(ctx context.Context, id primitive.ObjectID) (*models.Promotion, error) {
+	return findOne[models.Promotion](ctx, r.promotions, bson.M{"_id": id})
+}
+
+func (r *mongoPromotions) Save(ctx context.Context, p *models.Promotion) error {
+	if p.ID.IsZero() {
+		p.ID = primitive.NewObjectID()
+	}
+	raw, err := bson.Marshal(p)
+	if err != nil {
+		return err
+	}
+	var set bson.M
+	if err := bson.Unmarshal(raw, &set); err != nil {
+		return err
+	}
+	delete(set, "_id")
+	delete(set, "uses")
+	delete(set, "createdAt")
+	_, err = r.promotions.UpdateOne(ctx, bson.M{"_id": p.ID}, bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"uses": 0, "createdAt": p.CreatedAt},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return mongoErr(err)
+	}
+	stored, err := r.Get(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	p.Uses, p.CreatedAt = stored.Uses, stored.CreatedAt
+	return nil
+}
+
+func (r *mongoPromotions) Claim(ctx context.Context, p *models.Promotion, customer string) error {
+	filter := bson.M{"_id": p.ID}
+	if p.MaxUses > 0 {
+		filter["uses"] = bson.M{"$lt": p.MaxUses}
+	}
+	res, err := r.promotions.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrInsufficient
+	}
+
+	usage := bson.M{"_id": p.ID.Hex() + "|" + customer}
+	if p.MaxUsesPerUser > 0 {
+		usage["count"] = bson.M{"$lt": p.MaxUsesPerUser}
+	}
+	// at the limit the filter misses the existing document and the upsert collides with it
+	_, err = r.usage.UpdateOne(ctx, usage, bson.M{"$inc": bson.M{"count": 1}}, options.Update().SetUpsert(true))
+	if err == nil {
+		return nil
+	}
+	if _, uerr := r.promotions.UpdateOne(ctx, bson.M{"_id": p.ID}, bson.M{"$inc": bson.M{"uses": -1}}); uerr != nil {
+		return errors.Join(err, uerr)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrInsufficient
+	}
+	return err
+}
+
+func (r *mongoPromotions) Release(ctx context.Context, promotionID primitive.ObjectID, customer string) error {
+	if _, err := r.promotions.UpdateOne(ctx, bson.M{"_id": promotionID, "uses": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"uses": -1}}); err != nil {
+		return err
+	}
+	_, err := r.usage.UpdateOne(ctx, bson.M{"_id": promotionID.Hex() + "|" + customer, "count": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"count": -1}})
+	return err
+}
+
+func (r *mongoPromotions) InsertVouchers(ctx context.Context, vouchers []models.Voucher) error {
+	docs := make([]any, len(vouchers))
+	for i := range vouchers {
+		docs[i] = vouchers[i]
+	}
+	_, err := r.vouchers.InsertMany(ctx, docs)
+	return mongoErr(err)
+}
+
+func (r *mongoPromotions) Voucher(ctx context.Context, code string) (*models.Voucher, error) {
+	return findOne[models.Voucher](ctx, r.vouchers, bson.M{"_id": code})
+}
+
+func (r *mongoPromotions) Vouchers(ctx context.Context, promotionID primitive.ObjectID) ([]models.Voucher, error) {
+	return findAll[models.Voucher](ctx, r.vouchers, bson.M{"promotionId": promotionID})
+}
+
+func (r *mongoPromotions) UseVoucher(ctx context.Context, code string, bookingID primitive.ObjectID, at time.Time) error {
+	res, err := r.vouchers.UpdateOne(ctx,
+		bson.M{"_id": code, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": at, "bookingId": bookingID}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := r.Voucher(ctx, code); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *mongoPromotions) ReleaseVoucher(ctx context.Context, code string, bookingID primitive.ObjectID) error {
+	_, err := r.vouchers.UpdateOne(ctx,
+		bson.M{"_id": code, "bookingId": bookingID},
+		bson.M{"$unset": bson.M{"usedAt": "", "bookingId": ""}},
+	)
+	return err
+}
+
+// mongoGiftCards changes the balance or status with a conditional update first, as
+// mongoLoyalty does, and undoes it if the ledger insert fails.
+type mongoGiftCards struct{ cards, ledger *mongo.Collection }
+
+func NewMongoGiftCards(database *mongo.Database) GiftCardRepository {
+	return &mongoGiftCards{
+		cards:  database.Collection("giftcards"),
+		ledger: database.Collection("giftcard_ledger"),
+	}
+}
+
+func (r *mongoGiftCards) Insert(ctx context.Context, cards []models.GiftCard) error {
+	docs := make([]any, len(cards))
+	entries := make([]any, len(cards))
+	ids := make([]primitive.ObjectID, len(cards))
+	for i := range cards {
+		if cards[i].ID.IsZero() {
+			cards[i].ID = primitive.NewObjectID()
+		}
+		ids[i] = cards[i].ID
+		docs[i] = cards[i]
+		entries[i] = models.GiftCardEntry{
+			ID: primitive.NewObjectID(), CardID: cards[i].ID, Kind: models.GiftCardIssue,
+			Amount: cards[i].Balance, Balance: cards[i].Balance, CreatedAt: cards[i].CreatedAt,
+		}
+	}
+	if _, err := r.cards.InsertMany(ctx, docs); err != nil {
+		return mongoErr(err)
+	}
+	if _, err := r.ledger.InsertMany(ctx, entries); err != nil {
+		if _, derr := r.cards.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); derr != nil {
+			return errors.Join(err, derr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *mongoGiftCards) List(ctx context.Context) ([]models.GiftCard, error) {
+	cur, err := r.cards.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	out := []models.GiftCard{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *mongoGiftCards) Get(ctx context.Context, id primitive.ObjectID) (*models.GiftCard, error) {
+	return findOne[models.GiftCard](ctx, r.cards, bson.M{"_id": id})
+}
+
+func (r *mongoGiftCards) FindByCode(ctx context.Context, code string) (*models.GiftCard, error) {
+	return findOne[models.GiftCard](ctx, r.cards, bson.M{"code": code})
+}
+
+func (r *mongoGiftCards) Apply(ctx context.Context, e *models.GiftCardEntry) (*models.GiftCard, error) {
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	filter := bson.M{"_id": e.CardID, "status": models.GiftCardActive}
+	debit := e.Amount < 0
+	if debit {
+		filter["balance"] = bson.M{"$gte": -e.Amount}
+		filter["$or"] = bson.A{bson.M{"expiresAt": nil}, bson.M{"expiresAt": bson.M{"$gt": e.CreatedAt}}}
+	}
+	var card models.GiftCard
+	err := r.cards.FindOneAndUpdate(ctx, filter,
+		bson.M{"$inc": bson.M{"balance": e.Amount}, "$set": bson.M{"updatedAt": e.CreatedAt}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&card)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		stored, gerr := r.Get(ctx, e.CardID)
+		switch {
+		case gerr != nil:
+			return nil, gerr
+		case stored.Status != models.GiftCardActive || debit && stored.Expired(e.CreatedAt):
+			return nil, ErrConflict
+		}
+		return nil, ErrInsufficient
+	}
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+	e.Balance = card.Balance
+	if _, err := r.ledger.InsertOne(ctx, e); err != nil {
+		if _, uerr := r.cards.UpdateOne(ctx, bson.M{"_id": e.CardID}, bson.M{"$inc": bson.M{"balance": -e.Amount}}); uerr != nil {
+			return nil, errors.Join(err, uerr)
+		}
+		return nil, mongoErr(err)
+	}
+	return &card, nil
+}
+
+func (r *mongoGiftCards) Void(ctx context.Context, id primitive.ObjectID, at time.Time) (*models.GiftCard, error) {
+	var card models.GiftCard
+	err := r.cards.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.GiftCardActive},
+		bson.M{"$set": bson.M{"status": models.GiftCardVoided, "balance": 0, "voidedAt": at, "updatedAt": at}},
+	).Decode(&card)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	// card is the document before the update; Apply leaves a voided card alone, so
+	// restoring it cannot lose a concurrent change
+	entry := models.GiftCardEntry{ID: primitive.NewObjectID(), CardID: id, Kind: models.GiftCardVoid, Amount: -card.Balance, CreatedAt: at}
+	if _, err := r.ledger.InsertOne(ctx, entry); err != nil {
+		_, uerr := r.cards.UpdateOne(ctx, bson.M{"_id": id, "status": models.GiftCardVoided}, bson.M{
+			"$set":   bson.M{"status": card.Status, "balance": card.Balance, "updatedAt": card.UpdatedAt},
+			"$unset": bson.M{"voidedAt": ""},
+		})
+		if uerr != nil {
+			return nil, errors.Join(err, uerr)
+		}
+		return nil, mongoErr(err)
+	}
+	card.Status, card.Balance, card.VoidedAt, card.UpdatedAt = models.GiftCardVoided, 0, &at, at
+	return &card, nil
+}
+
+func (r *mongoGiftCards) History(ctx context.Context, id primitive.ObjectID) ([]models.GiftCardEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}})
+	cur, err := r.ledger.Find(ctx, bson.M{"cardId": id}, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := []models.GiftCardEntry{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type mongoPayments struct{ coll *mongo.Collection }
+
+func NewMongoPayments(database *mongo.Database) PaymentRepository {
+	return &mongoPayments{coll: database.Collection("payments")}
+}
+
+func (r *mongoPayments) Insert(ctx context.Context, p *models.Payment) error {
+	if p.ID.IsZero() {
+		p.ID = primitive.NewObjectID()
+	}
+	_, err := r.coll.InsertOne(ctx, p)
+	return mongoErr(err)
+}
+
+func (r *mongoPayments) Get(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	return findOne[models.Payment](ctx, r.coll, bson.M{"_id": id})
+}
+
+func (r *mongoPayments) SetStatus(ctx context.Context, id primitive.ObjectID, from []string, to, ref string, at time.Time) (*models.Payment, error) {
+	set := bson.M{"status": to, "updatedAt": at}
+	switch to {
+	case models.PaymentPaid:
+		set["paidAt"] = at
+	case models.PaymentRefunded:
+		set["refundedAt"] = at
+	}
+	if ref != "" {
+		set["ref"] = ref
+	}
+	var p models.Payment
+	err := r.coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": bson.M{"$in": from}},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&p)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *mongoPayments) Expired(ctx context.Context, t time.Time) ([]models.Payment, error) {
+	return findAll[models.Payment](ctx, r.coll, bson.M{"status": models.PaymentPending, "expiresAt": bson.M{"$lt": t}})
+}
+
+type mongoInvoices struct{ coll *mongo.Collection }
+
+func NewMongoInvoices(database *mongo.Database) InvoiceRepository {
+	return &mongoInvoices{coll: database.Collection("invoices")}
+}
+
+// maxNumberAttempts bounds how often Insert retries a number another insert took.
+const maxNumberAttempts = 20
+
+func (r *mongoInvoices) Insert(ctx context.Context, inv *models.Invoice) error {
+	if inv.ID.IsZero() {
+		inv.ID = primitive.NewObjectID()
+	}
+	for range maxNumberAttempts {
+		var last models.Invoice
+		err := r.coll.FindOne(ctx, bson.M{"branch": inv.Branch, "kind": inv.Kind},
+			options.FindOne().SetSort(bson.D{{Key: "number", Value: -1}}).SetProjection(bson.M{"number": 1}),
+		).Decode(&last)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		inv.Number = last.Number + 1
+		inv.Code = models.InvoiceCode(inv.Branch, inv.Kind, inv.Number)
+		_, err = r.coll.InsertOne(ctx, inv)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		// either the booking has this invoice already or the number was just taken
+		if _, err := r.FindByBooking(ctx, inv.BookingID, inv.Kind); err == nil {
+			return ErrDuplicate
+		}
+	}
+	return ErrConflict
+}
+
+func (r *mongoInvoices) Get(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error) {
+	return findOne[models.Invoice](ctx, r.coll, bson.M{"_id": id})
+}
+
+func (r *mongoInvoices) FindByBooking(ctx context.Context, bookingID primitive.ObjectID, kind string) (*models.Invoice, error) {
+	return findOne[models.Invoice](ctx, r.coll, bson.M{"bookingId": bookingID, "kind": kind})
+}
+
+func (r *mongoInvoices) List(ctx context.Context) ([]models.Invoice, error) {
+	cur, err := r.coll.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "issuedAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	out := []models.Invoice{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type mongoReviews struct{ coll *mongo.Collection }
+
+func NewMongoReviews(database *mongo.Database) ReviewRepository {
+	return &mongoReviews{coll: database.Collection("reviews")}
+}
+
+func (r *mongoReviews) Save(ctx context.Context, rv *models.Review) (*models.Review, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"bookingId": rv.BookingID,
+			"author":    rv.Author,
+			"rating":    rv.Rating,
+			"comment":   rv.Comment,
+			"status":    rv.Status,
+			"updatedAt": rv.UpdatedAt,
+		},
+		"$unset": bson.M{"note": "", "moderatedAt": ""},
+	}
+	// the unique drinkId/userId index turns a concurrent first review into a replace
+	for range 2 {
+		var prev models.Review
+		err := r.coll.FindOneAndUpdate(ctx, bson.M{"drinkId": rv.DrinkID, "userId": rv.UserID}, update).Decode(&prev)
+		if err == nil {
+			rv.ID, rv.CreatedAt = prev.ID, prev.CreatedAt
+			rv.Note, rv.ModeratedAt = "", nil
+			return &prev, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		rv.ID = primitive.NewObjectID()
+		_, err = r.coll.InsertOne(ctx, rv)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+	}
+	return nil, ErrConflict
+}
+
+func (r *mongoReviews) Get(ctx context.Context, id primitive.ObjectID) (*models.Review, error) {
+	return findOne[models.Review](ctx, r.coll, bson.M{"_id": id})
+}
+
+func (r *mongoReviews) SetStatus(ctx context.Context, id primitive.ObjectID, to, note string, at time.Time) (*models.Review, error) {
+	set := bson.M{"status": to, "moderatedAt": at}
+	update := bson.M{"$set": set}
+	if note != "" {
+		set["note"] = note
+	} else {
+		update["$unset"] = bson.M{"note": ""}
+	}
+	var prev models.Review
+	err := r.coll.FindOneAndUpdate(ctx, bson.M{"_id": id, "status": bson.M{"$ne": to}}, update).Decode(&prev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &prev, nil
+}
+
+func (r *mongoReviews) Delete(ctx context.Context, id primitive.ObjectID) (*models.Review, error) {
+	var prev models.Review
+	if err := r.coll.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&prev); err != nil {
+		return nil, mongoErr(err)
+	}
+	return &prev, nil
+}
+
+func (r *mongoReviews) ByDrink(ctx context.Context, drinkID, after primitive.ObjectID, limit int) ([]models.Review, error) {
+	filter := bson.M{"drinkId": drinkID, "status": models.ReviewApproved}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$lt": after}
+	}
+	return r.page(ctx, filter, -1, limit)
+}
+
+func (r *mongoReviews) RatingTotals(ctx context.Context) (map[primitive.ObjectID]RatingTotal, error) {
+	cur, err := r.coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": models.ReviewApproved}}},
+		{{Key: "$group", Value: bson.M{"_id": "$drinkId", "sum": bson.M{"$sum": "$rating"}, "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		DrinkID primitive.ObjectID `bson:"_id"`
+		Sum     int                `bson:"sum"`
+		Count   int                `bson:"count"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := make(map[primitive.ObjectID]RatingTotal, len(rows))
+	for _, row := range rows {
+		out[row.DrinkID] = RatingTotal{Sum: row.Sum, Count: row.Count}
+	}
+	return out, nil
+}
+
+func (r *mongoReviews) ByStatus(ctx context.Context, status string, after primitive.ObjectID, limit int) ([]models.Review, error) {
+	filter := bson.M{"status": status}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	return r.page(ctx, filter, 1, limit)
+}
+
+// page returns up to limit reviews matching filter in _id order, 1 or -1.
+func (r *mongoReviews) page(ctx context.Context, filter bson.M, order, limit int) ([]models.Review, error) {
+	cur, err := r.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: order}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	out := []models.Review{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type mongoRecoEvents struct{ coll *mongo.Collection }
+
+func NewMongoRecoEvents(database *mongo.Database) RecoEventRepository {
+	return &mongoRecoEvents{coll: database.Collection("reco_events")}
+}
+
+func (r *mongoRecoEvents) Insert(ctx context.Context, ev *models.RecoEvent) error {
+	if ev.ID.IsZero() {
+		ev.ID = primitive.NewObjectID()
+	}
+	_, err := r.coll.InsertOne(ctx, ev)
+	return mongoErr(err)
+}
+
+func (r *mongoRecoEvents) ByExperiment(ctx context.Context, key string) ([]models.RecoEvent, error) {
+	return findAll[models.RecoEvent](ctx, r.coll, bson.M{"exposure.key": key})
+}
+
+type mongoExperiments struct{ coll *mongo.Collection }
+
+func NewMongoExperiments(database *mongo.Database) ExperimentRepository {
+	return &mongoExperiments{coll: database.Collection("experiments")}
+}
+
+func (r *mongoExperiments) Insert(ctx context.Context, e *models.Experiment) error {
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	_, err := r.coll.InsertOne(ctx, e)
+	return mongoErr(err)
+}
+
+func (r *mongoExperiments) Active(ctx context.Context) (*models.Experiment, error) {
+	var e models.Experiment
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	if err := r.coll.FindOne(ctx, bson.M{"active": true}, opts).Decode(&e); err != nil {
+		return nil, mongoErr(err)
+	}
+	return &e, nil
+}
+
+func (r *mongoExperiments) Get(ctx context.Context, key string) (*models.Experiment, error) {
+	return findOne[models.Experiment](ctx, r.coll, bson.M{"key": key})
+}
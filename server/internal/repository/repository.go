@@ -0,0 +1,268 @@
+// Package repository hides storage behind small interfaces so handlers, resolvers and
+// services can run against Mongo in production and an in-memory store in tests.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The sentinels are client-facing errors, so a lookup that misses can be returned as is.
+var (
+	ErrNotFound  = apperr.New(apperr.NotFound, "not found")
+	ErrDuplicate = apperr.New(apperr.AlreadyExists, "already exists")
+	// ErrConflict means a conditional update found the record in another state.
+	ErrConflict = apperr.New(apperr.FailedPrecondition, "the record was changed by another request")
+	// ErrInsufficient means a debit would take a balance below zero.
+	ErrInsufficient = apperr.New(apperr.InsufficientBalance, "insufficient balance")
+)
+
+type UserRepository interface {
+	List(ctx context.Context) ([]models.User, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	// FindByNameOrEmail returns the user whose name matches name or whose email matches
+	// email, case-insensitively. Login passes the same value for both.
+	FindByNameOrEmail(ctx context.Context, name, email string) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// Insert stores u, assigning an ID if it has none. Names and emails are unique.
+	Insert(ctx context.Context, u *models.User) error
+	// Update replaces the stored user with the same ID. Favorites and saved orders are
+	// kept as stored; they change only through the methods below.
+	Update(ctx context.Context, u *models.User) error
+
+	// AddFavorite adds drinkID to the user's favorites unless it is there already. It
+	// fails with ErrConflict when the user has limit favorites.
+	AddFavorite(ctx context.Context, userID, drinkID primitive.ObjectID, limit int) error
+	RemoveFavorite(ctx context.Context, userID, drinkID primitive.ObjectID) error
+	// SaveOrder adds o to the user's saved orders, assigning its ID, or updates the saved
+	// order with o's ID (ErrNotFound if there is none), keeping its CreatedAt. Names are
+	// unique per user, case-insensitively (ErrDuplicate). Adding fails with ErrConflict
+	// when the user has limit saved orders.
+	SaveOrder(ctx context.Context, userID primitive.ObjectID, o *models.SavedOrder, limit int) error
+	DeleteOrder(ctx context.Context, userID, orderID primitive.ObjectID) error
+}
+
+type DrinkRepository interface {
+	// List returns the current menu, without archived drinks.
+	List(ctx context.Context) ([]models.Drink, error)
+	// ListAll includes archived drinks.
+	ListAll(ctx context.Context) ([]models.Drink, error)
+	// Get finds a drink by ID, archived or not, so old bookings still resolve.
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Drink, error)
+	// Save inserts d or replaces the drink with the same ID, assigning an ID if it has none.
+	// The rating is kept from the stored drink.
+	Save(ctx context.Context, d *models.Drink) error
+	// AddRating adds sum and count to the drink's review totals and recomputes its
+	// average, atomically.
+	AddRating(ctx context.Context, id primitive.ObjectID, sum, count int) error
+	// SetRating replaces the drink's review totals and recomputes its average.
+	SetRating(ctx context.Context, id primitive.ObjectID, sum, count int) error
+}
+
+type BookingRepository interface {
+	List(ctx context.Context) ([]models.Booking, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Booking, error)
+	// FindByCustomers returns bookings made by any of the users or in any of the sessions.
+	FindByCustomers(ctx context.Context, userIDs []primitive.ObjectID, sessionIDs []string) ([]models.Booking, error)
+	// FindByUser returns the bookings made while logged in as userID.
+	FindByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Booking, error)
+	// Insert stores b, assigning an ID if it has none.
+	Insert(ctx context.Context, b *models.Booking) error
+	// SetStatus moves a booking whose status is one of from (where "" also matches no
+	// status) to status to, atomically, and returns the updated booking. It fails with
+	// ErrConflict when the booking is in another state. Completing sets CompletedAt to at.
+	SetStatus(ctx context.Context, id primitive.ObjectID, from []string, to string, at time.Time) (*models.Booking, error)
+	// SetDepositStatus copies a payment's status onto the booking's deposit.
+	SetDepositStatus(ctx context.Context, id primitive.ObjectID, status string) error
+}
+
+type LoyaltyRepository interface {
+	// Account returns the user's balance; users who never earned get an empty account.
+	Account(ctx context.Context, userID primitive.ObjectID) (*models.LoyaltyAccount, error)
+	// Apply adds e's amounts to the account and records e in the ledger. A debit that
+	// would take any balance below zero changes nothing and fails with ErrInsufficient,
+	// so concurrent redemptions cannot spend the same points twice. A second entry of the
+	// same kind for a booking changes nothing and fails with ErrDuplicate.
+	Apply(ctx context.Context, e *models.LoyaltyEntry) error
+	// History returns the newest limit entries for the user, newest first.
+	History(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.LoyaltyEntry, error)
+}
+
+type PromotionRepository interface {
+	// List returns every promotion, newest first.
+	List(ctx context.Context) ([]models.Promotion, error)
+	Active(ctx context.Context) ([]models.Promotion, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Promotion, error)
+	// Save inserts p or replaces the promotion with the same ID, assigning an ID if it
+	// has none. Uses and CreatedAt are kept from the stored promotion.
+	Save(ctx context.Context, p *models.Promotion) error
+	// Claim counts one use of p by customer. It fails with ErrInsufficient, changing
+	// nothing, when p.MaxUses or p.MaxUsesPerUser is reached, even under concurrent claims.
+	Claim(ctx context.Context, p *models.Promotion, customer string) error
+	// Release gives back a use counted by Claim.
+	Release(ctx context.Context, promotionID primitive.ObjectID, customer string) error
+
+	// InsertVouchers stores new voucher codes; a code that exists fails with ErrDuplicate.
+	InsertVouchers(ctx context.Context, vouchers []models.Voucher) error
+	Voucher(ctx context.Context, code string) (*models.Voucher, error)
+	Vouchers(ctx context.Context, promotionID primitive.ObjectID) ([]models.Voucher, error)
+	// UseVoucher marks an unused voucher as used by bookingID; ErrConflict if it was used.
+	UseVoucher(ctx context.Context, code string, bookingID primitive.ObjectID, at time.Time) error
+	// ReleaseVoucher makes a voucher used by bookingID usable again.
+	ReleaseVoucher(ctx context.Context, code string, bookingID primitive.ObjectID) error
+}
+
+type GiftCardRepository interface {
+	// Insert stores new cards and their issue entries; a code that exists fails with
+	// ErrDuplicate.
+	Insert(ctx context.Context, cards []models.GiftCard) error
+	// List returns every card, newest first.
+	List(ctx context.Context) ([]models.GiftCard, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.GiftCard, error)
+	FindByCode(ctx context.Context, code string) (*models.GiftCard, error)
+	// Apply adds e.Amount to the card's balance, sets e.Balance and records e in the
+	// ledger. The card must be active; a debit also needs it unexpired at e.CreatedAt,
+	// with at least the amount left. Otherwise nothing changes and it fails with
+	// ErrConflict (voided or expired) or ErrInsufficient, so concurrent redemptions cannot
+	// overdraw a card and nothing lands on a voided one. A second entry of the same kind
+	// for a booking changes nothing and fails with ErrDuplicate.
+	Apply(ctx context.Context, e *models.GiftCardEntry) (*models.GiftCard, error)
+	// Void marks an active card voided and writes off its balance in the ledger, or
+	// changes nothing; ErrConflict if it was voided already.
+	Void(ctx context.Context, id primitive.ObjectID, at time.Time) (*models.GiftCard, error)
+	// History returns the card's ledger, newest first.
+	History(ctx context.Context, id primitive.ObjectID) ([]models.GiftCardEntry, error)
+}
+
+type PaymentRepository interface {
+	Insert(ctx context.Context, p *models.Payment) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Payment, error)
+	// SetStatus moves a payment whose status is one of from to status to, atomically,
+	// and returns the updated payment; ErrConflict when it is in another state. Paying
+	// records ref and sets PaidAt to at; refunding sets RefundedAt.
+	SetStatus(ctx context.Context, id primitive.ObjectID, from []string, to, ref string, at time.Time) (*models.Payment, error)
+	// Expired returns pending payments whose ExpiresAt is before t.
+	Expired(ctx context.Context, t time.Time) ([]models.Payment, error)
+}
+
+type InvoiceRepository interface {
+	// Insert numbers inv one after the last invoice of its branch and kind, sets Number
+	// and Code, and stores it. Numbers taken by concurrent inserts are retried, so the
+	// sequence has no gaps. A booking has at most one invoice of each kind; a second one
+	// fails with ErrDuplicate.
+	Insert(ctx context.Context, inv *models.Invoice) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error)
+	FindByBooking(ctx context.Context, bookingID primitive.ObjectID, kind string) (*models.Invoice, error)
+	// List returns every invoice, newest first.
+	List(ctx context.Context) ([]models.Invoice, error)
+}
+
+type ReviewRepository interface {
+	// Save stores r as its user's review of its drink, replacing any earlier one, and
+	// returns the review it replaced, or nil. r keeps the earlier ID and CreatedAt.
+	Save(ctx context.Context, r *models.Review) (*models.Review, error)
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Review, error)
+	// SetStatus moves a review to status to with the moderator's note, atomically, and
+	// returns the review as it was before; ErrConflict if it already had that status.
+	SetStatus(ctx context.Context, id primitive.ObjectID, to, note string, at time.Time) (*models.Review, error)
+	// Delete removes a review and returns it.
+	Delete(ctx context.Context, id primitive.ObjectID) (*models.Review, error)
+	// ByDrink returns up to limit approved reviews of the drink, newest first, starting
+	// after the review with ID after (zero for the first page).
+	ByDrink(ctx context.Context, drinkID, after primitive.ObjectID, limit int) ([]models.Review, error)
+	// ByStatus returns up to limit reviews with the status, oldest first, starting after
+	// the review with ID after.
+	ByStatus(ctx context.Context, status string, after primitive.ObjectID, limit int) ([]models.Review, error)
+	// RatingTotals sums the approved reviews of every drink that has any.
+	RatingTotals(ctx context.Context) (map[primitive.ObjectID]RatingTotal, error)
+}
+
+// RatingTotal is the sum and count of a drink's approved review ratings.
+type RatingTotal struct{ Sum, Count int }
+
+// RecoEventRepository logs served recommendations.
+type RecoEventRepository interface {
+	Insert(ctx context.Context, ev *models.RecoEvent) error
+	// ByExperiment returns the events that exposed someone to experiment key.
+	ByExperiment(ctx context.Context, key string) ([]models.RecoEvent, error)
+}
+
+// ExperimentRepository holds recommendation experiments. In production they are
+// written directly in Mongo; Insert is for tests and seeding.
+type ExperimentRepository interface {
+	Insert(ctx context.Context, e *models.Experiment) error
+	// Active returns the most recently created active experiment, or ErrNotFound.
+	Active(ctx context.Context) (*models.Experiment, error)
+	Get(ctx context.Context, key string) (*models.Experiment, error)
+}
+
+// Repositories bundles the repositories the API needs.
+type Repositories struct {
+	Users       UserRepository
+	Drinks      DrinkRepository
+	Bookings    BookingRepository
+	Loyalty     LoyaltyRepository
+	Promotions  PromotionRepository
+	GiftCards   GiftCardRepository
+	Payments    PaymentRepository
+	Invoices    InvoiceRepository
+	Reviews     ReviewRepository
+	RecoEvents  RecoEventRepository
+	Experiments ExperimentRepository
+}
+
+// NewMongo returns repositories backed by database.
+func NewMongo(database *mongo.Database) Repositories {
+	return Repositories{
+		Users:       NewMongoUsers(database),
+		Drinks:      NewMongoDrinks(database),
+		Bookings:    NewMongoBookings(database),
+		Loyalty:     NewMongoLoyalty(database),
+		Promotions:  NewMongoPromotions(database),
+		GiftCards:   NewMongoGiftCards(database),
+		Payments:    NewMongoPayments(database),
+		Invoices:    NewMongoInvoices(database),
+		Reviews:     NewMongoReviews(database),
+		RecoEvents:  NewMongoRecoEvents(database),
+		Experiments: NewMongoExperiments(database),
+	}
+}
+
+// NewMemory returns empty in-memory repositories, for tests and local experiments.
+func NewMemory() Repositories {
+	return Repositories{
+		Users:       NewMemoryUsers(),
+		Drinks:      NewMemoryDrinks(),
+		Bookings:    NewMemoryBookings(),
+		Loyalty:     NewMemoryLoyalty(),
+		Promotions:  NewMemoryPromotions(),
+		GiftCards:   NewMemoryGiftCards(),
+		Payments:    NewMemoryPayments(),
+		Invoices:    NewMemoryInvoices(),
+		Reviews:     NewMemoryReviews(),
+		RecoEvents:  NewMemoryRecoEvents(),
+		Experiments: NewMemoryExperiments(),
+	}
+}
+
+// savedOrderConflict explains why saving o for u changed nothing.
+func savedOrderConflict(u *models.User, o *models.SavedOrder, adding bool) error {
+	found := false
+	for _, other := range u.SavedOrders {
+		if other.ID == o.ID {
+			found = true
+		} else if other.NameLower == o.NameLower {
+			return ErrDuplicate
+		}
+	}
+	if !adding && !found {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
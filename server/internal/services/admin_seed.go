@@ -2,26 +2,25 @@ package services
 
 import (
 	"context"
-	"log"
-	"os"
+	"errors"
+	"log/slog"
 	"strings"
 	"time"
 
-	"leblanc/server/internal/db"
+	"leblanc/server/internal/config"
 	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// EnsureAdminUser inserts a predefined admin account if it does not already exist.
-// Controlled by env: ADMIN_NAME, ADMIN_EMAIL, ADMIN_PASSWORD.
-func EnsureAdminUser() {
-	name := strings.TrimSpace(os.Getenv("ADMIN_NAME"))
-	email := strings.TrimSpace(os.Getenv("ADMIN_EMAIL"))
-	password := os.Getenv("ADMIN_PASSWORD")
+// EnsureAdminUser inserts the configured admin account if it does not already exist.
+// Controlled by ADMIN_NAME, ADMIN_EMAIL and ADMIN_PASSWORD.
+func EnsureAdminUser(users repository.UserRepository, cfg config.AdminConfig) {
+	name := strings.TrimSpace(cfg.Name)
+	email := strings.TrimSpace(cfg.Email)
+	password := cfg.Password
 
 	if email == "" || password == "" {
 		return
@@ -30,25 +29,24 @@ func EnsureAdminUser() {
 	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 	defer cancel()
 
-	coll := db.DB.Collection("users")
 	emailLower := strings.ToLower(email)
 
-	var existing models.User
-	err := coll.FindOne(ctx, bson.M{"emailLower": emailLower}).Decode(&existing)
+	existing, err := users.FindByEmail(ctx, email)
 	if err == nil {
 		// already exists, ensure role admin
 		if existing.Role != "admin" || !existing.Verified {
-			_, _ = coll.UpdateOne(ctx, bson.M{"_id": existing.ID}, bson.M{"$set": bson.M{"role": "admin", "verified": true}})
+			existing.Role, existing.Verified = "admin", true
+			_ = users.Update(ctx, existing)
 		}
 		return
-	} else if err != mongo.ErrNoDocuments {
-		log.Printf("ensure admin user: lookup error: %v", err)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		slog.ErrorContext(ctx, "ensure admin user: lookup failed", "error", err)
 		return
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("ensure admin user: hash error: %v", err)
+		slog.ErrorContext(ctx, "ensure admin user: hash failed", "error", err)
 		return
 	}
 
@@ -68,10 +66,10 @@ func EnsureAdminUser() {
 		CreatedAt:    time.Now(),
 	}
 
-	if _, err := coll.InsertOne(ctx, admin); err != nil {
-		log.Printf("ensure admin user: insert error: %v", err)
+	if err := users.Insert(ctx, &admin); err != nil {
+		slog.ErrorContext(ctx, "ensure admin user: insert failed", "error", err)
 		return
 	}
 
-	log.Printf("admin account ensured for %s", email)
+	slog.InfoContext(ctx, "admin account ensured", "email", email)
 }
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/metrics"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned for an unknown user and a wrong password alike, so
+// login responses do not reveal which accounts exist.
+var ErrInvalidCredentials = apperr.New(apperr.InvalidCredentials, "incorrect name, email or password")
+
+var ErrEmailNotVerified = apperr.New(apperr.EmailNotVerified, "email not verified")
+
+// Authenticate checks a login by name or email for both REST and GraphQL, recording the
+// failure reason in metrics.
+func Authenticate(ctx context.Context, users repository.UserRepository, nameOrEmail, password string) (*models.User, error) {
+	nameOrEmail = strings.TrimSpace(nameOrEmail)
+	password = strings.TrimSpace(password)
+	if nameOrEmail == "" || password == "" {
+		metrics.LoginFailed(metrics.LoginInvalidRequest)
+		err := apperr.New(apperr.InvalidArgument, "name and password are required")
+		if nameOrEmail == "" {
+			err.Fields = append(err.Fields, apperr.FieldError{Field: "name", Message: "is required"})
+		}
+		if password == "" {
+			err.Fields = append(err.Fields, apperr.FieldError{Field: "password", Message: "is required"})
+		}
+		return nil, err
+	}
+
+	user, err := users.FindByNameOrEmail(ctx, nameOrEmail, nameOrEmail)
+	if errors.Is(err, repository.ErrNotFound) {
+		metrics.LoginFailed(metrics.LoginUnknownUser)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		metrics.LoginFailed(metrics.LoginWrongPassword)
+		return nil, ErrInvalidCredentials
+	}
+	if !user.Verified {
+		metrics.LoginFailed(metrics.LoginUnverified)
+		return nil, ErrEmailNotVerified
+	}
+	return user, nil
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/metrics"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errNotPending = apperr.New(apperr.FailedPrecondition, "only pending bookings can be completed or cancelled")
+
+// Bookings creates bookings for REST and GraphQL alike and moves them through their
+// statuses, keeping promotion uses, the loyalty ledger, gift card balances and deposits
+// in step.
+type Bookings struct {
+	repos      repository.Repositories
+	loyalty    *Loyalty
+	promotions *Promotions
+	giftCards  *GiftCards
+	payments   *Payments
+}
+
+func NewBookings(repos repository.Repositories, loyalty *Loyalty, promotions *Promotions, giftCards *GiftCards, payments *Payments) *Bookings {
+	return &Bookings{repos: repos, loyalty: loyalty, promotions: promotions, giftCards: giftCards, payments: payments}
+}
+
+// BookingOptions are the optional parts of a booking request.
+type BookingOptions struct {
+	// Redeem needs a logged-in user.
+	Redeem *RedeemRequest `json:"redeem"`
+	// Voucher is a single-use promotion code.
+	Voucher string `json:"voucher"`
+	// GiftCard pays for part or all of the total.
+	GiftCard *GiftCardRequest `json:"giftCard"`
+}
+
+// Place prices and stores b as a pending booking. Promotions are applied first, then any
+// loyalty redemption, which needs b.UserID to be the logged-in user, then the gift card
+// pays from what is left. Promotion uses, vouchers, points and gift card balance are
+// claimed before the booking is stored and given back if that fails. Large bookings also
+// open a deposit payment; b.Deposit.CheckoutURL is where the customer pays it.
+func (s *Bookings) Place(ctx context.Context, b *models.Booking, opts BookingOptions) error {
+	b.Email = strings.TrimSpace(b.Email)
+	if b.Email == "" {
+		return apperr.Invalid("email", "is required")
+	}
+	lines, subtotal, err := PriceItems(ctx, s.repos.Drinks, b.Items)
+	if err != nil {
+		return err
+	}
+	for i, line := range lines {
+		b.Items[i].Name, b.Items[i].Price = line.Drink.Name, line.Drink.Price
+	}
+	if b.ID.IsZero() {
+		b.ID = primitive.NewObjectID()
+	}
+	b.Status = models.BookingPending
+	b.Subtotal, b.Discount, b.Total = subtotal, 0, subtotal
+	b.Promotions, b.Redemption, b.GiftCardPayment, b.Deposit, b.CompletedAt = nil, nil, nil, nil, nil
+	b.CreatedAt = time.Now()
+	if opts.Redeem.empty() {
+		opts.Redeem = nil
+	} else if b.UserID == nil {
+		return apperr.New(apperr.Unauthenticated, "log in to redeem loyalty points")
+	}
+
+	applied, err := s.promotions.Apply(ctx, b, lines, subtotal, opts.Voucher)
+	if err != nil {
+		return err
+	}
+	b.Promotions = applied
+	for _, a := range applied {
+		b.Discount += a.Amount
+	}
+	b.Total = subtotal - b.Discount
+
+	if opts.Redeem != nil {
+		r, err := s.loyalty.Redeem(ctx, *b.UserID, b.ID, *opts.Redeem, lines, b.Total)
+		if err != nil {
+			s.promotions.Release(ctx, b)
+			return err
+		}
+		b.Redemption = r
+		b.Discount += r.Value
+		b.Total -= r.Value
+	}
+
+	b.AmountDue = b.Total
+	if !opts.GiftCard.empty() {
+		pay, err := s.giftCards.Charge(ctx, b, *opts.GiftCard)
+		if err != nil {
+			s.giveBack(ctx, b)
+			return err
+		}
+		if pay != nil {
+			b.GiftCardPayment = pay
+			b.AmountDue -= pay.Amount
+		}
+	}
+
+	if amount := s.payments.DepositFor(b); amount > 0 {
+		deposit, err := s.payments.Open(ctx, b, amount)
+		if err != nil {
+			s.giveBack(ctx, b)
+			return apperr.Wrap(err, apperr.Unavailable, "the payment provider is unavailable, try again later")
+		}
+		b.Deposit = deposit
+	}
+
+	if err := s.repos.Bookings.Insert(ctx, b); err != nil {
+		if b.Deposit != nil {
+			if _, err := s.payments.Abandon(ctx, b.Deposit.PaymentID, false); err != nil {
+				slog.ErrorContext(ctx, "deposit cancel failed", "booking", b.ID.Hex(), "error", err)
+			}
+		}
+		s.giveBack(ctx, b)
+		return err
+	}
+	metrics.BookingCreated(b.Channel)
+	return nil
+}
+
+// Complete marks a pending booking completed and credits its loyalty points. Only
+// bookings made while logged in earn, for the same reason as in BelongsTo. Completing
+// a completed booking credits the points if that failed before; they are credited once.
+func (s *Bookings) Complete(ctx context.Context, id primitive.ObjectID) (*models.Booking, error) {
+	b, _, err := s.moveTo(ctx, id, models.BookingCompleted)
+	if err != nil {
+		return nil, err
+	}
+	userID := b.UserID
+	if userID == nil {
+		return b, nil
+	}
+	lines, err := bookedItems(ctx, s.repos.Drinks, b.Items)
+	if err == nil {
+		err = s.loyalty.Earn(ctx, *userID, b, lines)
+	}
+	if err != nil {
+		// the status has changed; completing again retries
+		slog.ErrorContext(ctx, "loyalty earn failed", "booking", b.ID.Hex(), "user", userID.Hex(), "error", err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// Cancel marks a pending booking cancelled, gives back its promotion uses and voucher and
+// refunds what it redeemed or paid with a gift card. A deposit is refunded when the
+// booking is cancelled early enough, see Payments.Settle. Cancelling a cancelled booking
+// retries the refunds, which each happen once; the promotion uses were given back the
+// first time.
+func (s *Bookings) Cancel(ctx context.Context, id primitive.ObjectID) (*models.Booking, error) {
+	b, moved, err := s.moveTo(ctx, id, models.BookingCancelled)
+	if err != nil {
+		return nil, err
+	}
+	if moved {
+		s.promotions.Release(ctx, b)
+	}
+	if err := s.loyalty.Refund(ctx, b); err != nil {
+		slog.ErrorContext(ctx, "loyalty refund failed", "booking", b.ID.Hex(), "error", err)
+		return nil, err
+	}
+	if err := s.giftCards.Refund(ctx, b); err != nil {
+		slog.ErrorContext(ctx, "gift card refund failed", "booking", b.ID.Hex(), "error", err)
+		return nil, err
+	}
+	if b.Deposit != nil {
+		status, err := s.payments.Settle(ctx, b)
+		if err == nil {
+			err = s.repos.Bookings.SetDepositStatus(ctx, b.ID, status)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "deposit refund failed", "booking", b.ID.Hex(), "payment", b.Deposit.PaymentID.Hex(), "error", err)
+			return nil, err
+		}
+		b.Deposit.Status = status
+	}
+	return b, nil
+}
+
+// ConfirmDeposit applies a payment provider callback to the booking it pays for and
+// returns the booking. A failed payment cancels the booking. The error is what the
+// provider should be told; a repeated callback returns the booking with
+// payments.ErrAlreadyConfirmed.
+func (s *Bookings) ConfirmDeposit(ctx context.Context, provider string, query url.Values) (*models.Booking, error) {
+	p, confirmErr := s.payments.Confirm(ctx, provider, query)
+	if p == nil {
+		return nil, confirmErr
+	}
+	if confirmErr == nil {
+		var err error
+		if p.Status == models.PaymentFailed {
+			_, err = s.Cancel(ctx, p.BookingID)
+			if errors.Is(err, errNotPending) {
+				err = s.repos.Bookings.SetDepositStatus(ctx, p.BookingID, p.Status)
+			}
+		} else {
+			err = s.repos.Bookings.SetDepositStatus(ctx, p.BookingID, p.Status)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "deposit update failed", "booking", p.BookingID.Hex(), "payment", p.ID.Hex(), "status", p.Status, "error", err)
+			return nil, err
+		}
+	}
+	b, err := s.repos.Bookings.Get(ctx, p.BookingID)
+	if err != nil {
+		return nil, err
+	}
+	return b, confirmErr
+}
+
+// ExpireDeposits cancels the bookings whose deposit was not paid in time. It runs
+// periodically.
+func (s *Bookings) ExpireDeposits(ctx context.Context) error {
+	expired, err := s.payments.Expired(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range expired {
+		current, err := s.payments.Abandon(ctx, p.ID, true)
+		if err != nil {
+			return err
+		}
+		if current.Status != models.PaymentExpired {
+			continue // paid at the last moment
+		}
+		_, err = s.Cancel(ctx, p.BookingID)
+		if errors.Is(err, errNotPending) {
+			err = s.repos.Bookings.SetDepositStatus(ctx, p.BookingID, current.Status)
+		}
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "booking cancelled, deposit not paid", "booking", p.BookingID.Hex(), "payment", p.ID.Hex())
+	}
+	return nil
+}
+
+// giveBack undoes what Place claimed for a booking that was not stored.
+func (s *Bookings) giveBack(ctx context.Context, b *models.Booking) {
+	s.promotions.Release(ctx, b)
+	if err := s.loyalty.Refund(ctx, b); err != nil {
+		slog.ErrorContext(ctx, "loyalty refund failed", "booking", b.ID.Hex(), "error", err)
+	}
+	if err := s.giftCards.Refund(ctx, b); err != nil {
+		slog.ErrorContext(ctx, "gift card refund failed", "booking", b.ID.Hex(), "error", err)
+	}
+}
+
+// moveTo sets a pending booking's status to to. A booking already there is returned
+// too, with moved false, so that what follows the status change can be retried.
+func (s *Bookings) moveTo(ctx context.Context, id primitive.ObjectID, to string) (b *models.Booking, moved bool, err error) {
+	b, err = s.setStatus(ctx, id, to)
+	if !errors.Is(err, errNotPending) {
+		return b, err == nil, err
+	}
+	current, getErr := s.repos.Bookings.Get(ctx, id)
+	if getErr != nil {
+		return nil, false, getErr
+	}
+	if current.Status != to {
+		return nil, false, err
+	}
+	return current, false, nil
+}
+
+func (s *Bookings) setStatus(ctx context.Context, id primitive.ObjectID, to string) (*models.Booking, error) {
+	b, err := s.repos.Bookings.SetStatus(ctx, id, []string{"", models.BookingPending}, to, time.Now())
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return nil, apperr.New(apperr.NotFound, "booking not found")
+	case errors.Is(err, repository.ErrConflict):
+		return nil, errNotPending
+	}
+	return b, err
+}
+
+// BelongsTo reports whether b was made while logged in as userID. A matching email is
+// not enough, even for a verified account: verification is not mailed yet, so anyone
+// can verify an address they do not own.
+func (s *Bookings) BelongsTo(b *models.Booking, userID primitive.ObjectID) bool {
+	return b.UserID != nil && *b.UserID == userID
+}
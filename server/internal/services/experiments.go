@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Experiment splits recommendation traffic between scorer configurations. Experiments
+// are defined directly in Mongo's experiments collection:
+//
+//	{ key: "scorer-2025-06", active: true, createdAt: ISODate(...),
+//	  arms: [ { name: "label",  weight: 50, scorer: { name: "label",  scorer: "emotion" } },
+//	          { name: "cosine", weight: 50, scorer: { name: "cosine", scorer: "cosine" } } ] }
+type Experiment = models.Experiment
+
+// ExperimentArm is one variant; Weight is its relative share of traffic.
+type ExperimentArm = models.ExperimentArm
+
+// Exposure tells the client (and the event log) which arm served a recommendation.
+type Exposure = models.Exposure
+
+var ErrExperimentNotFound = apperr.New(apperr.NotFound, "experiment not found")
+
+// z-score for 95% confidence intervals
+const z95 = 1.96
+
+func validateExperiment(e Experiment) error {
+	if e.Key == "" {
+		return errors.New("experiment key is required")
+	}
+	if len(e.Arms) == 0 {
+		return fmt.Errorf("experiment %q has no arms", e.Key)
+	}
+	for _, a := range e.Arms {
+		if a.Name == "" || a.Weight <= 0 {
+			return fmt.Errorf("experiment %q: every arm needs a name and a positive weight", e.Key)
+		}
+		if err := ScorerConfig(a.Scorer).Validate(); err != nil {
+			return fmt.Errorf("experiment %q arm %q: %w", e.Key, a.Name, err)
+		}
+	}
+	return nil
+}
+
+// assignArm deterministically maps a unit (user or session) to an arm: the same unit
+// always lands in the same arm for a given experiment key and arm weights.
+func assignArm(e Experiment, unit string) ExperimentArm {
+	total := 0
+	for _, a := range e.Arms {
+		total += a.Weight
+	}
+	sum := sha256.Sum256([]byte(e.Key + ":" + unit))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, a := range e.Arms {
+		if bucket < a.Weight {
+			return a
+		}
+		bucket -= a.Weight
+	}
+	return e.Arms[len(e.Arms)-1]
+}
+
+// ExperimentUnit picks the bucketing unit: the logged-in user, else the session ID. The
+// email in a request is not used, since anyone can send any email and choose their arm.
+func ExperimentUnit(userID *primitive.ObjectID, sessionID string) string {
+	if userID != nil {
+		return "user:" + userID.Hex()
+	}
+	if sessionID = strings.TrimSpace(sessionID); sessionID != "" {
+		return "session:" + sessionID
+	}
+	return ""
+}
+
+// ActiveExperiment returns the most recently created active experiment, or nil if none.
+func ActiveExperiment(ctx context.Context, experiments repository.ExperimentRepository) (*Experiment, error) {
+	exp, err := experiments.Active(ctx)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return exp, err
+}
+
+// AssignScorer returns the scorer configuration for unit under the active experiment,
+// with the exposure to report. Anonymous units, missing or broken experiments fall back
+// to fallback with no exposure; experiment problems never fail a recommendation.
+func AssignScorer(ctx context.Context, experiments repository.ExperimentRepository, unit string, fallback ScorerConfig) (ScorerConfig, *Exposure) {
+	if unit == "" {
+		return fallback, nil
+	}
+	exp, err := ActiveExperiment(ctx, experiments)
+	if err != nil {
+		slog.ErrorContext(ctx, "experiments: lookup failed", "error", err)
+		return fallback, nil
+	}
+	if exp == nil {
+		return fallback, nil
+	}
+	if err := validateExperiment(*exp); err != nil {
+		slog.WarnContext(ctx, "experiments: ignoring invalid experiment", "key", exp.Key, "error", err)
+		return fallback, nil
+	}
+	arm := assignArm(*exp, unit)
+	return ScorerConfig(arm.Scorer), &Exposure{Key: exp.Key, Arm: arm.Name}
+}
+
+// ArmReport is conversion-to-booking for one arm. Rates carry 95% Wilson score
+// intervals; Lift is the difference to the first (control) arm with a 95% normal interval.
+type ArmReport struct {
+	Arm       string      `json:"arm"`
+	Exposed   int         `json:"exposed"`
+	Converted int         `json:"converted"`
+	Rate      float64     `json:"rate"`
+	RateCI    [2]float64  `json:"rateCi"`
+	Lift      *float64    `json:"lift,omitempty"`
+	LiftCI    *[2]float64 `json:"liftCi,omitempty"`
+}
+
+type ExperimentReport struct {
+	Key  string      `json:"key"`
+	Arms []ArmReport `json:"arms"`
+}
+
+// BuildExperimentReport counts, per arm, the distinct units (users or sessions) exposed to the experiment and
+// how many of them created a booking after their first exposure.
+func BuildExperimentReport(ctx context.Context, repos repository.Repositories, key string) (*ExperimentReport, error) {
+	exp, err := repos.Experiments.Get(ctx, key)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrExperimentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	events, err := repos.RecoEvents.ByExperiment(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// unit -> arm and first exposure time
+	type exposure struct {
+		arm   string
+		first time.Time
+	}
+	units := make(map[string]exposure)
+	var users []primitive.ObjectID
+	var sessions []string
+	for _, ev := range events {
+		unit := ExperimentUnit(ev.UserID, ev.SessionID)
+		if unit == "" || ev.Exposure == nil {
+			continue
+		}
+		if prev, ok := units[unit]; ok && !ev.Time.Before(prev.first) {
+			continue
+		}
+		if _, ok := units[unit]; !ok {
+			if ev.UserID != nil {
+				users = append(users, *ev.UserID)
+			} else {
+				sessions = append(sessions, strings.TrimSpace(ev.SessionID))
+			}
+		}
+		units[unit] = exposure{arm: ev.Exposure.Arm, first: ev.Time}
+	}
+
+	converted := make(map[string]bool)
+	if len(units) > 0 {
+		bookings, err := repos.Bookings.FindByCustomers(ctx, users, sessions)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bookings {
+			at := b.CreatedAt
+			if at.IsZero() {
+				at = b.Time
+			}
+			for _, unit := range []string{ExperimentUnit(b.UserID, ""), ExperimentUnit(nil, b.SessionID)} {
+				if e, ok := units[unit]; ok && unit != "" && !at.Before(e.first) {
+					converted[unit] = true
+				}
+			}
+		}
+	}
+
+	report := &ExperimentReport{Key: exp.Key}
+	index := make(map[string]int, len(exp.Arms))
+	for i, a := range exp.Arms {
+		index[a.Name] = i
+		report.Arms = append(report.Arms, ArmReport{Arm: a.Name})
+	}
+	for unit, e := range units {
+		i, ok := index[e.arm]
+		if !ok {
+			// arm removed since exposure
+			index[e.arm] = len(report.Arms)
+			report.Arms = append(report.Arms, ArmReport{Arm: e.arm})
+			i = index[e.arm]
+		}
+		report.Arms[i].Exposed++
+		if converted[unit] {
+			report.Arms[i].Converted++
+		}
+	}
+	sort.SliceStable(report.Arms[len(exp.Arms):], func(i, j int) bool {
+		return report.Arms[len(exp.Arms)+i].Arm < report.Arms[len(exp.Arms)+j].Arm
+	})
+
+	for i := range report.Arms {
+		a := &report.Arms[i]
+		if a.Exposed > 0 {
+			a.Rate = float64(a.Converted) / float64(a.Exposed)
+		}
+		a.RateCI = wilsonInterval(a.Converted, a.Exposed)
+	}
+	if len(report.Arms) > 0 && report.Arms[0].Exposed > 0 {
+		control := report.Arms[0]
+		for i := 1; i < len(report.Arms); i++ {
+			a := &report.Arms[i]
+			if a.Exposed == 0 {
+				continue
+			}
+			lift := a.Rate - control.Rate
+			se := math.Sqrt(control.Rate*(1-control.Rate)/float64(control.Exposed) + a.Rate*(1-a.Rate)/float64(a.Exposed))
+			a.Lift = &lift
+			a.LiftCI = &[2]float64{lift - z95*se, lift + z95*se}
+		}
+	}
+	return report, nil
+}
+
+// wilsonInterval is the 95% Wilson score interval for k successes out of n.
+func wilsonInterval(k, n int) [2]float64 {
+	if n == 0 {
+		return [2]float64{0, 0}
+	}
+	p := float64(k) / float64(n)
+	nf := float64(n)
+	denom := 1 + z95*z95/nf
+	center := (p + z95*z95/(2*nf)) / denom
+	margin := z95 * math.Sqrt(p*(1-p)/nf+z95*z95/(4*nf*nf)) / denom
+	return [2]float64{math.Max(0, center-margin), math.Min(1, center+margin)}
+}
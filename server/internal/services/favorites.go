@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Limits on what a user keeps.
+const (
+	MaxFavorites       = 100
+	MaxSavedOrders     = 20
+	MaxSavedOrderItems = 30
+	MaxSavedOrderName  = 60
+)
+
+var errSavedOrderNotFound = apperr.New(apperr.NotFound, "saved order not found")
+
+// Favorites keeps users' favorite drinks and saved orders, and turns past orders into
+// drafts of new bookings.
+type Favorites struct {
+	repos    repository.Repositories
+	bookings *Bookings
+	cafe     *Cafe
+}
+
+func NewFavorites(repos repository.Repositories, bookings *Bookings, cafe *Cafe) *Favorites {
+	return &Favorites{repos: repos, bookings: bookings, cafe: cafe}
+}
+
+func (s *Favorites) user(ctx context.Context, userID primitive.ObjectID) (*models.User, error) {
+	u, err := s.repos.Users.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, apperr.New(apperr.Unauthenticated, "log in to continue")
+	}
+	return u, err
+}
+
+// List returns the user's favorite drinks in the order they were added. Drinks taken
+// off the menu stay, marked archived, until the user removes them.
+func (s *Favorites) List(ctx context.Context, userID primitive.ObjectID) ([]models.Drink, error) {
+	u, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Favorites) == 0 {
+		return []models.Drink{}, nil
+	}
+	all, err := s.repos.Drinks.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]models.Drink, len(all))
+	for _, d := range all {
+		byID[d.ID] = d
+	}
+	out := make([]models.Drink, 0, len(u.Favorites))
+	for _, id := range u.Favorites {
+		if d, ok := byID[id]; ok {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// Add makes a drink on the menu one of the user's favorites; adding it again is a no-op.
+func (s *Favorites) Add(ctx context.Context, userID, drinkID primitive.ObjectID) ([]models.Drink, error) {
+	d, err := s.repos.Drinks.Get(ctx, drinkID)
+	if errors.Is(err, repository.ErrNotFound) || err == nil && d.Archived {
+		return nil, errDrinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = s.repos.Users.AddFavorite(ctx, userID, drinkID, MaxFavorites)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, apperr.New(apperr.FailedPrecondition, fmt.Sprintf("you can keep up to %d favorites", MaxFavorites))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.List(ctx, userID)
+}
+
+// Remove drops a drink from the user's favorites.
+func (s *Favorites) Remove(ctx context.Context, userID, drinkID primitive.ObjectID) ([]models.Drink, error) {
+	if err := s.repos.Users.RemoveFavorite(ctx, userID, drinkID); err != nil {
+		return nil, err
+	}
+	return s.List(ctx, userID)
+}
+
+// SavedOrders returns the user's saved orders, oldest first.
+func (s *Favorites) SavedOrders(ctx context.Context, userID primitive.ObjectID) ([]models.SavedOrder, error) {
+	u, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.SavedOrders == nil {
+		return []models.SavedOrder{}, nil
+	}
+	return u.SavedOrders, nil
+}
+
+// SaveOrder stores a named order for the user, or updates the one with o.ID. Every item
+// must be on the menu; names and prices are recorded as they are now.
+func (s *Favorites) SaveOrder(ctx context.Context, userID primitive.ObjectID, o models.SavedOrder) (*models.SavedOrder, error) {
+	o.Name = strings.TrimSpace(o.Name)
+	switch {
+	case o.Name == "":
+		return nil, apperr.Invalid("name", "is required")
+	case utf8.RuneCountInString(o.Name) > MaxSavedOrderName:
+		return nil, apperr.Invalid("name", fmt.Sprintf("must be at most %d characters", MaxSavedOrderName))
+	case len(o.Items) == 0:
+		return nil, apperr.Invalid("items", "must list at least one drink")
+	case len(o.Items) > MaxSavedOrderItems:
+		return nil, apperr.Invalid("items", fmt.Sprintf("must list at most %d drinks", MaxSavedOrderItems))
+	}
+	lines, _, err := PriceItems(ctx, s.repos.Drinks, o.Items)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range lines {
+		o.Items[i].Name, o.Items[i].Price = line.Drink.Name, line.Drink.Price
+	}
+	o.CreatedAt, o.UpdatedAt = time.Now(), time.Now()
+	err = s.repos.Users.SaveOrder(ctx, userID, &o, MaxSavedOrders)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		return nil, apperr.Invalid("name", "is already used by another saved order")
+	case errors.Is(err, repository.ErrNotFound):
+		return nil, errSavedOrderNotFound
+	case errors.Is(err, repository.ErrConflict):
+		return nil, apperr.New(apperr.FailedPrecondition, fmt.Sprintf("you can keep up to %d saved orders", MaxSavedOrders))
+	case err != nil:
+		return nil, err
+	}
+	return &o, nil
+}
+
+// DeleteOrder removes one of the user's saved orders.
+func (s *Favorites) DeleteOrder(ctx context.Context, userID, orderID primitive.ObjectID) error {
+	err := s.repos.Users.DeleteOrder(ctx, userID, orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return errSavedOrderNotFound
+	}
+	return err
+}
+
+// ReorderRequest names the booking or the saved order to order again, and when.
+type ReorderRequest struct {
+	BookingID    string `json:"bookingId"`
+	SavedOrderID string `json:"savedOrderId"`
+	// Time is the RFC 3339 arrival time, which decides the day or night menu; default now.
+	Time string `json:"time"`
+}
+
+// Draft is a new booking's items built from an earlier order, checked against the menu
+// as it is now. Items is ready to send as a booking's items.
+type Draft struct {
+	Items    []models.BookingItem `json:"items"`
+	Subtotal int                  `json:"subtotal"`
+	// Changed lists the items whose price moved since they were ordered.
+	Changed []PriceChange `json:"changed"`
+	// Dropped lists the items that cannot be ordered at that time.
+	Dropped []DroppedItem `json:"dropped"`
+}
+
+type PriceChange struct {
+	DrinkID primitive.ObjectID `json:"drinkId"`
+	Name    string             `json:"name"`
+	Was     int                `json:"was"`
+	Now     int                `json:"now"`
+}
+
+type DroppedItem struct {
+	DrinkID primitive.ObjectID `json:"drinkId"`
+	Name    string             `json:"name"`
+	Qty     int                `json:"qty"`
+	Reason  string             `json:"reason"`
+}
+
+// Reorder drafts a new booking from one of the user's bookings or saved orders. Drinks
+// taken off the menu or not served at the requested time are dropped, and the rest are
+// priced as they are now. Nothing is stored; the draft is placed like any booking.
+func (s *Favorites) Reorder(ctx context.Context, userID primitive.ObjectID, req ReorderRequest) (*Draft, error) {
+	at := time.Now()
+	if req.Time != "" {
+		t, err := time.Parse(time.RFC3339, req.Time)
+		if err != nil {
+			return nil, apperr.Invalid("time", "must be an RFC 3339 timestamp")
+		}
+		at = t
+	}
+	items, err := s.reorderItems(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	timeOfDay := s.cafe.TimeOfDayAt(at)
+	draft := &Draft{Items: []models.BookingItem{}, Changed: []PriceChange{}, Dropped: []DroppedItem{}}
+	for _, it := range items {
+		d, err := s.repos.Drinks.Get(ctx, it.DrinkID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		name := it.Name
+		if d != nil {
+			name = d.Name
+		}
+		switch {
+		case d == nil || d.Archived:
+			draft.Dropped = append(draft.Dropped, DroppedItem{DrinkID: it.DrinkID, Name: name, Qty: it.Qty, Reason: "no longer on the menu"})
+			continue
+		case !AvailableAt(*d, timeOfDay):
+			draft.Dropped = append(draft.Dropped, DroppedItem{DrinkID: it.DrinkID, Name: name, Qty: it.Qty, Reason: "not served at " + timeOfDay})
+			continue
+		}
+		if it.Price != 0 && it.Price != d.Price {
+			draft.Changed = append(draft.Changed, PriceChange{DrinkID: d.ID, Name: d.Name, Was: it.Price, Now: d.Price})
+		}
+		draft.Items = append(draft.Items, models.BookingItem{DrinkID: d.ID, Qty: it.Qty, Options: it.Options, Name: d.Name, Price: d.Price})
+		draft.Subtotal += d.Price * it.Qty
+	}
+	return draft, nil
+}
+
+// reorderItems returns the items of the booking or saved order req names, which must
+// be the user's.
+func (s *Favorites) reorderItems(ctx context.Context, userID primitive.ObjectID, req ReorderRequest) ([]models.BookingItem, error) {
+	switch {
+	case (req.BookingID == "") == (req.SavedOrderID == ""):
+		return nil, apperr.New(apperr.InvalidArgument, "give either bookingId or savedOrderId")
+	case req.BookingID != "":
+		id, err := primitive.ObjectIDFromHex(req.BookingID)
+		if err != nil {
+			return nil, apperr.Invalid("bookingId", "is not a valid booking ID")
+		}
+		b, err := s.repos.Bookings.Get(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperr.New(apperr.NotFound, "booking not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !s.bookings.BelongsTo(b, userID) {
+			return nil, apperr.New(apperr.NotFound, "booking not found")
+		}
+		return b.Items, nil
+	default:
+		id, err := primitive.ObjectIDFromHex(req.SavedOrderID)
+		if err != nil {
+			return nil, apperr.Invalid("savedOrderId", "is not a valid saved order ID")
+		}
+		orders, err := s.SavedOrders(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range orders {
+			if o.ID == id {
+				return o.Items, nil
+			}
+		}
+		return nil, errSavedOrderNotFound
+	}
+}
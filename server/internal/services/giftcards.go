@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Limits on one issue request. Cards without an expiry are valid for GiftCardValidity.
+const (
+	MaxGiftCards     = 100
+	MaxGiftCardValue = 20_000_000
+	GiftCardValidity = 365 * 24 * time.Hour
+)
+
+var (
+	errGiftCardInvalid  = apperr.Invalid("giftCard.code", "is not a valid gift card")
+	errGiftCardNotFound = apperr.New(apperr.NotFound, "gift card not found")
+	errGiftCardUnusable = apperr.New(apperr.FailedPrecondition, "this gift card has been voided or has expired")
+	errGiftCardEmpty    = apperr.New(apperr.InsufficientBalance, "the gift card balance is too low")
+)
+
+// GiftCards issues gift cards and spends them on bookings.
+type GiftCards struct {
+	repo repository.GiftCardRepository
+}
+
+func NewGiftCards(repo repository.GiftCardRepository) *GiftCards {
+	return &GiftCards{repo: repo}
+}
+
+// IssueRequest describes the cards to issue. Count defaults to 1.
+type IssueRequest struct {
+	Value     int        `json:"value"`
+	Count     int        `json:"count"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Note      string     `json:"note"`
+}
+
+// Issue creates req.Count cards worth req.Value VND each.
+func (s *GiftCards) Issue(ctx context.Context, req IssueRequest) ([]models.GiftCard, error) {
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 1 || req.Count > MaxGiftCards {
+		return nil, apperr.Invalid("count", fmt.Sprintf("must be between 1 and %d", MaxGiftCards))
+	}
+	if req.Value < 1 || req.Value > MaxGiftCardValue {
+		return nil, apperr.Invalid("value", fmt.Sprintf("must be between 1 and %d VND", MaxGiftCardValue))
+	}
+	now := time.Now()
+	expires := now.Add(GiftCardValidity)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) {
+			return nil, apperr.Invalid("expiresAt", "must be in the future")
+		}
+		expires = *req.ExpiresAt
+	}
+	cards := make([]models.GiftCard, req.Count)
+	for i := range cards {
+		cards[i] = models.GiftCard{
+			ID:        primitive.NewObjectID(),
+			Code:      giftCardCode(),
+			Value:     req.Value,
+			Balance:   req.Value,
+			Status:    models.GiftCardActive,
+			ExpiresAt: &expires,
+			Note:      strings.TrimSpace(req.Note),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+	if err := s.repo.Insert(ctx, cards); err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// Void writes off the card's balance; it cannot be spent afterwards.
+func (s *GiftCards) Void(ctx context.Context, id primitive.ObjectID) (*models.GiftCard, error) {
+	card, err := s.repo.Void(ctx, id, time.Now())
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return nil, errGiftCardNotFound
+	case errors.Is(err, repository.ErrConflict):
+		return nil, apperr.New(apperr.FailedPrecondition, "the gift card is already voided")
+	}
+	return card, err
+}
+
+// Balance looks a card up by code for its holder.
+func (s *GiftCards) Balance(ctx context.Context, code string) (*models.GiftCard, error) {
+	card, err := s.repo.FindByCode(ctx, NormalizeGiftCard(code))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errGiftCardInvalid
+	}
+	return card, err
+}
+
+// GiftCardRequest asks to pay part of a booking with a gift card. Amount 0 pays as much
+// as the card and the booking allow.
+type GiftCardRequest struct {
+	Code   string `json:"code"`
+	Amount int    `json:"amount"`
+}
+
+func (r *GiftCardRequest) empty() bool {
+	return r == nil || strings.TrimSpace(r.Code) == ""
+}
+
+// NormalizeGiftCard upper-cases a code and drops the spaces and dashes it is printed with.
+func NormalizeGiftCard(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// Charge debits the card for part of b.Total. The balance is read first to size the
+// charge, so when another booking spends the card in between, the charge is sized again.
+func (s *GiftCards) Charge(ctx context.Context, b *models.Booking, req GiftCardRequest) (*models.GiftCardPayment, error) {
+	code := NormalizeGiftCard(req.Code)
+	if req.Amount < 0 {
+		return nil, apperr.Invalid("giftCard.amount", "must not be negative")
+	}
+	if req.Amount > b.Total {
+		return nil, apperr.Invalid("giftCard.amount", "is more than the booking total")
+	}
+	for {
+		card, err := s.repo.FindByCode(ctx, code)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errGiftCardInvalid
+		}
+		if err != nil {
+			return nil, err
+		}
+		if card.Status != models.GiftCardActive || card.Expired(time.Now()) {
+			return nil, errGiftCardUnusable
+		}
+		amount := req.Amount
+		if amount == 0 {
+			amount = min(card.Balance, b.Total)
+		}
+		if amount == 0 {
+			if b.Total == 0 {
+				return nil, nil
+			}
+			return nil, errGiftCardEmpty
+		}
+		entry := models.GiftCardEntry{CardID: card.ID, Kind: models.GiftCardRedeem, Amount: -amount, BookingID: &b.ID}
+		_, err = s.repo.Apply(ctx, &entry)
+		switch {
+		case errors.Is(err, repository.ErrInsufficient) && req.Amount == 0:
+			continue
+		case errors.Is(err, repository.ErrInsufficient):
+			return nil, errGiftCardEmpty
+		case errors.Is(err, repository.ErrConflict):
+			return nil, errGiftCardUnusable
+		case err != nil:
+			return nil, err
+		}
+		return &models.GiftCardPayment{CardID: card.ID, Code: MaskGiftCard(code), Amount: amount}, nil
+	}
+}
+
+// Refund gives back what b paid with a gift card, even if the card has since expired,
+// once. A voided card gets nothing back, as its balance was written off; staff settle
+// that refund by hand.
+func (s *GiftCards) Refund(ctx context.Context, b *models.Booking) error {
+	if b.GiftCardPayment == nil {
+		return nil
+	}
+	entry := models.GiftCardEntry{CardID: b.GiftCardPayment.CardID, Kind: models.GiftCardRefund, Amount: b.GiftCardPayment.Amount, BookingID: &b.ID}
+	_, err := s.repo.Apply(ctx, &entry)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		return nil // refunded already
+	case errors.Is(err, repository.ErrConflict):
+		slog.WarnContext(ctx, "gift card voided, refund it by hand", "booking", b.ID.Hex(), "card", entry.CardID.Hex(), "amount", entry.Amount)
+		return nil
+	}
+	return err
+}
+
+// MaskGiftCard keeps the last four characters of a code, for receipts and bookings.
+func MaskGiftCard(code string) string {
+	if len(code) <= 4 {
+		return code
+	}
+	return "****" + code[len(code)-4:]
+}
+
+// giftCardCode is 16 characters from voucherAlphabet, about 79 random bits, so codes
+// cannot be guessed.
+func giftCardCode() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = voucherAlphabet[int(b[i])%len(voucherAlphabet)]
+	}
+	return string(b)
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/invoices"
+	"leblanc/server/internal/mailer"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+)
+
+// taxCode is a Vietnamese enterprise tax code, with the branch suffix if any.
+var taxCode = regexp.MustCompile(`^\d{10}(-\d{3})?$`)
+
+// Invoices issues receipts and VAT invoices for completed bookings and emails them.
+type Invoices struct {
+	repos    repository.Repositories
+	cfg      config.InvoiceConfig
+	mailer   mailer.Mailer
+	location *time.Location
+}
+
+// NewInvoices returns the service; m may be nil when mail is off. Invoices show times
+// in loc, the café's timezone.
+func NewInvoices(repos repository.Repositories, cfg config.InvoiceConfig, m mailer.Mailer, loc *time.Location) *Invoices {
+	return &Invoices{repos: repos, cfg: cfg, mailer: m, location: loc}
+}
+
+// InvoiceRequest asks for a receipt (the default) or a VAT invoice for Company.
+type InvoiceRequest struct {
+	Kind    string          `json:"kind"`
+	Company *models.Company `json:"company"`
+}
+
+// Issue returns b's invoice of the requested kind, issuing it on first request. Asking
+// again returns the same invoice, whatever the company details.
+func (s *Invoices) Issue(ctx context.Context, b *models.Booking, req InvoiceRequest) (*models.Invoice, error) {
+	if req.Kind == "" {
+		req.Kind = models.InvoiceReceipt
+	}
+	switch req.Kind {
+	case models.InvoiceReceipt:
+		if req.Company != nil {
+			return nil, apperr.Invalid("company", "is only for VAT invoices")
+		}
+	case models.InvoiceVAT:
+		if err := validCompany(req.Company); err != nil {
+			return nil, err
+		}
+		if s.cfg.SellerTaxCode == "" {
+			return nil, apperr.New(apperr.FailedPrecondition, "VAT invoices are not available, the café's tax code is not set up")
+		}
+	default:
+		return nil, apperr.Invalid("kind", "must be receipt or vat")
+	}
+	if b.Status != models.BookingCompleted {
+		return nil, apperr.New(apperr.FailedPrecondition, "receipts are issued once the booking is completed")
+	}
+
+	existing, err := s.repos.Invoices.FindByBooking(ctx, b.ID, req.Kind)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	inv, err := s.build(ctx, b, req)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repos.Invoices.Insert(ctx, inv)
+	if errors.Is(err, repository.ErrDuplicate) {
+		// issued by a concurrent request
+		return s.repos.Invoices.FindByBooking(ctx, b.ID, req.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func validCompany(c *models.Company) error {
+	if c == nil {
+		return apperr.Invalid("company", "is required for a VAT invoice")
+	}
+	c.Name, c.TaxCode = strings.TrimSpace(c.Name), strings.TrimSpace(c.TaxCode)
+	c.Address, c.Email = strings.TrimSpace(c.Address), strings.TrimSpace(c.Email)
+	switch {
+	case c.Name == "":
+		return apperr.Invalid("company.name", "is required")
+	case !taxCode.MatchString(c.TaxCode):
+		return apperr.Invalid("company.taxCode", "must be 10 digits, or 13 written 0123456789-001")
+	case c.Address == "":
+		return apperr.Invalid("company.address", "is required")
+	}
+	if c.Email != "" {
+		if _, err := mail.ParseAddress(c.Email); err != nil {
+			return apperr.Invalid("company.email", "is not a valid email address")
+		}
+	}
+	return nil
+}
+
+// build copies everything printed on the invoice from b. Bookings made before item
+// names and prices were recorded take them from the menu as it is now.
+func (s *Invoices) build(ctx context.Context, b *models.Booking, req InvoiceRequest) (*models.Invoice, error) {
+	inv := &models.Invoice{
+		BookingID:  b.ID,
+		Kind:       req.Kind,
+		Branch:     s.cfg.Branch,
+		Seller:     models.InvoiceSeller{Name: s.cfg.SellerName, TaxCode: s.cfg.SellerTaxCode, Address: s.cfg.SellerAddress},
+		Customer:   models.InvoiceParty{Name: b.Name, Email: b.Email, Phone: b.Phone},
+		Company:    req.Company,
+		Lines:      make([]models.InvoiceLine, 0, len(b.Items)),
+		Subtotal:   b.Subtotal,
+		Discount:   b.Discount,
+		Total:      b.Total,
+		VATPercent: s.cfg.VATPercent,
+		VisitAt:    b.Time,
+		IssuedAt:   time.Now(),
+	}
+	sum := 0
+	for _, it := range b.Items {
+		line := models.InvoiceLine{DrinkID: it.DrinkID, Name: it.Name, Options: optionLabels(it.Options), Qty: it.Qty, UnitPrice: it.Price}
+		if line.Name == "" {
+			d, err := s.repos.Drinks.Get(ctx, it.DrinkID)
+			switch {
+			case errors.Is(err, repository.ErrNotFound):
+				line.Name = "(" + it.DrinkID.Hex() + ")"
+			case err != nil:
+				return nil, err
+			default:
+				line.Name, line.UnitPrice = d.Name, d.Price
+			}
+		}
+		line.Amount = line.UnitPrice * line.Qty
+		sum += line.Amount
+		inv.Lines = append(inv.Lines, line)
+	}
+	if inv.Subtotal == 0 {
+		// booked before bookings were priced
+		inv.Subtotal, inv.Total = sum, sum-inv.Discount
+	}
+
+	for _, p := range b.Promotions {
+		label := p.Name
+		if p.Voucher != "" {
+			label += " (" + p.Voucher + ")"
+		}
+		inv.Adjustments = append(inv.Adjustments, models.InvoiceAdjustment{Label: label, Amount: -p.Amount})
+	}
+	if r := b.Redemption; r != nil {
+		label := fmt.Sprintf("Điểm thưởng / Loyalty points (%d)", r.Points)
+		if r.Reward != "" {
+			label = "Ly miễn phí / Free drink (" + r.Reward + ")"
+		}
+		inv.Adjustments = append(inv.Adjustments, models.InvoiceAdjustment{Label: label, Amount: -r.Value})
+	}
+	// menu prices include VAT
+	inv.VAT = (inv.Total*inv.VATPercent + (100+inv.VATPercent)/2) / (100 + inv.VATPercent)
+
+	inv.AmountDue = inv.Total
+	if g := b.GiftCardPayment; g != nil {
+		inv.Payments = append(inv.Payments, models.InvoiceAdjustment{Label: "Thẻ quà tặng / Gift card " + g.Code, Amount: -g.Amount})
+		inv.AmountDue -= g.Amount
+	}
+	if d := b.Deposit; d != nil && d.Status == models.PaymentPaid {
+		inv.Payments = append(inv.Payments, models.InvoiceAdjustment{Label: "Đặt cọc / Deposit", Amount: -d.Amount})
+		inv.AmountDue -= d.Amount
+	}
+	inv.AmountDue = max(inv.AmountDue, 0)
+	return inv, nil
+}
+
+// optionLabels lists the options that were chosen as "key: value", sorted.
+func optionLabels(opts map[string]any) []string {
+	var out []string
+	for k, v := range opts {
+		if v == nil || v == "" || v == false {
+			continue
+		}
+		out = append(out, fmt.Sprintf("%s: %v", k, v))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Email sends inv as text with the PDF attached, to to or else to the company or the
+// guest, and returns the address used.
+func (s *Invoices) Email(ctx context.Context, inv *models.Invoice, to string) (string, error) {
+	if s.mailer == nil {
+		return "", apperr.New(apperr.Unavailable, "email is not set up on this server")
+	}
+	if to == "" && inv.Company != nil {
+		to = inv.Company.Email
+	}
+	if to == "" {
+		to = inv.Customer.Email
+	}
+	if _, err := mail.ParseAddress(to); err != nil {
+		return "", apperr.Invalid("to", "is not a valid email address")
+	}
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      to,
+		Subject: fmt.Sprintf("%s - %s %s", inv.Seller.Name, invoices.Title(inv.Kind), inv.Code),
+		Text:    s.Text(inv),
+		Attachments: []mailer.Attachment{
+			{Name: inv.Code + ".pdf", ContentType: "application/pdf", Data: s.PDF(inv)},
+		},
+	})
+	if err != nil {
+		return "", apperr.Wrap(err, apperr.Unavailable, "the invoice could not be emailed, try again later")
+	}
+	return to, nil
+}
+
+// Text renders inv with times in the café's timezone.
+func (s *Invoices) Text(inv *models.Invoice) string { return invoices.Text(inv, s.location) }
+
+// PDF renders inv with times in the café's timezone.
+func (s *Invoices) PDF(inv *models.Invoice) []byte { return invoices.PDF(inv, s.location) }
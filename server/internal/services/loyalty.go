@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errLoyaltyOff = apperr.New(apperr.FailedPrecondition, "the loyalty program is not running")
+
+// Loyalty applies the earn and burn rules of LoyaltyConfig to the ledger.
+type Loyalty struct {
+	repo  repository.LoyaltyRepository
+	rules config.LoyaltyConfig
+}
+
+func NewLoyalty(repo repository.LoyaltyRepository, rules config.LoyaltyConfig) *Loyalty {
+	return &Loyalty{repo: repo, rules: rules}
+}
+
+// MaxItemQty is the most of one drink a booking line may order.
+const MaxItemQty = 50
+
+// PricedItem is a booking line with the drink it was priced from.
+type PricedItem struct {
+	Drink models.Drink
+	Qty   int
+}
+
+// PriceItems looks up the drink of every item and returns the lines with their subtotal
+// in VND. Drinks no longer on the menu cannot be booked.
+func PriceItems(ctx context.Context, drinks repository.DrinkRepository, items []models.BookingItem) ([]PricedItem, int, error) {
+	lines := make([]PricedItem, 0, len(items))
+	subtotal := 0
+	for i, it := range items {
+		if it.Qty <= 0 || it.Qty > MaxItemQty {
+			return nil, 0, apperr.Invalid(fmt.Sprintf("items[%d].qty", i), fmt.Sprintf("must be between 1 and %d", MaxItemQty))
+		}
+		d, err := drinks.Get(ctx, it.DrinkID)
+		if errors.Is(err, repository.ErrNotFound) || err == nil && d.Archived {
+			return nil, 0, apperr.Invalid(fmt.Sprintf("items[%d].drinkId", i), "is not on the menu")
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		lines = append(lines, PricedItem{Drink: *d, Qty: it.Qty})
+		subtotal += d.Price * it.Qty
+	}
+	return lines, subtotal, nil
+}
+
+// bookedItems resolves the drinks of an existing booking for earning. Unlike PriceItems
+// it keeps archived drinks and skips missing ones: the booking was valid when made.
+func bookedItems(ctx context.Context, drinks repository.DrinkRepository, items []models.BookingItem) ([]PricedItem, error) {
+	lines := make([]PricedItem, 0, len(items))
+	for _, it := range items {
+		d, err := drinks.Get(ctx, it.DrinkID)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, PricedItem{Drink: *d, Qty: it.Qty})
+	}
+	return lines, nil
+}
+
+// RedeemRequest asks to pay part of a booking with loyalty: either points or the free
+// drink of a full stamp card.
+type RedeemRequest struct {
+	Points int `json:"points"`
+	// Reward is the stamp card (drink tag) whose free drink to use.
+	Reward string `json:"reward"`
+}
+
+func (r *RedeemRequest) empty() bool { return r == nil || r.Points == 0 && r.Reward == "" }
+
+// Redeem spends the user's points or reward on a booking priced at lines, of which due
+// is left to pay, and returns what was spent. The balance is debited atomically, so two
+// bookings racing for the same points cannot both get them.
+func (l *Loyalty) Redeem(ctx context.Context, userID, bookingID primitive.ObjectID, req RedeemRequest, lines []PricedItem, due int) (*models.Redemption, error) {
+	if !l.rules.Enabled {
+		return nil, errLoyaltyOff
+	}
+	if req.Points != 0 && req.Reward != "" {
+		return nil, apperr.Invalid("redeem", "takes either points or a reward, not both")
+	}
+	entry := models.LoyaltyEntry{UserID: userID, Kind: models.LoyaltyRedeem, BookingID: &bookingID}
+	var r models.Redemption
+	if req.Reward != "" {
+		if _, ok := l.rules.StampCards[req.Reward]; !ok {
+			return nil, apperr.Invalid("redeem.reward", "is not a stamp card")
+		}
+		// the free drink is the cheapest one the card applies to
+		var free *models.Drink
+		for i := range lines {
+			if d := &lines[i].Drink; slices.Contains(d.Tags, req.Reward) && (free == nil || d.Price < free.Price) {
+				free = d
+			}
+		}
+		if free == nil {
+			return nil, apperr.Invalid("redeem.reward", "needs a "+req.Reward+" drink in the booking")
+		}
+		// what promotions already took off is not given twice
+		r = models.Redemption{Reward: req.Reward, Value: min(free.Price, due)}
+		entry.Rewards = map[string]int{req.Reward: -1}
+		entry.Note = "free " + free.Name
+	} else {
+		if req.Points < l.rules.MinRedeem {
+			return nil, apperr.Invalid("redeem.points", fmt.Sprintf("must be at least %d", l.rules.MinRedeem))
+		}
+		value := req.Points * l.rules.PointValueVND
+		if value > due {
+			return nil, apperr.Invalid("redeem.points", fmt.Sprintf("are worth more than the booking; use at most %d", due/l.rules.PointValueVND))
+		}
+		r = models.Redemption{Points: req.Points, Value: value}
+		entry.Points = -req.Points
+	}
+
+	if err := l.repo.Apply(ctx, &entry); err != nil {
+		if errors.Is(err, repository.ErrInsufficient) {
+			if r.Reward != "" {
+				return nil, apperr.New(apperr.InsufficientBalance, "no free "+r.Reward+" drink to redeem")
+			}
+			return nil, apperr.New(apperr.InsufficientBalance, "not enough loyalty points")
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Refund gives back what b redeemed. It does nothing for bookings that redeemed nothing
+// or were refunded already.
+func (l *Loyalty) Refund(ctx context.Context, b *models.Booking) error {
+	if b.Redemption == nil || b.UserID == nil {
+		return nil
+	}
+	entry := models.LoyaltyEntry{UserID: *b.UserID, Kind: models.LoyaltyRefund, BookingID: &b.ID, Points: b.Redemption.Points}
+	if b.Redemption.Reward != "" {
+		entry.Rewards = map[string]int{b.Redemption.Reward: 1}
+	}
+	if err := l.repo.Apply(ctx, &entry); err != nil && !errors.Is(err, repository.ErrDuplicate) {
+		return err
+	}
+	return nil
+}
+
+// Earn credits a completed booking: EarnPoints per EarnPerVND paid and one stamp per
+// drink tagged with a stamp card. Full cards are then turned into free drinks. A booking
+// that was credited already earns nothing more.
+func (l *Loyalty) Earn(ctx context.Context, userID primitive.ObjectID, b *models.Booking, lines []PricedItem) error {
+	if !l.rules.Enabled {
+		return nil
+	}
+	paid := b.Total
+	if b.Subtotal == 0 {
+		// booked before bookings were priced
+		for _, line := range lines {
+			paid += line.Drink.Price * line.Qty
+		}
+	}
+	points := paid / l.rules.EarnPerVND * l.rules.EarnPoints
+
+	stamps := map[string]int{}
+	for _, line := range lines {
+		for tag := range l.rules.StampCards {
+			if slices.Contains(line.Drink.Tags, tag) {
+				stamps[tag] += line.Qty
+			}
+		}
+	}
+	// a free drink earns no stamp
+	if b.Redemption != nil && b.Redemption.Reward != "" {
+		if stamps[b.Redemption.Reward]--; stamps[b.Redemption.Reward] <= 0 {
+			delete(stamps, b.Redemption.Reward)
+		}
+	}
+	if points == 0 && len(stamps) == 0 {
+		return nil
+	}
+	earn := models.LoyaltyEntry{UserID: userID, Kind: models.LoyaltyEarn, BookingID: &b.ID, Points: points, Stamps: stamps}
+	if err := l.repo.Apply(ctx, &earn); errors.Is(err, repository.ErrDuplicate) {
+		return nil // credited already
+	} else if err != nil {
+		return err
+	}
+	if len(stamps) == 0 {
+		return nil
+	}
+
+	acct, err := l.repo.Account(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for tag := range stamps {
+		need := l.rules.StampCards[tag]
+		full := acct.Stamps[tag] / need
+		if full == 0 {
+			continue
+		}
+		reward := models.LoyaltyEntry{
+			UserID:  userID,
+			Kind:    models.LoyaltyReward,
+			Stamps:  map[string]int{tag: -full * need},
+			Rewards: map[string]int{tag: full},
+			Note:    fmt.Sprintf("%d %s stamps", full*need, tag),
+		}
+		// ErrInsufficient: a concurrent completion already used these stamps
+		if err := l.repo.Apply(ctx, &reward); err != nil && !errors.Is(err, repository.ErrInsufficient) {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoyaltySummary is a user's balance together with the rules that apply to it.
+type LoyaltySummary struct {
+	Enabled       bool        `json:"enabled"`
+	Points        int         `json:"points"`
+	PointValueVND int         `json:"pointValueVnd"`
+	MinRedeem     int         `json:"minRedeem"`
+	Cards         []StampCard `json:"cards"`
+}
+
+// StampCard is the progress towards a free drink with Tag.
+type StampCard struct {
+	Tag     string `json:"tag"`
+	Stamps  int    `json:"stamps"`
+	Needed  int    `json:"needed"`
+	Rewards int    `json:"rewards"`
+}
+
+func (l *Loyalty) Summary(ctx context.Context, userID primitive.ObjectID) (*LoyaltySummary, error) {
+	acct, err := l.repo.Account(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	s := &LoyaltySummary{
+		Enabled:       l.rules.Enabled,
+		Points:        acct.Points,
+		PointValueVND: l.rules.PointValueVND,
+		MinRedeem:     l.rules.MinRedeem,
+		Cards:         []StampCard{},
+	}
+	for tag, need := range l.rules.StampCards {
+		s.Cards = append(s.Cards, StampCard{Tag: tag, Stamps: acct.Stamps[tag], Needed: need, Rewards: acct.Rewards[tag]})
+	}
+	sort.Slice(s.Cards, func(i, j int) bool { return s.Cards[i].Tag < s.Cards[j].Tag })
+	return s, nil
+}
+
+// History returns the user's newest ledger entries; limit defaults to 20 and is capped
+// at 100.
+func (l *Loyalty) History(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.LoyaltyEntry, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	return l.repo.History(ctx, userID, min(limit, 100))
+}
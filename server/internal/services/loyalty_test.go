@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+)
+
+func TestPriceItems(t *testing.T) {
+	drinks := repository.NewMemoryDrinks(models.Drink{Name: "Latte", Price: 45000}, models.Drink{Name: "Old", Price: 30000, Archived: true})
+	all, _ := drinks.ListAll(context.Background())
+	latte, old := all[0].ID, all[1].ID
+	tests := []struct {
+		name     string
+		items    []models.BookingItem
+		subtotal int
+		field    string
+	}{
+		{"one line", []models.BookingItem{{DrinkID: latte, Qty: 2}}, 90000, ""},
+		{"the most of one drink", []models.BookingItem{{DrinkID: latte, Qty: MaxItemQty}}, 45000 * MaxItemQty, ""},
+		{"no quantity", []models.BookingItem{{DrinkID: latte, Qty: 0}}, 0, "items[0].qty"},
+		{"too many", []models.BookingItem{{DrinkID: latte, Qty: 1}, {DrinkID: latte, Qty: MaxItemQty + 1}}, 0, "items[1].qty"},
+		{"overflowing quantity", []models.BookingItem{{DrinkID: latte, Qty: 1 << 60}}, 0, "items[0].qty"},
+		{"archived drink", []models.BookingItem{{DrinkID: old, Qty: 1}}, 0, "items[0].drinkId"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, subtotal, err := PriceItems(context.Background(), drinks, tc.items)
+			var e *apperr.Error
+			switch {
+			case tc.field == "" && (err != nil || subtotal != tc.subtotal):
+				t.Errorf("PriceItems = %d, %v, want %d", subtotal, err, tc.subtotal)
+			case tc.field != "" && (!errors.As(err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != tc.field):
+				t.Errorf("PriceItems error = %v, want one about %s", err, tc.field)
+			}
+		})
+	}
+}
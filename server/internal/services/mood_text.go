@@ -0,0 +1,364 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"leblanc/server/internal/models"
+)
+
+// Free-text mood parsing: a small bilingual (Vietnamese/English) lexicon turned into an
+// emotion vector plus temperature and sweetness hints. Vietnamese keys keep their
+// diacritics and text that has them must match exactly, so "đang" is not "đắng".
+// Text typed without diacritics matches the folded keys: "met moi" finds "mệt mỏi".
+
+// moodTerm is what one lexicon entry contributes, scaled by any intensity modifier.
+type moodTerm struct {
+	fit   models.EmotionFit
+	temp  string // hot|iced
+	sweet int    // target sweetness, 0 when the term says nothing about it
+}
+
+func emo(calm, happy, stressed, sad, adventurous float64) moodTerm {
+	return moodTerm{fit: models.EmotionFit{Calm: calm, Happy: happy, Stressed: stressed, Sad: sad, Adventurous: adventurous}}
+}
+
+var (
+	termTired    = emo(0.3, 0, 0.5, 0.1, 0)
+	termStressed = emo(0, 0, 0.8, 0.1, 0)
+	termCalm     = emo(0.8, 0.1, 0, 0, 0)
+	termHappy    = emo(0, 0.8, 0, 0, 0.1)
+	termSad      = emo(0.1, 0, 0, 0.8, 0)
+	termBold     = emo(0, 0.1, 0, 0, 0.8)
+	termHot      = moodTerm{temp: "hot"}
+	termIced     = moodTerm{temp: "iced"}
+	termSweet    = moodTerm{sweet: 4}
+	termLessSwt  = moodTerm{sweet: 2}
+	termBitter   = moodTerm{sweet: 1}
+)
+
+// moodLexicon keys may span up to three words. "đường" alone is left out: it is as
+// often the road as the sugar.
+var moodLexicon = newMoodDict(map[string]moodTerm{
+	// tired
+	"tired": termTired, "exhausted": termTired, "sleepy": termTired, "drained": termTired, "worn out": termTired,
+	"mệt": termTired, "mệt mỏi": termTired, "buồn ngủ": termTired, "uể oải": termTired, "kiệt sức": termTired, "đuối sức": termTired,
+	// stressed
+	"stressed": termStressed, "stress": termStressed, "anxious": termStressed, "overwhelmed": termStressed,
+	"busy": termStressed, "nervous": termStressed, "pressure": termStressed, "deadline": termStressed,
+	"căng thẳng": termStressed, "áp lực": termStressed, "lo lắng": termStressed, "bận rộn": termStressed, "stress quá": termStressed,
+	// calm
+	"calm": termCalm, "relaxed": termCalm, "relax": termCalm, "chill": termCalm, "peaceful": termCalm, "quiet": termCalm, "cozy": termCalm,
+	"thư giãn": termCalm, "bình yên": termCalm, "thoải mái": termCalm, "nhẹ nhàng": termCalm, "yên tĩnh": termCalm, "tĩnh tâm": termCalm,
+	// happy
+	"happy": termHappy, "great": termHappy, "excited": termHappy, "celebrate": termHappy, "celebrating": termHappy, "good": termHappy, "joyful": termHappy,
+	"vui": termHappy, "vui vẻ": termHappy, "hạnh phúc": termHappy, "phấn khích": termHappy, "ăn mừng": termHappy, "hào hứng": termHappy,
+	// sad
+	"sad": termSad, "down": termSad, "lonely": termSad, "blue": termSad, "upset": termSad, "heartbroken": termSad, "bored": termSad,
+	"buồn": termSad, "cô đơn": termSad, "chán": termSad, "thất tình": termSad, "tuyệt vọng": termSad,
+	// adventurous
+	"adventurous": termBold, "bold": termBold, "curious": termBold, "different": termBold, "new": termBold, "surprise": termBold, "adventure": termBold,
+	"phiêu lưu": termBold, "mới lạ": termBold, "khám phá": termBold, "thử cái mới": termBold, "lạ miệng": termBold, "bất ngờ": termBold,
+	// temperature
+	"warm": termHot, "hot": termHot, "steaming": termHot, "warming": termHot,
+	"ấm": termHot, "nóng": termHot, "ấm áp": termHot, "ấm bụng": termHot,
+	"cold": termIced, "iced": termIced, "icy": termIced, "cool": termIced, "refreshing": termIced, "chilled": termIced,
+	"lạnh": termIced, "mát lạnh": termIced, "giải nhiệt": termIced, "có đá": termIced, "thêm đá": termIced, "nhiều đá": termIced, "uống đá": termIced,
+	// sweetness
+	"sweet": termSweet, "sugary": termSweet, "sugar": termSweet, "ngọt": termSweet, "ngọt ngào": termSweet, "thêm đường": termSweet, "nhiều đường": termSweet,
+	"less sweet": termLessSwt, "less sugar": termLessSwt, "ít ngọt": termLessSwt, "ít đường": termLessSwt,
+	"bitter": termBitter, "đắng": termBitter,
+})
+
+// moodAccentOnly are keys whose folded spelling is a common word with another meaning
+// ("dang" is usually "đang", currently), so they only match with their diacritics.
+var moodAccentOnly = map[string]bool{"đắng": true}
+
+// Words that negate the next lexicon hit within negationWindow words.
+var moodNegators = newMoodDict(map[string]bool{
+	"not": true, "no": true, "dont": true, "don't": true, "never": true, "without": true, "nothing": true,
+	"không": true, "ko": true, "chẳng": true,
+})
+
+const negationWindow = 3
+
+// English phrases that would otherwise collide with folded Vietnamese words ("i am" vs "ấm").
+var moodIgnored = newMoodDict(map[string]bool{"i am": true, "am i": true})
+
+// Intensity modifiers placed before the word they modify ("very tired", "rất mệt").
+var moodPreModifiers = newMoodDict(map[string]float64{
+	"very": 1.5, "really": 1.5, "so": 1.5, "too": 1.5, "extremely": 2, "super": 1.8, "quite": 1.2,
+	"a bit": 0.6, "a little": 0.6, "slightly": 0.5, "somewhat": 0.7, "kinda": 0.7, "kind of": 0.7,
+	"rất": 1.5, "cực": 1.8, "cực kỳ": 2, "siêu": 1.8, "khá": 1.2, "hơi": 0.6,
+})
+
+// Intensity modifiers placed after the word they modify ("mệt lắm", "buồn quá").
+var moodPostModifiers = newMoodDict(map[string]float64{
+	"lắm": 1.5, "quá": 1.5, "ghê": 1.5, "vl": 1.8,
+})
+
+// moodDict looks phrases up by their spelling, or by their folded spelling when the
+// text has no diacritics.
+type moodDict[V any] struct {
+	exact  map[string]V
+	folded map[string]string // folded spelling -> key in exact
+}
+
+// newMoodDict indexes the keys with diacritics by their folded spelling, except those
+// in moodAccentOnly and those that fold to the same spelling as another key.
+func newMoodDict[V any](m map[string]V) moodDict[V] {
+	d := moodDict[V]{exact: m, folded: map[string]string{}}
+	clash := map[string]bool{}
+	for key := range m {
+		f := foldViet(key)
+		if f == key || moodAccentOnly[key] {
+			continue
+		}
+		if _, taken := d.folded[f]; taken || clash[f] {
+			clash[f] = true
+			continue
+		}
+		if _, english := m[f]; english {
+			continue
+		}
+		d.folded[f] = key
+	}
+	for f := range clash {
+		delete(d.folded, f)
+	}
+	return d
+}
+
+// match finds the longest key (up to three words) starting at words[i] and returns it
+// with its value and the number of words it took.
+func (d moodDict[V]) match(words []moodWord, i int) (string, V, int, bool) {
+	for n := 3; n >= 1; n-- {
+		if i+n > len(words) {
+			continue
+		}
+		text, folded := make([]string, n), make([]string, n)
+		for k, w := range words[i : i+n] {
+			text[k], folded[k] = w.text, w.folded
+		}
+		phrase := strings.Join(text, " ")
+		if v, ok := d.exact[phrase]; ok {
+			return phrase, v, n, true
+		}
+		if f := strings.Join(folded, " "); f == phrase {
+			if key, ok := d.folded[f]; ok {
+				return key, d.exact[key], n, true
+			}
+		}
+	}
+	var zero V
+	return "", zero, 0, false
+}
+
+// MoodHints is what ParseMood understood from a free-text mood.
+type MoodHints struct {
+	EmotionFit models.EmotionFit `json:"emotionFit"`
+	Emotion    string            `json:"emotion,omitempty"`   // strongest dimension, empty if no emotion word matched
+	TempPref   string            `json:"tempPref,omitempty"`  // hot|iced
+	Sweetness  int               `json:"sweetness,omitempty"` // 1-5, 0 when not mentioned
+	Matched    []string          `json:"matched"`
+}
+
+type moodHit struct {
+	term      moodTerm
+	phrase    string
+	intensity float64
+	negated   bool
+}
+
+// ParseMood maps free text such as "tired after work, want something warm" or
+// "hơi buồn, không muốn đồ ngọt" to an emotion vector and drink hints.
+func ParseMood(text string) MoodHints {
+	words := moodWords(text)
+	var hits []moodHit
+	pendingIntensity := 1.0
+	negateFor := 0 // words left in which a hit is negated
+
+	for i := 0; i < len(words); {
+		if _, _, n, ok := moodIgnored.match(words, i); ok {
+			i += n
+			continue
+		}
+		if _, m, n, ok := moodPreModifiers.match(words, i); ok {
+			pendingIntensity *= m
+			i += n
+			if negateFor > 0 {
+				negateFor--
+			}
+			continue
+		}
+		if _, _, n, ok := moodNegators.match(words, i); ok {
+			negateFor = negationWindow
+			i += n
+			continue
+		}
+		if phrase, term, n, ok := moodLexicon.match(words, i); ok {
+			hit := moodHit{term: term, phrase: phrase, intensity: pendingIntensity, negated: negateFor > 0}
+			i += n
+			if i < len(words) {
+				if _, m, _, ok := moodPostModifiers.match(words[i:i+1], 0); ok {
+					hit.intensity *= m
+					i++
+				}
+			}
+			hits = append(hits, hit)
+			pendingIntensity, negateFor = 1, 0
+			continue
+		}
+		if negateFor > 0 {
+			negateFor--
+		}
+		i++
+	}
+	return combineMoodHits(hits)
+}
+
+func combineMoodHits(hits []moodHit) MoodHints {
+	out := MoodHints{Matched: []string{}}
+	const base = 0.2
+	v := [5]float64{base, base, base, base, base}
+	sawEmotion := false
+
+	for _, h := range hits {
+		label := h.phrase
+		if h.negated {
+			label = "not " + label
+		}
+		out.Matched = append(out.Matched, label)
+
+		t := h.term
+		f := [5]float64{t.fit.Calm, t.fit.Happy, t.fit.Stressed, t.fit.Sad, t.fit.Adventurous}
+		scale := h.intensity
+		if h.negated {
+			// "not stressed" pulls the dimension down instead of up
+			scale = -0.5 * h.intensity
+		}
+		for k := range v {
+			if f[k] != 0 {
+				v[k] += f[k] * scale
+				sawEmotion = true
+			}
+		}
+
+		switch {
+		case t.temp != "" && !h.negated:
+			out.TempPref = t.temp
+		case t.temp == "hot":
+			out.TempPref = "iced"
+		case t.temp == "iced":
+			out.TempPref = "hot"
+		}
+
+		if t.sweet > 0 {
+			out.Sweetness = moodSweetness(t.sweet, h.intensity, h.negated)
+		}
+	}
+
+	for k := range v {
+		v[k] = math.Round(math.Min(1, math.Max(0, v[k]))*100) / 100
+	}
+	out.EmotionFit = models.EmotionFit{Calm: v[0], Happy: v[1], Stressed: v[2], Sad: v[3], Adventurous: v[4]}
+	if sawEmotion {
+		out.Emotion = dominantEmotion(out.EmotionFit)
+	} else {
+		out.EmotionFit = models.EmotionFit{Calm: 0.5, Happy: 0.5, Stressed: 0.5, Sad: 0.5, Adventurous: 0.5}
+	}
+	return out
+}
+
+// moodSweetness turns a sweetness term into a 1-5 target. "not too sweet" is a little
+// sweet, "not sweet" is not sweet at all, "not bitter" is middling.
+func moodSweetness(target int, intensity float64, negated bool) int {
+	if negated {
+		if target <= 2 {
+			return 3
+		}
+		if intensity > 1 {
+			return 2
+		}
+		return 1
+	}
+	if target <= 2 {
+		return target
+	}
+	s := int(math.Round(float64(target) * math.Min(intensity, 1.25)))
+	if intensity < 1 {
+		s = int(math.Round(float64(target) * intensity))
+	}
+	return max(1, min(5, s))
+}
+
+// moodWord is one word of the text, lower-cased, as written and without diacritics.
+type moodWord struct{ text, folded string }
+
+// moodWords lower-cases the text and splits it on anything but letters, digits and
+// apostrophes.
+func moodWords(text string) []moodWord {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	words := make([]moodWord, len(fields))
+	for i, f := range fields {
+		words[i] = moodWord{text: f, folded: foldViet(f)}
+	}
+	return words
+}
+
+// foldViet strips Vietnamese diacritics from lower-case text.
+func foldViet(s string) string {
+	return strings.Map(func(r rune) rune {
+		if f, ok := vietFold[r]; ok {
+			return f
+		}
+		return r
+	}, s)
+}
+
+var vietFold = func() map[rune]rune {
+	groups := map[rune]string{
+		'a': "àáạảãâầấậẩẫăằắặẳẵ",
+		'e': "èéẹẻẽêềếệểễ",
+		'i': "ìíịỉĩ",
+		'o': "òóọỏõôồốộổỗơờớợởỡ",
+		'u': "ùúụủũưừứựửữ",
+		'y': "ỳýỵỷỹ",
+		'd': "đ",
+	}
+	m := make(map[rune]rune)
+	for base, variants := range groups {
+		for _, r := range variants {
+			m[r] = base
+		}
+	}
+	return m
+}()
+
+// ApplyMood fills the fields of p the client left empty from its free-text Mood:
+// the emotion label, the temperature preference and the sweetness. It returns what was
+// understood, or nil when there is no mood text.
+func (p *RecoPayload) ApplyMood() *MoodHints {
+	if strings.TrimSpace(p.Mood) == "" {
+		return nil
+	}
+	hints := ParseMood(p.Mood)
+	if p.Emotion == "" {
+		p.Emotion = hints.Emotion
+	}
+	if p.EmotionFit == nil && hints.Emotion != "" {
+		fit := hints.EmotionFit
+		p.EmotionFit = &fit
+	}
+	if p.Context.TempPref == nil && hints.TempPref != "" {
+		temp := hints.TempPref
+		p.Context.TempPref = &temp
+	}
+	if p.Sweetness == 0 {
+		p.Sweetness = hints.Sweetness
+	}
+	return &hints
+}
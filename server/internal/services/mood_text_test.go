@@ -0,0 +1,41 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseMood(t *testing.T) {
+	tests := []struct {
+		text      string
+		emotion   string
+		tempPref  string
+		sweetness int
+		matched   []string
+	}{
+		{text: "tôi đang mệt", emotion: "stressed", matched: []string{"mệt"}},
+		{text: "trên đường về nhà, mệt quá", emotion: "stressed", matched: []string{"mệt"}},
+		{text: "toi dang met moi", emotion: "stressed", matched: []string{"mệt mỏi"}},
+		{text: "cà phê đắng", sweetness: 1, matched: []string{"đắng"}},
+		{text: "ít đường thôi", sweetness: 2, matched: []string{"ít đường"}},
+		{text: "thêm đường", sweetness: 4, matched: []string{"thêm đường"}},
+		{text: "hơi buồn, không muốn đồ ngọt", emotion: "sad", sweetness: 1, matched: []string{"buồn", "not ngọt"}},
+		{text: "hoi buon, khong muon do ngot", emotion: "sad", sweetness: 1, matched: []string{"buồn", "not ngọt"}},
+		{text: "muốn uống gì đó lạnh", tempPref: "iced", matched: []string{"lạnh"}},
+		{text: "i am tired, want something warm", emotion: "stressed", tempPref: "hot", matched: []string{"tired", "warm"}},
+		{text: "not cold today", tempPref: "hot", matched: []string{"not cold"}},
+		{text: "nothing in particular", matched: []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			got := ParseMood(tc.text)
+			if got.Emotion != tc.emotion || got.TempPref != tc.tempPref || got.Sweetness != tc.sweetness {
+				t.Errorf("emotion, tempPref, sweetness = %q, %q, %d, want %q, %q, %d",
+					got.Emotion, got.TempPref, got.Sweetness, tc.emotion, tc.tempPref, tc.sweetness)
+			}
+			if !slices.Equal(got.Matched, tc.matched) {
+				t.Errorf("matched = %q, want %q", got.Matched, tc.matched)
+			}
+		})
+	}
+}
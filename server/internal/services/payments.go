@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/payments"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payments collects booking deposits through the payment provider.
+type Payments struct {
+	repo     repository.PaymentRepository
+	provider payments.Provider
+	cfg      config.PaymentConfig
+}
+
+func NewPayments(repo repository.PaymentRepository, provider payments.Provider, cfg config.PaymentConfig) *Payments {
+	return &Payments{repo: repo, provider: provider, cfg: cfg}
+}
+
+// DepositFor is the deposit b needs in VND, or 0.
+func (s *Payments) DepositFor(b *models.Booking) int {
+	if !s.cfg.DepositsEnabled || b.Guests <= s.cfg.DepositGuestsOver {
+		return 0
+	}
+	return b.Guests * s.cfg.DepositPerGuestVND
+}
+
+// Open starts collecting amount for b and returns the deposit with its checkout URL.
+func (s *Payments) Open(ctx context.Context, b *models.Booking, amount int) (*models.Deposit, error) {
+	now := time.Now()
+	p := models.Payment{
+		ID:        primitive.NewObjectID(),
+		BookingID: b.ID,
+		Provider:  s.provider.Name(),
+		Amount:    amount,
+		Status:    models.PaymentPending,
+		ExpiresAt: now.Add(s.cfg.DepositTimeout),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	checkout, err := s.provider.Checkout(ctx, payments.Checkout{
+		PaymentID: p.ID.Hex(),
+		Amount:    amount,
+		Info:      fmt.Sprintf("Dat coc dat ban LeBlanc %s", b.ID.Hex()),
+		ReturnURL: s.cfg.PublicURL + "/payments/" + s.provider.Name() + "/return",
+		ClientIP:  payments.ClientIP(ctx),
+		ExpiresAt: p.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Insert(ctx, &p); err != nil {
+		return nil, err
+	}
+	return &models.Deposit{PaymentID: p.ID, Amount: amount, Status: p.Status, DueAt: p.ExpiresAt, CheckoutURL: checkout}, nil
+}
+
+// Confirm applies a callback from the named provider and returns the payment as it
+// now stands. A repeated callback returns the payment with payments.ErrAlreadyConfirmed.
+// A payment that succeeds after its booking was given up is refunded straight away.
+func (s *Payments) Confirm(ctx context.Context, provider string, query url.Values) (*models.Payment, error) {
+	if provider != s.provider.Name() {
+		return nil, payments.ErrUnknownPayment
+	}
+	res, err := s.provider.Verify(query)
+	if err != nil {
+		return nil, err
+	}
+	id, err := primitive.ObjectIDFromHex(res.PaymentID)
+	if err != nil {
+		return nil, payments.ErrUnknownPayment
+	}
+	p, err := s.repo.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, payments.ErrUnknownPayment
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.Amount != p.Amount {
+		return nil, payments.ErrAmount
+	}
+
+	to := models.PaymentFailed
+	if res.Paid {
+		to = models.PaymentPaid
+	}
+	updated, err := s.repo.SetStatus(ctx, id, []string{models.PaymentPending}, to, res.Ref, res.PaidAt)
+	if !errors.Is(err, repository.ErrConflict) {
+		return updated, err
+	}
+	if p, err = s.repo.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	if res.Paid && (p.Status == models.PaymentExpired || p.Status == models.PaymentCancelled) {
+		// the money arrived after the booking was cancelled
+		p.Ref, p.PaidAt = res.Ref, &res.PaidAt
+		return s.refund(ctx, p, []string{p.Status}, "Late payment for a cancelled booking")
+	}
+	return p, payments.ErrAlreadyConfirmed
+}
+
+// Abandon marks a pending payment cancelled, or expired when the timeout ran out, so a
+// later callback is refunded. If it was paid meanwhile, the paid payment is returned.
+func (s *Payments) Abandon(ctx context.Context, id primitive.ObjectID, expired bool) (*models.Payment, error) {
+	to := models.PaymentCancelled
+	if expired {
+		to = models.PaymentExpired
+	}
+	p, err := s.repo.SetStatus(ctx, id, []string{models.PaymentPending}, to, "", time.Now())
+	if errors.Is(err, repository.ErrConflict) {
+		return s.repo.Get(ctx, id)
+	}
+	return p, err
+}
+
+// Settle decides what happens to a cancelled booking's deposit: a pending one is
+// abandoned, a paid one refunded when the booking was cancelled at least RefundBefore
+// ahead of its time and kept otherwise. It returns the deposit's new status.
+func (s *Payments) Settle(ctx context.Context, b *models.Booking) (string, error) {
+	p, err := s.Abandon(ctx, b.Deposit.PaymentID, false)
+	if err != nil {
+		return "", err
+	}
+	if p.Status != models.PaymentPaid {
+		return p.Status, nil
+	}
+	if time.Until(b.Time) < s.cfg.RefundBefore {
+		return models.DepositForfeited, nil
+	}
+	p, err = s.refund(ctx, p, []string{models.PaymentPaid}, "Booking cancelled")
+	if err != nil {
+		return "", err
+	}
+	return p.Status, nil
+}
+
+func (s *Payments) refund(ctx context.Context, p *models.Payment, from []string, reason string) (*models.Payment, error) {
+	r := payments.Refund{PaymentID: p.ID.Hex(), Amount: p.Amount, Ref: p.Ref, Reason: reason, ClientIP: payments.ClientIP(ctx)}
+	if p.PaidAt != nil {
+		r.PaidAt = *p.PaidAt
+	}
+	if err := s.provider.Refund(ctx, r); err != nil {
+		return nil, err
+	}
+	return s.repo.SetStatus(ctx, p.ID, from, models.PaymentRefunded, p.Ref, time.Now())
+}
+
+// Expired returns the pending payments that ran out of time.
+func (s *Payments) Expired(ctx context.Context) ([]models.Payment, error) {
+	return s.repo.Expired(ctx, time.Now())
+}
+
+// Acknowledge is the provider's answer to a server-to-server callback that ended with err.
+func (s *Payments) Acknowledge(err error) (int, any) {
+	return s.provider.Acknowledge(err)
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxVouchers is the most codes one request may issue.
+const MaxVouchers = 500
+
+// Promotions picks the promotions a booking gets and counts their uses.
+type Promotions struct {
+	repo     repository.PromotionRepository
+	location *time.Location
+}
+
+// NewPromotions returns the service; time windows are read in loc, the café's timezone.
+func NewPromotions(repo repository.PromotionRepository, loc *time.Location) *Promotions {
+	return &Promotions{repo: repo, location: loc}
+}
+
+// ValidatePromotion checks p before it is saved and normalizes its tags.
+func ValidatePromotion(p *models.Promotion) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return apperr.Invalid("name", "is required")
+	}
+	switch p.Kind {
+	case models.PromoPercent:
+		if p.Percent < 1 || p.Percent > 100 {
+			return apperr.Invalid("percent", "must be between 1 and 100")
+		}
+	case models.PromoFixed:
+		if p.Amount <= 0 {
+			return apperr.Invalid("amount", "must be positive")
+		}
+	case models.PromoBuyGet:
+		if p.BuyQty < 1 || p.GetQty < 1 {
+			return apperr.Invalid("buyQty", "and getQty must be at least 1")
+		}
+	default:
+		return apperr.Invalid("kind", "must be percent, fixed or buy_get")
+	}
+	for i, tag := range p.Tags {
+		p.Tags[i] = strings.ToLower(strings.TrimSpace(tag))
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return apperr.Invalid("endsAt", "must be after startsAt")
+	}
+	for i, w := range p.Windows {
+		field := fmt.Sprintf("windows[%d]", i)
+		if _, err := clockMinutes(w.Start); err != nil {
+			return apperr.Invalid(field+".start", "must look like 21:00")
+		}
+		if _, err := clockMinutes(w.End); err != nil {
+			return apperr.Invalid(field+".end", "must look like 23:00")
+		}
+		for _, d := range w.Days {
+			if d < 0 || d > 6 {
+				return apperr.Invalid(field+".days", "must be 0 (Sunday) to 6")
+			}
+		}
+	}
+	if p.MinSubtotal < 0 || p.MaxUses < 0 || p.MaxUsesPerUser < 0 {
+		return apperr.New(apperr.InvalidArgument, "minSubtotal, maxUses and maxUsesPerUser must not be negative")
+	}
+	return nil
+}
+
+// Customer is the key per-user limits count against: the user when logged in, else the
+// booking email.
+func Customer(b *models.Booking) string {
+	if b.UserID != nil {
+		return "user:" + b.UserID.Hex()
+	}
+	return "email:" + strings.ToLower(strings.TrimSpace(b.Email))
+}
+
+// NormalizeVoucher makes codes case- and space-insensitive.
+func NormalizeVoucher(code string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(code), ""))
+}
+
+var (
+	errVoucherInvalid = apperr.Invalid("voucher", "is not a valid code")
+	errVoucherUsed    = apperr.New(apperr.FailedPrecondition, "this voucher has already been used")
+)
+
+// Apply picks the promotions for b, priced at lines, claims their uses and returns them.
+// voucher is optional; a voucher that does not apply is an error rather than ignored.
+// Promotions whose limits are reached meanwhile are dropped and the choice is made again.
+func (s *Promotions) Apply(ctx context.Context, b *models.Booking, lines []PricedItem, subtotal int, voucher string) ([]models.AppliedPromotion, error) {
+	promos, err := s.repo.Active(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var voucherPromo primitive.ObjectID
+	if voucher = NormalizeVoucher(voucher); voucher != "" {
+		v, err := s.repo.Voucher(ctx, voucher)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errVoucherInvalid
+		}
+		if err != nil {
+			return nil, err
+		}
+		if v.UsedAt != nil {
+			return nil, errVoucherUsed
+		}
+		voucherPromo = v.PromotionID
+	}
+
+	customer := Customer(b)
+	for {
+		chosen, err := choosePromotions(promos, voucherPromo, lines, subtotal, b.Time.In(s.location))
+		if err != nil {
+			return nil, err
+		}
+		var claimed []models.AppliedPromotion
+		var exhausted *models.Promotion
+		for i := range chosen {
+			p := chosen[i].promo
+			if err := s.repo.Claim(ctx, p, customer); err != nil {
+				s.release(ctx, claimed, customer, b.ID)
+				if !errors.Is(err, repository.ErrInsufficient) {
+					return nil, err
+				}
+				exhausted = p
+				break
+			}
+			claimed = append(claimed, models.AppliedPromotion{PromotionID: p.ID, Name: p.Name, Amount: chosen[i].amount})
+			if p.ID == voucherPromo {
+				claimed[len(claimed)-1].Voucher = voucher
+			}
+		}
+		if exhausted != nil {
+			if exhausted.ID == voucherPromo {
+				return nil, apperr.New(apperr.FailedPrecondition, "the voucher's promotion has reached its usage limit")
+			}
+			promos = slices.DeleteFunc(promos, func(p models.Promotion) bool { return p.ID == exhausted.ID })
+			continue
+		}
+		// the voucher is spent only when its promotion made the cut; promotions ranked
+		// above it may already have discounted the whole subtotal
+		if slices.ContainsFunc(claimed, func(a models.AppliedPromotion) bool { return a.Voucher != "" }) {
+			err := s.repo.UseVoucher(ctx, voucher, b.ID, time.Now())
+			if err != nil {
+				// the voucher's own entry has no Voucher to release yet
+				s.release(ctx, claimed, customer, primitive.NilObjectID)
+				if errors.Is(err, repository.ErrConflict) {
+					return nil, errVoucherUsed
+				}
+				return nil, err
+			}
+		}
+		return claimed, nil
+	}
+}
+
+// Release gives back the uses and voucher b claimed, after a failed insert or when b is
+// cancelled.
+func (s *Promotions) Release(ctx context.Context, b *models.Booking) {
+	s.release(ctx, b.Promotions, Customer(b), b.ID)
+}
+
+func (s *Promotions) release(ctx context.Context, applied []models.AppliedPromotion, customer string, bookingID primitive.ObjectID) {
+	for _, a := range applied {
+		if err := s.repo.Release(ctx, a.PromotionID, customer); err != nil {
+			slog.ErrorContext(ctx, "promotion release failed", "promotion", a.PromotionID.Hex(), "error", err)
+		}
+		if a.Voucher != "" && !bookingID.IsZero() {
+			if err := s.repo.ReleaseVoucher(ctx, a.Voucher, bookingID); err != nil {
+				slog.ErrorContext(ctx, "voucher release failed", "promotion", a.PromotionID.Hex(), "error", err)
+			}
+		}
+	}
+}
+
+// IssueVouchers creates n single-use codes for the promotion.
+func (s *Promotions) IssueVouchers(ctx context.Context, promotionID primitive.ObjectID, n int) ([]models.Voucher, error) {
+	if n < 1 || n > MaxVouchers {
+		return nil, apperr.Invalid("count", fmt.Sprintf("must be between 1 and %d", MaxVouchers))
+	}
+	if _, err := s.repo.Get(ctx, promotionID); errors.Is(err, repository.ErrNotFound) {
+		return nil, apperr.New(apperr.NotFound, "promotion not found")
+	} else if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	vouchers := make([]models.Voucher, n)
+	for i := range vouchers {
+		vouchers[i] = models.Voucher{Code: voucherCode(), PromotionID: promotionID, CreatedAt: now}
+	}
+	if err := s.repo.InsertVouchers(ctx, vouchers); err != nil {
+		return nil, err
+	}
+	return vouchers, nil
+}
+
+// voucherAlphabet leaves out 0/O and 1/I/L, which are misread on printed vouchers.
+const voucherAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+func voucherCode() string {
+	b := make([]byte, 10)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = voucherAlphabet[int(b[i])%len(voucherAlphabet)]
+	}
+	return string(b)
+}
+
+type promoAmount struct {
+	promo  *models.Promotion
+	amount int
+}
+
+// choosePromotions is the deterministic part of Apply. Every promotion that applies is
+// priced on the original line prices; the best non-stackable one (or the voucher's) is
+// combined with all stackable ones, in order of priority, then amount, then ID, until
+// the discounts reach the subtotal.
+func choosePromotions(promos []models.Promotion, voucherPromo primitive.ObjectID, lines []PricedItem, subtotal int, at time.Time) ([]promoAmount, error) {
+	var candidates []promoAmount
+	voucherApplies := false
+	for i := range promos {
+		p := &promos[i]
+		if p.VoucherOnly && p.ID != voucherPromo || !promotionApplies(p, subtotal, at) {
+			continue
+		}
+		if amount := promotionDiscount(p, lines); amount > 0 {
+			candidates = append(candidates, promoAmount{promo: p, amount: amount})
+			voucherApplies = voucherApplies || p.ID == voucherPromo
+		}
+	}
+	if !voucherPromo.IsZero() && !voucherApplies {
+		return nil, apperr.Invalid("voucher", "does not apply to this booking")
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.promo.Priority != b.promo.Priority {
+			return a.promo.Priority > b.promo.Priority
+		}
+		if a.amount != b.amount {
+			return a.amount > b.amount
+		}
+		return a.promo.ID.Hex() < b.promo.ID.Hex()
+	})
+
+	var exclusive *promoAmount
+	for i := range candidates {
+		c := &candidates[i]
+		if c.promo.ID == voucherPromo && !c.promo.Stackable {
+			exclusive = c
+			break
+		}
+		if exclusive == nil && !c.promo.Stackable {
+			exclusive = c
+		}
+	}
+	var chosen []promoAmount
+	left := subtotal
+	for _, c := range candidates {
+		if c.promo.Stackable || exclusive != nil && c.promo.ID == exclusive.promo.ID {
+			if left == 0 {
+				break
+			}
+			c.amount = min(c.amount, left)
+			left -= c.amount
+			chosen = append(chosen, c)
+		}
+	}
+	return chosen, nil
+}
+
+func promotionApplies(p *models.Promotion, subtotal int, at time.Time) bool {
+	if subtotal < p.MinSubtotal {
+		return false
+	}
+	if p.StartsAt != nil && at.Before(*p.StartsAt) || p.EndsAt != nil && !at.Before(*p.EndsAt) {
+		return false
+	}
+	if len(p.Windows) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.Windows, func(w models.TimeWindow) bool { return inWindow(w, at) })
+}
+
+// inWindow reports whether at, in café local time, falls in w. For a window past
+// midnight, the small hours count towards the day the window started.
+func inWindow(w models.TimeWindow, local time.Time) bool {
+	start, _ := clockMinutes(w.Start)
+	end, _ := clockMinutes(w.End)
+	now := local.Hour()*60 + local.Minute()
+	day := int(local.Weekday())
+	switch {
+	case start < end:
+		if now < start || now >= end {
+			return false
+		}
+	case start > end:
+		if now < start && now >= end {
+			return false
+		}
+		if now < end {
+			day = (day + 6) % 7
+		}
+	}
+	return len(w.Days) == 0 || slices.Contains(w.Days, day)
+}
+
+func clockMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func promotionMatches(p *models.Promotion, d models.Drink) bool {
+	return len(p.Tags) == 0 || slices.ContainsFunc(p.Tags, func(tag string) bool { return slices.Contains(d.Tags, tag) })
+}
+
+// promotionDiscount is what p takes off lines, in VND.
+func promotionDiscount(p *models.Promotion, lines []PricedItem) int {
+	matched := 0
+	var units []int
+	for _, line := range lines {
+		if !promotionMatches(p, line.Drink) {
+			continue
+		}
+		matched += line.Drink.Price * line.Qty
+		for range line.Qty {
+			units = append(units, line.Drink.Price)
+		}
+	}
+	switch p.Kind {
+	case models.PromoPercent:
+		return matched * p.Percent / 100
+	case models.PromoFixed:
+		return min(p.Amount, matched)
+	case models.PromoBuyGet:
+		// in each group of BuyQty+GetQty drinks, from the dearest down, the cheapest
+		// GetQty are free
+		slices.Sort(units)
+		slices.Reverse(units)
+		group, free := p.BuyQty+p.GetQty, 0
+		for i := group - 1; i < len(units); i += group {
+			for j := i - p.GetQty + 1; j <= i; j++ {
+				free += units[j]
+			}
+		}
+		return free
+	}
+	return 0
+}
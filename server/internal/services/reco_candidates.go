@@ -0,0 +1,23 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+)
+
+// RecoCandidates loads the menu and narrows it to the drinks that may be recommended:
+// served at the resolved time of day and within the hard constraints.
+func (cafe *Cafe) RecoCandidates(ctx context.Context, repo repository.DrinkRepository, rc Context, c Constraints) ([]models.Drink, Context, ConstraintReport, error) {
+	drinks, err := repo.List(ctx)
+	if err != nil {
+		return nil, rc, nil, err
+	}
+
+	rc = cafe.ResolveContext(ctx, rc, time.Now())
+	drinks = FilterAvailable(drinks, rc.TimeOfDay)
+	drinks, report := ApplyConstraints(drinks, c)
+	return drinks, rc, report, nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+)
+
+// Constraint names used as keys in a ConstraintReport.
+const (
+	ConstraintMaxPrice  = "maxPrice"
+	ConstraintCaffeine  = "caffeine"
+	ConstraintAlcohol   = "alcohol"
+	ConstraintAllergens = "allergens"
+	ConstraintSweetness = "sweetness"
+)
+
+// Tags that mark a drink as alcoholic.
+var alcoholTags = map[string]bool{
+	"cocktail": true, "wine": true, "beer": true, "liqueur": true,
+	"gin": true, "rum": true, "whisky": true,
+}
+
+// Allergens implied by tags, for drinks stored before the allergens field existed.
+var tagAllergens = map[string]string{
+	"milk":    "dairy",
+	"yogurt":  "dairy",
+	"oat":     "gluten",
+	"beer":    "gluten",
+	"coconut": "coconut",
+}
+
+// Constraints are hard filters: a drink that violates any of them is never recommended,
+// unlike the soft caffeine/temp/sweetness preferences which only lower its score.
+type Constraints struct {
+	MaxPrice        int      `json:"maxPrice" bson:"maxPrice,omitempty"`               // VND, 0 means no limit
+	ExcludeCaffeine []string `json:"excludeCaffeine" bson:"excludeCaffeine,omitempty"` // caffeine levels to drop: none|low|med|high
+	NoAlcohol       bool     `json:"noAlcohol" bson:"noAlcohol,omitempty"`
+	Allergens       []string `json:"allergens" bson:"allergens,omitempty"` // drop drinks containing any of these
+	MinSweetness    *int     `json:"minSweetness" bson:"minSweetness,omitempty"`
+	MaxSweetness    *int     `json:"maxSweetness" bson:"maxSweetness,omitempty"`
+}
+
+// ConstraintReport counts how many drinks each constraint removed.
+type ConstraintReport map[string]int
+
+func (c Constraints) Validate() error {
+	if c.MaxPrice < 0 {
+		return apperr.Invalid("constraints.maxPrice", "must not be negative")
+	}
+	for _, level := range c.ExcludeCaffeine {
+		if !slices.Contains([]string{"none", "low", "med", "high"}, strings.ToLower(level)) {
+			return apperr.Invalid("constraints.excludeCaffeine", fmt.Sprintf("has %q, must be none, low, med or high", level))
+		}
+	}
+	if c.MinSweetness != nil && c.MaxSweetness != nil && *c.MinSweetness > *c.MaxSweetness {
+		return apperr.Invalid("constraints.minSweetness", "must not exceed maxSweetness")
+	}
+	return nil
+}
+
+// ApplyConstraints drops drinks violating c. Each removed drink is counted once,
+// under the first constraint it fails.
+func ApplyConstraints(drinks []models.Drink, c Constraints) ([]models.Drink, ConstraintReport) {
+	report := ConstraintReport{}
+	excludedCaffeine := lowerSet(c.ExcludeCaffeine)
+	excludedAllergens := lowerSet(c.Allergens)
+
+	kept := make([]models.Drink, 0, len(drinks))
+	for _, d := range drinks {
+		reason := ""
+		switch {
+		case c.MaxPrice > 0 && d.Price > c.MaxPrice:
+			reason = ConstraintMaxPrice
+		case excludedCaffeine[strings.ToLower(d.Caffeine)]:
+			reason = ConstraintCaffeine
+		case c.NoAlcohol && IsAlcoholic(d):
+			reason = ConstraintAlcohol
+		case containsAny(DrinkAllergens(d), excludedAllergens):
+			reason = ConstraintAllergens
+		case c.MinSweetness != nil && d.Sweetness < *c.MinSweetness,
+			c.MaxSweetness != nil && d.Sweetness > *c.MaxSweetness:
+			reason = ConstraintSweetness
+		}
+		if reason != "" {
+			report[reason]++
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept, report
+}
+
+// IsAlcoholic reports whether any of the drink's tags marks it as alcoholic.
+func IsAlcoholic(d models.Drink) bool {
+	for _, t := range d.Tags {
+		if alcoholTags[strings.ToLower(t)] {
+			return true
+		}
+	}
+	return false
+}
+
+// DrinkAllergens returns the drink's declared allergens plus those implied by its tags.
+func DrinkAllergens(d models.Drink) map[string]bool {
+	out := lowerSet(d.Allergens)
+	for _, t := range d.Tags {
+		if a, ok := tagAllergens[strings.ToLower(t)]; ok {
+			out[a] = true
+		}
+	}
+	return out
+}
+
+// ShortfallNotice explains why fewer drinks than requested were returned, or "" if none are missing.
+func ShortfallNotice(requested, returned int, report ConstraintReport) string {
+	if returned >= requested {
+		return ""
+	}
+	var parts []string
+	keys := make([]string, 0, len(report))
+	for k := range report {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%d excluded by %s", report[k], k))
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("only %d of %d requested drinks are available on this menu", returned, requested)
+	}
+	return fmt.Sprintf("only %d of %d requested drinks match your constraints (%s)", returned, requested, strings.Join(parts, ", "))
+}
+
+func lowerSet(values []string) map[string]bool {
+	out := make(map[string]bool, len(values))
+	for _, v := range values {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			out[v] = true
+		}
+	}
+	return out
+}
+
+func containsAny(have, want map[string]bool) bool {
+	for k := range want {
+		if have[k] {
+			return true
+		}
+	}
+	return false
+}
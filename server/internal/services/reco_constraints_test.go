@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+)
+
+func TestConstraintsValidate(t *testing.T) {
+	one, three := 1, 3
+	tests := []struct {
+		name  string
+		c     Constraints
+		field string
+	}{
+		{"empty", Constraints{}, ""},
+		{"all set", Constraints{MaxPrice: 60000, ExcludeCaffeine: []string{"HIGH", "med"}, NoAlcohol: true, MinSweetness: &one, MaxSweetness: &three}, ""},
+		{"negative price", Constraints{MaxPrice: -1}, "constraints.maxPrice"},
+		{"unknown caffeine level", Constraints{ExcludeCaffeine: []string{"low", "extra"}}, "constraints.excludeCaffeine"},
+		{"sweetness range reversed", Constraints{MinSweetness: &three, MaxSweetness: &one}, "constraints.minSweetness"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.c.Validate()
+			var e *apperr.Error
+			switch {
+			case tc.field == "" && err != nil:
+				t.Errorf("Validate = %v, want nil", err)
+			case tc.field != "" && (!errors.As(err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != tc.field):
+				t.Errorf("Validate = %v, want an error about %s", err, tc.field)
+			}
+		})
+	}
+}
+
+func TestApplyConstraints(t *testing.T) {
+	drinks := []models.Drink{
+		{Name: "Espresso", Price: 35000, Caffeine: "high", Sweetness: 1, Tags: []string{"coffee"}},
+		{Name: "Latte", Price: 45000, Caffeine: "Med", Sweetness: 2, Tags: []string{"coffee", "milk"}},
+		{Name: "Mojito", Price: 90000, Caffeine: "none", Sweetness: 3, Tags: []string{"Cocktail", "rum"}},
+		{Name: "Coconut shake", Price: 55000, Caffeine: "none", Sweetness: 5, Allergens: []string{"Nuts"}, Tags: []string{"coconut"}},
+		{Name: "Yuzu soda", Price: 40000, Caffeine: "none", Sweetness: 3, Tags: []string{"fruit"}},
+	}
+	two, four := 2, 4
+	tests := []struct {
+		name   string
+		c      Constraints
+		kept   []string
+		report ConstraintReport
+	}{
+		{"none", Constraints{}, []string{"Espresso", "Latte", "Mojito", "Coconut shake", "Yuzu soda"}, ConstraintReport{}},
+		{"max price", Constraints{MaxPrice: 50000}, []string{"Espresso", "Latte", "Yuzu soda"}, ConstraintReport{ConstraintMaxPrice: 2}},
+		{"caffeine, any case", Constraints{ExcludeCaffeine: []string{"HIGH", "med"}}, []string{"Mojito", "Coconut shake", "Yuzu soda"}, ConstraintReport{ConstraintCaffeine: 2}},
+		{"no alcohol", Constraints{NoAlcohol: true}, []string{"Espresso", "Latte", "Coconut shake", "Yuzu soda"}, ConstraintReport{ConstraintAlcohol: 1}},
+		{"declared and tag allergens", Constraints{Allergens: []string{"dairy", " nuts "}}, []string{"Espresso", "Mojito", "Yuzu soda"}, ConstraintReport{ConstraintAllergens: 2}},
+		{"sweetness range", Constraints{MinSweetness: &two, MaxSweetness: &four}, []string{"Latte", "Mojito", "Yuzu soda"}, ConstraintReport{ConstraintSweetness: 2}},
+		{"counted under the first failed", Constraints{MaxPrice: 50000, NoAlcohol: true}, []string{"Espresso", "Latte", "Yuzu soda"}, ConstraintReport{ConstraintMaxPrice: 2}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kept, report := ApplyConstraints(drinks, tc.c)
+			var names []string
+			for _, d := range kept {
+				names = append(names, d.Name)
+			}
+			if !slices.Equal(names, tc.kept) || !maps.Equal(report, tc.report) {
+				t.Errorf("ApplyConstraints = %q, %v; want %q, %v", names, report, tc.kept, tc.report)
+			}
+		})
+	}
+}
+
+func TestShortfallNotice(t *testing.T) {
+	tests := []struct {
+		name               string
+		requested, results int
+		report             ConstraintReport
+		want               string
+	}{
+		{"enough", 3, 3, ConstraintReport{ConstraintMaxPrice: 4}, ""},
+		{"small menu", 5, 2, ConstraintReport{}, "only 2 of 5 requested drinks are available on this menu"},
+		{"constraints", 5, 2, ConstraintReport{ConstraintMaxPrice: 1, ConstraintAlcohol: 3},
+			"only 2 of 5 requested drinks match your constraints (3 excluded by alcohol, 1 excluded by maxPrice)"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ShortfallNotice(tc.requested, tc.results, tc.report); got != tc.want {
+				t.Errorf("ShortfallNotice = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
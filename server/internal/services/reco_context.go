@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/models"
+)
+
+const (
+	defaultCafeTimezone = "Asia/Ho_Chi_Minh"
+	// DayStartHour and NightStartHour bound the day menu in café local time.
+	DayStartHour   = 6
+	NightStartHour = 18
+)
+
+// Weather is an optional signal used to nudge the temperature preference. TempC is nil
+// when the temperature is unknown, so only the condition counts.
+type Weather struct {
+	TempC     *float64 `json:"tempC,omitempty"`
+	Condition string   `json:"condition"` // clear|cloudy|rain|storm
+}
+
+// WeatherProvider reports the weather at the café for a given moment.
+type WeatherProvider interface {
+	Current(ctx context.Context, at time.Time) (*Weather, error)
+}
+
+// StaticWeatherProvider always reports the same weather; used for local runs and tests.
+type StaticWeatherProvider struct {
+	Weather Weather
+}
+
+func (p StaticWeatherProvider) Current(ctx context.Context, at time.Time) (*Weather, error) {
+	w := p.Weather
+	return &w, nil
+}
+
+// Cafe is the timezone booking times are interpreted in and the weather provider, if
+// any, that recommendations consult.
+type Cafe struct {
+	location *time.Location
+	weather  WeatherProvider
+}
+
+// NewCafe returns a café in loc, Asia/Ho_Chi_Minh when nil. weather may be nil to
+// leave weather out.
+func NewCafe(loc *time.Location, weather WeatherProvider) *Cafe {
+	if loc == nil {
+		loc = mustLoadLocation(defaultCafeTimezone)
+	}
+	return &Cafe{location: loc, weather: weather}
+}
+
+// CafeFromConfig returns the café in CAFE_TIMEZONE with, when WEATHER_TEMP_C is
+// configured, a static weather provider.
+func CafeFromConfig(cafe config.CafeConfig, weather config.WeatherConfig) *Cafe {
+	if weather.TempC == nil {
+		return NewCafe(cafe.Location, nil)
+	}
+	return NewCafe(cafe.Location, StaticWeatherProvider{Weather: Weather{TempC: weather.TempC, Condition: weather.Condition}})
+}
+
+// Location is the café's timezone.
+func (cafe *Cafe) Location() *time.Location { return cafe.location }
+
+// TimeOfDayAt returns "day" or "night" for t in café local time.
+func (cafe *Cafe) TimeOfDayAt(t time.Time) string {
+	h := t.In(cafe.location).Hour()
+	if h >= DayStartHour && h < NightStartHour {
+		return "day"
+	}
+	return "night"
+}
+
+// ResolveContext fills in the server-derived parts of a recommendation context:
+// time of day from the booking time (or now) and, when a provider is configured,
+// the weather and a temperature preference if the client did not give one.
+func (cafe *Cafe) ResolveContext(ctx context.Context, c Context, now time.Time) Context {
+	at := now
+	if c.BookingTime != nil && !c.BookingTime.IsZero() {
+		at = *c.BookingTime
+	}
+	c.TimeOfDay = cafe.TimeOfDayAt(at)
+
+	if c.Weather == nil && cafe.weather != nil {
+		w, err := cafe.weather.Current(ctx, at)
+		if err != nil {
+			slog.WarnContext(ctx, "weather lookup failed", "error", err)
+		} else {
+			c.Weather = w
+		}
+	}
+	if c.TempPref == nil && c.Weather != nil {
+		if pref := tempPrefForWeather(*c.Weather); pref != "" {
+			c.TempPref = &pref
+		}
+	}
+	return c
+}
+
+// AvailableAt reports whether a drink is on the menu at the given time of day.
+// Drinks tagged with neither "day" nor "night" are always available.
+func AvailableAt(d models.Drink, timeOfDay string) bool {
+	var day, night bool
+	for _, t := range d.Tags {
+		switch strings.ToLower(t) {
+		case "day":
+			day = true
+		case "night":
+			night = true
+		}
+	}
+	if !day && !night {
+		return true
+	}
+	return (timeOfDay == "day" && day) || (timeOfDay == "night" && night)
+}
+
+// FilterAvailable keeps only drinks served at the given time of day.
+func FilterAvailable(drinks []models.Drink, timeOfDay string) []models.Drink {
+	out := make([]models.Drink, 0, len(drinks))
+	for _, d := range drinks {
+		if AvailableAt(d, timeOfDay) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func tempPrefForWeather(w Weather) string {
+	switch {
+	case w.Condition == "rain" || w.Condition == "storm":
+		return "hot"
+	case w.TempC == nil:
+		return ""
+	case *w.TempC <= 20:
+		return "hot"
+	case *w.TempC >= 30:
+		return "iced"
+	}
+	return ""
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
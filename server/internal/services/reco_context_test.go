@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestCafeResolveContext checks that each café reads the time in its own timezone and
+// only consults its own weather provider.
+func TestCafeResolveContext(t *testing.T) {
+	hot := 33.0
+	at := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC) // 19:00 in Ho Chi Minh City
+	tests := []struct {
+		name      string
+		cafe      *Cafe
+		timeOfDay string
+		tempPref  string
+	}{
+		{"default timezone", NewCafe(nil, nil), "night", ""},
+		{"UTC", NewCafe(time.UTC, nil), "day", ""},
+		{"hot weather", NewCafe(time.UTC, StaticWeatherProvider{Weather: Weather{TempC: &hot, Condition: "clear"}}), "day", "iced"},
+		{"rain without a temperature", NewCafe(time.UTC, StaticWeatherProvider{Weather: Weather{Condition: "rain"}}), "day", "hot"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.cafe.ResolveContext(context.Background(), Context{BookingTime: &at}, time.Now())
+			pref := ""
+			if got.TempPref != nil {
+				pref = *got.TempPref
+			}
+			if got.TimeOfDay != tc.timeOfDay || pref != tc.tempPref {
+				t.Errorf("timeOfDay, tempPref = %q, %q, want %q, %q", got.TimeOfDay, pref, tc.timeOfDay, tc.tempPref)
+			}
+		})
+	}
+}
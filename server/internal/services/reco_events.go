@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecoEventsCollection holds one document per served recommendation.
+const RecoEventsCollection = "reco_events"
+
+// RecoEvent records what was recommended to whom, and from which query. It is stored
+// as a models.RecoEvent; offline evaluation reads it back with the query typed.
+type RecoEvent struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"_id"`
+	Time      time.Time           `bson:"time" json:"time"`
+	Email     string              `bson:"email,omitempty" json:"email,omitempty"`
+	SessionID string              `bson:"sessionId,omitempty" json:"sessionId,omitempty"`
+	UserID    *primitive.ObjectID `bson:"userId,omitempty" json:"userId,omitempty"`
+	Endpoint  string              `bson:"endpoint" json:"endpoint"` // rest|graphql
+	Scorer    string              `bson:"scorer" json:"scorer"`
+	Query     RecoQuery           `bson:"query" json:"query"`
+	DrinkIDs  []string            `bson:"drinkIds" json:"drinkIds"`
+	Exposure  *Exposure           `bson:"exposure,omitempty" json:"exposure,omitempty"`
+}
+
+// LogRecoEvent stores a recommendation event. Failures are logged, never returned:
+// a missing event must not fail the recommendation itself.
+func LogRecoEvent(ctx context.Context, events repository.RecoEventRepository, ev RecoEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	doc := models.RecoEvent{
+		ID:        ev.ID,
+		Time:      ev.Time,
+		Email:     strings.ToLower(strings.TrimSpace(ev.Email)),
+		SessionID: ev.SessionID,
+		UserID:    ev.UserID,
+		Endpoint:  ev.Endpoint,
+		Scorer:    ev.Scorer,
+		Query:     ev.Query,
+		DrinkIDs:  ev.DrinkIDs,
+		Exposure:  ev.Exposure,
+	}
+	if err := events.Insert(ctx, &doc); err != nil {
+		slog.ErrorContext(ctx, "reco event: insert failed", "error", err)
+	}
+}
+
+// ScoreIDs returns the drink IDs of scores in order.
+func ScoreIDs(scores []DrinkScore) []string {
+	ids := make([]string, len(scores))
+	for i, s := range scores {
+		ids[i] = s.DrinkID
+	}
+	return ids
+}
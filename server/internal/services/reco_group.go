@@ -0,0 +1,168 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+)
+
+// Fairness strategies for combining guests' scores into one group score.
+const (
+	GroupAverage      = "average"       // maximise the mean fit
+	GroupLeastMisery  = "least_misery"  // maximise the fit of the least happy guest
+	GroupMostPleasure = "most_pleasure" // maximise the fit of the happiest guest
+)
+
+// MaxGroupGuests bounds how many preference profiles one request may carry.
+const MaxGroupGuests = 20
+
+// GroupRecoRequest is the body of a group recommendation request.
+type GroupRecoRequest struct {
+	Guests           []GuestProfile `json:"guests"`
+	Strategy         string         `json:"strategy"` // average|least_misery|most_pleasure
+	Limit            int            `json:"limit"`    // size of the drink set, defaults to one per guest
+	Diversity        *float64       `json:"diversity"`
+	ExcludeBookingID string         `json:"excludeBookingId"`
+	Context          Context        `json:"context"`
+	Constraints      Constraints    `json:"constraints"` // apply to the whole table
+}
+
+// GuestProfile is one guest's soft preferences, as accepted by ScoreDrinks.
+type GuestProfile struct {
+	Name       string            `json:"name"`
+	EmotionFit models.EmotionFit `json:"emotionFit"`
+	Caffeine   string            `json:"caffeine"`
+	Temp       string            `json:"temp"`
+	Sweetness  int               `json:"sweetness"`
+}
+
+// GroupDrinkScore is a drink's combined score with each guest's individual score, in guest order.
+type GroupDrinkScore struct {
+	DrinkID     string    `json:"drinkId"`
+	Score       float64   `json:"score"`
+	GuestScores []float64 `json:"guestScores"`
+}
+
+// GuestAssignment is the drink from the group set that suits a guest best.
+type GuestAssignment struct {
+	Guest   string  `json:"guest"`
+	DrinkID string  `json:"drinkId"`
+	Score   float64 `json:"score"`
+}
+
+// GroupRecommendation is the chosen set plus booking items ready to prefill a booking.
+type GroupRecommendation struct {
+	Strategy    string               `json:"strategy"`
+	Drinks      []GroupDrinkScore    `json:"drinks"`
+	Assignments []GuestAssignment    `json:"assignments"`
+	Items       []models.BookingItem `json:"items"`
+}
+
+// ValidGroupStrategy reports whether s is a known fairness strategy.
+func ValidGroupStrategy(s string) bool {
+	switch s {
+	case GroupAverage, GroupLeastMisery, GroupMostPleasure:
+		return true
+	}
+	return false
+}
+
+// RecommendForGroup scores every drink for every guest with ScoreDrinks, combines the scores
+// with the fairness strategy and picks a varied set of opts.Limit drinks (one per guest when
+// Limit is 0). Each guest is then assigned their best drink from that set, and the assignments
+// are folded into booking items.
+func RecommendForGroup(drinks []models.Drink, guests []GuestProfile, strategy string, opts RerankOptions) (*GroupRecommendation, error) {
+	if len(guests) == 0 {
+		return nil, apperr.Invalid("guests", "needs at least one guest profile")
+	}
+	if len(guests) > MaxGroupGuests {
+		return nil, apperr.Invalid("guests", fmt.Sprintf("allows at most %d guest profiles", MaxGroupGuests))
+	}
+	if strategy == "" {
+		strategy = GroupAverage
+	}
+	if !ValidGroupStrategy(strategy) {
+		return nil, apperr.Invalid("strategy", "must be average, least_misery or most_pleasure")
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = len(guests)
+	}
+
+	// per guest: drink ID -> score
+	perGuest := make([]map[string]float64, len(guests))
+	for i, g := range guests {
+		scores := ScoreDrinks(drinks, g.EmotionFit, g.Caffeine, g.Temp, g.Sweetness)
+		perGuest[i] = make(map[string]float64, len(scores))
+		for _, s := range scores {
+			perGuest[i][s.DrinkID] = s.Score
+		}
+	}
+
+	combined := make([]DrinkScore, 0, len(drinks))
+	for _, d := range drinks {
+		id := d.ID.Hex()
+		combined = append(combined, DrinkScore{DrinkID: id, Score: combineScores(perGuest, id, strategy)})
+	}
+	sort.SliceStable(combined, func(i, j int) bool { return combined[i].Score > combined[j].Score })
+	picked := RerankDiverse(drinks, combined, opts)
+	if len(picked) == 0 {
+		return &GroupRecommendation{Strategy: strategy, Drinks: []GroupDrinkScore{}, Assignments: []GuestAssignment{}, Items: []models.BookingItem{}}, nil
+	}
+
+	rec := &GroupRecommendation{Strategy: strategy}
+	for _, p := range picked {
+		guestScores := make([]float64, len(guests))
+		for i := range guests {
+			guestScores[i] = perGuest[i][p.DrinkID]
+		}
+		rec.Drinks = append(rec.Drinks, GroupDrinkScore{DrinkID: p.DrinkID, Score: p.Score, GuestScores: guestScores})
+	}
+
+	byID := make(map[string]models.Drink, len(drinks))
+	for _, d := range drinks {
+		byID[d.ID.Hex()] = d
+	}
+	qty := make(map[string]int)
+	var order []string
+	for i, g := range guests {
+		best := rec.Drinks[0]
+		for _, d := range rec.Drinks[1:] {
+			if d.GuestScores[i] > best.GuestScores[i] {
+				best = d
+			}
+		}
+		rec.Assignments = append(rec.Assignments, GuestAssignment{Guest: g.Name, DrinkID: best.DrinkID, Score: best.GuestScores[i]})
+		if qty[best.DrinkID] == 0 {
+			order = append(order, best.DrinkID)
+		}
+		qty[best.DrinkID]++
+	}
+	for _, id := range order {
+		rec.Items = append(rec.Items, models.BookingItem{DrinkID: byID[id].ID, Qty: qty[id], Options: map[string]any{}})
+	}
+	return rec, nil
+}
+
+func combineScores(perGuest []map[string]float64, drinkID, strategy string) float64 {
+	var total float64
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, scores := range perGuest {
+		s := scores[drinkID]
+		total += s
+		lo = math.Min(lo, s)
+		hi = math.Max(hi, s)
+	}
+	var out float64
+	switch strategy {
+	case GroupLeastMisery:
+		out = lo
+	case GroupMostPleasure:
+		out = hi
+	default:
+		out = total / float64(len(perGuest))
+	}
+	return math.Round(out*1000) / 1000
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCombineScores(t *testing.T) {
+	// the first guest loves a and the second hates it; both find b fine
+	perGuest := []map[string]float64{{"a": 0.9, "b": 0.6}, {"a": 0.1, "b": 0.5}}
+	tests := []struct {
+		strategy string
+		a, b     float64
+	}{
+		{GroupAverage, 0.5, 0.55},
+		{GroupLeastMisery, 0.1, 0.5},
+		{GroupMostPleasure, 0.9, 0.6},
+		{"", 0.5, 0.55},
+	}
+	for _, tc := range tests {
+		t.Run(tc.strategy, func(t *testing.T) {
+			a, b := combineScores(perGuest, "a", tc.strategy), combineScores(perGuest, "b", tc.strategy)
+			if a != tc.a || b != tc.b {
+				t.Errorf("combined a, b = %v, %v, want %v, %v", a, b, tc.a, tc.b)
+			}
+		})
+	}
+}
+
+func TestRecommendForGroup(t *testing.T) {
+	drinks := []models.Drink{
+		{ID: primitive.NewObjectID(), Name: "Chamomile", Caffeine: "none", Temp: "hot", Sweetness: 2, Tags: []string{"tea"}, EmotionFit: models.EmotionFit{Calm: 0.9}},
+		{ID: primitive.NewObjectID(), Name: "Espresso tonic", Caffeine: "high", Temp: "iced", Sweetness: 1, Tags: []string{"coffee"}, EmotionFit: models.EmotionFit{Adventurous: 0.9}},
+	}
+	calm := GuestProfile{Name: "An", EmotionFit: models.EmotionFit{Calm: 1}}
+	bold := GuestProfile{Name: "Binh", EmotionFit: models.EmotionFit{Adventurous: 1}}
+	tests := []struct {
+		name     string
+		guests   []GuestProfile
+		strategy string
+		field    string
+		qty      int
+	}{
+		{"no guests", nil, GroupAverage, "guests", 0},
+		{"too many guests", make([]GuestProfile, MaxGroupGuests+1), GroupAverage, "guests", 0},
+		{"unknown strategy", []GuestProfile{calm}, "majority", "strategy", 0},
+		{"default strategy", []GuestProfile{calm, bold}, "", "", 2},
+		{"least misery", []GuestProfile{calm, bold, calm}, GroupLeastMisery, "", 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := RecommendForGroup(drinks, tc.guests, tc.strategy, RerankOptions{})
+			if tc.field != "" {
+				var e *apperr.Error
+				if !errors.As(err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != tc.field {
+					t.Errorf("RecommendForGroup = %v, want an error about %s", err, tc.field)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.strategy == "" && rec.Strategy != GroupAverage {
+				t.Errorf("strategy = %q, want %q", rec.Strategy, GroupAverage)
+			}
+			if len(rec.Assignments) != len(tc.guests) {
+				t.Fatalf("assignments = %+v, want one per guest", rec.Assignments)
+			}
+			qty := 0
+			for _, it := range rec.Items {
+				qty += it.Qty
+			}
+			if qty != tc.qty {
+				t.Errorf("items = %+v, want %d drinks in all", rec.Items, tc.qty)
+			}
+			// each guest gets the drink that suits their mood
+			for i, a := range rec.Assignments {
+				want := drinks[0].ID.Hex()
+				if tc.guests[i].Name == bold.Name {
+					want = drinks[1].ID.Hex()
+				}
+				if a.DrinkID != want {
+					t.Errorf("%s is assigned %s, want %s", a.Guest, a.DrinkID, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// DefaultRecoLimit is the number of drinks returned when the client does not ask for a size.
+	DefaultRecoLimit = 5
+	// MaxRecoLimit caps the requested size so a client cannot ask for the whole menu.
+	MaxRecoLimit = 20
+	// DefaultDiversity trades a little relevance for variety (0 = pure score order).
+	DefaultDiversity = 0.3
+)
+
+// categoryTags lists the tags that identify a drink's style, most specific first,
+// so a coffee cocktail counts as a cocktail rather than a coffee.
+var categoryTags = []string{"cocktail", "wine", "beer", "liqueur", "coffee", "tea", "juice", "smoothie", "yogurt", "cacao"}
+
+// Tags that describe when or how a drink is served rather than what it is.
+var nonStyleTags = map[string]bool{"day": true, "night": true, "hot": true, "iced": true, "cold": true}
+
+// RerankOptions controls how a scored list is cut down to the final top-N.
+type RerankOptions struct {
+	Limit     int             // number of drinks to return; <= 0 means DefaultRecoLimit
+	Diversity float64         // 0 keeps score order, 1 maximises spread across styles
+	Exclude   map[string]bool // drink IDs (hex) that must not be returned
+}
+
+// NewRerankOptions validates client supplied tuning values and fills in defaults.
+func NewRerankOptions(limit int, diversity *float64, exclude map[string]bool) (RerankOptions, error) {
+	opts := RerankOptions{Limit: limit, Diversity: DefaultDiversity, Exclude: exclude}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultRecoLimit
+	}
+	if opts.Limit > MaxRecoLimit {
+		opts.Limit = MaxRecoLimit
+	}
+	if diversity != nil {
+		if *diversity < 0 || *diversity > 1 {
+			return RerankOptions{}, apperr.Invalid("diversity", "must be between 0 and 1")
+		}
+		opts.Diversity = *diversity
+	}
+	return opts, nil
+}
+
+// RerankDiverse picks the top-N drinks from scores using maximal marginal relevance:
+// each pick maximises (1-diversity)*score - diversity*similarity to what is already picked.
+// scores are expected in descending order, as returned by ScoreDrinks.
+func RerankDiverse(drinks []models.Drink, scores []DrinkScore, opts RerankOptions) []DrinkScore {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultRecoLimit
+	}
+
+	byID := make(map[string]models.Drink, len(drinks))
+	for _, d := range drinks {
+		byID[d.ID.Hex()] = d
+	}
+
+	var candidates []DrinkScore
+	for _, s := range scores {
+		if opts.Exclude[s.DrinkID] {
+			continue
+		}
+		if _, ok := byID[s.DrinkID]; !ok {
+			continue
+		}
+		candidates = append(candidates, s)
+	}
+
+	selected := make([]DrinkScore, 0, limit)
+	for len(selected) < limit && len(candidates) > 0 {
+		best, bestMMR := 0, 0.0
+		for i, c := range candidates {
+			maxSim := 0.0
+			for _, s := range selected {
+				if sim := DrinkSimilarity(byID[c.DrinkID], byID[s.DrinkID]); sim > maxSim {
+					maxSim = sim
+				}
+			}
+			mmr := (1-opts.Diversity)*c.Score - opts.Diversity*maxSim
+			// strict comparison keeps the earlier (higher scored) drink on ties
+			if i == 0 || mmr > bestMMR {
+				best, bestMMR = i, mmr
+			}
+		}
+		selected = append(selected, candidates[best])
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+	return selected
+}
+
+// DrinkCategory returns the style bucket of a drink derived from its tags, or "other".
+func DrinkCategory(d models.Drink) string {
+	tags := make(map[string]bool, len(d.Tags))
+	for _, t := range d.Tags {
+		tags[strings.ToLower(t)] = true
+	}
+	for _, c := range categoryTags {
+		if tags[c] {
+			return c
+		}
+	}
+	return "other"
+}
+
+// DrinkSimilarity scores how alike two drinks are in [0,1]: half from sharing a category,
+// half from the Jaccard overlap of their style tags.
+func DrinkSimilarity(a, b models.Drink) float64 {
+	sim := 0.0
+	if DrinkCategory(a) == DrinkCategory(b) {
+		sim += 0.5
+	}
+	return sim + 0.5*jaccard(styleTags(a), styleTags(b))
+}
+
+func styleTags(d models.Drink) map[string]bool {
+	out := make(map[string]bool, len(d.Tags))
+	for _, t := range d.Tags {
+		t = strings.ToLower(t)
+		if !nonStyleTags[t] {
+			out[t] = true
+		}
+	}
+	return out
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for t := range a {
+		if b[t] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+// BookedDrinkIDs returns the drink IDs already ordered in one of userID's bookings so
+// they can be excluded from recommendations. An empty bookingID yields no exclusions;
+// someone else's booking is reported as not found.
+func (s *Bookings) BookedDrinkIDs(ctx context.Context, userID primitive.ObjectID, bookingID string) (map[string]bool, error) {
+	if strings.TrimSpace(bookingID) == "" {
+		return nil, nil
+	}
+	objID, err := primitive.ObjectIDFromHex(bookingID)
+	if err != nil {
+		return nil, apperr.Invalid("excludeBookingId", "is not a valid booking ID")
+	}
+	booking, err := s.repos.Bookings.Get(ctx, objID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperr.New(apperr.NotFound, "booking not found")
+		}
+		return nil, err
+	}
+	if !s.BelongsTo(booking, userID) {
+		return nil, apperr.New(apperr.NotFound, "booking not found")
+	}
+	ids := make(map[string]bool, len(booking.Items))
+	for _, it := range booking.Items {
+		ids[it.DrinkID.Hex()] = true
+	}
+	return ids, nil
+}
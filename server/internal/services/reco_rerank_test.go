@@ -0,0 +1,85 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"leblanc/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRerankDiverse(t *testing.T) {
+	drink := func(name string, tags ...string) models.Drink {
+		return models.Drink{ID: primitive.NewObjectID(), Name: name, Tags: tags}
+	}
+	drinks := []models.Drink{
+		drink("Latte", "coffee", "milk", "hot"),
+		drink("Mocha", "coffee", "chocolate", "hot"),
+		drink("Jasmine tea", "tea", "floral"),
+		drink("Orange juice", "juice", "iced"),
+	}
+	scores := []DrinkScore{
+		{DrinkID: drinks[0].ID.Hex(), Score: 0.9},
+		{DrinkID: drinks[1].ID.Hex(), Score: 0.85},
+		{DrinkID: primitive.NewObjectID().Hex(), Score: 0.8}, // no longer on the menu
+		{DrinkID: drinks[2].ID.Hex(), Score: 0.7},
+		{DrinkID: drinks[3].ID.Hex(), Score: 0.5},
+	}
+	tests := []struct {
+		name string
+		opts RerankOptions
+		want []string
+	}{
+		{"score order", RerankOptions{Limit: 3}, []string{"Latte", "Mocha", "Jasmine tea"}},
+		{"diverse", RerankOptions{Limit: 3, Diversity: 0.5}, []string{"Latte", "Jasmine tea", "Orange juice"}},
+		{"excluded drink", RerankOptions{Limit: 2, Exclude: map[string]bool{drinks[0].ID.Hex(): true}}, []string{"Mocha", "Jasmine tea"}},
+		{"default limit", RerankOptions{}, []string{"Latte", "Mocha", "Jasmine tea", "Orange juice"}},
+		{"all excluded", RerankOptions{Limit: 2, Exclude: map[string]bool{
+			drinks[0].ID.Hex(): true, drinks[1].ID.Hex(): true, drinks[2].ID.Hex(): true, drinks[3].ID.Hex(): true}}, []string{}},
+	}
+	names := make(map[string]string, len(drinks))
+	for _, d := range drinks {
+		names[d.ID.Hex()] = d.Name
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := []string{}
+			for _, s := range RerankDiverse(drinks, scores, tc.opts) {
+				got = append(got, names[s.DrinkID])
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("RerankDiverse = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewRerankOptions(t *testing.T) {
+	ptr := func(f float64) *float64 { return &f }
+	tests := []struct {
+		name      string
+		limit     int
+		diversity *float64
+		wantLimit int
+		wantDiv   float64
+		wantErr   bool
+	}{
+		{"defaults", 0, nil, DefaultRecoLimit, DefaultDiversity, false},
+		{"given", 3, ptr(0), 3, 0, false},
+		{"limit capped", MaxRecoLimit + 1, ptr(1), MaxRecoLimit, 1, false},
+		{"diversity below 0", 3, ptr(-0.1), 0, 0, true},
+		{"diversity above 1", 3, ptr(1.5), 0, 0, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := NewRerankOptions(tc.limit, tc.diversity, nil)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewRerankOptions error = %v, want error %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && (opts.Limit != tc.wantLimit || opts.Diversity != tc.wantDiv) {
+				t.Errorf("NewRerankOptions = %+v, want limit %d and diversity %v", opts, tc.wantLimit, tc.wantDiv)
+			}
+		})
+	}
+}
@@ -3,29 +3,87 @@ package services
 import (
 	"math"
 	"sort"
+	"time"
 
 	"leblanc/server/internal/models"
 )
 
 // payload structures for reco
 type Context struct {
-	TimeOfDay string  `json:"timeOfDay"` // "day"|"night"
-	TempPref  *string `json:"tempPref"`  // optional: "hot"|"iced"
+	TimeOfDay   string     `json:"timeOfDay"`   // "day"|"night"; derived by ResolveContext
+	TempPref    *string    `json:"tempPref"`    // optional: "hot"|"iced"
+	BookingTime *time.Time `json:"bookingTime"` // optional: when the guest will arrive, defaults to now
+	Weather     *Weather   `json:"weather"`     // optional: overrides the configured weather provider
 }
 type RecoPayload struct {
 	Emotion   string  `json:"emotion"`
 	ColorTone string  `json:"colorTone"`
 	Context   Context `json:"context"`
+
+	// optional: free-text mood ("tired after work, want something warm"); ApplyMood
+	// fills Emotion, EmotionFit, Context.TempPref and Sweetness from it when they are empty
+	Mood       string             `json:"mood"`
+	EmotionFit *models.EmotionFit `json:"emotionFit"`
+	Sweetness  int                `json:"sweetness"` // optional: preferred sweetness 1-5
+
+	// reranking: how many drinks to return, how much to favour variety,
+	// and an optional booking whose drinks should not be suggested again
+	Limit            int      `json:"limit"`
+	Diversity        *float64 `json:"diversity"`
+	ExcludeBookingID string   `json:"excludeBookingId"`
+
+	// hard filters, applied before scoring
+	Constraints Constraints `json:"constraints"`
+
+	// optional: who is asking, so served recommendations can be matched to later bookings
+	Email     string `json:"email"`
+	SessionID string `json:"sessionId"`
+}
+
+// Query returns the scorer-independent part of the payload, for event logging.
+func (p RecoPayload) Query() RecoQuery {
+	q := RecoQuery{
+		Emotion:     p.Emotion,
+		ColorTone:   p.ColorTone,
+		EmotionFit:  p.EmotionFit,
+		Sweetness:   p.Sweetness,
+		TimeOfDay:   p.Context.TimeOfDay,
+		Constraints: p.Constraints,
+	}
+	if p.Context.TempPref != nil {
+		q.Temp = *p.Context.TempPref
+	}
+	return q
 }
 
+// LabelWeights weight the parts of the emotion-label scorer (ScoreDrink).
+type LabelWeights = models.LabelWeights
+
+// CosineWeights weight the parts of the cosine-similarity scorer (ScoreDrinks).
+type CosineWeights = models.CosineWeights
+
+var (
+	DefaultLabelWeights  = LabelWeights{Emotion: 0.5, Color: 0.3, Context: 0.2}
+	DefaultCosineWeights = CosineWeights{Emotion: 0.7, Preference: 0.3, Mismatch: 0.5}
+)
+
 func ScoreDrink(d models.Drink, p RecoPayload) float64 {
+	return ScoreDrinkWeighted(d, p, DefaultLabelWeights)
+}
+
+// ScoreDrinkWeighted is ScoreDrink with explicit weights.
+func ScoreDrinkWeighted(d models.Drink, p RecoPayload, w LabelWeights) float64 {
 	// emotion
 	em := map[string]float64{
 		"calm": d.EmotionFit.Calm, "happy": d.EmotionFit.Happy,
 		"stressed": d.EmotionFit.Stressed, "sad": d.EmotionFit.Sad,
 		"adventurous": d.EmotionFit.Adventurous,
 	}
-	sEmotion := em[p.Emotion]
+	emotion := p.Emotion
+	if emotion == "" && p.EmotionFit != nil {
+		emotion = dominantEmotion(*p.EmotionFit)
+	}
+	sEmotion := em[emotion]
 	if sEmotion == 0 { sEmotion = 0.5 }
 
 	// color tone
@@ -40,7 +98,10 @@ func ScoreDrink(d models.Drink, p RecoPayload) float64 {
 	if p.Context.TempPref != nil && (d.Temp == *p.Context.TempPref || d.Temp == "either") {
 		sContext += 0.3
 	}
-	return 0.5*sEmotion + 0.3*sColor + 0.2*sContext
+	if p.Sweetness > 0 && math.Abs(float64(d.Sweetness-p.Sweetness)) <= 1 {
+		sContext += 0.2
+	}
+	return w.Emotion*sEmotion + w.Color*sColor + w.Context*sContext
 }
 
 // DrinkScore represents a drink with its recommendation score
@@ -49,8 +110,14 @@ type DrinkScore struct {
 	Score   float64
 }
 
-// ScoreDrinks scores drinks based on emotion fit and optional preferences
+// ScoreDrinks scores drinks based on emotion fit and optional preferences.
+// The full list is returned in descending order; use RerankDiverse to pick the top-N.
 func ScoreDrinks(drinks []models.Drink, emotionFit models.EmotionFit, caffeine, temp string, sweetness int) []DrinkScore {
+	return ScoreDrinksWeighted(drinks, emotionFit, caffeine, temp, sweetness, DefaultCosineWeights)
+}
+
+// ScoreDrinksWeighted is ScoreDrinks with explicit weights.
+func ScoreDrinksWeighted(drinks []models.Drink, emotionFit models.EmotionFit, caffeine, temp string, sweetness int, w CosineWeights) []DrinkScore {
 	var scores []DrinkScore
 
 	for _, drink := range drinks {
@@ -62,12 +129,12 @@ func ScoreDrinks(drinks []models.Drink, emotionFit models.EmotionFit, caffeine,
 		
 		// Apply caffeine preference if specified
 		if caffeine != "" && drink.Caffeine != caffeine {
-			prefScore *= 0.5
+			prefScore *= w.Mismatch
 		}
 		
 		// Apply temperature preference if specified
 		if temp != "" && drink.Temp != "either" && drink.Temp != temp {
-			prefScore *= 0.5
+			prefScore *= w.Mismatch
 		}
 		
 		// Apply sweetness preference if specified
@@ -81,7 +148,7 @@ func ScoreDrinks(drinks []models.Drink, emotionFit models.EmotionFit, caffeine,
 		}
 		
 		// Combine emotion score and preference score
-		totalScore := emotionScore * 0.7 + prefScore * 0.3
+		totalScore := emotionScore * w.Emotion + prefScore * w.Preference
 		
 		scores = append(scores, DrinkScore{
 			DrinkID: drink.ID.Hex(),
@@ -94,11 +161,6 @@ func ScoreDrinks(drinks []models.Drink, emotionFit models.EmotionFit, caffeine,
 		return scores[i].Score > scores[j].Score
 	})
 	
-	// Return top 5
-	if len(scores) > 5 {
-		scores = scores[:5]
-	}
-	
 	return scores
 }
 
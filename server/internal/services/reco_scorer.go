@@ -0,0 +1,128 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"leblanc/server/internal/models"
+)
+
+// Scorer kinds.
+const (
+	ScorerEmotion = "emotion" // emotion label + colour tone + context (ScoreDrink)
+	ScorerCosine  = "cosine"  // emotion vector cosine similarity + preferences (ScoreDrinks)
+)
+
+// RecoQuery is the scorer-independent input of a recommendation. It is stored with each
+// recommendation event so the request can be replayed against other scorer configurations.
+type RecoQuery struct {
+	Emotion     string             `json:"emotion,omitempty" bson:"emotion,omitempty"`
+	ColorTone   string             `json:"colorTone,omitempty" bson:"colorTone,omitempty"`
+	EmotionFit  *models.EmotionFit `json:"emotionFit,omitempty" bson:"emotionFit,omitempty"`
+	Caffeine    string             `json:"caffeine,omitempty" bson:"caffeine,omitempty"`
+	Temp        string             `json:"temp,omitempty" bson:"temp,omitempty"`
+	Sweetness   int                `json:"sweetness,omitempty" bson:"sweetness,omitempty"`
+	TimeOfDay   string             `json:"timeOfDay,omitempty" bson:"timeOfDay,omitempty"`
+	Constraints Constraints        `json:"constraints" bson:"constraints"`
+}
+
+// ScorerConfig names a scorer and its tuning; zero fields fall back to the defaults.
+// Experiments store it as models.ScorerConfig.
+type ScorerConfig models.ScorerConfig
+
+func (c ScorerConfig) Validate() error {
+	if c.Scorer != ScorerEmotion && c.Scorer != ScorerCosine {
+		return fmt.Errorf("scorer %q: must be %s or %s", c.Name, ScorerEmotion, ScorerCosine)
+	}
+	if c.Diversity != nil && (*c.Diversity < 0 || *c.Diversity > 1) {
+		return fmt.Errorf("scorer %q: diversity must be between 0 and 1", c.Name)
+	}
+	return nil
+}
+
+// Score returns every drink's score for q under this configuration, best first.
+func (c ScorerConfig) Score(drinks []models.Drink, q RecoQuery) []DrinkScore {
+	if c.Scorer == ScorerCosine {
+		w := DefaultCosineWeights
+		if c.CosineWeights != nil {
+			w = *c.CosineWeights
+		}
+		return ScoreDrinksWeighted(drinks, q.emotionVector(), q.Caffeine, q.Temp, q.Sweetness, w)
+	}
+
+	w := DefaultLabelWeights
+	if c.LabelWeights != nil {
+		w = *c.LabelWeights
+	}
+	p := q.Payload()
+	scores := make([]DrinkScore, 0, len(drinks))
+	for _, d := range drinks {
+		scores = append(scores, DrinkScore{DrinkID: d.ID.Hex(), Score: ScoreDrinkWeighted(d, p, w)})
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+	return scores
+}
+
+// Rank replays q: it keeps the drinks that were on the menu and within the constraints,
+// scores them and returns a diversity-reranked top-limit.
+func (c ScorerConfig) Rank(drinks []models.Drink, q RecoQuery, limit int) []DrinkScore {
+	if q.TimeOfDay != "" {
+		drinks = FilterAvailable(drinks, q.TimeOfDay)
+	}
+	drinks, _ = ApplyConstraints(drinks, q.Constraints)
+	opts, err := NewRerankOptions(limit, c.Diversity, nil)
+	if err != nil {
+		opts, _ = NewRerankOptions(limit, nil, nil)
+	}
+	return RerankDiverse(drinks, c.Score(drinks, q), opts)
+}
+
+// Payload converts q to the emotion-label scorer's input. Queries that only carry an
+// emotion vector use its strongest dimension as the label.
+func (q RecoQuery) Payload() RecoPayload {
+	p := RecoPayload{Emotion: q.Emotion, ColorTone: q.ColorTone, Sweetness: q.Sweetness, Constraints: q.Constraints}
+	if p.Emotion == "" && q.EmotionFit != nil {
+		p.Emotion = dominantEmotion(*q.EmotionFit)
+	}
+	p.Context.TimeOfDay = q.TimeOfDay
+	if q.Temp != "" {
+		temp := q.Temp
+		p.Context.TempPref = &temp
+	}
+	return p
+}
+
+// emotionVector converts q to the cosine scorer's input. Label-only queries become a
+// vector leaning on that label.
+func (q RecoQuery) emotionVector() models.EmotionFit {
+	if q.EmotionFit != nil {
+		return *q.EmotionFit
+	}
+	ef := models.EmotionFit{Calm: 0.2, Happy: 0.2, Stressed: 0.2, Sad: 0.2, Adventurous: 0.2}
+	switch q.Emotion {
+	case "calm":
+		ef.Calm = 1
+	case "happy":
+		ef.Happy = 1
+	case "stressed":
+		ef.Stressed = 1
+	case "sad":
+		ef.Sad = 1
+	case "adventurous":
+		ef.Adventurous = 1
+	}
+	return ef
+}
+
+func dominantEmotion(ef models.EmotionFit) string {
+	best, label := ef.Calm, "calm"
+	for _, e := range []struct {
+		name string
+		v    float64
+	}{{"happy", ef.Happy}, {"stressed", ef.Stressed}, {"sad", ef.Sad}, {"adventurous", ef.Adventurous}} {
+		if e.v > best {
+			best, label = e.v, e.name
+		}
+	}
+	return label
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Review limits. Pages default to DefaultReviewPage reviews.
+const (
+	MaxReviewComment  = 1000
+	DefaultReviewPage = 10
+	MaxReviewPage     = 50
+)
+
+var (
+	errReviewNotFound = apperr.New(apperr.NotFound, "review not found")
+	errDrinkNotFound  = apperr.New(apperr.NotFound, "drink not found")
+	errNotOrdered     = apperr.New(apperr.FailedPrecondition, "you can review drinks from your completed bookings")
+)
+
+// Reviews takes ratings from guests who had the drink, moderates them and keeps each
+// drink's rating up to date.
+type Reviews struct {
+	repos repository.Repositories
+}
+
+func NewReviews(repos repository.Repositories) *Reviews {
+	return &Reviews{repos: repos}
+}
+
+// ReviewInput is a rating from 1 to 5 with an optional comment.
+type ReviewInput struct {
+	Rating  int    `json:"rating"`
+	Comment string `json:"comment"`
+}
+
+// Write stores userID's review of drinkID, replacing their earlier one. The user must
+// have had the drink on a completed booking. A rating alone is published straight away;
+// one with a comment waits for moderation.
+func (s *Reviews) Write(ctx context.Context, userID, drinkID primitive.ObjectID, in ReviewInput) (*models.Review, error) {
+	in.Comment = strings.TrimSpace(in.Comment)
+	if in.Rating < 1 || in.Rating > 5 {
+		return nil, apperr.Invalid("rating", "must be between 1 and 5")
+	}
+	if utf8.RuneCountInString(in.Comment) > MaxReviewComment {
+		return nil, apperr.Invalid("comment", fmt.Sprintf("must be at most %d characters", MaxReviewComment))
+	}
+	user, err := s.repos.Users.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, apperr.New(apperr.Unauthenticated, "log in to continue")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.Verified {
+		return nil, ErrEmailNotVerified
+	}
+	if _, err := s.repos.Drinks.Get(ctx, drinkID); errors.Is(err, repository.ErrNotFound) {
+		return nil, errDrinkNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	booking, err := s.orderedIn(ctx, userID, drinkID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rv := &models.Review{
+		DrinkID:   drinkID,
+		UserID:    userID,
+		BookingID: booking,
+		Author:    user.Name,
+		Rating:    in.Rating,
+		Comment:   in.Comment,
+		Status:    models.ReviewApproved,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if rv.Comment != "" {
+		rv.Status = models.ReviewPending
+	}
+	prev, err := s.repos.Reviews.Save(ctx, rv)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recount(ctx, drinkID, prev, rv); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// orderedIn returns the user's latest completed booking that had the drink.
+func (s *Reviews) orderedIn(ctx context.Context, userID primitive.ObjectID, drinkID primitive.ObjectID) (primitive.ObjectID, error) {
+	bookings, err := s.repos.Bookings.FindByUser(ctx, userID)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	var found *models.Booking
+	for i, b := range bookings {
+		if b.Status != models.BookingCompleted || found != nil && !b.Time.After(found.Time) {
+			continue
+		}
+		for _, it := range b.Items {
+			if it.DrinkID == drinkID {
+				found = &bookings[i]
+				break
+			}
+		}
+	}
+	if found == nil {
+		return primitive.NilObjectID, errNotOrdered
+	}
+	return found.ID, nil
+}
+
+// Moderate approves or rejects a review; note tells the author why it was rejected.
+func (s *Reviews) Moderate(ctx context.Context, id primitive.ObjectID, status, note string) (*models.Review, error) {
+	if status != models.ReviewApproved && status != models.ReviewRejected {
+		return nil, apperr.Invalid("status", "must be approved or rejected")
+	}
+	note = strings.TrimSpace(note)
+	if status == models.ReviewApproved {
+		note = ""
+	}
+	now := time.Now()
+	prev, err := s.repos.Reviews.SetStatus(ctx, id, status, note, now)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return nil, errReviewNotFound
+	case errors.Is(err, repository.ErrConflict):
+		return nil, apperr.New(apperr.FailedPrecondition, "the review is already "+status)
+	case err != nil:
+		return nil, err
+	}
+	rv := *prev
+	rv.Status, rv.Note, rv.ModeratedAt = status, note, &now
+	if err := s.recount(ctx, rv.DrinkID, prev, &rv); err != nil {
+		return nil, err
+	}
+	return &rv, nil
+}
+
+// Delete removes a review; only its author or an admin may.
+func (s *Reviews) Delete(ctx context.Context, id, userID primitive.ObjectID, admin bool) error {
+	rv, err := s.repos.Reviews.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) || err == nil && !admin && rv.UserID != userID {
+		return errReviewNotFound
+	}
+	if err != nil {
+		return err
+	}
+	prev, err := s.repos.Reviews.Delete(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		// deleted by a concurrent request, which recounted
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.recount(ctx, prev.DrinkID, prev, nil)
+}
+
+// recount moves the drink's rating from counting before to counting after, either of
+// which may be nil.
+func (s *Reviews) recount(ctx context.Context, drinkID primitive.ObjectID, before, after *models.Review) error {
+	sum, count := 0, 0
+	if before.Counted() {
+		sum, count = sum-before.Rating, count-1
+	}
+	if after.Counted() {
+		sum, count = sum+after.Rating, count+1
+	}
+	if sum == 0 && count == 0 {
+		return nil
+	}
+	return s.repos.Drinks.AddRating(ctx, drinkID, sum, count)
+}
+
+// Recount recomputes every drink's rating from its approved reviews and returns how many
+// drinks it corrected. Running it again changes nothing, so it is safe to repeat after a
+// review was stored but its rating update failed. A review moderated while it runs can
+// be missed until the next run.
+func (s *Reviews) Recount(ctx context.Context) (int, error) {
+	totals, err := s.repos.Reviews.RatingTotals(ctx)
+	if err != nil {
+		return 0, err
+	}
+	drinks, err := s.repos.Drinks.ListAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	fixed := 0
+	for _, d := range drinks {
+		t := totals[d.ID]
+		if d.RatingSum == t.Sum && d.RatingCount == t.Count {
+			continue
+		}
+		slog.WarnContext(ctx, "drink rating recounted", "drink", d.ID.Hex(), "sum", t.Sum, "count", t.Count, "was", d.RatingCount)
+		if err := s.repos.Drinks.SetRating(ctx, d.ID, t.Sum, t.Count); err != nil {
+			return fixed, err
+		}
+		fixed++
+	}
+	return fixed, nil
+}
+
+// ReviewPage is one page of reviews; Next is the cursor of the following page, empty
+// on the last one.
+type ReviewPage[T any] struct {
+	Reviews []T    `json:"reviews"`
+	Next    string `json:"next,omitempty"`
+}
+
+// ForDrink returns a page of the drink's approved reviews, newest first.
+func (s *Reviews) ForDrink(ctx context.Context, drinkID primitive.ObjectID, first int, after string) (*ReviewPage[models.PublicReview], error) {
+	first, cursor, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.repos.Reviews.ByDrink(ctx, drinkID, cursor, first+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &ReviewPage[models.PublicReview]{}
+	if len(list) > first {
+		list, page.Next = list[:first], list[first-1].ID.Hex()
+	}
+	page.Reviews = make([]models.PublicReview, len(list))
+	for i, rv := range list {
+		page.Reviews[i] = rv.Public()
+	}
+	return page, nil
+}
+
+// Queue returns a page of reviews with the status, pending by default, oldest first.
+func (s *Reviews) Queue(ctx context.Context, status string, first int, after string) (*ReviewPage[models.Review], error) {
+	switch status {
+	case "":
+		status = models.ReviewPending
+	case models.ReviewPending, models.ReviewApproved, models.ReviewRejected:
+	default:
+		return nil, apperr.Invalid("status", "must be pending, approved or rejected")
+	}
+	first, cursor, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.repos.Reviews.ByStatus(ctx, status, cursor, first+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &ReviewPage[models.Review]{Reviews: list}
+	if len(list) > first {
+		page.Reviews, page.Next = list[:first], list[first-1].ID.Hex()
+	}
+	return page, nil
+}
+
+func pageArgs(first int, after string) (int, primitive.ObjectID, error) {
+	if first == 0 {
+		first = DefaultReviewPage
+	}
+	if first < 1 || first > MaxReviewPage {
+		return 0, primitive.NilObjectID, apperr.Invalid("first", fmt.Sprintf("must be between 1 and %d", MaxReviewPage))
+	}
+	if after == "" {
+		return first, primitive.NilObjectID, nil
+	}
+	cursor, err := primitive.ObjectIDFromHex(after)
+	if err != nil {
+		return 0, primitive.NilObjectID, apperr.Invalid("after", "is not a valid cursor")
+	}
+	return first, cursor, nil
+}
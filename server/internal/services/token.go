@@ -6,79 +6,93 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
-	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"leblanc/server/internal/apperr"
+	"leblanc/server/internal/config"
 )
 
-var (
-	tokenSecret []byte
-	tokenTTL    time.Duration
-	regTTL      time.Duration
+// Token kinds. Each kind is signed with its own key derived from the secret, so a token
+// of one kind never verifies as another whatever its payload.
+const (
+	tokenVerification = "verification"
+	tokenRegistration = "registration"
+	tokenSession      = "session"
 )
 
-func init() {
-	secret := os.Getenv("TOKEN_SECRET")
-	if secret == "" {
-		secret = "change-me-token-secret"
-	}
-	tokenSecret = []byte(secret)
+// Tokens signs and verifies the HMAC tokens used for email verification, registration
+// and login sessions.
+type Tokens struct {
+	keys            map[string][]byte
+	verificationTTL time.Duration
+	registrationTTL time.Duration
+	sessionTTL      time.Duration
+}
 
-	ttlMinutes := 30
-	if v := os.Getenv("VERIFICATION_TTL_MIN"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			ttlMinutes = n
-		}
+func NewTokens(cfg config.TokenConfig) *Tokens {
+	keys := make(map[string][]byte)
+	for _, kind := range []string{tokenVerification, tokenRegistration, tokenSession} {
+		keys[kind] = deriveKey(cfg.Secret, kind)
 	}
-	tokenTTL = time.Duration(ttlMinutes) * time.Minute
-
-	regTTLMinutes := 60
-	if v := os.Getenv("REGISTRATION_TTL_MIN"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			regTTLMinutes = n
-		}
+	return &Tokens{
+		keys:            keys,
+		verificationTTL: cfg.VerificationTTL,
+		registrationTTL: cfg.RegistrationTTL,
+		sessionTTL:      cfg.SessionTTL,
 	}
-	regTTL = time.Duration(regTTLMinutes) * time.Minute
+}
+
+// PaymentsKey is the key the fake payment provider signs its callbacks with. It is
+// derived from the token secret like the token keys, so a callback signature is never
+// an HMAC made with the secret itself.
+func PaymentsKey(secret string) []byte {
+	return deriveKey(secret, "payments")
+}
+
+func deriveKey(secret, kind string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte("leblanc token key: " + kind))
+	return h.Sum(nil)
 }
 
 // GenerateVerificationToken creates a HMAC-SHA256 signed token that encodes the email and expiry.
-func GenerateVerificationToken(email string) (token string, expiresAt time.Time) {
-	expiresAt = time.Now().Add(tokenTTL)
+func (t *Tokens) GenerateVerificationToken(email string) (token string, expiresAt time.Time) {
+	expiresAt = time.Now().Add(t.verificationTTL)
 	payload := email + "|" + strconv.FormatInt(expiresAt.Unix(), 10)
-	sig := signPayload(payload)
+	sig := t.signPayload(tokenVerification, payload)
 	raw := payload + "|" + sig
 	token = base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(raw))
 	return token, expiresAt
 }
 
 // VerifyToken validates signature and expiry, returning the embedded email.
-func VerifyToken(token string) (string, error) {
+func (t *Tokens) VerifyToken(token string) (string, error) {
 	if token == "" {
-		return "", errors.New("missing token")
+		return "", invalidToken("missing token")
 	}
 	decoded, err := base64.URLEncoding.WithPadding(base64.NoPadding).DecodeString(token)
 	if err != nil {
-		return "", errors.New("invalid token encoding")
+		return "", invalidToken("invalid token encoding")
 	}
 	parts := strings.Split(string(decoded), "|")
 	if len(parts) != 3 {
-		return "", errors.New("invalid token structure")
+		return "", invalidToken("invalid token structure")
 	}
 	email := parts[0]
 	expUnix, err := strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
-		return "", errors.New("invalid expiry")
+		return "", invalidToken("invalid expiry")
 	}
 	expiresAt := time.Unix(expUnix, 0)
 	if time.Now().After(expiresAt) {
-		return "", errors.New("token expired")
+		return "", invalidToken("token expired")
 	}
 	payload := parts[0] + "|" + parts[1]
-	expectedSig := signPayload(payload)
+	expectedSig := t.signPayload(tokenVerification, payload)
 	if !hmac.Equal([]byte(expectedSig), []byte(parts[2])) {
-		return "", errors.New("invalid signature")
+		return "", invalidToken("invalid signature")
 	}
 	return email, nil
 }
@@ -92,55 +106,97 @@ type RegistrationClaims struct {
 }
 
 // GenerateRegistrationToken signs registration claims (name/email/password hash/role) with expiry.
-func GenerateRegistrationToken(claims RegistrationClaims) (token string, expiresAt time.Time, err error) {
-	expiresAt = time.Now().Add(regTTL)
+func (t *Tokens) GenerateRegistrationToken(claims RegistrationClaims) (token string, expiresAt time.Time, err error) {
+	expiresAt = time.Now().Add(t.registrationTTL)
 	claims.Exp = expiresAt.Unix()
 	b, err := json.Marshal(claims)
 	if err != nil {
 		return "", time.Time{}, err
 	}
 	payload := base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(b)
-	sig := signPayload(payload)
+	sig := t.signPayload(tokenRegistration, payload)
 	raw := payload + "|" + sig
 	token = base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(raw))
 	return token, expiresAt, nil
 }
 
 // VerifyRegistrationToken validates signature/expiry and returns claims.
-func VerifyRegistrationToken(token string) (*RegistrationClaims, error) {
+func (t *Tokens) VerifyRegistrationToken(token string) (*RegistrationClaims, error) {
 	if token == "" {
-		return nil, errors.New("missing token")
+		return nil, invalidToken("missing token")
 	}
 	decoded, err := base64.URLEncoding.WithPadding(base64.NoPadding).DecodeString(token)
 	if err != nil {
-		return nil, errors.New("invalid token encoding")
+		return nil, invalidToken("invalid token encoding")
 	}
 	parts := strings.Split(string(decoded), "|")
 	if len(parts) != 2 {
-		return nil, errors.New("invalid token structure")
+		return nil, invalidToken("invalid token structure")
 	}
 	payload := parts[0]
 	sig := parts[1]
-	expectedSig := signPayload(payload)
+	expectedSig := t.signPayload(tokenRegistration, payload)
 	if !hmac.Equal([]byte(expectedSig), []byte(sig)) {
-		return nil, errors.New("invalid signature")
+		return nil, invalidToken("invalid signature")
 	}
 	payloadBytes, err := base64.URLEncoding.WithPadding(base64.NoPadding).DecodeString(payload)
 	if err != nil {
-		return nil, errors.New("invalid payload encoding")
+		return nil, invalidToken("invalid payload encoding")
 	}
 	var claims RegistrationClaims
 	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
-		return nil, errors.New("invalid claims")
+		return nil, invalidToken("invalid claims")
 	}
 	if claims.Exp == 0 || time.Now().After(time.Unix(claims.Exp, 0)) {
-		return nil, errors.New("token expired")
+		return nil, invalidToken("token expired")
 	}
 	return &claims, nil
 }
 
-func signPayload(payload string) string {
-	h := hmac.New(sha256.New, tokenSecret)
+// Session is who a session token was issued to.
+type Session struct {
+	UserID string
+	Role   string
+}
+
+// GenerateSessionToken signs a login session for the user, sent back as a bearer token.
+func (t *Tokens) GenerateSessionToken(s Session) (token string, expiresAt time.Time) {
+	expiresAt = time.Now().Add(t.sessionTTL)
+	payload := strings.Join([]string{tokenSession, s.UserID, s.Role, strconv.FormatInt(expiresAt.Unix(), 10)}, "|")
+	raw := payload + "|" + t.signPayload(tokenSession, payload)
+	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(raw)), expiresAt
+}
+
+// VerifySessionToken validates signature and expiry and returns the session.
+func (t *Tokens) VerifySessionToken(token string) (*Session, error) {
+	decoded, err := base64.URLEncoding.WithPadding(base64.NoPadding).DecodeString(token)
+	if err != nil {
+		return nil, invalidToken("invalid token encoding")
+	}
+	parts := strings.Split(string(decoded), "|")
+	if len(parts) != 5 || parts[0] != tokenSession {
+		return nil, invalidToken("invalid token structure")
+	}
+	payload := strings.Join(parts[:4], "|")
+	if !hmac.Equal([]byte(t.signPayload(tokenSession, payload)), []byte(parts[4])) {
+		return nil, invalidToken("invalid signature")
+	}
+	exp, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return nil, invalidToken("invalid expiry")
+	}
+	if time.Now().After(time.Unix(exp, 0)) {
+		return nil, invalidToken("session expired, log in again")
+	}
+	return &Session{UserID: parts[1], Role: parts[2]}, nil
+}
+
+func invalidToken(reason string) error {
+	return apperr.New(apperr.InvalidToken, reason)
+}
+
+func (t *Tokens) signPayload(kind, payload string) string {
+	h := hmac.New(sha256.New, t.keys[kind])
 	h.Write([]byte(payload))
 	return hex.EncodeToString(h.Sum(nil))
 }
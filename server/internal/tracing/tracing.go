@@ -0,0 +1,102 @@
+// Package tracing sets up OpenTelemetry tracing: a span per HTTP request (otelgin), per
+// GraphQL operation and resolver, and per Mongo command (otelmongo). Spans follow the
+// request context, so handlers and resolvers must pass c.Request.Context() down.
+//
+// Incoming W3C traceparent headers are honoured, so a trace started by a proxy or the
+// frontend continues through the API.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"leblanc/server/internal/config"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "leblanc/server"
+
+// Setup installs the global tracer provider and propagator. The returned function flushes
+// and stops the exporter; call it on shutdown. With exporter "none" spans are still
+// created (and carry trace IDs into the logs) but nothing is exported.
+func Setup(ctx context.Context, cfg config.TracingConfig, env string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.DeploymentEnvironment(env),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing resource: %w", err)
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+
+	switch cfg.Exporter {
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("stdout exporter: %w", err)
+		}
+		// synchronous so spans appear as requests finish
+		opts = append(opts, sdktrace.WithSyncer(exp))
+	case "otlp":
+		exp, err := otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpointURL(cfg.Endpoint),
+			otlptracehttp.WithHeaders(cfg.Headers),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("otlp exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Traced reports whether a request gets a span; probes and scrapes do not.
+func Traced(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
+
+// Start starts a span named name as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// MongoMonitor returns the driver monitor that opens a span per command. Statements are
+// left out of the spans: they can contain emails and phone numbers.
+func MongoMonitor() *event.CommandMonitor {
+	return otelmongo.NewMonitor(otelmongo.WithCommandAttributeDisabled(true))
+}
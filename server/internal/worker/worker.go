@@ -0,0 +1,68 @@
+// Package worker runs background jobs that must stop cleanly on shutdown.
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Group owns a set of background workers sharing one cancellable context.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{ctx: ctx, cancel: cancel}
+}
+
+// Go starts fn in its own goroutine. fn must return soon after ctx is cancelled.
+func (g *Group) Go(name string, fn func(ctx context.Context)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("worker panicked", "worker", name, "panic", r)
+			}
+		}()
+		fn(g.ctx)
+	}()
+}
+
+// Every starts a worker that calls fn every interval until shutdown. A run in progress
+// when shutdown starts sees ctx cancelled and should wrap up.
+func (g *Group) Every(name string, interval time.Duration, fn func(ctx context.Context)) {
+	g.Go(name, func(ctx context.Context) {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				fn(ctx)
+			}
+		}
+	})
+}
+
+// Shutdown cancels the workers and waits for them to return, or for ctx to expire.
+func (g *Group) Shutdown(ctx context.Context) error {
+	g.cancel()
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
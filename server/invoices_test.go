@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// completedBooking stores a completed booking for email, made while logged in as
+// userID unless it is nil.
+func completedBooking(t *testing.T, s *testServer, email string, userID *primitive.ObjectID) *models.Booking {
+	t.Helper()
+	b := &models.Booking{Email: email, Name: "Guest", Phone: "0901234567", Time: time.Now(), Channel: "web",
+		UserID: userID, Status: models.BookingCompleted, Subtotal: 45000, Total: 45000,
+		Items: []models.BookingItem{{DrinkID: primitive.NewObjectID(), Qty: 1, Name: "Latte", Price: 45000}}}
+	if err := s.repos.Bookings.Insert(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestInvoiceOwnership checks that only the user who booked while logged in gets an
+// invoice: a verified account with the booking's email is not proof, as anyone can
+// verify an address while verification is not mailed.
+func TestInvoiceOwnership(t *testing.T) {
+	s := newTestServer(t)
+	owner, ownerToken := s.login("owner", "")
+	_, guestToken := s.login("guest", "")
+	_, admin := s.login("boss", "admin")
+
+	mine := completedBooking(t, s, "someone@example.com", &owner.ID)
+	anonymous := completedBooking(t, s, "guest@example.com", nil)
+
+	var inv models.Invoice
+	path := "/bookings/" + mine.ID.Hex() + "/invoices"
+	if code := s.do(ownerToken, http.MethodPost, path, nil, &inv); code != http.StatusOK || inv.Code != "LB01-R-0000001" {
+		t.Fatalf("POST %s as the owner = %d, %+v", path, code, inv)
+	}
+	if code := s.do(guestToken, http.MethodPost, path, nil, nil); code != http.StatusNotFound {
+		t.Errorf("POST %s as another user = %d, want 404", path, code)
+	}
+	if code := s.do(ownerToken, http.MethodGet, "/invoices/"+inv.ID.Hex()+"?format=json", nil, nil); code != http.StatusOK {
+		t.Errorf("GET invoice as the owner = %d", code)
+	}
+	if code := s.do(guestToken, http.MethodGet, "/invoices/"+inv.ID.Hex()+"?format=json", nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET invoice as another user = %d, want 404", code)
+	}
+
+	path = "/bookings/" + anonymous.ID.Hex() + "/invoices"
+	if code := s.do(guestToken, http.MethodPost, path, nil, nil); code != http.StatusNotFound {
+		t.Errorf("POST %s as the verified account with the booking email = %d, want 404", path, code)
+	}
+	if code := s.do(admin, http.MethodPost, path, nil, &inv); code != http.StatusOK || inv.Number != 2 {
+		t.Errorf("POST %s as admin = %d, %+v", path, code, inv)
+	}
+}
+
+// TestInvoiceNumbering issues invoices concurrently on two branches and checks each
+// numbers its own from 1 without gaps, and that asking again returns the same invoice.
+func TestInvoiceNumbering(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	branches := map[string]int{"LB01": 12, "LB02": 5}
+
+	var mu sync.Mutex
+	numbers := map[string][]int{}
+	var wg sync.WaitGroup
+	for branch, n := range branches {
+		invoices := services.NewInvoices(s.repos, config.InvoiceConfig{Branch: branch, VATPercent: 8}, nil, time.UTC)
+		for i := 0; i < n; i++ {
+			b := completedBooking(t, s, fmt.Sprintf("%s-%d@example.com", branch, i), nil)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				inv, err := invoices.Issue(ctx, b, services.InvoiceRequest{})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				again, err := invoices.Issue(ctx, b, services.InvoiceRequest{})
+				if err != nil || again.ID != inv.ID {
+					t.Errorf("issuing twice gave %+v, %v; want %s again", again, err, inv.Code)
+				}
+				mu.Lock()
+				numbers[branch] = append(numbers[branch], inv.Number)
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+
+	for branch, n := range branches {
+		seen := make([]bool, n+1)
+		for _, num := range numbers[branch] {
+			if num < 1 || num > n || seen[num] {
+				t.Fatalf("branch %s numbers = %v, want 1..%d once each", branch, numbers[branch], n)
+			}
+			seen[num] = true
+		}
+		if len(numbers[branch]) != n {
+			t.Fatalf("branch %s issued %d invoices, want %d", branch, len(numbers[branch]), n)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/repository"
+	"leblanc/server/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestLoyaltyOncePerBooking earns, redeems and refunds twice for the same bookings and
+// checks only the first of each reaches the balance.
+func TestLoyaltyOncePerBooking(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemory().Loyalty
+	loyalty := services.NewLoyalty(repo, config.LoyaltyConfig{
+		Enabled: true, EarnPoints: 1, EarnPerVND: 10000, PointValueVND: 1000, MinRedeem: 5,
+		StampCards: map[string]int{"coffee": 3},
+	})
+	userID := primitive.NewObjectID()
+	balance := func(points, stamps, rewards int) {
+		t.Helper()
+		a, err := repo.Account(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Points != points || a.Stamps["coffee"] != stamps || a.Rewards["coffee"] != rewards {
+			t.Fatalf("account = %d points, %d stamps, %d rewards; want %d, %d, %d",
+				a.Points, a.Stamps["coffee"], a.Rewards["coffee"], points, stamps, rewards)
+		}
+	}
+
+	latte := models.Drink{ID: primitive.NewObjectID(), Name: "Latte", Price: 50000, Tags: []string{"coffee"}}
+	lines := []services.PricedItem{{Drink: latte, Qty: 4}}
+	completed := &models.Booking{ID: primitive.NewObjectID(), UserID: &userID, Subtotal: 200000, Total: 200000}
+	for range 2 {
+		if err := loyalty.Earn(ctx, userID, completed, lines); err != nil {
+			t.Fatal(err)
+		}
+	}
+	balance(20, 1, 1)
+
+	next := primitive.NewObjectID()
+	redemption, err := loyalty.Redeem(ctx, userID, next, services.RedeemRequest{Points: 10}, lines, 200000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loyalty.Redeem(ctx, userID, next, services.RedeemRequest{Points: 10}, lines, 200000); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("redeeming twice for one booking = %v, want ErrDuplicate", err)
+	}
+	balance(10, 1, 1)
+
+	cancelled := &models.Booking{ID: next, UserID: &userID, Redemption: redemption}
+	for range 2 {
+		if err := loyalty.Refund(ctx, cancelled); err != nil {
+			t.Fatal(err)
+		}
+	}
+	balance(20, 1, 1)
+}
+
+// TestLoyaltyOnlyForLoggedInBookings completes a walk-in booking made with a verified
+// user's email and one they made while logged in, and checks only the second earns.
+func TestLoyaltyOnlyForLoggedInBookings(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	rules := config.LoyaltyConfig{Enabled: true, EarnPoints: 1, EarnPerVND: 10000, PointValueVND: 100, MinRedeem: 50}
+	bookings := services.NewBookings(repos,
+		services.NewLoyalty(repos.Loyalty, rules),
+		services.NewPromotions(repos.Promotions, time.UTC),
+		services.NewGiftCards(repos.GiftCards),
+		services.NewPayments(repos.Payments, nil, config.PaymentConfig{}))
+
+	u := &models.User{Name: "regular", NameLower: "regular", Email: "regular@example.com", EmailLower: "regular@example.com", Verified: true}
+	if err := repos.Users.Insert(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	latte := models.Drink{Name: "Latte", Price: 50000}
+	if err := repos.Drinks.Save(ctx, &latte); err != nil {
+		t.Fatal(err)
+	}
+	points := func() int {
+		t.Helper()
+		a, err := repos.Loyalty.Account(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a.Points
+	}
+	for _, owner := range []*primitive.ObjectID{nil, &u.ID} {
+		b := &models.Booking{Email: u.Email, Name: "Regular", Phone: "0901234567", Time: time.Now(), Channel: "web",
+			UserID: owner, Subtotal: 100000, Total: 100000, Items: []models.BookingItem{{DrinkID: latte.ID, Qty: 2}}}
+		if err := repos.Bookings.Insert(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bookings.Complete(ctx, b.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := points(); got != 10 {
+		t.Errorf("points = %d, want 10 from the logged-in booking only", got)
+	}
+}
@@ -1,59 +1,225 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"leblanc/server/internal/auth"
+	"leblanc/server/internal/config"
 	"leblanc/server/internal/db"
 	"leblanc/server/internal/graph"
 	"leblanc/server/internal/handlers"
+	"leblanc/server/internal/health"
+	"leblanc/server/internal/logging"
+	"leblanc/server/internal/metrics"
+	"leblanc/server/internal/openapi"
+	"leblanc/server/internal/ratelimit"
+	"leblanc/server/internal/repository"
 	"leblanc/server/internal/services"
+	"leblanc/server/internal/tracing"
+	"leblanc/server/internal/worker"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
-	_ = godotenv.Load()
-	db.Init()
-	services.EnsureAdminUser()
+	configPath := flag.String("config", "", "optional JSON config file (defaults to CONFIG_FILE)")
+	printConfig := flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	flag.Parse()
 
-	r := gin.Default()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	if *printConfig {
+		_ = cfg.WriteRedacted(os.Stdout)
+		return
+	}
+	logging.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	slog.Info("config loaded", "config", cfg)
+	if !cfg.IsDev() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing, cfg.Env)
+	if err != nil {
+		slog.Error("tracing setup failed", "error", err)
+		os.Exit(1)
+	}
+
+	db.Init(cfg.Mongo)
+	repos := repository.NewMongo(db.DB)
+	services.EnsureAdminUser(repos.Users, cfg.Admin)
+	h := handlers.New(cfg, repos)
+	checker := health.New(health.MongoPing(db.Client), health.Migrated(db.DB))
+	workers := worker.NewGroup()
+	workers.Every("deposit-expiry", time.Minute, h.ExpireDeposits)
+
+	r := gin.New()
+	r.TrustedPlatform = cfg.HTTP.ClientIPHeader
+	if err := r.SetTrustedProxies(cfg.HTTP.TrustedProxies); err != nil {
+		slog.Error("invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(tracing.Traced)))
+	r.Use(logging.AssignRequestID(), logging.AccessLog(), logging.Recovery(), metrics.Middleware())
 
 	// Configure CORS to allow requests from frontend
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:5173", "http://127.0.0.1:3000", "http://127.0.0.1:5173", "https://le-blanc-web.vercel.app"},
+		AllowOrigins:     cfg.CORS.AllowOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Content-Type", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "X-Requested-With", logging.RequestIDHeader},
+		ExposeHeaders:    append([]string{"Content-Type", "Authorization", logging.RequestIDHeader}, ratelimit.Headers...),
 		AllowCredentials: true,
 		MaxAge:           3600,
 	}))
+	// identify the user first so rate limits can key on them
+	r.Use(auth.Middleware(services.NewTokens(cfg.Tokens)))
+	if cfg.Limits.Enabled {
+		r.Use(rateLimiter(cfg.Limits).Middleware())
+	}
+
+	if cfg.HTTP.ValidateOpenAPI {
+		r.Use(openAPIValidator())
+	}
+	registerRoutes(r, cfg, h, graph.Handler(cfg, repos), checker)
+
+	port := cfg.Port
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("listen failed", "addr", srv.Addr, "error", err)
+			os.Exit(1)
+		}
+	}()
+	slog.Info("server listening", "addr", srv.Addr, "rest", "http://localhost:"+port, "graphql", "http://localhost:"+port+"/graphql")
+
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+	cancel()
+	shutdown(srv, checker, workers, stopTracing, cfg.ShutdownTimeout)
+}
 
+// registerRoutes mounts every endpoint. Each one must be described in
+// internal/openapi/openapi.json; TestRoutesDocumented checks.
+func registerRoutes(r *gin.Engine, cfg *config.Config, h *handlers.Handler, gql gin.HandlerFunc, checker *health.Checker) {
 	// REST API endpoints
 	r.GET("/", func(c *gin.Context) { c.JSON(200, gin.H{"msg": "LeBlanc Go API with REST & GraphQL."}) })
-	r.GET("/users", handlers.GetUsers)
-	r.GET("/drinks", handlers.GetDrinks)
-	r.POST("/reco/from-features", handlers.RecoFromFeatures)
-	r.POST("/bookings", handlers.CreateBooking)
-	r.POST("/auth/register", handlers.RegisterUser)
-	r.POST("/auth/login", handlers.LoginUser)
-	r.POST("/auth/request-verify", handlers.RequestVerify)
-	r.POST("/auth/verify", handlers.VerifyToken)
+	r.GET("/healthz", checker.Live)
+	r.GET("/readyz", checker.Ready)
+	if cfg.Metrics.Enabled {
+		r.GET("/metrics", metrics.Handler(cfg.Metrics))
+	}
+	r.GET("/openapi.json", openapi.Handler)
+	r.GET("/docs", openapi.Docs)
+	r.GET("/users", h.GetUsers)
+	r.GET("/drinks", h.GetDrinks)
+	r.GET("/drinks/:id/reviews", h.ListDrinkReviews)
+	r.POST("/drinks/:id/reviews", auth.RequireUser(), h.WriteReview)
+	r.DELETE("/reviews/:id", auth.RequireUser(), h.DeleteReview)
+	r.POST("/reco/from-features", h.RecoFromFeatures)
+	r.POST("/reco/group", h.RecoForGroup)
+	r.POST("/bookings", h.CreateBooking)
+	r.GET("/loyalty", auth.RequireUser(), h.GetLoyalty)
+	r.GET("/loyalty/history", auth.RequireUser(), h.GetLoyaltyHistory)
+	r.GET("/favorites", auth.RequireUser(), h.ListFavorites)
+	r.PUT("/favorites/:id", auth.RequireUser(), h.AddFavorite)
+	r.DELETE("/favorites/:id", auth.RequireUser(), h.RemoveFavorite)
+	r.GET("/saved-orders", auth.RequireUser(), h.ListSavedOrders)
+	r.POST("/saved-orders", auth.RequireUser(), h.CreateSavedOrder)
+	r.PUT("/saved-orders/:id", auth.RequireUser(), h.UpdateSavedOrder)
+	r.DELETE("/saved-orders/:id", auth.RequireUser(), h.DeleteSavedOrder)
+	r.POST("/reorder", auth.RequireUser(), h.Reorder)
+	r.POST("/giftcards/balance", h.GiftCardBalance)
+	r.GET("/payments/:provider/return", h.PaymentReturn)
+	r.GET("/payments/:provider/ipn", h.PaymentIPN)
+	r.POST("/bookings/:id/invoices", auth.RequireUser(), h.IssueInvoice)
+	r.GET("/invoices/:id", auth.RequireUser(), h.DownloadInvoice)
+	r.POST("/invoices/:id/email", auth.RequireUser(), h.EmailInvoice)
+	r.POST("/auth/register", h.RegisterUser)
+	r.POST("/auth/login", h.LoginUser)
+	r.POST("/auth/request-verify", h.RequestVerify)
+	r.POST("/auth/verify", h.VerifyToken)
+
+	// Admin endpoints
+	admin := r.Group("", auth.RequireRole(auth.RoleAdmin))
+	admin.PATCH("/bookings/:id/status", h.SetBookingStatus)
+	admin.GET("/experiments/:key/report", h.ExperimentReport)
+	admin.GET("/promotions", h.ListPromotions)
+	admin.POST("/promotions", h.CreatePromotion)
+	admin.PUT("/promotions/:id", h.UpdatePromotion)
+	admin.GET("/promotions/:id/vouchers", h.ListVouchers)
+	admin.POST("/promotions/:id/vouchers", h.IssueVouchers)
+	admin.GET("/giftcards", h.ListGiftCards)
+	admin.POST("/giftcards", h.IssueGiftCards)
+	admin.GET("/giftcards/:id", h.GetGiftCard)
+	admin.POST("/giftcards/:id/void", h.VoidGiftCard)
+	admin.GET("/invoices", h.ListInvoices)
+	admin.GET("/reviews", h.ReviewQueue)
+	admin.PATCH("/reviews/:id", h.ModerateReview)
+	admin.POST("/reviews/recount", h.RecountRatings)
 
 	// GraphQL endpoint
-	r.POST("/graphql", graph.Handler())
+	r.POST("/graphql", gql)
 	r.GET("/graphql", func(c *gin.Context) {
 		c.JSON(200, gin.H{"msg": "GraphQL endpoint - send POST requests with GraphQL queries"})
 	})
+}
+
+// openAPIValidator checks traffic against openapi.json (OPENAPI_VALIDATE, dev only).
+func openAPIValidator() gin.HandlerFunc {
+	doc, err := openapi.Load()
+	if err != nil {
+		slog.Error("invalid OpenAPI document", "error", err)
+		os.Exit(1)
+	}
+	v, err := openapi.Validator(doc)
+	if err != nil {
+		slog.Error("OpenAPI validator", "error", err)
+		os.Exit(1)
+	}
+	slog.Warn("validating requests and responses against openapi.json")
+	return v
+}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "4000"
+func rateLimiter(cfg config.RateLimitConfig) *ratelimit.Limiter {
+	var store ratelimit.Store = ratelimit.NewMemory()
+	if cfg.Backend == "mongo" {
+		store = ratelimit.NewMongo(db.DB)
+	}
+	return ratelimit.New(store, cfg.Policies)
+}
+
+// shutdown fails readiness, lets in-flight requests and background workers finish
+// within timeout, then closes the Mongo client and flushes pending spans.
+func shutdown(srv *http.Server, checker *health.Checker, workers *worker.Group, stopTracing func(context.Context) error, timeout time.Duration) {
+	slog.Info("shutting down", "timeout", timeout.String())
+	checker.Drain()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("http shutdown", "error", err)
+	}
+	if err := workers.Shutdown(ctx); err != nil {
+		slog.Error("workers shutdown", "error", err)
+	}
+	if err := db.Disconnect(ctx); err != nil {
+		slog.Error("mongo disconnect", "error", err)
+	}
+	if err := stopTracing(ctx); err != nil {
+		slog.Error("tracing shutdown", "error", err)
 	}
-	log.Println("Server listening on http://localhost:" + port)
-	log.Println("REST API: http://localhost:" + port)
-	log.Println("GraphQL: http://localhost:" + port + "/graphql")
-	_ = r.Run(":" + port)
+	slog.Info("shutdown complete")
 }
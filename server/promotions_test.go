@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/models"
+)
+
+// TestVoucherUsedOnce books with a voucher whose promotion loses out to a full discount,
+// then with one it applies to, and checks the code is spent only in the second case,
+// cannot be spent twice and comes back when the booking is cancelled.
+func TestVoucherUsedOnce(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	latte := models.Drink{Name: "Latte", Price: 45000, Tags: []string{"coffee"}}
+	if err := s.repos.Drinks.Save(ctx, &latte); err != nil {
+		t.Fatal(err)
+	}
+	free := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	until := free.Add(time.Hour)
+	promos := []*models.Promotion{
+		{Name: "Voucher", Active: true, Kind: models.PromoFixed, Amount: 10000, VoucherOnly: true},
+		{Name: "Opening day", Active: true, Kind: models.PromoPercent, Percent: 100, Stackable: true, Priority: 10, StartsAt: &free, EndsAt: &until},
+	}
+	for _, p := range promos {
+		if err := s.repos.Promotions.Save(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.repos.Promotions.InsertVouchers(ctx, []models.Voucher{{Code: "WELCOME10", PromotionID: promos[0].ID, CreatedAt: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	book := func(at time.Time) (int, string) {
+		t.Helper()
+		var out struct {
+			ID       string
+			Discount int
+		}
+		body := map[string]any{"email": "guest@example.com", "name": "Guest", "phone": "0901234567",
+			"time": at.Format(time.RFC3339), "channel": "web", "voucher": "welcome10",
+			"items": []map[string]any{{"drinkId": latte.ID.Hex(), "qty": 1}}}
+		code := s.do("", http.MethodPost, "/bookings", body, &out)
+		return code, out.ID
+	}
+	usedBy := func() string {
+		t.Helper()
+		v, err := s.repos.Promotions.Voucher(ctx, "WELCOME10")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.UsedAt == nil || v.BookingID == nil {
+			return ""
+		}
+		return v.BookingID.Hex()
+	}
+
+	if code, _ := book(free); code != http.StatusOK {
+		t.Fatalf("booking on the free day = %d", code)
+	}
+	if id := usedBy(); id != "" {
+		t.Fatalf("voucher was spent by %s though the free-day promotion left nothing to discount", id)
+	}
+
+	later := free.Add(24 * time.Hour)
+	code, first := book(later)
+	if code != http.StatusOK || usedBy() != first {
+		t.Fatalf("booking with the voucher = %d, used by %q; want it used by %s", code, usedBy(), first)
+	}
+	if code, _ := book(later); code != http.StatusConflict {
+		t.Errorf("booking with the voucher again = %d, want 409", code)
+	}
+
+	_, admin := s.login("boss", "admin")
+	if code := s.do(admin, http.MethodPatch, "/bookings/"+first+"/status", map[string]any{"status": "cancelled"}, nil); code != http.StatusOK {
+		t.Fatalf("cancelling %s = %d", first, code)
+	}
+	if id := usedBy(); id != "" {
+		t.Fatalf("voucher still used by %s after the booking was cancelled", id)
+	}
+	code, second := book(later)
+	if code != http.StatusOK || usedBy() != second {
+		t.Fatalf("booking with the released voucher = %d, used by %q; want %s", code, usedBy(), second)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/auth"
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/ratelimit"
+	"leblanc/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRateLimitFollowsUser registers auth before the limiter, as main does, and checks
+// a logged-in user is limited across IPs while anonymous callers are limited per IP.
+func TestRateLimitFollowsUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := services.NewTokens(config.TokenConfig{Secret: "test-secret", SessionTTL: time.Hour})
+	policies := map[string]config.RatePolicy{"GET /ping": {Limit: 2, Period: time.Minute}}
+	r := gin.New()
+	r.Use(auth.Middleware(tokens), ratelimit.New(ratelimit.NewMemory(), policies).Middleware())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	token, _ := tokens.GenerateSessionToken(services.Session{UserID: "6ad5a7bd23f3e0c38960640d"})
+	ping := func(ip, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = ip + ":1234"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		if code := ping(ip, token); code != http.StatusOK {
+			t.Fatalf("request %d from %s = %d, want 200", i+1, ip, code)
+		}
+	}
+	if code := ping("10.0.0.3", token); code != http.StatusTooManyRequests {
+		t.Errorf("third request as the user from a new IP = %d, want 429", code)
+	}
+	if code := ping("10.0.0.1", ""); code != http.StatusOK {
+		t.Errorf("anonymous request from an IP the user came from = %d, want 200", code)
+	}
+}
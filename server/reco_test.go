@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/models"
+	"leblanc/server/internal/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestRecoOnMemoryRepositories serves recommendations, experiment exposures and the
+// experiment report without Mongo. Logged-in users are bucketed by account, not email.
+func TestRecoOnMemoryRepositories(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	for _, d := range []models.Drink{
+		{Name: "Latte", Price: 45000, Tags: []string{"coffee"}, Caffeine: "med", Temp: "hot", Sweetness: 2, ColorTone: "warm", EmotionFit: models.EmotionFit{Calm: 0.8}},
+		{Name: "Yuzu soda", Price: 40000, Tags: []string{"fruit"}, Caffeine: "none", Temp: "iced", Sweetness: 3, ColorTone: "cool", EmotionFit: models.EmotionFit{Happy: 0.9}},
+	} {
+		if err := s.repos.Drinks.Save(ctx, &d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.repos.Experiments.Insert(ctx, &models.Experiment{Key: "scorer-test", Active: true, CreatedAt: time.Now(), Arms: []models.ExperimentArm{
+		{Name: "label", Weight: 1, Scorer: models.ScorerConfig{Name: "label", Scorer: services.ScorerEmotion}},
+		{Name: "cosine", Weight: 1, Scorer: models.ScorerConfig{Name: "cosine", Scorer: services.ScorerCosine}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reco struct {
+		Items      []struct{ Name string }
+		Experiment *models.Exposure
+	}
+	body := map[string]any{"emotion": "calm", "sessionId": "session-1"}
+	if code := s.do("", http.MethodPost, "/reco/from-features", body, &reco); code != http.StatusOK {
+		t.Fatalf("POST /reco/from-features = %d", code)
+	}
+	if len(reco.Items) != 2 || reco.Experiment == nil || reco.Experiment.Key != "scorer-test" {
+		t.Fatalf("recommendation = %+v, want both drinks and an exposure to scorer-test", reco)
+	}
+	events, err := s.repos.RecoEvents.ByExperiment(ctx, "scorer-test")
+	if err != nil || len(events) != 1 || events[0].Exposure.Arm != reco.Experiment.Arm {
+		t.Fatalf("logged events = %+v, %v; want one exposure to arm %q", events, err, reco.Experiment.Arm)
+	}
+
+	// a logged-in user keeps their arm whatever email they send
+	user, token := s.login("regular", "")
+	arm := ""
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"} {
+		reco.Experiment = nil
+		body := map[string]any{"emotion": "calm", "email": email, "sessionId": email}
+		if code := s.do(token, http.MethodPost, "/reco/from-features", body, &reco); code != http.StatusOK || reco.Experiment == nil {
+			t.Fatalf("POST /reco/from-features as %s = %d, %+v", user.Name, code, reco)
+		}
+		if arm != "" && reco.Experiment.Arm != arm {
+			t.Fatalf("email %s moved the user from arm %s to %s", email, arm, reco.Experiment.Arm)
+		}
+		arm = reco.Experiment.Arm
+	}
+	booking := map[string]any{"email": "x@example.com", "name": "Regular", "phone": "0901234567",
+		"time": time.Now().Add(24 * time.Hour).Format(time.RFC3339), "channel": "web",
+		"items": []map[string]any{{"drinkId": drinkID(t, s, "Latte"), "qty": 1}}}
+	if code := s.do(token, http.MethodPost, "/bookings", booking, nil); code != http.StatusOK {
+		t.Fatalf("POST /bookings = %d", code)
+	}
+
+	path := "/experiments/scorer-test/report"
+	if code := s.do("", http.MethodGet, path, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("GET report anonymously = %d, want 401", code)
+	}
+	if code := s.do(token, http.MethodGet, path, nil, nil); code != http.StatusForbidden {
+		t.Errorf("GET report as a user = %d, want 403", code)
+	}
+	_, admin := s.login("boss", "admin")
+	var report services.ExperimentReport
+	if code := s.do(admin, http.MethodGet, path, nil, &report); code != http.StatusOK {
+		t.Fatalf("GET report as admin = %d", code)
+	}
+	exposed, converted := 0, 0
+	for _, a := range report.Arms {
+		exposed += a.Exposed
+		converted += a.Converted
+	}
+	if exposed != 2 || converted != 1 {
+		t.Errorf("report counts %d exposed and %d converted units, want 2 and 1", exposed, converted)
+	}
+}
+
+// TestRecoExcludeOwnBookingOnly checks that excludeBookingId only reads the caller's
+// own bookings; anyone else's, or any booking when anonymous, is not found.
+func TestRecoExcludeOwnBookingOnly(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	for _, d := range []models.Drink{
+		{Name: "Latte", Price: 45000, Caffeine: "med", Temp: "hot", Sweetness: 2, EmotionFit: models.EmotionFit{Calm: 0.8}},
+		{Name: "Yuzu soda", Price: 40000, Caffeine: "none", Temp: "iced", Sweetness: 3, EmotionFit: models.EmotionFit{Happy: 0.9}},
+	} {
+		if err := s.repos.Drinks.Save(ctx, &d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owner, ownerToken := s.login("owner", "")
+	_, otherToken := s.login("other", "")
+	latte, err := primitive.ObjectIDFromHex(drinkID(t, s, "Latte"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &models.Booking{Email: "owner@example.com", Name: "Owner", Phone: "0901234567", Time: time.Now(), Channel: "web",
+		UserID: &owner.ID, Status: models.BookingCompleted, Subtotal: 45000, Total: 45000,
+		Items: []models.BookingItem{{DrinkID: latte, Qty: 1, Name: "Latte", Price: 45000}}}
+	if err := s.repos.Bookings.Insert(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+
+	body := map[string]any{"emotion": "calm", "excludeBookingId": b.ID.Hex()}
+	var reco struct{ Items []struct{ Name string } }
+	if code := s.do(ownerToken, http.MethodPost, "/reco/from-features", body, &reco); code != http.StatusOK {
+		t.Fatalf("POST /reco/from-features as the owner = %d", code)
+	}
+	if len(reco.Items) != 1 || reco.Items[0].Name != "Yuzu soda" {
+		t.Errorf("owner's recommendation = %+v, want the Latte excluded", reco.Items)
+	}
+	for who, token := range map[string]string{"another user": otherToken, "anonymous": ""} {
+		if code := s.do(token, http.MethodPost, "/reco/from-features", body, nil); code != http.StatusNotFound {
+			t.Errorf("POST /reco/from-features as %s = %d, want 404", who, code)
+		}
+	}
+}
+
+func drinkID(t *testing.T, s *testServer, name string) string {
+	t.Helper()
+	drinks, err := s.repos.Drinks.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range drinks {
+		if d.Name == name {
+			return d.ID.Hex()
+		}
+	}
+	t.Fatalf("no drink named %s", name)
+	return ""
+}
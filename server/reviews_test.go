@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"leblanc/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestReviewRatings follows a drink's rating as reviews are published, approved,
+// rejected and deleted, then breaks the totals and checks the recount repairs them.
+func TestReviewRatings(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	latte := models.Drink{Name: "Latte", Price: 45000}
+	if err := s.repos.Drinks.Save(ctx, &latte); err != nil {
+		t.Fatal(err)
+	}
+	had := func(email string, userID *primitive.ObjectID) {
+		t.Helper()
+		b := &models.Booking{Email: email, Name: "Guest", Phone: "0901234567", Time: time.Now().Add(-time.Hour),
+			Channel: "web", UserID: userID, Status: models.BookingCompleted,
+			Items: []models.BookingItem{{DrinkID: latte.ID, Qty: 1, Name: latte.Name, Price: latte.Price}}}
+		if err := s.repos.Bookings.Insert(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rating := func(want float64, count int) {
+		t.Helper()
+		d, err := s.repos.Drinks.Get(ctx, latte.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Rating != want || d.RatingCount != count {
+			t.Fatalf("rating = %v over %d reviews, want %v over %d", d.Rating, d.RatingCount, want, count)
+		}
+	}
+	path := "/drinks/" + latte.ID.Hex() + "/reviews"
+	_, admin := s.login("boss", "admin")
+
+	alice, aliceToken := s.login("alice", "")
+	had(alice.Email, &alice.ID)
+	if code := s.do(aliceToken, http.MethodPost, path, map[string]any{"rating": 4}, nil); code != http.StatusOK {
+		t.Fatalf("POST %s = %d", path, code)
+	}
+	rating(4, 1)
+
+	bob, bobToken := s.login("bob", "")
+	had(bob.Email, &bob.ID)
+	var rv models.Review
+	if code := s.do(bobToken, http.MethodPost, path, map[string]any{"rating": 2, "comment": "Too milky"}, &rv); code != http.StatusOK || rv.Status != models.ReviewPending {
+		t.Fatalf("POST %s with a comment = %d, %+v", path, code, rv)
+	}
+	rating(4, 1)
+
+	moderate := "/reviews/" + rv.ID.Hex()
+	for _, step := range []struct {
+		status string
+		rating float64
+		count  int
+	}{{models.ReviewApproved, 3, 2}, {models.ReviewRejected, 4, 1}, {models.ReviewApproved, 3, 2}} {
+		if code := s.do(admin, http.MethodPatch, moderate, map[string]any{"status": step.status}, nil); code != http.StatusOK {
+			t.Fatalf("PATCH %s to %s = %d", moderate, step.status, code)
+		}
+		rating(step.rating, step.count)
+	}
+	if code := s.do(bobToken, http.MethodDelete, moderate, nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE %s = %d", moderate, code)
+	}
+	rating(4, 1)
+
+	// a verified account with the email of an anonymous booking did not order the drink
+	carol, carolToken := s.login("carol", "")
+	had(carol.Email, nil)
+	if code := s.do(carolToken, http.MethodPost, path, map[string]any{"rating": 1}, nil); code != http.StatusConflict {
+		t.Errorf("POST %s for an anonymous booking with the user's email = %d, want 409", path, code)
+	}
+	rating(4, 1)
+
+	// a rating update lost after its review was stored
+	if err := s.repos.Drinks.AddRating(ctx, latte.ID, 5, 1); err != nil {
+		t.Fatal(err)
+	}
+	var out struct{ Corrected int }
+	if code := s.do(admin, http.MethodPost, "/reviews/recount", nil, &out); code != http.StatusOK || out.Corrected != 1 {
+		t.Fatalf("POST /reviews/recount = %d, corrected %d; want 1", code, out.Corrected)
+	}
+	rating(4, 1)
+	if code := s.do(admin, http.MethodPost, "/reviews/recount", nil, &out); code != http.StatusOK || out.Corrected != 0 {
+		t.Errorf("POST /reviews/recount again = %d, corrected %d; want 0", code, out.Corrected)
+	}
+	if code := s.do(aliceToken, http.MethodPost, "/reviews/recount", nil, nil); code != http.StatusForbidden {
+		t.Errorf("POST /reviews/recount as a user = %d, want 403", code)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"leblanc/server/internal/config"
+	"leblanc/server/internal/graph"
+	"leblanc/server/internal/handlers"
+	"leblanc/server/internal/health"
+	"leblanc/server/internal/openapi"
+	"leblanc/server/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ginParam = regexp.MustCompile(`[:*](\w+)`)
+
+// TestRoutesDocumented fails when a registered route is missing from openapi.json, or
+// the document describes an operation that is no longer registered.
+func TestRoutesDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Env: config.EnvDev, Metrics: config.MetricsConfig{Enabled: true}}
+	repos := repository.NewMemory()
+	r := gin.New()
+	registerRoutes(r, cfg, handlers.New(cfg, repos), graph.Handler(cfg, repos), health.New())
+
+	registered := map[string]bool{}
+	for _, rt := range r.Routes() {
+		path := ginParam.ReplaceAllString(rt.Path, "{$1}")
+		registered[rt.Method+" "+path] = true
+		item := doc.Paths.Find(path)
+		if item == nil || item.GetOperation(rt.Method) == nil {
+			t.Errorf("%s %s is not described in internal/openapi/openapi.json", rt.Method, rt.Path)
+		}
+	}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			if method != http.MethodOptions && !registered[method+" "+path] {
+				t.Errorf("openapi.json describes %s %s, which is not registered", method, path)
+			}
+		}
+	}
+}
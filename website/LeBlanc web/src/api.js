@@ -8,12 +8,27 @@ import {
   registerUserGraphQL,
   loginUserGraphQL,
   recoFromFeaturesGraphQL,
+  recoForGroupGraphQL,
+  getLoyaltyGraphQL,
 } from './graphql'
+import { getSessionToken, clearSessionToken } from './session'
 
 const api = axios.create({
   baseURL: import.meta.env.VITE_API_BASE  ,
 })
 
+api.interceptors.request.use((config) => {
+  const token = getSessionToken()
+  if (token) config.headers.Authorization = `Bearer ${token}`
+  return config
+})
+
+// An expired session is dropped so the next request goes through anonymously.
+api.interceptors.response.use(undefined, (err) => {
+  if (err?.response?.data?.code === 'INVALID_TOKEN' && getSessionToken()) clearSessionToken()
+  return Promise.reject(err)
+})
+
 // Configuration: Set to true to use GraphQL, false to use REST API
 const USE_GRAPHQL = import.meta.env.VITE_USE_GRAPHQL === 'true' || false
 
@@ -24,6 +39,9 @@ const getDrinksREST = () => api.get('/drinks').then((res) => res.data)
 const recoFromFeaturesREST = (payload) =>
   api.post('/reco/from-features', payload).then((res) => res.data)
 
+const recoForGroupREST = (payload) =>
+  api.post('/reco/group', payload).then((res) => res.data)
+
 const createBookingREST = (booking) =>
   api.post('/bookings', booking).then((res) => res.data)
 
@@ -39,6 +57,14 @@ const requestVerifyREST = (payload) =>
 const verifyTokenREST = (payload) =>
   api.post('/auth/verify', payload).then((res) => res.data)
 
+const getLoyaltyREST = () => api.get('/loyalty').then((res) => res.data)
+
+const getLoyaltyHistoryREST = (limit) =>
+  api.get('/loyalty/history', { params: { limit } }).then((res) => res.data.entries)
+
+const getGiftCardBalanceREST = (code) =>
+  api.post('/giftcards/balance', { code }).then((res) => res.data)
+
 // Unified API - switches between REST and GraphQL based on configuration
 export const getUsers = () => {
   return USE_GRAPHQL ? getUsersGraphQL() : getUsersREST()
@@ -59,24 +85,33 @@ export const getBookings = () => {
 export const recoFromFeatures = (payload) => {
   if (USE_GRAPHQL) {
     // Convert REST payload to GraphQL format
-    // Assuming payload has emotion fit and optional preferences
-    const emotionFit = payload.emotionFit || {
+    // Assuming payload has emotion fit and/or free-text mood and optional preferences
+    const emotionFit = payload.emotionFit || (payload.mood ? null : {
       calm: payload.calm || 0,
       happy: payload.happy || 0,
       stressed: payload.stressed || 0,
       sad: payload.sad || 0,
       adventurous: payload.adventurous || 0,
-    }
+    })
     return recoFromFeaturesGraphQL(
       emotionFit,
       payload.caffeine,
       payload.temp,
-      payload.sweetness
+      payload.sweetness,
+      payload.constraints,
+      payload.mood
     )
   }
   return recoFromFeaturesREST(payload)
 }
 
+// Recommend one set of drinks for a table. `guests` is a list of
+// { name, emotionFit, caffeine, temp, sweetness }; the result's `items`
+// can be passed straight to createBooking to prefill the order.
+export const recoForGroup = (payload) => {
+  return USE_GRAPHQL ? recoForGroupGraphQL(payload) : recoForGroupREST(payload)
+}
+
 export const createBooking = (booking) => {
   const normalizedTime = booking.time
     ? (() => {
@@ -100,6 +135,9 @@ export const createBooking = (booking) => {
       })),
       channel: booking.channel || 'web',
     }
+    if (booking.voucher) input.voucher = booking.voucher
+    if (booking.redeem) input.redeem = booking.redeem
+    if (booking.giftCard) input.giftCard = booking.giftCard
     return createBookingGraphQL(input)
   }
   return createBookingREST({ ...booking, time: normalizedTime })
@@ -136,6 +174,44 @@ export const verifyToken = (payload) => {
   return verifyTokenREST(payload)
 }
 
+// Loyalty of the logged-in user: { points, pointValueVnd, minRedeem, cards }.
+export const getLoyalty = () => {
+  return USE_GRAPHQL ? getLoyaltyGraphQL(0) : getLoyaltyREST()
+}
+
+export const getLoyaltyHistory = (limit = 20) => {
+  return USE_GRAPHQL
+    ? getLoyaltyGraphQL(limit).then((loyalty) => loyalty.history)
+    : getLoyaltyHistoryREST(limit)
+}
+
+// Gift card balance by code: { code, balance, status, expiresAt }. REST only.
+export const getGiftCardBalance = (code) => {
+  return getGiftCardBalanceREST(code)
+}
+
+// Reads a failed REST ({ error, code, fields, requestId }) or GraphQL
+// (errors[0].extensions) call. Switch on `code`; messages may change.
+export const apiError = (err) => {
+  const gqlError = err?.response?.errors?.[0]
+  if (gqlError) {
+    const ext = gqlError.extensions || {}
+    return {
+      code: ext.code || '',
+      message: gqlError.message || '',
+      fields: ext.fields || [],
+      requestId: ext.requestId || '',
+    }
+  }
+  const data = err?.response?.data || {}
+  return {
+    code: data.code || '',
+    message: data.error || '',
+    fields: data.fields || [],
+    requestId: data.requestId || '',
+  }
+}
+
 // Export GraphQL functions directly for specific use cases
 export {
   getDrinksGraphQL,
@@ -145,6 +221,8 @@ export {
   registerUserGraphQL,
   loginUserGraphQL,
   recoFromFeaturesGraphQL,
+  recoForGroupGraphQL,
+  getLoyaltyGraphQL,
   getUsersGraphQL,
 }
 
@@ -152,12 +230,15 @@ export {
 export {
   getDrinksREST,
   recoFromFeaturesREST,
+  recoForGroupREST,
   createBookingREST,
   registerUserREST,
   loginUserREST,
   getUsersREST,
   requestVerifyREST,
   verifyTokenREST,
+  getLoyaltyREST,
+  getLoyaltyHistoryREST,
 }
 
 export default api
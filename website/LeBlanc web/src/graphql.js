@@ -1,9 +1,13 @@
 import { GraphQLClient, gql } from 'graphql-request'
+import { getSessionToken } from './session'
 
 const graphqlEndpoint = (import.meta.env.VITE_API_BASE || 'http://localhost:4000') + '/graphql'
 
 const client = new GraphQLClient(graphqlEndpoint, {
-  headers: {},
+  headers: () => {
+    const token = getSessionToken()
+    return token ? { Authorization: `Bearer ${token}` } : {}
+  },
 })
 
 // Queries
@@ -101,6 +105,58 @@ export const CREATE_BOOKING_MUTATION = gql`
         options
       }
       channel
+      subtotal
+      discount
+      total
+      promotions {
+        promotionId
+        name
+        voucher
+        amount
+      }
+      redemption {
+        points
+        reward
+        value
+      }
+      giftCardPayment {
+        code
+        amount
+      }
+      amountDue
+      deposit {
+        amount
+        status
+        dueAt
+        checkoutUrl
+      }
+    }
+  }
+`
+
+export const GET_LOYALTY_QUERY = gql`
+  query GetLoyalty($historyLimit: Int) {
+    loyalty(historyLimit: $historyLimit) {
+      enabled
+      points
+      pointValueVnd
+      minRedeem
+      cards {
+        tag
+        stamps
+        needed
+        rewards
+      }
+      history {
+        _id
+        kind
+        points
+        stamps
+        rewards
+        bookingId
+        note
+        createdAt
+      }
     }
   }
 `
@@ -123,6 +179,8 @@ export const LOGIN_MUTATION = gql`
   mutation Login($input: LoginInput!) {
     login(input: $input) {
       ok
+      token
+      expiresAt
       user {
         _id
         name
@@ -135,19 +193,61 @@ export const LOGIN_MUTATION = gql`
 
 export const RECOMMEND_FROM_FEATURES_MUTATION = gql`
   mutation RecommendFromFeatures(
-    $emotionFit: EmotionFitInput!
+    $emotionFit: EmotionFitInput
+    $mood: String
     $caffeine: String
     $temp: String
     $sweetness: Int
+    $constraints: RecoConstraintsInput
   ) {
     recommendFromFeatures(
       emotionFit: $emotionFit
+      mood: $mood
       caffeine: $caffeine
       temp: $temp
       sweetness: $sweetness
+      constraints: $constraints
     ) {
-      drinkId
-      score
+      items {
+        drinkId
+        score
+      }
+      requested
+      notice
+      excluded {
+        constraint
+        count
+      }
+      mood {
+        emotion
+        tempPref
+        sweetness
+        matched
+      }
+    }
+  }
+`
+
+export const RECOMMEND_FOR_GROUP_MUTATION = gql`
+  mutation RecommendForGroup($input: GroupRecoInput!) {
+    recommendForGroup(input: $input) {
+      strategy
+      drinks {
+        drinkId
+        score
+        guestScores
+      }
+      assignments {
+        guest
+        drinkId
+        score
+      }
+      items {
+        drinkId
+        qty
+      }
+      requested
+      notice
     }
   }
 `
@@ -188,14 +288,27 @@ export const loginUserGraphQL = async (input) => {
   return data.login
 }
 
-export const recoFromFeaturesGraphQL = async (emotionFit, caffeine, temp, sweetness) => {
-  const variables = { emotionFit }
+export const getLoyaltyGraphQL = async (historyLimit) => {
+  const data = await client.request(GET_LOYALTY_QUERY, { historyLimit })
+  return data.loyalty
+}
+
+export const recoFromFeaturesGraphQL = async (emotionFit, caffeine, temp, sweetness, constraints, mood) => {
+  const variables = {}
+  if (emotionFit) variables.emotionFit = emotionFit
+  if (mood) variables.mood = mood
   if (caffeine) variables.caffeine = caffeine
   if (temp) variables.temp = temp
   if (sweetness) variables.sweetness = sweetness
+  if (constraints) variables.constraints = constraints
   
   const data = await client.request(RECOMMEND_FROM_FEATURES_MUTATION, variables)
   return data.recommendFromFeatures
 }
 
+export const recoForGroupGraphQL = async (input) => {
+  const data = await client.request(RECOMMEND_FOR_GROUP_MUTATION, { input })
+  return data.recommendForGroup
+}
+
 export default client
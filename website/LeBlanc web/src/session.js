@@ -0,0 +1,21 @@
+// Session token from login; api.js and graphql.js send it as `Authorization: Bearer`.
+const TOKEN_KEY = 'leblancToken'
+
+export const getSessionToken = () => {
+  try {
+    return localStorage.getItem(TOKEN_KEY) || ''
+  } catch {
+    return ''
+  }
+}
+
+export const setSessionToken = (token) => {
+  try {
+    if (token) localStorage.setItem(TOKEN_KEY, token)
+    else localStorage.removeItem(TOKEN_KEY)
+  } catch (err) {
+    console.warn('Could not persist session', err)
+  }
+}
+
+export const clearSessionToken = () => setSessionToken('')